@@ -0,0 +1,197 @@
+// Package fold finds and keeps track of the folds of the textarea and the
+// viewport: ranges of lines that collapse to their first one.
+package fold
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Fold is a range of lines, from Start up to End, inclusive. When Closed,
+// only its first line is shown.
+type Fold struct {
+	Start, End int
+	Closed     bool
+}
+
+// Sort sorts folds by their first line, and the folds starting on the same
+// line from the largest to the smallest, so that folds come before the folds
+// inside them. Folds of less than two lines are removed.
+func Sort(folds []Fold) []Fold {
+	folds = slices.DeleteFunc(folds, func(f Fold) bool { return f.End <= f.Start || f.Start < 0 })
+	slices.SortStableFunc(folds, func(a, b Fold) int {
+		if a.Start != b.Start {
+			return a.Start - b.Start
+		}
+		return b.End - a.End
+	})
+	return slices.CompactFunc(folds, func(a, b Fold) bool { return a.Start == b.Start && a.End == b.End })
+}
+
+// Closed returns the closed folds of sorted folds that aren't inside other
+// closed folds. They don't overlap, and they're in order.
+func Closed(folds []Fold) []Fold {
+	var closed []Fold
+	for _, f := range folds {
+		if !f.Closed || len(closed) > 0 && f.Start <= closed[len(closed)-1].End {
+			continue
+		}
+		closed = append(closed, f)
+	}
+	return closed
+}
+
+// Hiding returns the index in sorted folds of the closed fold hiding a line,
+// which is inside it, past its first line, or -1 if the line is shown.
+func Hiding(folds []Fold, line int) int {
+	for i, f := range folds {
+		if f.Start >= line {
+			break
+		}
+		if f.Closed && line <= f.End {
+			return i
+		}
+	}
+	return -1
+}
+
+// Toggle opens the closed fold a line is in, or if there's none, closes the
+// innermost open fold it's in. It returns the index of the fold it toggled,
+// or -1 if the line isn't in a fold.
+func Toggle(folds []Fold, line int) int {
+	if i := Open(folds, line); i >= 0 {
+		return i
+	}
+	return Close(folds, line)
+}
+
+// Open opens the outermost closed fold a line is in, returning its index,
+// or -1 if there's none.
+func Open(folds []Fold, line int) int {
+	for i, f := range folds {
+		if f.Start > line {
+			break
+		}
+		if f.Closed && line <= f.End {
+			folds[i].Closed = false
+			return i
+		}
+	}
+	return -1
+}
+
+// Close closes the innermost open fold a line is in, returning its index,
+// or -1 if there's none.
+func Close(folds []Fold, line int) int {
+	inner := -1
+	for i, f := range folds {
+		if f.Start > line {
+			break
+		}
+		if !f.Closed && line <= f.End {
+			inner = i
+		}
+	}
+	if inner >= 0 {
+		folds[inner].Closed = true
+	}
+	return inner
+}
+
+// SetAll opens or closes all folds.
+func SetAll(folds []Fold, closed bool) {
+	for i := range folds {
+		folds[i].Closed = closed
+	}
+}
+
+// ByIndent returns the folds of n lines made of each line followed by the
+// lines indented more than it, with tabs extending to the next multiple of
+// tabWidth. Blank lines are part of the folds around them. The folds are
+// open and sorted.
+func ByIndent(n int, line func(int) string, tabWidth int) []Fold {
+	indents := make([]int, n)
+	for i := range n {
+		indents[i] = indent(line(i), tabWidth)
+	}
+	var folds []Fold
+	for i, in := range indents {
+		if in < 0 {
+			continue
+		}
+		end := i
+		for j := i + 1; j < n && (indents[j] < 0 || indents[j] > in); j++ {
+			if indents[j] >= 0 {
+				end = j
+			}
+		}
+		if end > i {
+			folds = append(folds, Fold{Start: i, End: end})
+		}
+	}
+	return folds
+}
+
+// indent returns the width of the indentation of a line, or -1 if it's blank.
+func indent(line string, tabWidth int) int {
+	w := 0
+	for _, r := range line {
+		switch r {
+		case ' ':
+			w++
+		case '\t':
+			w += tabWidth - w%tabWidth
+		default:
+			return w
+		}
+	}
+	return -1
+}
+
+// ByMarker returns the folds of n lines from the lines containing the open
+// marker to the lines containing the close marker matching them, such as
+// "{{{" and "}}}". The folds are open and sorted.
+func ByMarker(n int, line func(int) string, open, close string) []Fold {
+	var (
+		folds []Fold
+		stack []int
+	)
+	for i := range n {
+		l := line(i)
+		// A line can close a fold and open another, in that order.
+		if c := strings.Index(l, close); c >= 0 && len(stack) > 0 {
+			if o := strings.Index(l, open); o < 0 || c < o {
+				folds = append(folds, Fold{Start: stack[len(stack)-1], End: i})
+				stack = stack[:len(stack)-1]
+				l = l[c+len(close):]
+			}
+		}
+		if strings.Contains(l, open) {
+			stack = append(stack, i)
+		}
+	}
+	return Sort(folds)
+}
+
+// Move returns the line that a line moves to when the lines from start up to
+// end, inclusive, are replaced with the lines from start up to newEnd.
+// Lines inside the replaced ones stay, unless they're past newEnd.
+func Move(line, start, end, newEnd int) int {
+	switch {
+	case line <= start:
+		return line
+	case line > end:
+		return line + newEnd - end
+	}
+	return min(line, newEnd)
+}
+
+// Summary returns the text shown after the first line of a closed fold.
+func Summary(f Fold) string {
+	n := f.End - f.Start
+	if n == 1 {
+		return "⋯ 1 line"
+	}
+	return fmt.Sprintf("⋯ %d lines", n)
+}
@@ -0,0 +1,75 @@
+package fold
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestByIndent(t *testing.T) {
+	lines := strings.Split("a\n  b\n\n  c\n\td\ne\n  f", "\n")
+	got := ByIndent(len(lines), func(i int) string { return lines[i] }, 4)
+	want := []Fold{{Start: 0, End: 4}, {Start: 3, End: 4}, {Start: 5, End: 6}}
+	if !slices.Equal(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestByMarker(t *testing.T) {
+	lines := strings.Split("a {{{\nb {{{\n}}} c {{{\n}}}\n}}}\n}}}", "\n")
+	got := ByMarker(len(lines), func(i int) string { return lines[i] }, "{{{", "}}}")
+	want := []Fold{{Start: 0, End: 4}, {Start: 1, End: 2}, {Start: 2, End: 3}}
+	if !slices.Equal(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestToggle(t *testing.T) {
+	folds := []Fold{{Start: 0, End: 5}, {Start: 1, End: 3}, {Start: 2, End: 3}}
+
+	// Closing closes the innermost open fold, and opening the outermost
+	// closed one.
+	for _, want := range []int{2, 1, 0} {
+		if i := Close(folds, 3); i != want {
+			t.Fatalf("want fold %d closed, got %d", want, i)
+		}
+	}
+	if i := Close(folds, 3); i != -1 {
+		t.Errorf("want no fold closed, got %d", i)
+	}
+	if got, want := Closed(folds), folds[:1]; !slices.Equal(got, want) {
+		t.Errorf("want closed folds %v, got %v", want, got)
+	}
+	if i := Hiding(folds, 3); i != 0 {
+		t.Errorf("want line hidden by fold 0, got %d", i)
+	}
+	if i := Hiding(folds, 0); i != -1 {
+		t.Errorf("want the first line shown, got %d", i)
+	}
+	if i := Toggle(folds, 3); i != 0 {
+		t.Errorf("want fold 0 opened, got %d", i)
+	}
+	if got, want := Closed(folds), folds[1:2]; !slices.Equal(got, want) {
+		t.Errorf("want closed folds %v, got %v", want, got)
+	}
+	if i := Toggle(folds, 4); i != 0 {
+		t.Errorf("want fold 0 closed, got %d", i)
+	}
+}
+
+func TestMove(t *testing.T) {
+	for _, tc := range []struct {
+		line, start, end, newEnd, want int
+	}{
+		{line: 1, start: 2, end: 3, newEnd: 5, want: 1},
+		{line: 2, start: 2, end: 3, newEnd: 5, want: 2},
+		{line: 3, start: 2, end: 3, newEnd: 5, want: 3},
+		{line: 4, start: 2, end: 3, newEnd: 5, want: 6},
+		{line: 4, start: 2, end: 5, newEnd: 3, want: 3},
+		{line: 6, start: 2, end: 5, newEnd: 3, want: 4},
+	} {
+		if got := Move(tc.line, tc.start, tc.end, tc.newEnd); got != tc.want {
+			t.Errorf("Move(%d, %d, %d, %d): want %d, got %d", tc.line, tc.start, tc.end, tc.newEnd, tc.want, got)
+		}
+	}
+}
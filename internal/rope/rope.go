@@ -0,0 +1,530 @@
+// Package rope provides a persistent sequence of lines of text, suited to
+// editing large buffers.
+package rope
+
+import (
+	"fmt"
+	"iter"
+	"slices"
+)
+
+const (
+	// maxLeafLines is the maximum number of lines in a leaf.
+	maxLeafLines = 64
+
+	// maxChildren is the maximum number of children of an inner node.
+	maxChildren = 32
+
+	// maxMetrics is the maximum number of metrics whose sums are cached in
+	// a node. The oldest one is dropped to make room for another.
+	maxMetrics = 4
+
+	// maxScans is the maximum number of scans whose states are cached in a
+	// node. The oldest one is dropped to make room for another.
+	maxScans = 4
+)
+
+// Rope is a sequence of lines stored in a balanced tree, so that lines can be
+// looked up, replaced, inserted and deleted in logarithmic time.
+//
+// Ropes are immutable: an edit returns a new rope that shares the unchanged
+// parts of the tree with the old one. Copying a rope is cheap, and so is
+// keeping old versions of it around, such as to undo edits. For the same
+// reason, the lines of a rope must not be modified in place.
+//
+// Measuring a rope with a [Metric] caches the results in the tree, which is
+// shared between versions. A rope and the ropes derived from it must not be
+// measured from several goroutines at once.
+//
+// The zero value is an empty rope.
+type Rope struct {
+	root *node
+}
+
+// Metric measures lines, such as by the number of rows they take up once
+// soft-wrapped. The measures are cached in the rope, so that summing a metric
+// only measures the lines that changed since the last sum.
+type Metric struct {
+	// Key identifies the metric. Cached measures are only reused for a
+	// metric with an equal key, so the key must change whenever Measure
+	// would measure lines differently. It must be comparable.
+	Key any
+
+	// Measure returns the measure of a line, which must not be negative.
+	Measure func(line []rune) int
+}
+
+// Scanner carries a state from line to line, such as the state of a syntax
+// highlighter inside a block comment. The states are cached in the rope, so
+// that scanning only scans the lines that changed since the last scan.
+type Scanner struct {
+	// Key identifies the scanner. Cached states are only reused for a
+	// scanner with an equal key, so the key must change whenever Scan would
+	// return different states. It must be comparable.
+	Key any
+
+	// Scan returns the state after a line, given the state before it.
+	Scan func(line []rune, state string) string
+}
+
+// node is a node of the tree. Leaves hold lines and inner nodes hold other
+// nodes, all of which have the same depth.
+type node struct {
+	// lines is the number of lines under the node.
+	lines int
+
+	// leaf holds the lines of a leaf, and children the children of an inner
+	// node.
+	leaf     [][]rune
+	children []*node
+
+	// sums caches the sums of metrics over the lines of the node.
+	sums []sum
+
+	// scans caches the states of scanners after the lines of the node.
+	scans []scan
+}
+
+// scan is the cached state of a scanner after the lines of a node, starting
+// from state in.
+type scan struct {
+	key     any
+	in, out string
+
+	// states holds the state after each line of a leaf.
+	states []string
+}
+
+// sum is the cached sum of a metric over the lines of a node.
+type sum struct {
+	key any
+
+	// total is the sum, or -1 if it isn't known yet.
+	total int
+
+	// measures holds the measure of each line of a leaf, or -1 for the lines
+	// that haven't been measured yet.
+	measures []int
+}
+
+// New returns a rope holding the given lines.
+func New(lines ...[]rune) Rope {
+	return Rope{root: join(leaves(slices.Clone(lines), nil))}
+}
+
+// Len returns the number of lines in the rope.
+func (r Rope) Len() int {
+	if r.root == nil {
+		return 0
+	}
+	return r.root.lines
+}
+
+// Line returns the line at index i. It panics if i is out of range.
+func (r Rope) Line(i int) []rune {
+	r.check(i, i+1)
+	n := r.root
+	for n.children != nil {
+		for _, c := range n.children {
+			if i < c.lines {
+				n = c
+				break
+			}
+			i -= c.lines
+		}
+	}
+	return n.leaf[i]
+}
+
+// Lines returns an iterator over the lines of the rope and their indexes,
+// starting at index start.
+func (r Rope) Lines(start int) iter.Seq2[int, []rune] {
+	return func(yield func(int, []rune) bool) {
+		if r.root != nil {
+			r.root.walk(max(start, 0), 0, yield)
+		}
+	}
+}
+
+// Set returns a rope where the line at index i is replaced with line.
+func (r Rope) Set(i int, line []rune) Rope {
+	return r.Replace(i, i+1, line)
+}
+
+// Insert returns a rope where lines are inserted before the line at index i.
+func (r Rope) Insert(i int, lines ...[]rune) Rope {
+	return r.Replace(i, i, lines...)
+}
+
+// Delete returns a rope without the lines from index start to end, exclusive.
+func (r Rope) Delete(start, end int) Rope {
+	return r.Replace(start, end)
+}
+
+// Replace returns a rope where the lines from index start to end, exclusive,
+// are replaced with lines. It panics if the range is out of bounds.
+func (r Rope) Replace(start, end int, lines ...[]rune) Rope {
+	r.check(start, end)
+	switch {
+	case start == end && len(lines) == 0:
+		return r
+	case r.root == nil:
+		return New(lines...)
+	}
+	return Rope{root: join(r.root.replace(start, end, lines))}
+}
+
+// Sum returns the sum of a metric over the lines before index end.
+func (r Rope) Sum(m Metric, end int) int {
+	r.check(0, end)
+	total := 0
+	n := r.root
+	for n != nil && end > 0 {
+		if end == n.lines {
+			return total + n.total(m)
+		}
+		if n.children == nil {
+			for i := range end {
+				total += n.measure(m, i)
+			}
+			return total
+		}
+		for _, c := range n.children {
+			if end < c.lines {
+				n = c
+				break
+			}
+			total += c.total(m)
+			end -= c.lines
+		}
+	}
+	return total
+}
+
+// State returns the state of a scanner after the lines before index end,
+// starting from state.
+func (r Rope) State(s Scanner, end int, state string) string {
+	r.check(0, end)
+	n := r.root
+	for n != nil && end > 0 {
+		if end == n.lines {
+			return n.scan(s, state).out
+		}
+		if n.children == nil {
+			return n.scan(s, state).states[end-1]
+		}
+		for _, c := range n.children {
+			if end < c.lines {
+				n = c
+				break
+			}
+			state = c.scan(s, state).out
+			end -= c.lines
+		}
+	}
+	return state
+}
+
+// Total returns the sum of a metric over all the lines.
+func (r Rope) Total(m Metric) int {
+	if r.root == nil {
+		return 0
+	}
+	return r.root.total(m)
+}
+
+// Find returns the index of the line in which the sum of a metric reaches
+// v, counting from 0, and what is left of v at the start of that line. For
+// instance, if lines are measured in rows, it returns the line shown on row v
+// and the row within that line. If v is past the total, it returns the number
+// of lines and what is left of v past the last line.
+func (r Rope) Find(m Metric, v int) (line, rest int) {
+	n := r.root
+	for n != nil {
+		if n.children == nil {
+			for i := range n.leaf {
+				w := n.measure(m, i)
+				if v < w {
+					return line + i, v
+				}
+				v -= w
+			}
+			return line + len(n.leaf), v
+		}
+		var next *node
+		for _, c := range n.children {
+			t := c.total(m)
+			if v < t {
+				next = c
+				break
+			}
+			v -= t
+			line += c.lines
+		}
+		n = next
+	}
+	return line, v
+}
+
+// Equal reports whether two ropes hold the same lines. Parts of the ropes that
+// are shared are compared in constant time.
+func Equal(a, b Rope) bool {
+	if a.root == b.root {
+		return true
+	}
+	if a.Len() != b.Len() {
+		return false
+	}
+	la, lb := a.root.leaves(nil), b.root.leaves(nil)
+	var i, j, ci, cj int
+	for i < len(la) {
+		if ci == 0 && cj == 0 && la[i] == lb[j] {
+			i++
+			j++
+			continue
+		}
+		if !sameLine(la[i].leaf[ci], lb[j].leaf[cj]) {
+			return false
+		}
+		if ci++; ci == la[i].lines {
+			i, ci = i+1, 0
+		}
+		if cj++; cj == lb[j].lines {
+			j, cj = j+1, 0
+		}
+	}
+	return true
+}
+
+// check panics if the range from start to end is out of bounds.
+func (r Rope) check(start, end int) {
+	if start < 0 || start > end || end > r.Len() {
+		panic(fmt.Sprintf("rope: range [%d:%d] out of bounds with %d lines", start, end, r.Len()))
+	}
+}
+
+// walk yields the lines of the node from index start on. offset is the index
+// of the first line of the node. It returns false if yield did.
+func (n *node) walk(start, offset int, yield func(int, []rune) bool) bool {
+	if n.children == nil {
+		for i := max(start-offset, 0); i < len(n.leaf); i++ {
+			if !yield(offset+i, n.leaf[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, c := range n.children {
+		if offset+c.lines > start && !c.walk(start, offset, yield) {
+			return false
+		}
+		offset += c.lines
+	}
+	return true
+}
+
+// leaves appends the leaves under the node to dst, in order.
+func (n *node) leaves(dst []*node) []*node {
+	if n.children == nil {
+		return append(dst, n)
+	}
+	for _, c := range n.children {
+		dst = c.leaves(dst)
+	}
+	return dst
+}
+
+// replace replaces the lines of the node from start to end with lines. It
+// returns the nodes to replace the node with, of the same depth, which may be
+// none if no lines are left or several if there are too many for one node.
+func (n *node) replace(start, end int, lines [][]rune) []*node {
+	if n.children == nil {
+		l := make([][]rune, 0, len(n.leaf)-(end-start)+len(lines))
+		l = append(l, n.leaf[:start]...)
+		l = append(l, lines...)
+		l = append(l, n.leaf[end:]...)
+		return leaves(l, n.spliceMeasures(start, end, len(lines)))
+	}
+
+	// Find the first and last children holding replaced lines. Lines
+	// inserted at the end go into the last child.
+	first, last := len(n.children)-1, -1
+	var firstOffset, lastOffset, offset int
+	for i, c := range n.children {
+		if i < first && start < offset+c.lines {
+			first, firstOffset = i, offset
+		}
+		if last < 0 && end-1 < offset+c.lines {
+			last, lastOffset = i, offset
+		}
+		offset += c.lines
+	}
+	if first == len(n.children)-1 {
+		firstOffset = offset - n.children[first].lines
+	}
+	if start == end {
+		last, lastOffset = first, firstOffset
+	}
+
+	var nodes []*node
+	if first == last {
+		nodes = n.children[first].replace(start-firstOffset, end-firstOffset, lines)
+	} else {
+		a, b := n.children[first], n.children[last]
+		nodes = append(a.replace(start-firstOffset, a.lines, lines), b.replace(0, end-lastOffset, nil)...)
+	}
+	return parents(slices.Concat(n.children[:first], nodes, n.children[last+1:]))
+}
+
+// spliceMeasures returns the cached measures of a leaf after replacing its
+// lines from start to end with n lines, which aren't measured yet.
+func (n *node) spliceMeasures(start, end, inserted int) []sum {
+	sums := make([]sum, len(n.sums))
+	for i, s := range n.sums {
+		measures := make([]int, 0, len(s.measures)-(end-start)+inserted)
+		measures = append(measures, s.measures[:start]...)
+		for range inserted {
+			measures = append(measures, -1)
+		}
+		measures = append(measures, s.measures[end:]...)
+		sums[i] = sum{key: s.key, total: -1, measures: measures}
+	}
+	return sums
+}
+
+// total returns the sum of a metric over the lines of the node.
+func (n *node) total(m Metric) int {
+	s := n.sum(m.Key)
+	if s.total >= 0 {
+		return s.total
+	}
+	total := 0
+	if n.children == nil {
+		for i := range n.leaf {
+			total += n.measure(m, i)
+		}
+	} else {
+		for _, c := range n.children {
+			total += c.total(m)
+		}
+	}
+	s.total = total
+	return total
+}
+
+// measure returns the measure of the line at index i of a leaf.
+func (n *node) measure(m Metric, i int) int {
+	s := n.sum(m.Key)
+	if s.measures[i] < 0 {
+		s.measures[i] = m.Measure(n.leaf[i])
+	}
+	return s.measures[i]
+}
+
+// sum returns the cache of the metric with the given key, adding an empty one
+// if there is none.
+func (n *node) sum(key any) *sum {
+	for i := range n.sums {
+		if n.sums[i].key == key {
+			return &n.sums[i]
+		}
+	}
+	if len(n.sums) == maxMetrics {
+		n.sums = slices.Delete(n.sums, 0, 1)
+	}
+	s := sum{key: key, total: -1}
+	if n.children == nil {
+		s.measures = make([]int, len(n.leaf))
+		for i := range s.measures {
+			s.measures[i] = -1
+		}
+	}
+	n.sums = append(n.sums, s)
+	return &n.sums[len(n.sums)-1]
+}
+
+// scan returns the cached states of a scanner over the lines of the node,
+// starting from state, scanning them if they aren't cached yet.
+func (n *node) scan(s Scanner, state string) *scan {
+	for i := range n.scans {
+		if c := &n.scans[i]; c.key == s.Key && c.in == state {
+			return c
+		}
+	}
+	c := scan{key: s.Key, in: state}
+	if n.children == nil {
+		c.states = make([]string, len(n.leaf))
+		for i, line := range n.leaf {
+			state = s.Scan(line, state)
+			c.states[i] = state
+		}
+	} else {
+		for _, child := range n.children {
+			state = child.scan(s, state).out
+		}
+	}
+	c.out = state
+	if len(n.scans) == maxScans {
+		n.scans = slices.Delete(n.scans, 0, 1)
+	}
+	n.scans = append(n.scans, c)
+	return &n.scans[len(n.scans)-1]
+}
+
+// leaves returns the leaves holding lines, each with its share of the cached
+// measures in sums.
+func leaves(lines [][]rune, sums []sum) []*node {
+	k := (len(lines) + maxLeafLines - 1) / maxLeafLines
+	nodes := make([]*node, k)
+	for i := range k {
+		lo, hi := i*len(lines)/k, (i+1)*len(lines)/k
+		n := &node{lines: hi - lo, leaf: lines[lo:hi:hi]}
+		for _, s := range sums {
+			n.sums = append(n.sums, sum{key: s.key, total: -1, measures: s.measures[lo:hi:hi]})
+		}
+		nodes[i] = n
+	}
+	return nodes
+}
+
+// parents returns the inner nodes holding children, as few as possible.
+func parents(children []*node) []*node {
+	k := (len(children) + maxChildren - 1) / maxChildren
+	nodes := make([]*node, k)
+	for i := range k {
+		lo, hi := i*len(children)/k, (i+1)*len(children)/k
+		n := &node{children: slices.Clone(children[lo:hi])}
+		for _, c := range n.children {
+			n.lines += c.lines
+		}
+		nodes[i] = n
+	}
+	return nodes
+}
+
+// join returns the root of a tree holding nodes of the same depth, in order.
+func join(nodes []*node) *node {
+	for len(nodes) > 1 {
+		nodes = parents(nodes)
+	}
+	if len(nodes) == 0 {
+		return nil
+	}
+	n := nodes[0]
+	for len(n.children) == 1 {
+		n = n.children[0]
+	}
+	return n
+}
+
+// sameLine reports whether two lines hold the same runes, without comparing
+// them if they're the same slice.
+func sameLine(a, b []rune) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	if len(a) == 0 || &a[0] == &b[0] {
+		return true
+	}
+	return slices.Equal(a, b)
+}
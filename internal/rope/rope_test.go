@@ -0,0 +1,212 @@
+package rope
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// length measures lines by their number of runes.
+var length = Metric{Key: "length", Measure: func(l []rune) int { return len(l) }}
+
+func lines(r Rope) [][]rune {
+	var l [][]rune
+	for _, line := range r.Lines(0) {
+		l = append(l, line)
+	}
+	return l
+}
+
+func TestReplace(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	var want [][]rune
+	var r Rope
+	versions := []Rope{r}
+	contents := [][][]rune{nil}
+	for i := range 2000 {
+		start := rnd.Intn(len(want) + 1)
+		end := start + rnd.Intn(len(want)-start+1)
+		if rnd.Intn(4) > 0 {
+			// Mostly small edits, sometimes large ones.
+			end = min(end, start+2)
+		}
+		n := rnd.Intn(3)
+		if rnd.Intn(20) == 0 {
+			n = rnd.Intn(500)
+		}
+		var ins [][]rune
+		for j := range n {
+			ins = append(ins, []rune(fmt.Sprintf("%d.%d", i, j)))
+		}
+
+		want = slices.Concat(want[:start], ins, want[end:])
+		r = r.Replace(start, end, ins...)
+		if r.Len() != len(want) {
+			t.Fatalf("edit %d: want %d lines, got %d", i, len(want), r.Len())
+		}
+		if i%50 == 0 {
+			versions = append(versions, r)
+			contents = append(contents, want)
+		}
+	}
+
+	if !slices.EqualFunc(lines(r), want, slices.Equal) {
+		t.Fatal("lines differ")
+	}
+	for i := range want {
+		if string(r.Line(i)) != string(want[i]) {
+			t.Fatalf("line %d: want %q, got %q", i, string(want[i]), string(r.Line(i)))
+		}
+	}
+	// Old versions are left untouched.
+	for i, v := range versions {
+		if !slices.EqualFunc(lines(v), contents[i], slices.Equal) {
+			t.Fatalf("version %d changed", i)
+		}
+	}
+}
+
+func TestLines(t *testing.T) {
+	var l [][]rune
+	for i := range 1000 {
+		l = append(l, []rune(fmt.Sprint(i)))
+	}
+	r := New(l...)
+	for i, line := range r.Lines(990) {
+		if string(line) != fmt.Sprint(i) {
+			t.Fatalf("line %d: got %q", i, string(line))
+		}
+		if i == 995 {
+			return
+		}
+	}
+	t.Fatal("iteration didn't stop")
+}
+
+func TestSumAndFind(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2))
+	var l [][]rune
+	for range 5000 {
+		l = append(l, make([]rune, rnd.Intn(4)))
+	}
+	r := New(l...)
+
+	check := func(l [][]rune) {
+		t.Helper()
+		prefix := 0
+		for i, line := range l {
+			if got := r.Sum(length, i); got != prefix {
+				t.Fatalf("sum to %d: want %d, got %d", i, prefix, got)
+			}
+			for j := range len(line) {
+				if gotLine, gotRest := r.Find(length, prefix+j); gotLine != i || gotRest != j {
+					t.Fatalf("find %d: want (%d, %d), got (%d, %d)", prefix+j, i, j, gotLine, gotRest)
+				}
+			}
+			prefix += len(line)
+		}
+		if got := r.Total(length); got != prefix {
+			t.Fatalf("total: want %d, got %d", prefix, got)
+		}
+		if gotLine, gotRest := r.Find(length, prefix+2); gotLine != len(l) || gotRest != 2 {
+			t.Fatalf("find past the end: want (%d, 2), got (%d, %d)", len(l), gotLine, gotRest)
+		}
+	}
+	check(l)
+
+	// Edits only measure the lines that changed.
+	measured := 0
+	counting := Metric{Key: "counting", Measure: func(l []rune) int {
+		measured++
+		return len(l)
+	}}
+	r.Total(counting)
+	measured = 0
+	r = r.Set(2500, []rune("hello"))
+	r.Total(counting)
+	if measured != 1 {
+		t.Errorf("want 1 line measured after an edit, got %d", measured)
+	}
+
+	l[2500] = []rune("hello")
+	check(l)
+}
+
+func TestState(t *testing.T) {
+	var l [][]rune
+	for i := range 5000 {
+		l = append(l, []rune(fmt.Sprint(i%7)))
+	}
+	r := New(l...)
+
+	// The scanner keeps the last line starting with 0.
+	scanned := 0
+	last := Scanner{Key: "last", Scan: func(l []rune, state string) string {
+		scanned++
+		if len(l) > 0 && l[0] == '0' {
+			return string(l)
+		}
+		return state
+	}}
+	check := func(l [][]rune) {
+		t.Helper()
+		state := "start"
+		for i, line := range l {
+			if got := r.State(last, i, "start"); got != state {
+				t.Fatalf("state at %d: want %q, got %q", i, state, got)
+			}
+			state = last.Scan(line, state)
+		}
+		if got := r.State(last, len(l), "start"); got != state {
+			t.Fatalf("final state: want %q, got %q", state, got)
+		}
+	}
+	check(l)
+
+	// Edits only scan the lines of the leaf that changed.
+	r.State(last, r.Len(), "")
+	scanned = 0
+	r = r.Set(2500, []rune("0 edited"))
+	r.State(last, r.Len(), "")
+	if scanned > maxLeafLines {
+		t.Errorf("want at most %d lines scanned after an edit, got %d", maxLeafLines, scanned)
+	}
+
+	l[2500] = []rune("0 edited")
+	check(l)
+}
+
+func TestEqual(t *testing.T) {
+	var l [][]rune
+	for i := range 1000 {
+		l = append(l, []rune(fmt.Sprint(i)))
+	}
+	a := New(l...)
+	b := a.Set(500, []rune("x")).Set(500, []rune("500"))
+	if !Equal(a, b) {
+		t.Error("want equal after undoing an edit")
+	}
+	c := a.Insert(10, []rune("10")).Delete(11, 12)
+	if !Equal(a, c) {
+		t.Error("want equal with shifted leaves")
+	}
+	if Equal(a, a.Set(999, []rune("x"))) {
+		t.Error("want different lines to differ")
+	}
+	if Equal(a, a.Delete(0, 1)) {
+		t.Error("want different lengths to differ")
+	}
+}
+
+func BenchmarkSet(b *testing.B) {
+	l := make([][]rune, 200_000)
+	for i := range l {
+		l[i] = []rune(fmt.Sprintf("line %d", i))
+	}
+	r := New(l...)
+	b.ResetTimer()
+	for i := range b.N {
+		r = r.Set(i%len(l), []rune("edited"))
+	}
+}
@@ -0,0 +1,68 @@
+package runeutil
+
+import (
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+)
+
+// firstCluster returns the number of runes of the grapheme cluster at the
+// start of runes, and its width. Tabs are given a width of 1, as they take up
+// room when displayed.
+func firstCluster(runes []rune) (n, width int) {
+	if len(runes) == 0 {
+		return 0, 0
+	}
+	if runes[0] == '\t' {
+		return 1, 1
+	}
+	// Only the start of runes is converted, as clusters are short, unless
+	// the cluster reaches its end.
+	for window := 16; ; window *= 2 {
+		w := min(window, len(runes))
+		cluster, rest, width, _ := uniseg.FirstGraphemeClusterInString(string(runes[:w]), -1)
+		if rest != "" || w == len(runes) {
+			return utf8.RuneCountInString(cluster), width
+		}
+	}
+}
+
+// NextGrapheme returns the index of the rune after the character starting at
+// index i of runes. Characters are the grapheme clusters a user sees as one,
+// such as an emoji made of several joined emojis or a letter followed by
+// combining accents, along with the zero-width clusters around them, such as
+// right-to-left marks, which can't be seen on their own.
+func NextGrapheme(runes []rune, i int) int {
+	// Printable ASCII characters followed by other ones, or by nothing, are
+	// characters of their own.
+	if i < len(runes) && isPrintableASCII(runes[i]) &&
+		(i+1 == len(runes) || isPrintableASCII(runes[i+1]) || runes[i+1] == '\t') {
+		return i + 1
+	}
+	width := 0
+	for i < len(runes) {
+		n, w := firstCluster(runes[i:])
+		if width > 0 && w > 0 {
+			break
+		}
+		i += n
+		width += w
+	}
+	return i
+}
+
+// PrevGrapheme returns the index of the first rune of the character before
+// index i of runes, or of the character containing it if i is inside one.
+func PrevGrapheme(runes []rune, i int) int {
+	prev := 0
+	for j := 0; j < min(i, len(runes)); {
+		prev = j
+		j = NextGrapheme(runes, j)
+	}
+	return prev
+}
+
+// isPrintableASCII reports whether r is a printable ASCII character.
+func isPrintableASCII(r rune) bool {
+	return r >= ' ' && r <= '~'
+}
@@ -0,0 +1,108 @@
+package runeutil
+
+import (
+	"slices"
+	"unicode"
+
+	"github.com/rivo/uniseg"
+)
+
+// Reflow hard-wraps the paragraphs of lines, which are separated by blank
+// lines, so that lines are at most width columns wide, unless a single word
+// is wider. The words of a paragraph are separated by single spaces. Its first
+// line keeps its indentation, and the others get the indentation of its
+// second line, so that hanging indents are kept. Tabs in the indentation
+// extend to the next multiple of tabWidth. Blank lines are emptied.
+func Reflow(lines [][]rune, width, tabWidth int) [][]rune {
+	var out [][]rune
+	for i := 0; i < len(lines); {
+		if isBlank(lines[i]) {
+			out = append(out, []rune{})
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(lines) && !isBlank(lines[j]) {
+			j++
+		}
+		out = append(out, reflowParagraph(lines[i:j], width, tabWidth)...)
+		i = j
+	}
+	return out
+}
+
+// reflowParagraph hard-wraps the lines of a paragraph, none of which is blank.
+func reflowParagraph(lines [][]rune, width, tabWidth int) [][]rune {
+	indent := leadingSpace(lines[0])
+	if len(lines) > 1 {
+		indent = leadingSpace(lines[1])
+	}
+	var words [][]rune
+	for _, l := range lines {
+		words = append(words, fields(l)...)
+	}
+
+	var out [][]rune
+	cur := slices.Clone(leadingSpace(lines[0]))
+	x := indentWidth(cur, tabWidth)
+	for i, w := range words {
+		ww := uniseg.StringWidth(string(w))
+		if i > 0 && x+1+ww > width {
+			out = append(out, cur)
+			cur = slices.Clone(indent)
+			x = indentWidth(cur, tabWidth)
+		} else if i > 0 {
+			cur = append(cur, ' ')
+			x++
+		}
+		cur = append(cur, w...)
+		x += ww
+	}
+	return append(out, cur)
+}
+
+// isBlank reports whether a line is made of whitespace only.
+func isBlank(line []rune) bool {
+	return !slices.ContainsFunc(line, func(r rune) bool { return !unicode.IsSpace(r) })
+}
+
+// leadingSpace returns the spaces and tabs at the start of a line.
+func leadingSpace(line []rune) []rune {
+	i := 0
+	for i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+		i++
+	}
+	return line[:i]
+}
+
+// indentWidth returns the width of an indentation of spaces and tabs.
+func indentWidth(indent []rune, tabWidth int) int {
+	x := 0
+	for _, r := range indent {
+		if r == '\t' {
+			x += tabWidth - x%tabWidth
+		} else {
+			x++
+		}
+	}
+	return x
+}
+
+// fields returns the words of a line, separated by whitespace.
+func fields(line []rune) [][]rune {
+	var words [][]rune
+	start := -1
+	for i, r := range line {
+		switch {
+		case unicode.IsSpace(r) && start >= 0:
+			words = append(words, line[start:i])
+			start = -1
+		case !unicode.IsSpace(r) && start < 0:
+			start = i
+		}
+	}
+	if start >= 0 {
+		words = append(words, line[start:])
+	}
+	return words
+}
@@ -1,6 +1,8 @@
 package runeutil
 
 import (
+	"slices"
+	"strings"
 	"testing"
 	"unicode/utf8"
 )
@@ -42,3 +44,80 @@ func TestSanitize(t *testing.T) {
 		}
 	}
 }
+
+func TestGraphemes(t *testing.T) {
+	td := []struct {
+		name  string
+		input string
+		chars []string
+	}{
+		{"ascii", "ab c", []string{"a", "b", " ", "c"}},
+		{"cjk", "漢字とかな", []string{"漢", "字", "と", "か", "な"}},
+		{"emoji", "hi 👍🏽 👨‍👩‍👧 🇯🇵!", []string{"h", "i", " ", "👍🏽", " ", "👨‍👩‍👧", " ", "🇯🇵", "!"}},
+		{"combining", "cafe\u0301 n\u0303o\u0308", []string{"c", "a", "f", "e\u0301", " ", "n\u0303", "o\u0308"}},
+		{"rtl marks", "a \u200f\u05e9\u05dc\u05d5\u05dd\u200f b", []string{"a", " \u200f", "\u05e9", "\u05dc", "\u05d5", "\u05dd\u200f", " ", "b"}},
+		{"leading mark", "\u200fab", []string{"\u200fa", "b"}},
+		{"tab", "a\t\u0301b", []string{"a", "\t\u0301", "b"}},
+		{"long cluster", "a" + strings.Repeat("\u0301", 40) + "b", []string{"a" + strings.Repeat("\u0301", 40), "b"}},
+	}
+
+	for _, tc := range td {
+		t.Run(tc.name, func(t *testing.T) {
+			runes := []rune(tc.input)
+			var chars []string
+			var starts []int
+			for i := 0; i < len(runes); {
+				next := NextGrapheme(runes, i)
+				chars = append(chars, string(runes[i:next]))
+				starts = append(starts, i)
+				i = next
+			}
+			if !slices.Equal(chars, tc.chars) {
+				t.Fatalf("want characters %q, got %q", tc.chars, chars)
+			}
+			for i := len(starts) - 1; i > 0; i-- {
+				end := len(runes)
+				if i+1 < len(starts) {
+					end = starts[i+1]
+				}
+				if got := PrevGrapheme(runes, end); got != starts[i] {
+					t.Errorf("want the character before %d to start at %d, got %d", end, starts[i], got)
+				}
+			}
+		})
+	}
+}
+
+func TestReflow(t *testing.T) {
+	td := []struct {
+		name  string
+		input string
+		width int
+		want  string
+	}{
+		{"join", "one two\nthree four", 20, "one two three four"},
+		{"wrap", "one two three four five", 9, "one two\nthree\nfour five"},
+		{"paragraphs", "a b\nc\n  \nd e", 10, "a b c\n\nd e"},
+		{"long word", "a verylongword b", 5, "a\nverylongword\nb"},
+		{"indent", "  one two three", 9, "  one two\n  three"},
+		{"hanging indent", "- one two\n  three four", 9, "- one two\n  three\n  four"},
+		{"tab indent", "\tone two", 8, "\tone\n\ttwo"},
+		{"wide", "漢字 かな 字", 9, "漢字 かな\n字"},
+	}
+
+	for _, tc := range td {
+		t.Run(tc.name, func(t *testing.T) {
+			var lines [][]rune
+			for _, l := range strings.Split(tc.input, "\n") {
+				lines = append(lines, []rune(l))
+			}
+			var got []string
+			for _, l := range Reflow(lines, tc.width, 4) {
+				got = append(got, string(l))
+			}
+			if s := strings.Join(got, "\n"); s != tc.want {
+				t.Errorf("want %q, got %q", tc.want, s)
+			}
+		})
+	}
+}
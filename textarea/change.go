@@ -0,0 +1,368 @@
+package textarea
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/haochend413/bubbles/v2/internal/rope"
+)
+
+// ChangeKind is the kind of a [Change].
+type ChangeKind int
+
+const (
+	// ChangeInsert is a change inserting text.
+	ChangeInsert ChangeKind = iota
+
+	// ChangeDelete is a change deleting text.
+	ChangeDelete
+
+	// ChangeReplace is a change replacing text with other text.
+	ChangeReplace
+)
+
+// String returns the name of the kind of change.
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeInsert:
+		return "insert"
+	case ChangeDelete:
+		return "delete"
+	case ChangeReplace:
+		return "replace"
+	}
+	return "unknown"
+}
+
+// Change is an edit of the value, reported to [Model.OnChange]: the text
+// from StartRow and StartCol up to EndRow and EndCol, exclusive, was replaced
+// with NewText. Applying the changes in the order they're reported to the
+// value before them gives the value after them.
+type Change struct {
+	Kind ChangeKind
+
+	// StartRow and StartCol are the position of the start of the change.
+	StartRow, StartCol int
+
+	// EndRow and EndCol are the position of the end of the replaced text,
+	// before the change. They're the start for insertions.
+	EndRow, EndCol int
+
+	// NewEndRow and NewEndCol are the position of the end of the inserted
+	// text, after the change. They're the start for deletions.
+	NewEndRow, NewEndCol int
+
+	// OldText is the replaced text, and NewText the text replacing it. Their
+	// lines are separated by newlines.
+	OldText, NewText string
+}
+
+// edit is a change of the value: the characters from offset start up to end,
+// replaced, were replaced with text.
+type edit struct {
+	start, end     int
+	text, replaced []rune
+}
+
+// inverse returns the edit undoing e.
+func (e edit) inverse() edit {
+	return edit{start: e.start, end: e.start + len(e.text), text: e.replaced, replaced: e.text}
+}
+
+// step is an edit along with the values before and after it.
+type step struct {
+	edit
+	before, after rope.Rope
+}
+
+// editLog records the edits of the value as they're made, from one value to
+// another, so that they don't have to be found by comparing the values.
+type editLog struct {
+	// from is the value before the edits, and to the value after the last
+	// one.
+	from, to rope.Rope
+
+	// known is cleared if the value was changed other than by setLines and
+	// replace in between, so that the edits don't add up to the value.
+	known bool
+
+	steps []step
+}
+
+// reset starts recording the edits of a value.
+func (l *editLog) reset(value rope.Rope) {
+	*l = editLog{from: value, to: value, known: true}
+}
+
+// add records a step, unless it changes nothing.
+func (l *editLog) add(s step) {
+	if s.before != l.to {
+		l.known = false
+	}
+	l.to = s.after
+	if s.start < s.end || len(s.text) > 0 {
+		l.steps = append(l.steps, s)
+	}
+}
+
+// since returns the recorded steps turning old into value, and reports
+// whether they're known.
+func (l editLog) since(old, value rope.Rope) ([]step, bool) {
+	if !l.known || l.from != old || l.to != value {
+		return nil, false
+	}
+	return l.steps, true
+}
+
+// setLines replaces the lines of the value from row start up to row end,
+// exclusive, with lines. The edit is found by comparing the lines it replaced
+// with the new ones, so edits that know where they insert or delete text
+// use replace instead.
+func (m *Model) setLines(start, end int, lines ...[]rune) {
+	old := m.value
+	m.value = m.value.Replace(start, end, lines...)
+	if m.tracking {
+		e, _ := diffLines(old, m.value, start, end, start+len(lines))
+		m.record(old, e)
+	}
+}
+
+// replace replaces the text of the value from start up to end, exclusive,
+// with lines, which are joined by line breaks. The first and last of lines
+// are replaced with the lines they end up in.
+func (m *Model) replace(start, end pos, lines ...[]rune) {
+	if !m.tracking {
+		m.value = splice(m.value, start, end, lines)
+		return
+	}
+	old := m.value
+	e := edit{
+		start:    old.Sum(offsetMetric, start.row) + start.col,
+		end:      old.Sum(offsetMetric, end.row) + end.col,
+		text:     joinRunes(lines),
+		replaced: []rune(textBetween(old, start, end)),
+	}
+	m.value = splice(old, start, end, lines)
+	m.record(old, e)
+}
+
+// record records an edit of the value, made while an edit is tracked, for
+// the tracked edit and for the undo history.
+func (m *Model) record(before rope.Rope, e edit) {
+	s := step{edit: e, before: before, after: m.value}
+	m.edits.add(s)
+	m.history.log.add(s)
+}
+
+// stepsSince returns the edits turning old, the value when the tracked edit
+// began, into the value: those recorded, if the value was only changed by
+// setLines and replace, or else a single edit found by comparing the values.
+func (m *Model) stepsSince(old rope.Rope) []step {
+	if steps, ok := m.edits.since(old, m.value); ok {
+		return steps
+	}
+	if e, ok := diff(old, m.value); ok {
+		return []step{{edit: e, before: old, after: m.value}}
+	}
+	return nil
+}
+
+// splice returns r with the text from start up to end, exclusive, replaced
+// with lines. The first and last of lines are replaced with the lines they
+// end up in.
+func splice(r rope.Rope, start, end pos, lines [][]rune) rope.Rope {
+	head, tail := r.Line(start.row)[:start.col], r.Line(end.row)[end.col:]
+	if len(lines) == 0 {
+		return r.Replace(start.row, end.row+1, slices.Concat(head, tail))
+	}
+	last := len(lines) - 1
+	lines[0] = slices.Concat(head, lines[0])
+	lines[last] = slices.Concat(lines[last], tail)
+	return r.Replace(start.row, end.row+1, lines...)
+}
+
+// apply returns r with an edit applied, along with the step it makes.
+func apply(r rope.Rope, e edit) step {
+	var lines [][]rune
+	text := e.text
+	for {
+		i := slices.Index(text, '\n')
+		if i < 0 {
+			break
+		}
+		lines = append(lines, text[:i])
+		text = text[i+1:]
+	}
+	lines = append(lines, text)
+	after := splice(r, posIn(r, e.start), posIn(r, e.end), lines)
+	return step{edit: e, before: r, after: after}
+}
+
+// joinRunes returns lines separated by newlines.
+func joinRunes(lines [][]rune) []rune {
+	var runes []rune
+	for i, line := range lines {
+		if i > 0 {
+			runes = append(runes, '\n')
+		}
+		runes = append(runes, line...)
+	}
+	return runes
+}
+
+// diff returns the edit turning old into new, and reports whether they
+// differ. If they differ in several places, the edit spans all of them.
+func diff(old, new rope.Rope) (edit, bool) {
+	if rope.Equal(old, new) {
+		return edit{}, false
+	}
+
+	// Only the lines between those the values start and end with are
+	// compared character by character.
+	first := 0
+	for first < min(old.Len(), new.Len()) && sameLine(old.Line(first), new.Line(first)) {
+		first++
+	}
+	oldEnd, newEnd := old.Len(), new.Len()
+	for oldEnd > first && newEnd > first && sameLine(old.Line(oldEnd-1), new.Line(newEnd-1)) {
+		oldEnd--
+		newEnd--
+	}
+	return diffLines(old, new, first, oldEnd, newEnd)
+}
+
+// diffLines returns the edit turning old into new, which only differ in their
+// lines from first up to oldEnd and newEnd, exclusive, and reports whether
+// they differ.
+func diffLines(old, new rope.Rope, first, oldEnd, newEnd int) (edit, bool) {
+	// Lines inserted or deleted come with a line break, so a line next to
+	// them is compared too.
+	if first == oldEnd || first == newEnd {
+		if first > 0 {
+			first--
+		} else {
+			oldEnd++
+			newEnd++
+		}
+	}
+
+	a, b := joinLines(old, first, oldEnd), joinLines(new, first, newEnd)
+	prefix := 0
+	for prefix < min(len(a), len(b)) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < min(len(a), len(b))-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	if prefix == len(a) && prefix == len(b) {
+		return edit{}, false
+	}
+	base := old.Sum(offsetMetric, first)
+	return edit{
+		start:    base + prefix,
+		end:      base + len(a) - suffix,
+		text:     slices.Clone(b[prefix : len(b)-suffix]),
+		replaced: slices.Clone(a[prefix : len(a)-suffix]),
+	}, true
+}
+
+// sameLine reports whether two lines have the same characters. Lines that
+// weren't changed are shared by the ropes, which is quick to check.
+func sameLine(a, b []rune) bool {
+	if len(a) > 0 && len(b) > 0 && &a[0] == &b[0] && len(a) == len(b) {
+		return true
+	}
+	return slices.Equal(a, b)
+}
+
+// joinLines returns the lines of r from start up to end, separated by
+// newlines.
+func joinLines(r rope.Rope, start, end int) []rune {
+	var runes []rune
+	for i, line := range r.Lines(start) {
+		if i == end {
+			break
+		}
+		if i > start {
+			runes = append(runes, '\n')
+		}
+		runes = append(runes, line...)
+	}
+	return runes
+}
+
+// textBetween returns the text of r from start up to end, with its lines
+// separated by newlines.
+func textBetween(r rope.Rope, start, end pos) string {
+	if start.row == end.row {
+		return string(r.Line(start.row)[start.col:end.col])
+	}
+	var b strings.Builder
+	for row, line := range r.Lines(start.row) {
+		switch row {
+		case start.row:
+			b.WriteString(string(line[start.col:]))
+			continue
+		case end.row:
+			b.WriteByte('\n')
+			b.WriteString(string(line[:end.col]))
+			return b.String()
+		}
+		b.WriteByte('\n')
+		b.WriteString(string(line))
+	}
+	return b.String()
+}
+
+// track runs an edit of the value that isn't made by the user, or whose
+// protected text was already checked. The protected ranges move along with
+// it, as do the folds, and the edits it's made of are reported to OnChange.
+// Edits run while another is tracked are part of it.
+func (m *Model) track(f func()) {
+	if m.tracking || len(m.protected) == 0 && len(m.folds) == 0 && m.OnChange == nil {
+		f()
+		return
+	}
+	old := m.value
+	m.tracking = true
+	m.edits.reset(m.value)
+	f()
+	m.tracking = false
+	for _, s := range m.stepsSince(old) {
+		m.changed(s)
+	}
+}
+
+// changed moves the protected ranges and the folds along with a step of an
+// edit, and reports it to OnChange.
+func (m *Model) changed(s step) {
+	m.moveProtected(s.edit)
+	if len(m.folds) == 0 && m.OnChange == nil {
+		return
+	}
+	start, end := posIn(s.before, s.start), posIn(s.before, s.end)
+	newEnd := posIn(s.after, s.start+len(s.text))
+	m.moveFolds(start, end, newEnd)
+	if m.OnChange == nil {
+		return
+	}
+	c := Change{
+		Kind:      ChangeReplace,
+		StartRow:  start.row,
+		StartCol:  start.col,
+		EndRow:    end.row,
+		EndCol:    end.col,
+		NewEndRow: newEnd.row,
+		NewEndCol: newEnd.col,
+		OldText:   string(s.replaced),
+		NewText:   string(s.text),
+	}
+	switch {
+	case c.OldText == "":
+		c.Kind = ChangeInsert
+	case c.NewText == "":
+		c.Kind = ChangeDelete
+	}
+	m.OnChange(c)
+}
@@ -0,0 +1,324 @@
+package textarea
+
+import (
+	"strings"
+	"sync/atomic"
+	"unicode"
+
+	tea "charm.land/bubbletea/v2"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/haochend413/bubbles/v2/internal/rope"
+	"github.com/haochend413/bubbles/v2/key"
+	"github.com/haochend413/lipgloss/v2"
+)
+
+const defaultMaxCompletions = 6
+
+// Completion is a candidate for completing the word before the cursor.
+type Completion struct {
+	// Text replaces the word when the completion is accepted.
+	Text string
+
+	// Detail is shown next to the text in the popup, such as "table" or
+	// "column".
+	Detail string
+}
+
+// Buffer gives read-only access to the lines of a textarea.
+type Buffer interface {
+	// LineCount returns the number of lines.
+	LineCount() int
+
+	// LineRunes returns the characters of a line, which must not be
+	// modified.
+	LineRunes(row int) []rune
+}
+
+// valueBuffer is the value of a textarea at some point, as a [Buffer].
+type valueBuffer struct {
+	value rope.Rope
+}
+
+func (s valueBuffer) LineCount() int {
+	return s.value.Len()
+}
+
+func (s valueBuffer) LineRunes(row int) []rune {
+	return s.value.Line(row)
+}
+
+// CompletionRequest is a request for the completions of the word before the
+// cursor.
+type CompletionRequest struct {
+	// Buffer is the text of the textarea when completion was requested. It
+	// doesn't change with later edits, so asynchronous providers can read it.
+	Buffer Buffer
+
+	// Row and Col are the position of the cursor.
+	Row, Col int
+
+	// Word is the word before the cursor, made of letters, digits and
+	// underscores. It's empty if there's none, such as after a ".".
+	Word string
+
+	id int64
+}
+
+// Reply returns the message delivering the completions of an asynchronous
+// request. Replies to outdated requests are ignored.
+func (r CompletionRequest) Reply(completions []Completion) CompletionMsg {
+	return CompletionMsg{Completions: completions, id: r.id}
+}
+
+// CompletionMsg delivers the completions of an asynchronous
+// [CompletionProvider].
+type CompletionMsg struct {
+	Completions []Completion
+
+	id int64
+}
+
+// CompletionProvider provides the completions shown in the popup.
+type CompletionProvider interface {
+	// Complete returns the completions for a request. To complete
+	// asynchronously, such as by querying a database, it returns a command
+	// instead, whose message is the request's [CompletionRequest.Reply].
+	Complete(req CompletionRequest) ([]Completion, tea.Cmd)
+}
+
+// CompletionProviderFunc is a function that implements [CompletionProvider].
+type CompletionProviderFunc func(req CompletionRequest) ([]Completion, tea.Cmd)
+
+// Complete calls f(req).
+func (f CompletionProviderFunc) Complete(req CompletionRequest) ([]Completion, tea.Cmd) {
+	return f(req)
+}
+
+// lastCompletionID is the ID of the last completion request of all textareas,
+// so that replies reach the textarea that asked for them.
+var lastCompletionID atomic.Int64
+
+// completion is the state of the completion popup.
+type completion struct {
+	// id is the ID of the last request.
+	id int64
+
+	// open is set while the popup is shown, or awaited.
+	open bool
+
+	// row and start are the position of the word being completed.
+	row, start int
+	word       string
+
+	items    []Completion
+	selected int
+}
+
+// isWordRune reports whether r is part of the words being completed.
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Completing reports whether the completion popup is shown.
+func (m Model) Completing() bool {
+	return m.completion.open && len(m.completion.items) > 0
+}
+
+// Complete asks the CompletionProvider for the completions of the word before
+// the cursor, to show them in the popup. It returns the command of
+// asynchronous providers. Completions aren't asked for when the textarea is
+// ReadOnly.
+func (m *Model) Complete() tea.Cmd {
+	if m.CompletionProvider == nil || m.ReadOnly {
+		return nil
+	}
+	line := m.value.Line(m.row)
+	col := min(m.col, len(line))
+	start := col
+	for start > 0 && isWordRune(line[start-1]) {
+		start--
+	}
+
+	id := lastCompletionID.Add(1)
+	word := string(line[start:col])
+	prev := m.completion
+	m.completion = completion{id: id, open: true, row: m.row, start: start, word: word}
+	if prev.open && prev.row == m.row && prev.start == start {
+		// Keep showing the completions of the word being completed until
+		// those of asynchronous providers arrive.
+		m.completion.items = prev.items
+	}
+	items, cmd := m.CompletionProvider.Complete(CompletionRequest{
+		Buffer: valueBuffer{m.value},
+		Row:    m.row,
+		Col:    col,
+		Word:   word,
+		id:     id,
+	})
+	if cmd == nil {
+		m.setCompletions(items)
+	}
+	return cmd
+}
+
+// CloseCompletion closes the completion popup, and ignores the completions
+// of pending requests.
+func (m *Model) CloseCompletion() {
+	m.completion = completion{}
+}
+
+// setCompletions shows completions in the popup, or closes it if there are
+// none.
+func (m *Model) setCompletions(items []Completion) {
+	if len(items) == 0 {
+		m.CloseCompletion()
+		return
+	}
+	m.completion.items = items
+	m.completion.selected = 0
+}
+
+// completionReply handles the reply of an asynchronous provider.
+func (m *Model) completionReply(msg CompletionMsg) {
+	if !m.completion.open || msg.id != m.completion.id {
+		return
+	}
+	m.setCompletions(msg.Completions)
+}
+
+// completionKey handles the keys navigating the completion popup while it's
+// shown, and the key opening it. It reports whether the key was handled.
+func (m *Model) completionKey(msg tea.KeyPressMsg) (tea.Cmd, bool) {
+	if m.CompletionProvider != nil && key.Matches(msg, m.KeyMap.Complete) {
+		return m.Complete(), true
+	}
+	if !m.Completing() {
+		return nil, false
+	}
+	c := &m.completion
+	switch {
+	case key.Matches(msg, m.KeyMap.NextCompletion):
+		c.selected = (c.selected + 1) % len(c.items)
+	case key.Matches(msg, m.KeyMap.PrevCompletion):
+		c.selected = (c.selected - 1 + len(c.items)) % len(c.items)
+	case key.Matches(msg, m.KeyMap.AcceptCompletion):
+		m.acceptCompletion()
+	case key.Matches(msg, m.KeyMap.CancelCompletion):
+		m.CloseCompletion()
+	default:
+		return nil, false
+	}
+	return nil, true
+}
+
+// acceptCompletion replaces the word being completed with the selected
+// completion.
+func (m *Model) acceptCompletion() {
+	c := m.completion
+	m.CloseCompletion()
+	if c.row != m.row || c.start > m.col {
+		return
+	}
+	m.ReplaceRange(c.row, c.start, m.row, m.col, c.items[c.selected].Text)
+}
+
+// updateCompletion follows a key typed without the popup handling it: with
+// AutoComplete, typing a word asks for completions, and while the popup is
+// open, they're refreshed as the word changes. It closes once the cursor
+// leaves the word.
+func (m *Model) updateCompletion(msg tea.KeyPressMsg) tea.Cmd {
+	if m.CompletionProvider == nil {
+		return nil
+	}
+	c := m.completion
+	if !c.open {
+		if m.AutoComplete && msg.Text != "" && isWordRune([]rune(msg.Text)[0]) {
+			return m.Complete()
+		}
+		return nil
+	}
+
+	line := m.value.Line(m.row)
+	col := min(m.col, len(line))
+	if m.row != c.row || col < c.start || strings.IndexFunc(string(line[c.start:col]), func(r rune) bool {
+		return !isWordRune(r)
+	}) >= 0 {
+		m.CloseCompletion()
+		return nil
+	}
+	if string(line[c.start:col]) != c.word {
+		return m.Complete()
+	}
+	return nil
+}
+
+// completionView renders the completion popup.
+func (m Model) completionView() []string {
+	c := m.completion
+	height := m.MaxCompletions
+	if height <= 0 {
+		height = defaultMaxCompletions
+	}
+	height = min(height, len(c.items))
+	first := max(0, c.selected-height+1)
+
+	textWidth, detailWidth := 0, 0
+	for _, item := range c.items {
+		textWidth = max(textWidth, ansi.StringWidth(item.Text))
+		detailWidth = max(detailWidth, ansi.StringWidth(item.Detail))
+	}
+
+	styles := m.activeStyle()
+	lines := make([]string, height)
+	for i := range lines {
+		item := c.items[first+i]
+		text := " " + item.Text + strings.Repeat(" ", textWidth-ansi.StringWidth(item.Text)) + " "
+		if detailWidth > 0 {
+			text += item.Detail + strings.Repeat(" ", detailWidth-ansi.StringWidth(item.Detail)) + " "
+		}
+		style := styles.Completion
+		if first+i == c.selected {
+			style = styles.SelectedCompletion
+		}
+		lines[i] = style.Inline(true).Render(text)
+	}
+	return lines
+}
+
+// drawCompletion draws the completion popup over the rendered lines of the
+// view, under the cursor, or above it if there's no room below.
+func (m Model) drawCompletion(view string) string {
+	if !m.focus || !m.Completing() {
+		return view
+	}
+	popup := m.completionView()
+	lines := strings.Split(view, "\n")
+
+	lineInfo := m.LineInfo()
+	x := lineInfo.CharOffset + m.rowIndent(m.value.Line(m.row), lineInfo.RowOffset) + lipgloss.Width(m.promptView(0)) + m.gutterWidth() + lipgloss.Width(m.lineNumberView(0, false))
+	y := m.cursorLineNumber() - m.yOffset
+	if y < 0 || y >= len(lines) {
+		return view
+	}
+
+	top := y + 1
+	if below, above := len(lines)-top, y; below < len(popup) && above > below {
+		popup = popup[max(0, len(popup)-above):]
+		top = y - len(popup)
+	} else {
+		popup = popup[:min(len(popup), below)]
+	}
+
+	for i, p := range popup {
+		line := lines[top+i]
+		width := ansi.StringWidth(line)
+		pw := ansi.StringWidth(p)
+		if pw > width {
+			p = ansi.Truncate(p, width, "")
+			pw = width
+		}
+		px := max(0, min(x, width-pw))
+		lines[top+i] = ansi.Truncate(line, px, "") + p + ansi.TruncateLeft(line, px+pw, "")
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,283 @@
+package textarea
+
+import (
+	"slices"
+
+	tea "charm.land/bubbletea/v2"
+	"github.com/haochend413/bubbles/v2/internal/rope"
+	"github.com/haochend413/bubbles/v2/internal/runeutil"
+	"github.com/haochend413/bubbles/v2/key"
+)
+
+// extraCursor is a cursor besides the primary one, which is at the row and
+// column of the model.
+type extraCursor struct {
+	pos
+
+	// charOffset is the display column kept when moving vertically, like the
+	// lastCharOffset of the model.
+	charOffset int
+}
+
+// offsetKey is the key of offsetMetric.
+type offsetKey struct{}
+
+// offsetMetric is the metric of the number of characters of a line followed
+// by a line break, to turn positions into offsets in the value.
+var offsetMetric = rope.Metric{
+	Key: offsetKey{},
+	Measure: func(line []rune) int {
+		return len(line) + 1
+	},
+}
+
+// offset returns the offset of a position in the value.
+func (m Model) offset(p pos) int {
+	return m.value.Sum(offsetMetric, p.row) + min(p.col, len(m.value.Line(p.row)))
+}
+
+// posAt returns the position at an offset in the value.
+func (m Model) posAt(offset int) pos {
+	return posIn(m.value, offset)
+}
+
+// posIn returns the position at an offset in a value.
+func posIn(r rope.Rope, offset int) pos {
+	row, col := r.Find(offsetMetric, max(0, offset))
+	if row >= r.Len() {
+		row = r.Len() - 1
+		col = len(r.Line(row))
+	}
+	return pos{row, min(col, len(r.Line(row)))}
+}
+
+// CursorCount returns the number of cursors, counting the primary one.
+func (m Model) CursorCount() int {
+	return len(m.cursors) + 1
+}
+
+// AddCursor adds a cursor at the given row and column, clamped to the value.
+// Typing, deleting and moving then happen at every cursor, while the cursor
+// shown by [Model.Cursor] and moved by the other methods stays the primary
+// one.
+func (m *Model) AddCursor(row, col int) {
+	row = clamp(row, 0, m.value.Len()-1)
+	m.addCursor(extraCursor{pos: pos{row, clamp(col, 0, len(m.value.Line(row)))}})
+}
+
+// ClearCursors removes the cursors other than the primary one.
+func (m *Model) ClearCursors() {
+	m.cursors = nil
+}
+
+// addCursor adds a cursor, unless there's already one at its position.
+func (m *Model) addCursor(c extraCursor) {
+	if m.hasCursor(c.pos) {
+		return
+	}
+	m.cursors = append(m.cursors, c)
+}
+
+// hasCursor reports whether one of the cursors is at p.
+func (m Model) hasCursor(p pos) bool {
+	if p == (pos{m.row, m.col}) {
+		return true
+	}
+	return slices.ContainsFunc(m.cursors, func(c extraCursor) bool {
+		return c.pos == p
+	})
+}
+
+// AddCursorAbove adds a cursor on the line above the topmost cursor, at the
+// same display column.
+func (m *Model) AddCursorAbove() {
+	m.addCursorVertically(-1)
+}
+
+// AddCursorBelow adds a cursor on the line below the bottommost cursor, at the
+// same display column.
+func (m *Model) AddCursorBelow() {
+	m.addCursorVertically(1)
+}
+
+// addCursorVertically adds a cursor a line above or below the outermost
+// cursor in that direction. Lines are display lines, as when moving the
+// cursor up and down.
+func (m *Model) addCursorVertically(delta int) {
+	edge := extraCursor{pos{m.row, m.col}, m.lastCharOffset}
+	for _, c := range m.cursors {
+		if delta < 0 && c.before(edge.pos) || delta > 0 && edge.before(c.pos) {
+			edge = c
+		}
+	}
+
+	row, col, charOffset := m.row, m.col, m.lastCharOffset
+	yOffset, xOffset := m.yOffset, m.xOffset
+	m.row, m.col, m.lastCharOffset = edge.row, edge.col, edge.charOffset
+	m.setCursorLineRelative(delta)
+	c := extraCursor{pos{m.row, m.col}, m.lastCharOffset}
+	m.row, m.col, m.lastCharOffset = row, col, charOffset
+	m.yOffset, m.xOffset = yOffset, xOffset
+
+	// There's no line past the first or the last one.
+	if delta < 0 && c.before(edge.pos) || delta > 0 && edge.before(c.pos) {
+		m.addCursor(c)
+	}
+}
+
+// AddCursorAtNextOccurrence adds a cursor at the next occurrence of the word
+// under the primary cursor, after the cursor added last, at the same place in
+// the word. The search wraps around to the start of the value, and only
+// matches whole words.
+func (m *Model) AddCursorAtNextOccurrence() {
+	line := m.value.Line(m.row)
+	col := min(m.col, len(line))
+	start, end := col, col
+	for start > 0 && isWordRune(line[start-1]) {
+		start--
+	}
+	for end < len(line) && isWordRune(line[end]) {
+		end++
+	}
+	if start == end {
+		return
+	}
+	word := slices.Clone(line[start:end])
+	rel := col - start
+
+	from := pos{m.row, end}
+	if n := len(m.cursors); n > 0 {
+		last := m.cursors[n-1]
+		from = pos{last.row, last.col - rel + len(word)}
+	}
+	for i := range m.value.Len() + 1 {
+		row := (from.row + i) % m.value.Len()
+		line := m.value.Line(row)
+		c := 0
+		if i == 0 {
+			c = clamp(from.col, 0, len(line))
+		}
+		for ; c+len(word) <= len(line); c++ {
+			if !slices.Equal(line[c:c+len(word)], word) ||
+				c > 0 && isWordRune(line[c-1]) ||
+				c+len(word) < len(line) && isWordRune(line[c+len(word)]) {
+				continue
+			}
+			if p := (pos{row, c + rel}); !m.hasCursor(p) {
+				m.addCursor(extraCursor{pos: p})
+				return
+			}
+		}
+	}
+}
+
+// multiCursorKey reports whether a key press runs at every cursor. Keys that
+// move far away or undo changes remove the extra cursors instead, and only
+// the primary one selects text or pastes.
+func (m *Model) multiCursorKey(msg tea.KeyPressMsg) bool {
+	if len(m.cursors) == 0 {
+		return false
+	}
+	k := m.KeyMap
+	switch {
+	case key.Matches(msg, k.Undo, k.Redo, k.InputBegin, k.InputEnd, k.PageUp, k.PageDown, k.Reflow):
+		m.ClearCursors()
+		return false
+	case key.Matches(msg, k.Paste):
+		return false
+	}
+	return true
+}
+
+// cursorKey handles the keys that add and remove cursors. It reports whether
+// the key was handled.
+func (m *Model) cursorKey(msg tea.KeyPressMsg) bool {
+	k := m.KeyMap
+	switch {
+	case key.Matches(msg, k.AddCursorAbove):
+		m.AddCursorAbove()
+	case key.Matches(msg, k.AddCursorBelow):
+		m.AddCursorBelow()
+	case key.Matches(msg, k.AddCursorAtNextOccurrence):
+		m.AddCursorAtNextOccurrence()
+	case len(m.cursors) > 0 && key.Matches(msg, k.ClearCursors):
+		m.ClearCursors()
+	default:
+		return false
+	}
+	return true
+}
+
+// eachCursor runs f at every cursor, from the last one in the value to the
+// first one, so that the edits made at a cursor don't move the cursors before
+// it. Those after it keep their distance from the end of the value. Cursors
+// that end up at the same position are merged.
+func (m *Model) eachCursor(f func()) {
+	// Cursors are indexed in the order they were added, and the primary one
+	// comes last.
+	type mark struct {
+		extraCursor
+		index int
+	}
+	marks := make([]mark, 0, len(m.cursors)+1)
+	for i, c := range m.cursors {
+		marks = append(marks, mark{c, i})
+	}
+	primary := len(m.cursors)
+	marks = append(marks, mark{extraCursor{pos{m.row, m.col}, m.lastCharOffset}, primary})
+	slices.SortFunc(marks, func(a, b mark) int {
+		switch {
+		case b.before(a.pos):
+			return -1
+		case a.before(b.pos):
+			return 1
+		}
+		return 0
+	})
+
+	yOffset, xOffset := m.yOffset, m.xOffset
+	fromEnd := make([]int, len(marks))
+	for i, c := range marks {
+		m.row = clamp(c.row, 0, m.value.Len()-1)
+		m.col, m.lastCharOffset = c.col, c.charOffset
+		f()
+		fromEnd[i] = m.value.Total(offsetMetric) - m.offset(pos{m.row, m.col})
+		marks[i].charOffset = m.lastCharOffset
+	}
+
+	total := m.value.Total(offsetMetric)
+	cursors := make([]extraCursor, len(m.cursors))
+	for i, c := range marks {
+		c.pos = m.posAt(total - fromEnd[i])
+		if c.index == primary {
+			m.row, m.col, m.lastCharOffset = c.row, c.col, c.charOffset
+		} else {
+			cursors[c.index] = c.extraCursor
+		}
+	}
+	m.cursors = nil
+	for _, c := range cursors {
+		m.addCursor(c)
+	}
+	m.yOffset, m.xOffset = yOffset, xOffset
+	m.repositionView()
+}
+
+// cursorSpans returns the spans drawing the extra cursors of a row on top of
+// its text.
+func (m Model) cursorSpans(row int, spans []Span) []Span {
+	if !m.focus {
+		return spans
+	}
+	style := m.activeStyle().SecondaryCursor
+	spans = slices.Clip(spans)
+	for _, c := range m.cursors {
+		if c.row == row {
+			// The cursor covers a whole character, or the cell past the end
+			// of the line.
+			end := max(c.col+1, runeutil.NextGrapheme(m.value.Line(row), c.col))
+			spans = append(spans, Span{Start: c.col, End: end, Style: style})
+		}
+	}
+	return spans
+}
@@ -0,0 +1,214 @@
+package textarea
+
+import (
+	"slices"
+
+	"github.com/charmbracelet/x/ansi"
+	"github.com/haochend413/bubbles/v2/internal/fold"
+	"github.com/haochend413/lipgloss/v2"
+)
+
+// Fold is a range of lines that can be collapsed to its first one, from row
+// Start up to row End, inclusive. When Closed, the lines after the first one
+// are hidden, and the first one is followed by the number of lines hidden.
+// The cursor moves over closed folds, and opens those it's moved into in
+// other ways, such as by searching.
+type Fold struct {
+	Start, End int
+	Closed     bool
+}
+
+// SetFolds sets the folds, replacing those set before. Folds can be nested,
+// but they must not otherwise overlap. Folds move along with edits, and
+// they're cleared when the value is set or reset.
+func (m *Model) SetFolds(folds []Fold) {
+	m.folds = m.folds[:0]
+	for _, f := range folds {
+		m.folds = append(m.folds, fold.Fold(f))
+	}
+	m.folds = fold.Sort(m.folds)
+	m.revealCursor()
+}
+
+// Folds returns the folds, in order of their first line.
+func (m Model) Folds() []Fold {
+	folds := make([]Fold, len(m.folds))
+	for i, f := range m.folds {
+		folds[i] = Fold(f)
+	}
+	return folds
+}
+
+// FoldByIndent sets the folds to those of the lines followed by lines
+// indented more than them, all open.
+func (m *Model) FoldByIndent() {
+	m.folds = fold.ByIndent(m.value.Len(), m.lineString, m.tabStop())
+}
+
+// FoldByMarker sets the folds to those from the lines containing the open
+// marker to the lines containing the matching close marker, such as "{{{"
+// and "}}}", all open.
+func (m *Model) FoldByMarker(open, close string) {
+	m.folds = fold.ByMarker(m.value.Len(), m.lineString, open, close)
+}
+
+// lineString returns a line as a string.
+func (m Model) lineString(row int) string {
+	return string(m.value.Line(row))
+}
+
+// ToggleFold opens the closed fold a row is in, or if there's none, closes
+// the innermost fold it's in.
+func (m *Model) ToggleFold(row int) {
+	fold.Toggle(m.folds, row)
+	m.hideCursor()
+}
+
+// OpenFold opens the outermost closed fold a row is in.
+func (m *Model) OpenFold(row int) {
+	fold.Open(m.folds, row)
+}
+
+// CloseFold closes the innermost open fold a row is in.
+func (m *Model) CloseFold(row int) {
+	fold.Close(m.folds, row)
+	m.hideCursor()
+}
+
+// OpenAllFolds opens all folds.
+func (m *Model) OpenAllFolds() {
+	fold.SetAll(m.folds, false)
+}
+
+// CloseAllFolds closes all folds.
+func (m *Model) CloseAllFolds() {
+	fold.SetAll(m.folds, true)
+	m.hideCursor()
+}
+
+// ClosedFold returns the closed fold hiding the lines after a row, if the row
+// is inside one. Closed folds inside it aren't.
+func (m Model) ClosedFold(row int) (Fold, bool) {
+	for _, f := range fold.Closed(m.folds) {
+		if f.Start <= row && row <= f.End {
+			return Fold(f), true
+		}
+	}
+	return Fold{}, false
+}
+
+// hideCursor moves the cursor out of the folds that were closed over it, to
+// their first line.
+func (m *Model) hideCursor() {
+	if m.hidden(m.row) {
+		f, _ := m.ClosedFold(m.row)
+		m.row = f.Start
+		m.SetCursorColumn(m.col)
+	}
+}
+
+// revealCursor opens the folds that hide the cursor line.
+func (m *Model) revealCursor() {
+	for fold.Hiding(m.folds, m.row) >= 0 {
+		fold.Open(m.folds, m.row)
+	}
+}
+
+// hidden reports whether a row is hidden by a closed fold.
+func (m Model) hidden(row int) bool {
+	return fold.Hiding(m.folds, row) >= 0
+}
+
+// nextRow returns the row shown after a row, or m.value.Len() if there's
+// none.
+func (m Model) nextRow(row int) int {
+	if f, ok := m.ClosedFold(row); ok {
+		return f.End + 1
+	}
+	return row + 1
+}
+
+// prevRow returns the row shown before a row, or -1 if there's none.
+func (m Model) prevRow(row int) int {
+	if f, ok := m.ClosedFold(row - 1); ok {
+		return f.Start
+	}
+	return row - 1
+}
+
+// moveFolds moves the folds along with an edit replacing the text from start
+// up to end with the text from start up to newEnd. The first line of a fold
+// moves along with its text from the start of the line, and the last line
+// along with its text up to the end of the line.
+func (m *Model) moveFolds(start, end, newEnd pos) {
+	for i, f := range m.folds {
+		m.folds[i].Start = fold.Move(f.Start, start.row, end.row, newEnd.row)
+		if f.Start == start.row && start.col == 0 {
+			m.folds[i].Start = newEnd.row
+		}
+		m.folds[i].End = fold.Move(f.End, start.row, end.row, newEnd.row)
+		if f.End == end.row {
+			m.folds[i].End = newEnd.row
+		}
+	}
+	m.folds = fold.Sort(m.folds)
+}
+
+// hiddenHeight returns the number of display rows that closed folds hide.
+func (m Model) hiddenHeight(closed []fold.Fold) int {
+	h, n := m.heightMetric(), 0
+	for _, f := range closed {
+		n += m.value.Sum(h, f.End+1) - m.value.Sum(h, f.Start+1)
+	}
+	return n
+}
+
+// rowsBefore returns the number of display rows before a row, not counting
+// those hidden by closed folds.
+func (m Model) rowsBefore(row int) int {
+	closed := fold.Closed(m.folds)
+	i := 0
+	for i < len(closed) && closed[i].End < row {
+		i++
+	}
+	return m.value.Sum(m.heightMetric(), row) - m.hiddenHeight(closed[:i])
+}
+
+// findRow returns the row shown at display row y, and the row of its
+// soft-wrapped rows that y is on, not counting the rows hidden by closed
+// folds.
+func (m Model) findRow(y int) (int, int) {
+	h := m.heightMetric()
+	for _, f := range fold.Closed(m.folds) {
+		if y < m.value.Sum(h, f.Start+1) {
+			break
+		}
+		y += m.value.Sum(h, f.End+1) - m.value.Sum(h, f.Start+1)
+	}
+	return m.value.Find(h, y)
+}
+
+// foldState returns the fold indicator of a row: that of the fold starting
+// on it, or the one set with SetFoldIndicators.
+func (m Model) foldState(row int) FoldState {
+	i, ok := slices.BinarySearchFunc(m.folds, row, func(f fold.Fold, row int) int { return f.Start - row })
+	if !ok {
+		return m.foldIndicators[row]
+	}
+	if m.folds[i].Closed {
+		return FoldClosed
+	}
+	return FoldOpen
+}
+
+// foldSummary renders what follows the last row of a row that starts a
+// closed fold, in width cells, or returns "" if it doesn't start one.
+func (m Model) foldSummary(row, width int, style lipgloss.Style) string {
+	f, ok := m.ClosedFold(row)
+	if !ok || f.Start != row || width <= 0 {
+		return ""
+	}
+	// The space after the line, left for the cursor, separates the summary.
+	summary := ansi.Truncate(fold.Summary(fold.Fold(f)), width, "")
+	return m.activeStyle().FoldSummary.Inherit(style).Render(summary)
+}
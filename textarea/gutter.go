@@ -0,0 +1,289 @@
+package textarea
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/x/ansi"
+	"github.com/haochend413/lipgloss/v2"
+)
+
+// GutterFunc renders a column of the gutter for a row of the textarea. See
+// [Model.SetGutter].
+//
+// Example implementation showing a mark on the cursor line:
+//
+//	func(info GutterContext) string {
+//		if info.CursorLine && !info.Soft {
+//			return info.Style.Render("*")
+//		}
+//		return ""
+//	}
+type GutterFunc func(GutterContext) string
+
+// GutterContext provides context to a [GutterFunc].
+type GutterContext struct {
+	// Index is the index of the line which the gutter is being rendered for.
+	Index int
+
+	// TotalLines is the total number of lines in the textarea.
+	TotalLines int
+
+	// Soft is whether the row is one that a soft-wrapped line continues on.
+	Soft bool
+
+	// CursorLine is whether the line is the one the cursor is on.
+	CursorLine bool
+
+	// Severity is the severity of the most severe diagnostic of the line, or
+	// SeverityNone if it has none.
+	Severity Severity
+
+	// Change is how the line changed, as set by [Model.SetLineChanges].
+	Change LineChange
+
+	// Fold is the fold indicator of the line.
+	Fold FoldState
+
+	// Style is the style of the row, such as that of the cursor line, which
+	// the column is rendered on top of.
+	Style lipgloss.Style
+
+	// styles are the styles of the textarea.
+	styles *StyleState
+}
+
+// GutterColumn is a column of the gutter, Width cells wide. What Func
+// returns is padded or truncated to the width.
+type GutterColumn struct {
+	Width int
+	Func  GutterFunc
+}
+
+// The gutter columns showing what's set with the methods of the textarea.
+var (
+	// DiagnosticColumn shows the sign of the most severe diagnostic of each
+	// line: E, W, I or H, in the style of its severity.
+	DiagnosticColumn = GutterColumn{Width: 2, Func: diagnosticSign}
+
+	// ChangeColumn shows a marker on the lines that were added or changed,
+	// and under those after which lines were removed.
+	ChangeColumn = GutterColumn{Width: 1, Func: changeMarker}
+
+	// FoldColumn shows the fold indicators of the lines.
+	FoldColumn = GutterColumn{Width: 2, Func: foldIndicator}
+)
+
+// Severity is the severity of a [Diagnostic].
+type Severity int
+
+const (
+	// SeverityNone is the severity of lines without diagnostics.
+	SeverityNone Severity = iota
+	SeverityHint
+	SeverityInfo
+	SeverityWarning
+	SeverityError
+)
+
+// Diagnostic is a message about a line, such as an error found by a linter.
+type Diagnostic struct {
+	Row      int
+	Severity Severity
+	Message  string
+}
+
+// LineChange is how a line changed, such as since the last commit.
+type LineChange int
+
+const (
+	LineUnchanged LineChange = iota
+	LineAdded
+	LineChanged
+
+	// LineRemoved marks the line after which lines were removed.
+	LineRemoved
+)
+
+// FoldState is the fold indicator of a line.
+type FoldState int
+
+const (
+	// FoldNone is the state of lines that don't start a fold.
+	FoldNone FoldState = iota
+
+	// FoldOpen is the state of the first line of a fold that's open.
+	FoldOpen
+
+	// FoldClosed is the state of the first line of a fold that's closed.
+	FoldClosed
+)
+
+// SetGutter sets the columns of the gutter, shown between the prompt and the
+// line numbers, in order. The width of the text shrinks to make room for
+// them.
+func (m *Model) SetGutter(columns ...GutterColumn) {
+	old := m.gutterWidth()
+	m.gutter = slices.Clone(columns)
+	m.width = max(1, m.width+old-m.gutterWidth())
+	m.recalculateHeight()
+}
+
+// gutterWidth returns the width of the gutter.
+func (m Model) gutterWidth() int {
+	w := 0
+	for _, c := range m.gutter {
+		w += max(0, c.Width)
+	}
+	return w
+}
+
+// SetDiagnostics sets the diagnostics of the lines, replacing those set
+// before. Their signs are shown by the DiagnosticColumn of the gutter, and
+// the message of the most severe one of the cursor line is shown after its
+// text when ShowDiagnosticMessages is set. Diagnostics don't move along with
+// edits, so they're usually set again when the value changes.
+func (m *Model) SetDiagnostics(diagnostics []Diagnostic) {
+	m.diagnostics = make(map[int][]Diagnostic, len(diagnostics))
+	for _, d := range diagnostics {
+		m.diagnostics[d.Row] = append(m.diagnostics[d.Row], d)
+	}
+	for _, ds := range m.diagnostics {
+		// The most severe come first.
+		slices.SortStableFunc(ds, func(a, b Diagnostic) int { return int(b.Severity - a.Severity) })
+	}
+}
+
+// LineDiagnostics returns the diagnostics of a line, the most severe first,
+// such as to show those of the cursor line in a status bar.
+func (m Model) LineDiagnostics(row int) []Diagnostic {
+	return slices.Clone(m.diagnostics[row])
+}
+
+// SetLineChanges sets how the lines changed, by row, replacing what was set
+// before. The changes are shown by the ChangeColumn of the gutter. Like
+// diagnostics, they don't move along with edits.
+func (m *Model) SetLineChanges(changes map[int]LineChange) {
+	m.lineChanges = changes
+}
+
+// SetFoldIndicators sets the fold indicators of the lines, by row, replacing
+// what was set before. They're shown by the FoldColumn of the gutter.
+func (m *Model) SetFoldIndicators(folds map[int]FoldState) {
+	m.foldIndicators = folds
+}
+
+// severity returns the severity of the most severe diagnostic of a line.
+func (m Model) severity(row int) Severity {
+	if ds := m.diagnostics[row]; len(ds) > 0 {
+		return ds[0].Severity
+	}
+	return SeverityNone
+}
+
+// gutterView renders the gutter of a row of a line.
+func (m Model) gutterView(row int, soft bool, style lipgloss.Style) string {
+	if len(m.gutter) == 0 {
+		return ""
+	}
+	ctx := GutterContext{
+		Index:      row,
+		TotalLines: m.value.Len(),
+		Soft:       soft,
+		CursorLine: row == m.row,
+		Severity:   m.severity(row),
+		Change:     m.lineChanges[row],
+		Fold:       m.foldState(row),
+		Style:      style,
+		styles:     m.activeStyle(),
+	}
+	var b strings.Builder
+	for _, c := range m.gutter {
+		if c.Width <= 0 {
+			continue
+		}
+		var s string
+		if c.Func != nil {
+			s = ansi.Truncate(c.Func(ctx), c.Width, "")
+		}
+		b.WriteString(s)
+		b.WriteString(style.Render(strings.Repeat(" ", c.Width-ansi.StringWidth(s))))
+	}
+	return b.String()
+}
+
+// severityStyle returns the style of the diagnostics of a severity.
+func (s StyleState) severityStyle(severity Severity) lipgloss.Style {
+	switch severity {
+	case SeverityError:
+		return s.DiagnosticError
+	case SeverityWarning:
+		return s.DiagnosticWarning
+	case SeverityInfo:
+		return s.DiagnosticInfo
+	}
+	return s.DiagnosticHint
+}
+
+func diagnosticSign(info GutterContext) string {
+	if info.Soft || info.Severity == SeverityNone {
+		return ""
+	}
+	// Unknown severities are shown as hints, as severityStyle styles them.
+	sign := "H"
+	switch info.Severity {
+	case SeverityError:
+		sign = "E"
+	case SeverityWarning:
+		sign = "W"
+	case SeverityInfo:
+		sign = "I"
+	}
+	return info.styles.severityStyle(info.Severity).Inherit(info.Style).Render(sign)
+}
+
+func changeMarker(info GutterContext) string {
+	var style lipgloss.Style
+	marker := "┃"
+	switch info.Change {
+	case LineAdded:
+		style = info.styles.LineAdded
+	case LineChanged:
+		style = info.styles.LineChanged
+	case LineRemoved:
+		if info.Soft {
+			return ""
+		}
+		style, marker = info.styles.LineRemoved, "▁"
+	default:
+		return ""
+	}
+	return style.Inherit(info.Style).Render(marker)
+}
+
+func foldIndicator(info GutterContext) string {
+	if info.Soft {
+		return ""
+	}
+	style := info.styles.FoldIndicator.Inherit(info.Style)
+	switch info.Fold {
+	case FoldOpen:
+		return style.Render("▾")
+	case FoldClosed:
+		return style.Render("▸")
+	}
+	return ""
+}
+
+// diagnosticMessage renders the message of the most severe diagnostic of the
+// cursor line, to show after its text in width cells, or returns "" if
+// there's none or no room for it.
+func (m Model) diagnosticMessage(width int, style lipgloss.Style) string {
+	ds := m.diagnostics[m.row]
+	if !m.ShowDiagnosticMessages || len(ds) == 0 || width < 2 {
+		return ""
+	}
+	msg, _, _ := strings.Cut(ds[0].Message, "\n")
+	msg = ansi.Truncate(msg, width-1, "…")
+	return style.Render(" ") + m.activeStyle().severityStyle(ds[0].Severity).Inherit(style).Render(msg)
+}
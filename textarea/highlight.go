@@ -0,0 +1,118 @@
+package textarea
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/haochend413/bubbles/v2/internal/memoization"
+	"github.com/haochend413/bubbles/v2/internal/rope"
+	"github.com/haochend413/lipgloss/v2"
+)
+
+// Span is a styled run of text in a line, as returned by a [Highlighter].
+type Span struct {
+	// Start and End are the columns of the first rune of the span and of
+	// the rune after its last one.
+	Start, End int
+
+	// Style is the style of the span. It's applied on top of the style of
+	// the line, so spans without a background keep the cursor line's.
+	Style lipgloss.Style
+}
+
+// Highlighter styles the text of a textarea, such as for syntax highlighting.
+type Highlighter interface {
+	// Highlight returns the styled spans of a line. state is the state
+	// returned for the previous line, or an empty string for the first
+	// one, so that constructs spanning several lines, such as block
+	// comments, can be highlighted. The spans must be in order and must not
+	// overlap. Text outside of spans is rendered as usual.
+	//
+	// Results are cached by line and state, so Highlight must return the
+	// same result for the same arguments.
+	Highlight(line []rune, state string) (spans []Span, next string)
+}
+
+// HighlighterFunc is a function that implements [Highlighter].
+type HighlighterFunc func(line []rune, state string) ([]Span, string)
+
+// Highlight calls f(line, state).
+func (f HighlighterFunc) Highlight(line []rune, state string) ([]Span, string) {
+	return f(line, state)
+}
+
+// highlightInput is the input to the highlighter. This is stored in a struct
+// so that it can be hashed and memoized.
+type highlightInput struct {
+	runes []rune
+	state string
+}
+
+// Hash returns a hash of the highlighter input.
+func (h highlightInput) Hash() string {
+	v := fmt.Sprintf("%s\x00%s", h.state, string(h.runes))
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(v)))
+}
+
+// highlighted is the output of the highlighter for a line.
+type highlighted struct {
+	spans []Span
+	state string
+}
+
+// SetHighlighter sets the highlighter that styles the text. Set it to nil to
+// render all text with the Text style again.
+func (m *Model) SetHighlighter(h Highlighter) {
+	m.highlighter = h
+	m.highlightCache = memoization.NewMemoCache[highlightInput, highlighted](cacheSize)
+}
+
+// memoizedHighlight highlights a line, given the state returned for the
+// previous line.
+func (m Model) memoizedHighlight(runes []rune, state string) ([]Span, string) {
+	if m.highlighter == nil || m.highlightCache == nil {
+		return nil, ""
+	}
+	input := highlightInput{runes: runes, state: state}
+	if v, ok := m.highlightCache.Get(input); ok {
+		return v.spans, v.state
+	}
+	spans, next := m.highlighter.Highlight(runes, state)
+	m.highlightCache.Set(input, highlighted{spans: spans, state: next})
+	return spans, next
+}
+
+// highlightScanner returns the scanner of the states of the highlighter. The
+// states are cached in the value, so that rendering the lines far down a
+// large value only highlights the lines above them that changed.
+func (m Model) highlightScanner() rope.Scanner {
+	return rope.Scanner{
+		// The cache is made anew with each highlighter.
+		Key: m.highlightCache,
+		Scan: func(line []rune, state string) string {
+			_, next := m.highlighter.Highlight(line, state)
+			return next
+		},
+	}
+}
+
+// spanAt returns the index of the span containing column col, or -1.
+func spanAt(spans []Span, col int) int {
+	for i, s := range spans {
+		if col >= s.Start && col < s.End {
+			return i
+		}
+	}
+	return -1
+}
+
+// topSpanAt returns the index of the last of possibly overlapping spans
+// containing column col, or -1.
+func topSpanAt(spans []Span, col int) int {
+	for i := len(spans) - 1; i >= 0; i-- {
+		if s := spans[i]; col >= s.Start && col < s.End {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,302 @@
+package textarea
+
+import (
+	"slices"
+
+	tea "charm.land/bubbletea/v2"
+	"github.com/haochend413/bubbles/v2/internal/rope"
+	"github.com/haochend413/bubbles/v2/key"
+)
+
+// editKind tells how an edit is grouped with the edits before it in the undo
+// history.
+type editKind int
+
+const (
+	// editOther is an edit that is undone on its own.
+	editOther editKind = iota
+
+	// editTyping is a typed character. A run of typed characters is undone
+	// in a single step.
+	editTyping
+)
+
+// snapshot is a state of the textarea saved in the undo history. As the value
+// is a rope, it shares the lines that didn't change with the other states.
+type snapshot struct {
+	value    rope.Rope
+	row, col int
+
+	// edits turn after, the value the state led to, back into the value of
+	// the state, so that returning to it reports them to OnChange one by
+	// one. They're nil if the edits weren't all recorded.
+	edits []edit
+	after rope.Rope
+}
+
+// history holds the states the textarea can go back and forth between with
+// undo and redo.
+type history struct {
+	undo []snapshot
+	redo []snapshot
+
+	// editing is set between beginEdit and endEdit.
+	editing bool
+
+	// pending is the state saved when an edit begins. It's pushed onto the
+	// undo stack when the edit ends, unless the edit didn't change anything.
+	pending *snapshot
+
+	// change is the state saved by BeginChange. Until EndChange, edits are
+	// part of the same change rather than changes of their own.
+	change *snapshot
+
+	// typing is set while typed characters are added to the change at the
+	// top of the undo stack. row and col are the cursor position after the
+	// last of them, so that moving the cursor starts a new change.
+	typing   bool
+	row, col int
+
+	// log records the edits since the last state saved, to undo them.
+	log editLog
+}
+
+// CanUndo reports whether there is a change to undo.
+func (m Model) CanUndo() bool {
+	return len(m.history.undo) > 0
+}
+
+// CanRedo reports whether there is an undone change to redo.
+func (m Model) CanRedo() bool {
+	return len(m.history.redo) > 0
+}
+
+// Undo reverts the last change. It does nothing if there is no change to
+// undo, or if undoing it would change protected text, such as the change
+// setting the value before the text was protected.
+func (m *Model) Undo() {
+	m.EndChange()
+	m.history.typing = false
+	m.back(&m.history.undo, &m.history.redo)
+}
+
+// Redo reapplies the last undone change. It does nothing if there is no
+// change to redo, or if redoing it would change protected text.
+func (m *Model) Redo() {
+	m.EndChange()
+	m.history.typing = false
+	m.back(&m.history.redo, &m.history.undo)
+}
+
+// back returns to the state at the top of the stack from, saving the current
+// state onto the stack to so that it can be returned to in turn. It does
+// nothing if returning to it would change protected text.
+func (m *Model) back(from, to *[]snapshot) {
+	if len(*from) == 0 {
+		return
+	}
+	s := (*from)[len(*from)-1]
+	steps, known := m.restoreSteps(s)
+	if !m.canRestore(s, steps, known) {
+		return
+	}
+	*from = (*from)[:len(*from)-1]
+	r := m.snapshot()
+	if known {
+		r.edits, r.after = undoEdits(steps), s.value
+	}
+	*to = append(*to, r)
+	m.restore(s, steps, known)
+}
+
+// ClearHistory discards all changes that could be undone or redone.
+func (m *Model) ClearHistory() {
+	m.history = history{}
+}
+
+// BeginChange starts a change made of several edits, such as a command of an
+// editor built on the textarea, which is undone in a single step. It does
+// nothing if a change has already begun.
+func (m *Model) BeginChange() {
+	h := &m.history
+	if h.change != nil {
+		return
+	}
+	h.typing = false
+	s := m.snapshot()
+	h.change = &s
+	h.log.reset(m.value)
+}
+
+// EndChange completes the change started by BeginChange, recording it in the
+// undo history if it changed the value.
+func (m *Model) EndChange() {
+	h := &m.history
+	s := h.change
+	h.change = nil
+	if s != nil {
+		m.push(*s)
+	}
+}
+
+// beginEdit saves the current state before an edit so that it can be undone.
+// Typed characters that follow each other are added to the same change.
+func (m *Model) beginEdit(kind editKind) {
+	h := &m.history
+	h.editing = true
+	if h.change != nil {
+		return
+	}
+	if kind == editTyping && h.typing && h.row == m.row && h.col == m.col {
+		return
+	}
+	s := m.snapshot()
+	h.pending = &s
+	h.typing = kind == editTyping
+	h.log.reset(m.value)
+}
+
+// endEdit completes the edit started by beginEdit, recording it in the undo
+// history if it changed the value.
+func (m *Model) endEdit() {
+	h := &m.history
+	if !h.editing {
+		return
+	}
+	s := h.pending
+	h.editing, h.pending = false, nil
+	switch {
+	case s != nil:
+		if !m.push(*s) {
+			h.typing = false
+			return
+		}
+	case h.typing && len(h.undo) > 0:
+		// The typed characters are added to the change at the top of the
+		// stack, and so are their edits.
+		top := &h.undo[len(h.undo)-1]
+		if steps, ok := h.log.since(top.after, m.value); ok && top.edits != nil {
+			top.edits = append(undoEdits(steps), top.edits...)
+			top.after = m.value
+		} else if rope.Equal(top.after, m.value) {
+			top.after = m.value
+		} else {
+			top.edits = nil
+		}
+		h.log.reset(m.value)
+	}
+	if h.typing {
+		h.row, h.col = m.row, m.col
+	}
+}
+
+// push records the state before a change in the undo history, unless the
+// value is still the same. It reports whether it was recorded.
+func (m *Model) push(s snapshot) bool {
+	h := &m.history
+	steps, known := h.log.since(s.value, m.value)
+	h.log.reset(m.value)
+	if rope.Equal(s.value, m.value) {
+		return false
+	}
+	if known {
+		s.edits, s.after = undoEdits(steps), m.value
+	}
+	h.undo = append(h.undo, s)
+	if m.HistoryLimit > 0 && len(h.undo) > m.HistoryLimit {
+		h.undo = slices.Delete(h.undo, 0, len(h.undo)-m.HistoryLimit)
+	}
+	h.redo = nil
+	return true
+}
+
+// keyEditKind reports whether a key press edits the value and, if so, how the
+// edit is grouped in the undo history.
+func (m Model) keyEditKind(msg tea.KeyPressMsg) (editKind, bool) {
+	k := m.KeyMap
+	switch {
+	case key.Matches(msg, k.DeleteAfterCursor, k.DeleteBeforeCursor,
+		k.DeleteCharacterBackward, k.DeleteCharacterForward,
+		k.DeleteWordBackward, k.DeleteWordForward, k.InsertNewline,
+		k.UppercaseWordForward, k.LowercaseWordForward,
+		k.CapitalizeWordForward, k.TransposeCharacterBackward,
+		k.InsertTab, k.Outdent, k.Reflow):
+		return editOther, true
+	case key.Matches(msg, k.CharacterBackward, k.CharacterForward,
+		k.LineEnd, k.LineNext, k.LinePrevious, k.LineStart, k.PageUp,
+		k.PageDown, k.Paste, k.WordBackward, k.WordForward, k.InputBegin,
+		k.InputEnd, k.Undo, k.Redo, k.SelectCharacterBackward,
+		k.SelectCharacterForward, k.SelectWordBackward, k.SelectWordForward,
+		k.SelectLinePrevious, k.SelectLineNext, k.SelectLineStart,
+		k.SelectLineEnd, k.SelectInputBegin, k.SelectInputEnd, k.SelectAll,
+		k.Copy, k.AddCursorAbove, k.AddCursorBelow,
+		k.AddCursorAtNextOccurrence, k.ClearCursors):
+		return editOther, false
+	case key.Matches(msg, k.Cut):
+		return editOther, true
+	}
+	return editTyping, msg.Text != ""
+}
+
+// snapshot returns the current state.
+func (m Model) snapshot() snapshot {
+	return snapshot{value: m.value, row: m.row, col: m.col}
+}
+
+// undoEdits returns the edits undoing steps, in the order to make them.
+func undoEdits(steps []step) []edit {
+	edits := make([]edit, len(steps))
+	for i, s := range steps {
+		edits[len(steps)-1-i] = s.inverse()
+	}
+	return edits
+}
+
+// restoreSteps returns the steps of the edits returning to a saved state, if
+// they were recorded.
+func (m Model) restoreSteps(s snapshot) ([]step, bool) {
+	if s.edits == nil || s.after != m.value {
+		return nil, false
+	}
+	steps := make([]step, len(s.edits))
+	r := m.value
+	for i, e := range s.edits {
+		steps[i] = apply(r, e)
+		r = steps[i].after
+	}
+	return steps, true
+}
+
+// canRestore reports whether returning to a saved state leaves the protected
+// text as it is. If the steps returning to it weren't recorded, the states
+// are compared from their first difference to their last one, so protected
+// text between two changes of the same state counts as changed.
+func (m Model) canRestore(s snapshot, steps []step, known bool) bool {
+	switch {
+	case len(m.protected) == 0:
+		return true
+	case known:
+		return !m.violatesSteps(steps)
+	}
+	e, ok := diff(m.value, s.value)
+	return !ok || !m.violates(e)
+}
+
+// restore returns to a saved state. The steps returning to it are reported
+// as they were recorded, or else as a single edit from the current value.
+func (m *Model) restore(s snapshot, steps []step, known bool) {
+	if known {
+		m.value = s.value
+		for _, st := range steps {
+			m.changed(st)
+		}
+	} else {
+		m.track(func() { m.value = s.value })
+	}
+	m.row = clamp(s.row, 0, m.value.Len()-1)
+	m.SetCursorColumn(s.col)
+	m.ClearSelection()
+	m.ClearCursors()
+	m.fitLineNumbers()
+	m.recalculateHeight()
+}
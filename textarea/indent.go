@@ -0,0 +1,318 @@
+package textarea
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/haochend413/bubbles/v2/internal/runeutil"
+	"github.com/rivo/uniseg"
+)
+
+const defaultTabWidth = 4
+
+// DefaultAutoClosePairs are the pairs of brackets and quotes commonly closed
+// automatically, to set [Model.AutoClosePairs] to.
+const DefaultAutoClosePairs = `()[]{}""''` + "``"
+
+// tabStop returns the distance between tab stops.
+func (m Model) tabStop() int {
+	if m.TabWidth > 0 {
+		return m.TabWidth
+	}
+	return defaultTabWidth
+}
+
+// tabWidthAt returns the width of a tab displayed at column x of a row: up to
+// the next tab stop.
+func tabWidthAt(x, tabWidth int) int {
+	return tabWidth - x%tabWidth
+}
+
+// textWidth returns the width of runes displayed from the start of a row,
+// where tabs extend to the next tab stop.
+func textWidth(runes []rune, tabWidth int) int {
+	width, start := 0, 0
+	for i, r := range runes {
+		if r == '\t' {
+			width += uniseg.StringWidth(string(runes[start:i]))
+			width += tabWidthAt(width, tabWidth)
+			start = i + 1
+		}
+	}
+	return width + uniseg.StringWidth(string(runes[start:]))
+}
+
+// nextChar returns the index of the rune after the character at index i of
+// runes, and the width of the character displayed at column x of its row.
+// Characters are grapheme clusters, or tabs, which extend to the next tab
+// stop.
+func nextChar(runes []rune, i, x, tabWidth int) (next, width int) {
+	if runes[i] == '\t' {
+		return i + 1, tabWidthAt(x, tabWidth)
+	}
+	next = runeutil.NextGrapheme(runes, i)
+	return next, uniseg.StringWidth(string(runes[i:next]))
+}
+
+// expandTabs replaces the tabs of runes displayed from column x of a row by
+// the spaces they're displayed as.
+func expandTabs(runes []rune, x, tabWidth int) string {
+	s := string(runes)
+	if !strings.ContainsRune(s, '\t') {
+		return s
+	}
+	var b strings.Builder
+	start := 0
+	for i, r := range runes {
+		if r == '\t' {
+			b.WriteString(string(runes[start:i]))
+			x += uniseg.StringWidth(string(runes[start:i]))
+			w := tabWidthAt(x, tabWidth)
+			b.WriteString(strings.Repeat(" ", w))
+			x += w
+			start = i + 1
+		}
+	}
+	b.WriteString(string(runes[start:]))
+	return b.String()
+}
+
+// indentUnit returns what a level of indentation is made of: a tab, or
+// spaces up to the next tab stop when tabs are expanded.
+func (m Model) indentUnit(col int) []rune {
+	if !m.ExpandTabs {
+		return []rune{'\t'}
+	}
+	return repeatSpaces(tabWidthAt(col, m.tabStop()))
+}
+
+// indentation returns the leading spaces and tabs of a line.
+func indentation(line []rune) []rune {
+	i := 0
+	for i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+		i++
+	}
+	return line[:i]
+}
+
+// indentedRows returns the rows that Indent and Outdent act on: those of the
+// selection, or else the cursor row. A selection ending at the start of a
+// line doesn't include that line.
+func (m Model) indentedRows() (int, int) {
+	start, end, ok := m.selectionRange()
+	if !ok {
+		return m.row, m.row
+	}
+	if end.col == 0 && end.row > start.row {
+		end.row--
+	}
+	return start.row, end.row
+}
+
+// Indent indents the selected lines, or the cursor line if there's no
+// selection, by a tab, or by TabWidth spaces when tabs are expanded. The
+// change can be undone. Like the keys, it doesn't edit protected text or a
+// ReadOnly textarea.
+func (m *Model) Indent() {
+	m.beginEdit(editOther)
+	m.guard(m.indent)
+	m.endEdit()
+	m.recalculateHeight()
+}
+
+// indent indents the selected lines, or the cursor line.
+func (m *Model) indent() {
+	first, last := m.indentedRows()
+	unit := m.indentUnit(0)
+	for row := first; row <= last; row++ {
+		line := m.value.Line(row)
+		if len(line) == 0 {
+			continue
+		}
+		m.replace(pos{row, 0}, pos{row, 0}, unit)
+		m.shiftColumns(row, len(unit))
+	}
+}
+
+// Outdent removes a level of indentation from the selected lines, or from
+// the cursor line if there's no selection: a tab, or up to TabWidth spaces.
+// The change can be undone. Like the keys, it doesn't edit protected text or
+// a ReadOnly textarea.
+func (m *Model) Outdent() {
+	m.beginEdit(editOther)
+	m.guard(m.outdent)
+	m.endEdit()
+	m.recalculateHeight()
+}
+
+// outdent outdents the selected lines, or the cursor line.
+func (m *Model) outdent() {
+	first, last := m.indentedRows()
+	for row := first; row <= last; row++ {
+		line := m.value.Line(row)
+		n := 0
+		for n < len(line) && n < m.tabStop() && line[n] == ' ' {
+			n++
+		}
+		if n == 0 && len(line) > 0 && line[0] == '\t' {
+			n = 1
+		}
+		if n == 0 {
+			continue
+		}
+		m.replace(pos{row, 0}, pos{row, n})
+		m.shiftColumns(row, -n)
+	}
+}
+
+// shiftColumns moves the cursor and the selection anchor on a row by n
+// columns, after n characters were inserted at the start of the row, or -n
+// deleted. Those at the start of the row stay there, so that selected lines
+// stay selected whole.
+func (m *Model) shiftColumns(row, n int) {
+	shift := func(col int) int {
+		if col == 0 {
+			return 0
+		}
+		return max(0, col+n)
+	}
+	if m.row == row {
+		m.col = shift(m.col)
+	}
+	if a := &m.selection.anchor; m.selection.active && a.row == row {
+		a.col = shift(a.col)
+	}
+}
+
+// insertTab inserts a tab, or spaces up to the next tab stop when tabs are
+// expanded.
+func (m *Model) insertTab() {
+	line := m.value.Line(m.row)
+	unit := m.indentUnit(textWidth(line[:min(m.col, len(line))], m.tabStop()))
+	m.insertRaw(unit)
+}
+
+// insertRaw inserts runes of a single line at the cursor, without sanitizing
+// them, unless the CharLimit is reached.
+func (m *Model) insertRaw(runes []rune) {
+	if m.CharLimit > 0 && m.Length()+len(runes) > m.CharLimit {
+		return
+	}
+	line := m.value.Line(m.row)
+	m.col = min(m.col, len(line))
+	m.replace(pos{m.row, m.col}, pos{m.row, m.col}, runes)
+	m.SetCursorColumn(m.col + len(runes))
+}
+
+// insertNewline splits the line at the cursor. With AutoIndent, the new line
+// gets the indentation of the line, and a newline typed between a pair of
+// brackets puts the closing one on a line of its own, below an indented one.
+func (m *Model) insertNewline() {
+	line := m.value.Line(m.row)
+	m.col = clamp(m.col, 0, len(line))
+	if !m.AutoIndent {
+		m.splitLine(m.row, m.col)
+		return
+	}
+
+	indent := slices.Clone(indentation(line[:m.col]))
+	between := m.col > 0 && m.col < len(line) && strings.ContainsRune("([{", line[m.col-1]) &&
+		m.closer(line[m.col-1]) == line[m.col]
+	// Like editors, spaces after the cursor go away with the line break.
+	tail := line[m.col:]
+	for len(tail) > 0 && (tail[0] == ' ' || tail[0] == '\t') {
+		tail = tail[1:]
+	}
+
+	lines := [][]rune{nil, indent}
+	col := len(indent)
+	if between {
+		inner := slices.Concat(indent, m.indentUnit(0))
+		lines = [][]rune{nil, inner, indent}
+		col = len(inner)
+	}
+	m.replace(pos{m.row, m.col}, pos{m.row, len(line) - len(tail)}, lines...)
+	m.row++
+	m.SetCursorColumn(col)
+}
+
+// closer returns the closing rune of an opening bracket or quote of the
+// AutoClosePairs, or 0 if r isn't one.
+func (m Model) closer(r rune) rune {
+	pairs := []rune(m.AutoClosePairs)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i] == r {
+			return pairs[i+1]
+		}
+	}
+	return 0
+}
+
+// isCloser reports whether r is a closing bracket or quote of the
+// AutoClosePairs.
+func (m Model) isCloser(r rune) bool {
+	pairs := []rune(m.AutoClosePairs)
+	for i := 1; i < len(pairs); i += 2 {
+		if pairs[i] == r {
+			return true
+		}
+	}
+	return false
+}
+
+// autoClose handles a character typed with AutoClosePairs set. Typing a
+// closing character in front of the same one moves over it, and typing an
+// opening one inserts the closing one after it, unless that would be out of
+// place, such as an apostrophe in a word. It reports whether it handled the
+// character.
+func (m *Model) autoClose(text string) bool {
+	runes := []rune(text)
+	if m.AutoClosePairs == "" || len(runes) != 1 {
+		return false
+	}
+	r := runes[0]
+	line := m.value.Line(m.row)
+	col := min(m.col, len(line))
+	var prev, next rune
+	if col > 0 {
+		prev = line[col-1]
+	}
+	if col < len(line) {
+		next = line[col]
+	}
+
+	if next == r && m.isCloser(r) {
+		m.SetCursorColumn(col + 1)
+		return true
+	}
+	closer := m.closer(r)
+	if closer == 0 {
+		return false
+	}
+	if next != 0 && next != ' ' && next != '\t' && !m.isCloser(next) {
+		return false
+	}
+	if closer == r && isWordRune(prev) {
+		// Quotes after a word, such as apostrophes, are left alone.
+		return false
+	}
+	if m.CharLimit > 0 && m.Length()+2 > m.CharLimit {
+		return false
+	}
+	m.insertRaw([]rune{r, closer})
+	m.SetCursorColumn(col + 1)
+	return true
+}
+
+// deletePair deletes an empty pair of brackets or quotes around the cursor,
+// as typed with AutoClosePairs. It reports whether there was one.
+func (m *Model) deletePair() bool {
+	line := m.value.Line(m.row)
+	col := min(m.col, len(line))
+	if m.AutoClosePairs == "" || col == 0 || col >= len(line) || m.closer(line[col-1]) != line[col] {
+		return false
+	}
+	m.replace(pos{m.row, col - 1}, pos{m.row, col + 1})
+	m.SetCursorColumn(col - 1)
+	return true
+}
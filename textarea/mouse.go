@@ -0,0 +1,162 @@
+package textarea
+
+import (
+	"time"
+	"unicode"
+
+	tea "charm.land/bubbletea/v2"
+	"github.com/haochend413/lipgloss/v2"
+)
+
+const (
+	defaultMouseWheelDelta     = 3
+	defaultDoubleClickInterval = 500 * time.Millisecond
+)
+
+// mouseDown handles a press of the left mouse button, which moves the cursor
+// to the clicked position and starts selecting text from there. With shift
+// held down, it extends the selection instead. Clicking twice on the same
+// position selects the word there.
+func (m *Model) mouseDown(msg tea.MouseClickMsg) {
+	if !m.MouseClickEnabled || msg.Button != tea.MouseLeft {
+		return
+	}
+	p := m.positionAt(msg.X, msg.Y)
+
+	now := time.Now()
+	double := m.DoubleClickInterval > 0 &&
+		p == m.selection.lastClickPos &&
+		now.Sub(m.selection.lastClick) <= m.DoubleClickInterval
+
+	switch {
+	case double:
+		m.selectWord(p)
+		// A third click starts over.
+		now = time.Time{}
+	case msg.Mod.Contains(tea.ModShift):
+		if !m.selection.active {
+			m.selection.active = true
+			m.selection.anchor = pos{m.row, m.col}
+		}
+		m.row = p.row
+		m.SetCursorColumn(p.col)
+	default:
+		m.selection.active = false
+		m.selection.anchor = p
+		m.row = p.row
+		m.SetCursorColumn(p.col)
+	}
+	m.selection.dragging = !double
+	m.selection.lastClick, m.selection.lastClickPos = now, p
+}
+
+// mouseDrag handles the motion of the mouse, which selects text while the
+// button is held down.
+func (m *Model) mouseDrag(msg tea.MouseMotionMsg) {
+	if !m.selection.dragging || msg.Button != tea.MouseLeft {
+		return
+	}
+	p := m.positionAt(msg.X, msg.Y)
+	m.row = p.row
+	m.SetCursorColumn(p.col)
+	m.selection.active = p != m.selection.anchor
+}
+
+// mouseWheel scrolls the view with the mouse wheel. The cursor moves along
+// when it would otherwise leave the view.
+func (m *Model) mouseWheel(msg tea.MouseWheelMsg) {
+	if !m.MouseWheelEnabled {
+		return
+	}
+	switch msg.Button {
+	case tea.MouseWheelUp:
+		m.setYOffset(m.yOffset - m.MouseWheelDelta)
+	case tea.MouseWheelDown:
+		m.setYOffset(m.yOffset + m.MouseWheelDelta)
+	default:
+		return
+	}
+
+	top := m.yOffset
+	bottom := top + m.height - 1
+	if line := m.cursorLineNumber(); line < top {
+		m.setCursorLineRelative(top - line)
+	} else if line > bottom {
+		m.setCursorLineRelative(bottom - line)
+	}
+}
+
+// selectWord selects the word at p, along with the blanks that follow it. On
+// a blank, it selects the run of blanks instead.
+func (m *Model) selectWord(p pos) {
+	line := m.value.Line(p.row)
+	if p.col >= len(line) {
+		m.row = p.row
+		m.SetCursorColumn(p.col)
+		m.selection.active = false
+		return
+	}
+	blank := unicode.IsSpace(line[p.col])
+	start, end := p.col, p.col
+	for start > 0 && unicode.IsSpace(line[start-1]) == blank {
+		start--
+	}
+	for end < len(line) && unicode.IsSpace(line[end]) == blank {
+		end++
+	}
+	m.selection.active = true
+	m.selection.anchor = pos{p.row, start}
+	m.row = p.row
+	m.SetCursorColumn(end)
+}
+
+// positionAt returns the position in the value shown at the given cell of
+// the view, taking soft wrapping and wide characters into account. Like the
+// position returned by [Model.Cursor], x and y are relative to the top left
+// corner of the textarea.
+func (m Model) positionAt(x, y int) pos {
+	w := lipgloss.Width
+	base := m.activeStyle().Base
+	x -= w(m.promptView(0)) +
+		m.gutterWidth() +
+		w(m.lineNumberView(0, false)) +
+		base.GetMarginLeft() +
+		base.GetPaddingLeft() +
+		base.GetBorderLeftSize()
+	y -= base.GetMarginTop() +
+		base.GetPaddingTop() +
+		base.GetBorderTopSize()
+	y += m.yOffset
+
+	if y < 0 {
+		return pos{0, 0}
+	}
+	row, y := m.findRow(y)
+	if row == m.value.Len() {
+		row--
+		return pos{row, len(m.value.Line(row))}
+	}
+	line := m.value.Line(row)
+	wrapped := m.wrapLine(line)
+	x -= m.rowIndent(line, y)
+	col := m.scrollOffset()
+	for _, l := range wrapped[:y] {
+		col += len(l)
+	}
+	// Past the end of a soft-wrapped line, the cursor stays on its last
+	// character, as the next one is on the next line.
+	last := len(wrapped[y]) - 1
+	if y == len(wrapped)-1 {
+		last = len(wrapped[y])
+	}
+	width := 0
+	for i := 0; i < len(wrapped[y]); {
+		next, w := nextChar(wrapped[y], i, width, m.tabStop())
+		width += w
+		if x < width || next > last {
+			return pos{row, min(col+i, len(line))}
+		}
+		i = next
+	}
+	return pos{row, min(col+max(0, last), len(line))}
+}
@@ -0,0 +1,197 @@
+package textarea
+
+import (
+	"slices"
+)
+
+// Range is a range of text in the value, from the character at offset Start
+// up to the one at offset End, exclusive. Offsets count the characters of
+// [Model.Value], in which lines are separated by a single newline.
+type Range struct {
+	Start, End int
+}
+
+// Protect protects a range of text from being edited: typed and pasted text
+// isn't inserted inside it, and deleting stops at its edges. The text before
+// and after it can still be edited, which moves the range along. Protected
+// text is drawn with the Protected style. Ranges are cleared when the value
+// is set or reset.
+//
+// Only the keys, paste, undo and redo are stopped. Changes that would change
+// protected text can't be undone or redone, such as setting the value before
+// protecting part of it. The methods editing the value, such as
+// [Model.InsertString] and [Model.ReplaceRange], edit protected text as
+// well, moving and shrinking the ranges to fit.
+func (m *Model) Protect(r Range) {
+	total := m.value.Total(offsetMetric) - 1
+	r.Start, r.End = clamp(r.Start, 0, total), clamp(r.End, 0, total)
+	if r.End <= r.Start {
+		return
+	}
+	m.protected = append(m.protected, r)
+	slices.SortFunc(m.protected, func(a, b Range) int { return a.Start - b.Start })
+
+	// Merge the ranges that overlap or touch.
+	merged := m.protected[:1]
+	for _, r := range m.protected[1:] {
+		last := &merged[len(merged)-1]
+		if r.Start <= last.End {
+			last.End = max(last.End, r.End)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	m.protected = merged
+}
+
+// ProtectedRanges returns the protected ranges, in order.
+func (m Model) ProtectedRanges() []Range {
+	return slices.Clone(m.protected)
+}
+
+// ClearProtected removes the protection of all ranges.
+func (m *Model) ClearProtected() {
+	m.protected = nil
+}
+
+// CanReplace reports whether the keys could replace the text from startRow
+// and startCol up to endRow and endCol, exclusive: the textarea isn't
+// ReadOnly, and the text isn't protected. Editors built on the textarea use
+// it to check their commands before running them with [Model.ReplaceRange].
+func (m Model) CanReplace(startRow, startCol, endRow, endCol int) bool {
+	if m.ReadOnly {
+		return false
+	}
+	start := m.offset(m.clampPos(pos{startRow, startCol}))
+	end := m.offset(m.clampPos(pos{endRow, endCol}))
+	return !m.violates(edit{start: min(start, end), end: max(start, end)})
+}
+
+// violates reports whether an edit changes protected text.
+func (m Model) violates(e edit) bool {
+	for _, r := range m.protected {
+		if e.start < r.End && e.end > r.Start {
+			return true
+		}
+		if e.start == e.end && r.Start < e.start && e.start < r.End {
+			// Text is inserted inside the range.
+			return true
+		}
+	}
+	return false
+}
+
+// moveProtected moves the protected ranges along with an edit. The ranges
+// after it move by the length of the text inserted or deleted, and those it
+// changes shrink to the text left of them.
+func (m *Model) moveProtected(e edit) {
+	delta := len(e.text) - (e.end - e.start)
+	ranges := m.protected[:0]
+	for _, r := range m.protected {
+		switch {
+		case r.Start >= e.end:
+			r.Start += delta
+		case r.Start > e.start:
+			r.Start = e.start + len(e.text)
+		}
+		switch {
+		case r.End >= e.end && r.End > e.start:
+			r.End += delta
+		case r.End > e.start:
+			r.End = e.start
+		}
+		if r.Start < r.End {
+			ranges = append(ranges, r)
+		}
+	}
+	m.protected = ranges
+}
+
+// guard runs an edit made by the user, such as the binding of a key. The
+// edit is undone if the textarea is ReadOnly or if it changes protected
+// text, except for deletions, which are cut short at the edge of the
+// protected text next to the cursor.
+func (m *Model) guard(f func()) {
+	if m.tracking || !m.ReadOnly && len(m.protected) == 0 {
+		m.track(f)
+		return
+	}
+	old, log := m.snapshot(), m.history.log
+	cursor := m.offset(pos{m.row, m.col})
+	m.tracking = true
+	m.edits.reset(m.value)
+	f()
+	m.tracking = false
+	steps := m.stepsSince(old.value)
+	switch {
+	case len(steps) == 0:
+		return
+	case m.ReadOnly:
+	case !m.violatesSteps(steps):
+		for _, s := range steps {
+			m.changed(s)
+		}
+		return
+	case len(steps) == 1 && len(steps[0].text) == 0:
+		if start, end := m.unprotected(steps[0].edit, cursor); start < end {
+			m.value, m.history.log = old.value, log
+			m.track(func() { m.deleteRange(m.posAt(start), m.posAt(end)) })
+			return
+		}
+	}
+	m.value, m.row = old.value, old.row
+	m.history.log = log
+	m.SetCursorColumn(old.col)
+}
+
+// violatesSteps reports whether the steps of an edit change protected text,
+// each one checked against the ranges moved along with the steps before it.
+func (m Model) violatesSteps(steps []step) bool {
+	m.protected = slices.Clone(m.protected)
+	for _, s := range steps {
+		if m.violates(s.edit) {
+			return true
+		}
+		m.moveProtected(s.edit)
+	}
+	return false
+}
+
+// unprotected returns the part of a deletion that isn't protected and that
+// is next to the cursor: before it when deleting backward, after it
+// otherwise.
+func (m Model) unprotected(e edit, cursor int) (int, int) {
+	start, end := e.start, e.end
+	for _, r := range m.protected {
+		if r.End <= e.start || r.Start >= e.end {
+			continue
+		}
+		if cursor >= e.end {
+			start = max(start, r.End)
+		} else {
+			end = min(end, r.Start)
+		}
+	}
+	return start, end
+}
+
+// protectedSpans adds the spans of the protected text of a row to spans.
+func (m Model) protectedSpans(row int, spans []Span) []Span {
+	if len(m.protected) == 0 {
+		return spans
+	}
+	start := m.value.Sum(offsetMetric, row)
+	end := start + len(m.value.Line(row))
+	style := m.activeStyle().Protected
+	for _, r := range m.protected {
+		if r.End <= start || r.Start >= end {
+			continue
+		}
+		spans = append(spans, Span{
+			Start: max(r.Start, start) - start,
+			End:   min(r.End, end) - start,
+			Style: style,
+		})
+	}
+	return spans
+}
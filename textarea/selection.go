@@ -0,0 +1,282 @@
+package textarea
+
+import (
+	"strings"
+	"time"
+
+	tea "charm.land/bubbletea/v2"
+	"github.com/atotto/clipboard"
+	"github.com/haochend413/bubbles/v2/key"
+	"github.com/haochend413/lipgloss/v2"
+	"github.com/rivo/uniseg"
+)
+
+// pos is a position in the value.
+type pos struct {
+	row, col int
+}
+
+// before reports whether p comes before q in the value.
+func (p pos) before(q pos) bool {
+	return p.row < q.row || (p.row == q.row && p.col < q.col)
+}
+
+// selection is the state of the text selected with the keyboard or the
+// mouse. The selected text spans from the anchor to the cursor.
+type selection struct {
+	// active is set while text is selected.
+	active bool
+
+	// anchor is the end of the selection opposite to the cursor.
+	anchor pos
+
+	// dragging is set while the mouse button that started a selection is
+	// held down.
+	dragging bool
+
+	// lastClick and lastClickPos are the time and position of the last
+	// click, to recognize double clicks.
+	lastClick    time.Time
+	lastClickPos pos
+}
+
+// SelectedText returns the selected text, or an empty string if there is no
+// selection.
+func (m Model) SelectedText() string {
+	start, end, ok := m.selectionRange()
+	if !ok {
+		return ""
+	}
+	return textBetween(m.value, start, end)
+}
+
+// SelectAll selects the whole value and moves the cursor to its end.
+func (m *Model) SelectAll() {
+	m.selection = selection{active: true}
+	m.row = m.value.Len() - 1
+	m.SetCursorColumn(len(m.value.Line(m.row)))
+}
+
+// ClearSelection deselects the selected text, if any.
+func (m *Model) ClearSelection() {
+	m.selection = selection{}
+}
+
+// selectionRange returns the start and end of the selected text, in order.
+// The end is exclusive.
+func (m Model) selectionRange() (pos, pos, bool) {
+	if !m.selection.active {
+		return pos{}, pos{}, false
+	}
+	start := m.selection.anchor
+	start.row = clamp(start.row, 0, m.value.Len()-1)
+	start.col = clamp(start.col, 0, len(m.value.Line(start.row)))
+	end := pos{m.row, min(m.col, len(m.value.Line(m.row)))}
+	if end.before(start) {
+		start, end = end, start
+	}
+	return start, end, start != end
+}
+
+// deleteSelection deletes the selected text and moves the cursor to where it
+// was. The extra cursors after the selection move along with the text, and
+// those inside it move to where it was. It reports whether there was any text
+// to delete.
+func (m *Model) deleteSelection() bool {
+	start, end, ok := m.selectionRange()
+	m.ClearSelection()
+	if !ok {
+		return false
+	}
+	from, to := m.offset(start), m.offset(end)
+	offsets := make([]int, len(m.cursors))
+	for i, c := range m.cursors {
+		offsets[i] = m.offset(c.pos)
+		switch {
+		case offsets[i] >= to:
+			offsets[i] -= to - from
+		case offsets[i] > from:
+			offsets[i] = from
+		}
+	}
+	m.deleteRange(start, end)
+	cursors := m.cursors
+	m.cursors = nil
+	for i, c := range cursors {
+		c.pos = m.posAt(offsets[i])
+		m.addCursor(c)
+	}
+	return true
+}
+
+// deleteRange deletes the text from start up to end and moves the cursor to
+// start.
+func (m *Model) deleteRange(start, end pos) {
+	m.replace(start, end)
+	m.row = start.row
+	m.SetCursorColumn(start.col)
+}
+
+// extendSelection runs a cursor movement, selecting the text it moves over.
+func (m *Model) extendSelection(move func()) {
+	if !m.selection.active {
+		m.selection = selection{active: true, anchor: pos{m.row, m.col}}
+	}
+	move()
+}
+
+// selectionKey handles the keys that select text and the keys that act on the
+// selection. It reports whether the key was fully handled. Other keys clear
+// the selection, and the keys that insert text replace it.
+func (m *Model) selectionKey(msg tea.KeyPressMsg) (tea.Cmd, bool) {
+	k := m.KeyMap
+	switch {
+	case key.Matches(msg, k.SelectCharacterBackward):
+		m.extendSelection(func() { m.characterLeft(false /* insideLine */) })
+	case key.Matches(msg, k.SelectCharacterForward):
+		m.extendSelection(m.characterRight)
+	case key.Matches(msg, k.SelectWordBackward):
+		m.extendSelection(m.wordLeft)
+	case key.Matches(msg, k.SelectWordForward):
+		m.extendSelection(m.wordRight)
+	case key.Matches(msg, k.SelectLinePrevious):
+		m.extendSelection(m.CursorUp)
+	case key.Matches(msg, k.SelectLineNext):
+		m.extendSelection(m.CursorDown)
+	case key.Matches(msg, k.SelectLineStart):
+		m.extendSelection(m.CursorStart)
+	case key.Matches(msg, k.SelectLineEnd):
+		m.extendSelection(m.CursorEnd)
+	case key.Matches(msg, k.SelectInputBegin):
+		m.extendSelection(m.MoveToBegin)
+	case key.Matches(msg, k.SelectInputEnd):
+		m.extendSelection(m.MoveToEnd)
+	case key.Matches(msg, k.SelectAll):
+		m.SelectAll()
+	case key.Matches(msg, k.Copy):
+		if text := m.SelectedText(); text != "" {
+			return copyToClipboard(text), true
+		}
+	case key.Matches(msg, k.Cut):
+		if text := m.SelectedText(); text != "" {
+			m.deleteSelection()
+			return copyToClipboard(text), true
+		}
+	case !m.selection.active:
+		return nil, false
+	case key.Matches(msg, k.DeleteAfterCursor, k.DeleteBeforeCursor,
+		k.DeleteCharacterBackward, k.DeleteCharacterForward,
+		k.DeleteWordBackward, k.DeleteWordForward):
+		// Deleting deletes the selection and nothing else.
+		if !m.deleteSelection() {
+			return nil, false
+		}
+	case key.Matches(msg, k.CharacterBackward, k.CharacterForward):
+		// Moving left or right moves to that end of the selection.
+		start, end, ok := m.selectionRange()
+		m.ClearSelection()
+		if !ok {
+			return nil, false
+		}
+		p := start
+		if key.Matches(msg, k.CharacterForward) {
+			p = end
+		}
+		m.row = p.row
+		m.SetCursorColumn(p.col)
+	case key.Matches(msg, k.InsertTab, k.Outdent):
+		// Tabbing indents or outdents the selected lines, which stay
+		// selected.
+		if key.Matches(msg, k.InsertTab) {
+			m.indent()
+		} else {
+			m.outdent()
+		}
+	case key.Matches(msg, k.Reflow):
+		// Reflowing reflows the paragraphs of the selected lines.
+		m.reflow()
+	case key.Matches(msg, k.InsertNewline) || m.keyInsertsText(msg):
+		m.deleteSelection()
+		return nil, false
+	default:
+		m.ClearSelection()
+		return nil, false
+	}
+	return nil, true
+}
+
+// keyInsertsText reports whether a key press types text rather than running
+// one of the bindings of [KeyMap].
+func (m Model) keyInsertsText(msg tea.KeyPressMsg) bool {
+	kind, ok := m.keyEditKind(msg)
+	return ok && kind == editTyping
+}
+
+// copyToClipboard writes text to the system clipboard.
+func copyToClipboard(text string) tea.Cmd {
+	return func() tea.Msg {
+		if err := clipboard.WriteAll(text); err != nil {
+			return copyErrMsg{err}
+		}
+		return nil
+	}
+}
+
+// renderText renders runes of the given row, starting at column col, with
+// style. Runes inside the spans of the highlighter are rendered with the
+// style of their span on top, selected runes with the selection style, and
+// runes inside the spans of the overlay with the style of the topmost one.
+// Tabs extend to the next tab stop, counting from x, the display column of
+// the first rune in its soft-wrapped row.
+func (m Model) renderText(row, col, x int, runes []rune, style lipgloss.Style, spans, overlay []Span) string {
+	tabWidth := m.tabStop()
+	start, end, selecting := m.selectionRange()
+	selecting = selecting && row >= start.row && row <= end.row
+	if !selecting && len(spans) == 0 && len(overlay) == 0 {
+		return style.Render(expandTabs(runes, x, tabWidth))
+	}
+
+	// The line break past the end of a line is selected if the selection
+	// continues on the next line.
+	n := len(m.value.Line(row))
+	selected := func(c int) bool {
+		if !selecting || c >= n && (row == end.row || c > n) {
+			return false
+		}
+		return !pos{row, c}.before(start) && pos{row, c}.before(end)
+	}
+	// Runes are rendered in runs with the same spans and selection.
+	type run struct {
+		span     int
+		selected bool
+		overlay  int
+	}
+	runAt := func(c int) run {
+		return run{spanAt(spans, c), selected(c), topSpanAt(overlay, c)}
+	}
+
+	selStyle := m.activeStyle().computedSelection()
+	var b strings.Builder
+	for i := 0; i < len(runes); {
+		r := runAt(col + i)
+		j := i + 1
+		for j < len(runes) && runAt(col+j) == r {
+			j++
+		}
+		s := style
+		if r.span >= 0 {
+			s = spans[r.span].Style.Inherit(s)
+		}
+		if r.selected {
+			s = selStyle.Inherit(s)
+		}
+		if r.overlay >= 0 {
+			s = overlay[r.overlay].Style.Inherit(s)
+		}
+		text := expandTabs(runes[i:j], x, tabWidth)
+		x += uniseg.StringWidth(text)
+		b.WriteString(s.Render(text))
+		i = j
+	}
+	return b.String()
+}
@@ -16,12 +16,13 @@ import (
 	"github.com/atotto/clipboard"
 	"github.com/charmbracelet/x/ansi"
 	"github.com/haochend413/bubbles/v2/cursor"
+	"github.com/haochend413/bubbles/v2/internal/fold"
 	"github.com/haochend413/bubbles/v2/internal/memoization"
+	"github.com/haochend413/bubbles/v2/internal/rope"
 	"github.com/haochend413/bubbles/v2/internal/runeutil"
 	"github.com/haochend413/bubbles/v2/key"
 	"github.com/haochend413/bubbles/v2/viewport"
 	"github.com/haochend413/lipgloss/v2"
-	rw "github.com/mattn/go-runewidth"
 	"github.com/rivo/uniseg"
 )
 
@@ -33,14 +34,18 @@ const (
 	defaultMaxHeight = 99
 	defaultMaxWidth  = 500
 
-	// XXX: in v2, make max lines dynamic and default max lines configurable.
-	maxLines = 10000
+	defaultHistoryLimit = 100
+
+	// cacheSize is the number of lines whose wrapping and highlighting is
+	// cached.
+	cacheSize = 10000
 )
 
 // Internal messages for clipboard operations.
 type (
 	pasteMsg    string
 	pasteErrMsg struct{ error }
+	copyErrMsg  struct{ error }
 )
 
 // KeyMap is the key bindings for different actions within the textarea.
@@ -71,6 +76,40 @@ type KeyMap struct {
 	CapitalizeWordForward key.Binding
 
 	TransposeCharacterBackward key.Binding
+
+	Undo key.Binding
+	Redo key.Binding
+
+	SelectCharacterBackward key.Binding
+	SelectCharacterForward  key.Binding
+	SelectWordBackward      key.Binding
+	SelectWordForward       key.Binding
+	SelectLinePrevious      key.Binding
+	SelectLineNext          key.Binding
+	SelectLineStart         key.Binding
+	SelectLineEnd           key.Binding
+	SelectInputBegin        key.Binding
+	SelectInputEnd          key.Binding
+	SelectAll               key.Binding
+
+	Copy key.Binding
+	Cut  key.Binding
+
+	Complete         key.Binding
+	AcceptCompletion key.Binding
+	NextCompletion   key.Binding
+	PrevCompletion   key.Binding
+	CancelCompletion key.Binding
+
+	InsertTab key.Binding
+	Outdent   key.Binding
+
+	Reflow key.Binding
+
+	AddCursorAbove            key.Binding
+	AddCursorBelow            key.Binding
+	AddCursorAtNextOccurrence key.Binding
+	ClearCursors              key.Binding
 }
 
 // DefaultKeyMap returns the default set of key bindings for navigating and acting
@@ -103,6 +142,40 @@ func DefaultKeyMap() KeyMap {
 		UppercaseWordForward:  key.NewBinding(key.WithKeys("alt+u"), key.WithHelp("alt+u", "uppercase word forward")),
 
 		TransposeCharacterBackward: key.NewBinding(key.WithKeys("ctrl+t"), key.WithHelp("ctrl+t", "transpose character backward")),
+
+		Undo: key.NewBinding(key.WithKeys("ctrl+z"), key.WithHelp("ctrl+z", "undo")),
+		Redo: key.NewBinding(key.WithKeys("ctrl+y"), key.WithHelp("ctrl+y", "redo")),
+
+		SelectCharacterBackward: key.NewBinding(key.WithKeys("shift+left"), key.WithHelp("shift+left", "select character backward")),
+		SelectCharacterForward:  key.NewBinding(key.WithKeys("shift+right"), key.WithHelp("shift+right", "select character forward")),
+		SelectWordBackward:      key.NewBinding(key.WithKeys("alt+shift+left", "ctrl+shift+left"), key.WithHelp("alt+shift+left", "select word backward")),
+		SelectWordForward:       key.NewBinding(key.WithKeys("alt+shift+right", "ctrl+shift+right"), key.WithHelp("alt+shift+right", "select word forward")),
+		SelectLinePrevious:      key.NewBinding(key.WithKeys("shift+up"), key.WithHelp("shift+up", "select to previous line")),
+		SelectLineNext:          key.NewBinding(key.WithKeys("shift+down"), key.WithHelp("shift+down", "select to next line")),
+		SelectLineStart:         key.NewBinding(key.WithKeys("shift+home"), key.WithHelp("shift+home", "select to line start")),
+		SelectLineEnd:           key.NewBinding(key.WithKeys("shift+end"), key.WithHelp("shift+end", "select to line end")),
+		SelectInputBegin:        key.NewBinding(key.WithKeys("ctrl+shift+home"), key.WithHelp("ctrl+shift+home", "select to input begin")),
+		SelectInputEnd:          key.NewBinding(key.WithKeys("ctrl+shift+end"), key.WithHelp("ctrl+shift+end", "select to input end")),
+		SelectAll:               key.NewBinding(key.WithKeys("alt+a", "ctrl+shift+a"), key.WithHelp("alt+a", "select all")),
+
+		Copy: key.NewBinding(key.WithKeys("ctrl+shift+c", "ctrl+insert"), key.WithHelp("ctrl+shift+c", "copy")),
+		Cut:  key.NewBinding(key.WithKeys("ctrl+x", "shift+delete"), key.WithHelp("ctrl+x", "cut")),
+
+		Complete:         key.NewBinding(key.WithKeys("ctrl+space"), key.WithHelp("ctrl+space", "complete")),
+		AcceptCompletion: key.NewBinding(key.WithKeys("tab", "enter"), key.WithHelp("tab", "accept completion")),
+		NextCompletion:   key.NewBinding(key.WithKeys("down", "ctrl+n"), key.WithHelp("down", "next completion")),
+		PrevCompletion:   key.NewBinding(key.WithKeys("up", "ctrl+p"), key.WithHelp("up", "previous completion")),
+		CancelCompletion: key.NewBinding(key.WithKeys("esc"), key.WithHelp("esc", "close completions")),
+
+		InsertTab: key.NewBinding(key.WithKeys("tab"), key.WithHelp("tab", "insert tab")),
+		Outdent:   key.NewBinding(key.WithKeys("shift+tab"), key.WithHelp("shift+tab", "outdent")),
+
+		Reflow: key.NewBinding(key.WithKeys("alt+q"), key.WithHelp("alt+q", "reflow paragraph")),
+
+		AddCursorAbove:            key.NewBinding(key.WithKeys("ctrl+alt+up"), key.WithHelp("ctrl+alt+up", "add cursor above")),
+		AddCursorBelow:            key.NewBinding(key.WithKeys("ctrl+alt+down"), key.WithHelp("ctrl+alt+down", "add cursor below")),
+		AddCursorAtNextOccurrence: key.NewBinding(key.WithKeys("alt+n"), key.WithHelp("alt+n", "add cursor at next occurrence")),
+		ClearCursors:              key.NewBinding(key.WithKeys("esc"), key.WithHelp("esc", "remove extra cursors")),
 	}
 }
 
@@ -197,6 +270,43 @@ type StyleState struct {
 	EndOfBuffer      lipgloss.Style
 	Placeholder      lipgloss.Style
 	Prompt           lipgloss.Style
+
+	// Selection styles the selected text.
+	Selection lipgloss.Style
+
+	// Completion styles the completion popup, and SelectedCompletion the
+	// selected completion in it.
+	Completion         lipgloss.Style
+	SelectedCompletion lipgloss.Style
+
+	// SecondaryCursor styles the cursors other than the primary one, which
+	// is drawn as usual.
+	SecondaryCursor lipgloss.Style
+
+	// WrapIndicator styles the WrapIndicator of soft-wrapped lines.
+	WrapIndicator lipgloss.Style
+
+	// Protected styles the protected text. See [Model.Protect].
+	Protected lipgloss.Style
+
+	// DiagnosticError, DiagnosticWarning, DiagnosticInfo and DiagnosticHint
+	// style the signs and messages of diagnostics, by severity.
+	DiagnosticError   lipgloss.Style
+	DiagnosticWarning lipgloss.Style
+	DiagnosticInfo    lipgloss.Style
+	DiagnosticHint    lipgloss.Style
+
+	// LineAdded, LineChanged and LineRemoved style the markers of the
+	// ChangeColumn of the gutter.
+	LineAdded   lipgloss.Style
+	LineChanged lipgloss.Style
+	LineRemoved lipgloss.Style
+
+	// FoldIndicator styles the indicators of the FoldColumn of the gutter.
+	FoldIndicator lipgloss.Style
+
+	// FoldSummary styles the number of lines hidden by closed folds.
+	FoldSummary lipgloss.Style
 }
 
 func (s StyleState) computedCursorLine() lipgloss.Style {
@@ -230,16 +340,20 @@ func (s StyleState) computedText() lipgloss.Style {
 	return s.Text.Inherit(s.Base).Inline(true)
 }
 
+func (s StyleState) computedSelection() lipgloss.Style {
+	return s.Selection.Inherit(s.Base).Inline(true)
+}
+
 // line is the input to the text wrapping function. This is stored in a struct
 // so that it can be hashed and memoized.
 type line struct {
-	runes []rune
-	width int
+	runes    []rune
+	wrapping wrapping
 }
 
 // Hash returns a hash of the line.
 func (w line) Hash() string {
-	v := fmt.Sprintf("%s:%d", string(w.runes), w.width)
+	v := fmt.Sprintf("%s:%v", string(w.runes), w.wrapping)
 	return fmt.Sprintf("%x", sha256.Sum256([]byte(v)))
 }
 
@@ -266,6 +380,11 @@ type Model struct {
 	// after the prompt.
 	ShowLineNumbers bool
 
+	// ShowDiagnosticMessages shows the message of the most severe diagnostic
+	// of the cursor line after its text, if there's room. See
+	// [Model.SetDiagnostics].
+	ShowDiagnosticMessages bool
+
 	// EndOfBufferCharacter is displayed at the end of the input.
 	EndOfBufferCharacter rune
 
@@ -304,6 +423,110 @@ type Model struct {
 	// logical lines) for backward compatibility.
 	MaxContentHeight int
 
+	// HistoryLimit is the maximum number of changes that can be undone. If 0
+	// or less, there's no limit.
+	HistoryLimit int
+
+	// MouseClickEnabled lets clicking move the cursor and dragging select
+	// text. Mouse events are expected relative to the top left corner of
+	// the textarea, like the position returned by [Model.Cursor].
+	MouseClickEnabled bool
+
+	// MouseWheelEnabled lets the mouse wheel scroll the textarea.
+	MouseWheelEnabled bool
+
+	// MouseWheelDelta is the number of lines scrolled by the mouse wheel.
+	MouseWheelDelta int
+
+	// DoubleClickInterval is the longest time between two clicks at the same
+	// position for them to be a double click, which selects a word. If 0 or
+	// less, double clicks aren't recognized.
+	DoubleClickInterval time.Duration
+
+	// SoftWrap wraps lines that are wider than the textarea, as set by
+	// WrapMode. When it's false, lines are cut off instead and the view
+	// scrolls horizontally to keep the cursor visible, as with WrapNone.
+	SoftWrap bool
+
+	// WrapMode is how lines are soft-wrapped: between words, which is the
+	// default, between characters, or not at all.
+	WrapMode WrapMode
+
+	// WrapIndicator, if set, is displayed at the start of the rows that
+	// soft-wrapped lines continue on, with the WrapIndicator style, such as
+	// "↪ ".
+	WrapIndicator string
+
+	// BreakIndent indents the rows that soft-wrapped lines continue on like
+	// the lines themselves.
+	BreakIndent bool
+
+	// HangingIndent is the number of columns that the rows soft-wrapped lines
+	// continue on are indented by, past the WrapIndicator and the indentation
+	// of BreakIndent. Continuation rows are indented by at most half the
+	// width.
+	HangingIndent int
+
+	// ReflowWidth is the width that the Reflow key hard-wraps paragraphs to.
+	// If 0 or less, it's the width of the textarea.
+	ReflowWidth int
+
+	// Overlay, if set, returns styled spans of a row drawn on top of the
+	// text, the highlighter's spans and the selection, such as the matches
+	// of a search. Later spans are drawn on top of earlier ones. Unlike
+	// those of the highlighter, its results aren't cached, so they can
+	// depend on more than the line.
+	Overlay func(row int, line []rune) []Span
+
+	// CompletionProvider, if set, provides the completions of the word
+	// before the cursor, shown in a popup under the cursor when the Complete
+	// key is pressed.
+	CompletionProvider CompletionProvider
+
+	// AutoComplete asks for completions as words are typed, without
+	// pressing the Complete key.
+	AutoComplete bool
+
+	// MaxCompletions is the number of completions shown at once in the
+	// popup. If 0 or less, up to 6 are.
+	MaxCompletions int
+
+	// TabWidth is the distance between tab stops, to which tabs extend when
+	// displayed. If 0 or less, it's 4.
+	TabWidth int
+
+	// ExpandTabs replaces the tabs of typed and pasted text with spaces, and
+	// makes the InsertTab key insert spaces up to the next tab stop. When
+	// unset, tabs are kept as they are.
+	ExpandTabs bool
+
+	// AutoIndent gives new lines the indentation of the line they're split
+	// from. A newline typed between a pair of brackets also indents the line
+	// between them.
+	AutoIndent bool
+
+	// AutoClosePairs, if set, is made of the pairs of opening and closing
+	// characters that are closed automatically when the opening one is
+	// typed, such as [DefaultAutoClosePairs]. Typing the closing one in front
+	// of it moves over it, and deleting the opening one of an empty pair
+	// deletes both.
+	AutoClosePairs string
+
+	// ReadOnly stops the keys and paste from editing the value, while the
+	// cursor can still be moved, and text selected, copied and searched.
+	// Methods such as [Model.SetValue], [Model.InsertString] and
+	// [Model.ReplaceRange] still edit it.
+	ReadOnly bool
+
+	// OnChange, if set, is called with every change of the value, whether
+	// made with the keys, by pasting, by undoing or with the methods, such
+	// as to save the value or to send its changes elsewhere. Changes are
+	// reported where they were made: an edit at several cursors is
+	// reported as a change at each, and undoing it reports the changes
+	// reverting them, in reverse. It's called from Update and from the
+	// methods, before they return.
+	OnChange func(Change)
+
 	// Styling. Styles are defined in [Styles]. Use [SetStyles] and [GetStyles]
 	// to work with this value publicly.
 	styles Styles
@@ -320,6 +543,20 @@ type Model struct {
 	// promptWidth is the width of the prompt.
 	promptWidth int
 
+	// gutter holds the columns of the gutter. Use [Model.SetGutter] to set
+	// them.
+	gutter []GutterColumn
+
+	// diagnostics, lineChanges and foldIndicators are what the gutter shows
+	// for each row.
+	diagnostics    map[int][]Diagnostic
+	lineChanges    map[int]LineChange
+	foldIndicators map[int]FoldState
+
+	// digits is the number of digits of the line numbers that width leaves
+	// room for.
+	digits int
+
 	// width is the maximum number of characters that can be displayed at once.
 	// If 0 or less this setting is ignored.
 	width int
@@ -329,8 +566,8 @@ type Model struct {
 	// if there are more lines than the permitted height.
 	height int
 
-	// Underlying text value.
-	value [][]rune
+	// Underlying text value, one line per element of the rope.
+	value rope.Rope
 
 	// focus indicates whether user input focus should be on this input
 	// component. When false, ignore keyboard input and hide the cursor.
@@ -342,6 +579,13 @@ type Model struct {
 	// Cursor row.
 	row int
 
+	// yOffset is the visual line shown at the top of the text area, counting
+	// soft-wrapped lines.
+	yOffset int
+
+	// xOffset is the first column shown when lines aren't soft wrapped.
+	xOffset int
+
 	// Last character offset, used to maintain state when the cursor is moved
 	// vertically such that we can maintain the same navigating position.
 	lastCharOffset int
@@ -350,32 +594,73 @@ type Model struct {
 	// input.
 	viewport *viewport.Model
 
-	// rune sanitizer for input.
-	rsan runeutil.Sanitizer
+	// rune sanitizer for input, and what it replaces tabs with.
+	rsan     runeutil.Sanitizer
+	rsanTabs string
+
+	// history holds the changes that can be undone and redone.
+	history history
+
+	// cursors are the cursors besides the primary one, in the order they
+	// were added.
+	cursors []extraCursor
+
+	// selection holds the selected text.
+	selection selection
+
+	// completion is the state of the completion popup.
+	completion completion
+
+	// protected holds the ranges of text that the keys can't edit, in order.
+	protected []Range
+
+	// folds holds the folds, sorted with fold.Sort.
+	folds []fold.Fold
+
+	// tracking is set while an edit is tracked, to report the edits it's
+	// made of. edits records them.
+	tracking bool
+	edits    editLog
+
+	// highlighter styles the text, if set. Use [Model.SetHighlighter] to set
+	// it. highlightCache holds its results.
+	highlighter    Highlighter
+	highlightCache *memoization.MemoCache[highlightInput, highlighted]
 }
 
 // New creates a new model with default settings.
 func New() Model {
 	vp := viewport.New()
 	vp.KeyMap = viewport.KeyMap{}
+	// The textarea scrolls with the mouse wheel itself, moving the cursor
+	// along.
+	vp.MouseWheelEnabled = false
 	cur := cursor.New()
 
 	styles := DefaultDarkStyles()
 
 	m := Model{
-		CharLimit:            defaultCharLimit,
-		MaxHeight:            defaultMaxHeight,
-		MaxWidth:             defaultMaxWidth,
-		Prompt:               lipgloss.ThickBorder().Left + " ",
-		styles:               styles,
-		cache:                memoization.NewMemoCache[line, [][]rune](maxLines),
-		EndOfBufferCharacter: ' ',
-		ShowLineNumbers:      true,
-		useVirtualCursor:     true,
-		virtualCursor:        cur,
-		KeyMap:               DefaultKeyMap(),
-
-		value: make([][]rune, minHeight, maxLines),
+		CharLimit:              defaultCharLimit,
+		MaxHeight:              defaultMaxHeight,
+		MaxWidth:               defaultMaxWidth,
+		HistoryLimit:           defaultHistoryLimit,
+		MouseClickEnabled:      true,
+		MouseWheelEnabled:      true,
+		MouseWheelDelta:        defaultMouseWheelDelta,
+		DoubleClickInterval:    defaultDoubleClickInterval,
+		SoftWrap:               true,
+		ExpandTabs:             true,
+		Prompt:                 lipgloss.ThickBorder().Left + " ",
+		styles:                 styles,
+		cache:                  memoization.NewMemoCache[line, [][]rune](cacheSize),
+		EndOfBufferCharacter:   ' ',
+		ShowLineNumbers:        true,
+		ShowDiagnosticMessages: true,
+		useVirtualCursor:       true,
+		virtualCursor:          cur,
+		KeyMap:                 DefaultKeyMap(),
+
+		value: rope.New(make([][]rune, minHeight)...),
 		focus: false,
 		col:   0,
 		row:   0,
@@ -396,24 +681,54 @@ func DefaultStyles(isDark bool) Styles {
 
 	var s Styles
 	s.Focused = StyleState{
-		Base:             lipgloss.NewStyle(),
-		CursorLine:       lipgloss.NewStyle().Background(lightDark(lipgloss.Color("255"), lipgloss.Color("0"))),
-		CursorLineNumber: lipgloss.NewStyle().Foreground(lightDark(lipgloss.Color("240"), lipgloss.Color("240"))),
-		EndOfBuffer:      lipgloss.NewStyle().Foreground(lightDark(lipgloss.Color("254"), lipgloss.Color("0"))),
-		LineNumber:       lipgloss.NewStyle().Foreground(lightDark(lipgloss.Color("249"), lipgloss.Color("7"))),
-		Placeholder:      lipgloss.NewStyle().Foreground(lipgloss.Color("240")),
-		Prompt:           lipgloss.NewStyle().Foreground(lipgloss.Color("7")),
-		Text:             lipgloss.NewStyle(),
+		Base:               lipgloss.NewStyle(),
+		CursorLine:         lipgloss.NewStyle().Background(lightDark(lipgloss.Color("255"), lipgloss.Color("0"))),
+		CursorLineNumber:   lipgloss.NewStyle().Foreground(lightDark(lipgloss.Color("240"), lipgloss.Color("240"))),
+		EndOfBuffer:        lipgloss.NewStyle().Foreground(lightDark(lipgloss.Color("254"), lipgloss.Color("0"))),
+		LineNumber:         lipgloss.NewStyle().Foreground(lightDark(lipgloss.Color("249"), lipgloss.Color("7"))),
+		Placeholder:        lipgloss.NewStyle().Foreground(lipgloss.Color("240")),
+		Prompt:             lipgloss.NewStyle().Foreground(lipgloss.Color("7")),
+		Text:               lipgloss.NewStyle(),
+		Selection:          lipgloss.NewStyle().Background(lightDark(lipgloss.Color("252"), lipgloss.Color("238"))),
+		Completion:         lipgloss.NewStyle().Foreground(lightDark(lipgloss.Color("235"), lipgloss.Color("252"))).Background(lightDark(lipgloss.Color("254"), lipgloss.Color("236"))),
+		SelectedCompletion: lipgloss.NewStyle().Foreground(lipgloss.Color("230")).Background(lipgloss.Color("62")),
+		SecondaryCursor:    lipgloss.NewStyle().Reverse(true),
+		WrapIndicator:      lipgloss.NewStyle().Foreground(lipgloss.Color("240")),
+		Protected:          lipgloss.NewStyle().Foreground(lightDark(lipgloss.Color("243"), lipgloss.Color("246"))),
+		DiagnosticError:    lipgloss.NewStyle().Foreground(lightDark(lipgloss.Color("1"), lipgloss.Color("9"))),
+		DiagnosticWarning:  lipgloss.NewStyle().Foreground(lightDark(lipgloss.Color("3"), lipgloss.Color("11"))),
+		DiagnosticInfo:     lipgloss.NewStyle().Foreground(lightDark(lipgloss.Color("4"), lipgloss.Color("12"))),
+		DiagnosticHint:     lipgloss.NewStyle().Foreground(lipgloss.Color("244")),
+		LineAdded:          lipgloss.NewStyle().Foreground(lightDark(lipgloss.Color("2"), lipgloss.Color("10"))),
+		LineChanged:        lipgloss.NewStyle().Foreground(lightDark(lipgloss.Color("4"), lipgloss.Color("12"))),
+		LineRemoved:        lipgloss.NewStyle().Foreground(lightDark(lipgloss.Color("1"), lipgloss.Color("9"))),
+		FoldIndicator:      lipgloss.NewStyle().Foreground(lipgloss.Color("240")),
+		FoldSummary:        lipgloss.NewStyle().Foreground(lipgloss.Color("240")),
 	}
 	s.Blurred = StyleState{
-		Base:             lipgloss.NewStyle(),
-		CursorLine:       lipgloss.NewStyle().Foreground(lightDark(lipgloss.Color("245"), lipgloss.Color("7"))),
-		CursorLineNumber: lipgloss.NewStyle().Foreground(lightDark(lipgloss.Color("249"), lipgloss.Color("7"))),
-		EndOfBuffer:      lipgloss.NewStyle().Foreground(lightDark(lipgloss.Color("254"), lipgloss.Color("0"))),
-		LineNumber:       lipgloss.NewStyle().Foreground(lightDark(lipgloss.Color("249"), lipgloss.Color("7"))),
-		Placeholder:      lipgloss.NewStyle().Foreground(lipgloss.Color("240")),
-		Prompt:           lipgloss.NewStyle().Foreground(lipgloss.Color("7")),
-		Text:             lipgloss.NewStyle().Foreground(lightDark(lipgloss.Color("245"), lipgloss.Color("7"))),
+		Base:               lipgloss.NewStyle(),
+		CursorLine:         lipgloss.NewStyle().Foreground(lightDark(lipgloss.Color("245"), lipgloss.Color("7"))),
+		CursorLineNumber:   lipgloss.NewStyle().Foreground(lightDark(lipgloss.Color("249"), lipgloss.Color("7"))),
+		EndOfBuffer:        lipgloss.NewStyle().Foreground(lightDark(lipgloss.Color("254"), lipgloss.Color("0"))),
+		LineNumber:         lipgloss.NewStyle().Foreground(lightDark(lipgloss.Color("249"), lipgloss.Color("7"))),
+		Placeholder:        lipgloss.NewStyle().Foreground(lipgloss.Color("240")),
+		Prompt:             lipgloss.NewStyle().Foreground(lipgloss.Color("7")),
+		Text:               lipgloss.NewStyle().Foreground(lightDark(lipgloss.Color("245"), lipgloss.Color("7"))),
+		Selection:          lipgloss.NewStyle().Background(lightDark(lipgloss.Color("252"), lipgloss.Color("238"))),
+		Completion:         lipgloss.NewStyle().Foreground(lightDark(lipgloss.Color("235"), lipgloss.Color("252"))).Background(lightDark(lipgloss.Color("254"), lipgloss.Color("236"))),
+		SelectedCompletion: lipgloss.NewStyle().Foreground(lipgloss.Color("230")).Background(lipgloss.Color("62")),
+		SecondaryCursor:    lipgloss.NewStyle().Reverse(true),
+		WrapIndicator:      lipgloss.NewStyle().Foreground(lipgloss.Color("240")),
+		Protected:          lipgloss.NewStyle().Foreground(lightDark(lipgloss.Color("243"), lipgloss.Color("246"))),
+		DiagnosticError:    lipgloss.NewStyle().Foreground(lightDark(lipgloss.Color("1"), lipgloss.Color("9"))),
+		DiagnosticWarning:  lipgloss.NewStyle().Foreground(lightDark(lipgloss.Color("3"), lipgloss.Color("11"))),
+		DiagnosticInfo:     lipgloss.NewStyle().Foreground(lightDark(lipgloss.Color("4"), lipgloss.Color("12"))),
+		DiagnosticHint:     lipgloss.NewStyle().Foreground(lipgloss.Color("244")),
+		LineAdded:          lipgloss.NewStyle().Foreground(lightDark(lipgloss.Color("2"), lipgloss.Color("10"))),
+		LineChanged:        lipgloss.NewStyle().Foreground(lightDark(lipgloss.Color("4"), lipgloss.Color("12"))),
+		LineRemoved:        lipgloss.NewStyle().Foreground(lightDark(lipgloss.Color("1"), lipgloss.Color("9"))),
+		FoldIndicator:      lipgloss.NewStyle().Foreground(lipgloss.Color("240")),
+		FoldSummary:        lipgloss.NewStyle().Foreground(lipgloss.Color("240")),
 	}
 	s.Cursor = CursorStyle{
 		Color: lipgloss.Color("7"),
@@ -477,22 +792,35 @@ func (m *Model) updateVirtualCursorStyle() {
 	m.virtualCursor.SetMode(cursor.CursorStatic)
 }
 
-// SetValue sets the value of the text input.
+// SetValue sets the value of the text input. The change can be undone.
 func (m *Model) SetValue(s string) {
-	m.Reset()
-	m.InsertString(s)
+	m.beginEdit(editOther)
+	m.track(func() {
+		m.Reset()
+		m.insertRunesFromUserInput([]rune(s))
+	})
+	m.endEdit()
+	m.fitLineNumbers()
 	m.recalculateHeight()
 }
 
-// InsertString inserts a string at the cursor position.
+// InsertString inserts a string at the cursor position. The change can be
+// undone.
 func (m *Model) InsertString(s string) {
-	m.insertRunesFromUserInput([]rune(s))
+	m.beginEdit(editOther)
+	m.track(func() { m.insertRunesFromUserInput([]rune(s)) })
+	m.endEdit()
+	m.fitLineNumbers()
 	m.recalculateHeight()
 }
 
-// InsertRune inserts a rune at the cursor position.
+// InsertRune inserts a rune at the cursor position. Like typed characters,
+// runes inserted one after the other are undone together.
 func (m *Model) InsertRune(r rune) {
-	m.insertRunesFromUserInput([]rune{r})
+	m.beginEdit(editTyping)
+	m.track(func() { m.insertRunesFromUserInput([]rune{r}) })
+	m.endEdit()
+	m.fitLineNumbers()
 	m.recalculateHeight()
 }
 
@@ -535,12 +863,6 @@ func (m *Model) insertRunesFromUserInput(runes []rune) {
 		lines = append(lines, runes[lstart:])
 	}
 
-	// Obey the maximum line limit.
-	if maxLines > 0 && len(m.value)+len(lines)-1 > maxLines {
-		allowedHeight := max(0, maxLines-len(m.value)+1)
-		lines = lines[:allowedHeight]
-	}
-
 	// Obey MaxContentHeight in visual rows when set.
 	if m.MaxContentHeight > 0 {
 		budget := m.MaxContentHeight - m.totalVisualLines()
@@ -558,53 +880,28 @@ func (m *Model) insertRunesFromUserInput(runes []rune) {
 		return
 	}
 
-	// Save the remainder of the original line at the current
-	// cursor position.
-	tail := make([]rune, len(m.value[m.row][m.col:]))
-	copy(tail, m.value[m.row][m.col:])
-
-	// Paste the first line at the current cursor position.
-	m.value[m.row] = append(m.value[m.row][:m.col], lines[0]...)
-	m.col += len(lines[0])
-
-	if numExtraLines := len(lines) - 1; numExtraLines > 0 {
-		// Add the new lines.
-		// We try to reuse the slice if there's already space.
-		var newGrid [][]rune
-		if cap(m.value) >= len(m.value)+numExtraLines {
-			// Can reuse the extra space.
-			newGrid = m.value[:len(m.value)+numExtraLines]
-		} else {
-			// No space left; need a new slice.
-			newGrid = make([][]rune, len(m.value)+numExtraLines)
-			copy(newGrid, m.value[:m.row+1])
-		}
-		// Add all the rows that were after the cursor in the original
-		// grid at the end of the new grid.
-		copy(newGrid[m.row+1+numExtraLines:], m.value[m.row+1:])
-		m.value = newGrid
-		// Insert all the new lines in the middle.
-		for _, l := range lines[1:] {
-			m.row++
-			m.value[m.row] = l
-			m.col = len(l)
-		}
+	// Paste the first line at the current cursor position, and the
+	// remainder of the original line after the last one.
+	m.col = clamp(m.col, 0, len(m.value.Line(m.row)))
+	last := len(lines) - 1
+	col := len(lines[last])
+	if last == 0 {
+		col += m.col
 	}
+	m.replace(pos{m.row, m.col}, pos{m.row, m.col}, lines...)
+	m.row += last
 
-	// Finally add the tail at the end of the last line inserted.
-	m.value[m.row] = append(m.value[m.row], tail...)
-
-	m.SetCursorColumn(m.col)
+	m.SetCursorColumn(col)
 }
 
 // Value returns the value of the text input.
 func (m Model) Value() string {
-	if m.value == nil {
+	if m.value.Len() == 0 {
 		return ""
 	}
 
 	var v strings.Builder
-	for _, l := range m.value {
+	for _, l := range m.value.Lines(0) {
 		v.WriteString(string(l))
 		v.WriteByte('\n')
 	}
@@ -614,17 +911,49 @@ func (m Model) Value() string {
 
 // Length returns the number of characters currently in the text input.
 func (m *Model) Length() int {
-	var l int
-	for _, row := range m.value {
-		l += uniseg.StringWidth(string(row))
-	}
-	// We add len(m.value) to include the newline characters.
-	return l + len(m.value) - 1
+	// We add the number of lines to include the newline characters.
+	return m.value.Total(lengthMetric) + m.value.Len() - 1
 }
 
 // LineCount returns the number of lines that are currently in the text input.
 func (m *Model) LineCount() int {
-	return len(m.value)
+	return m.value.Len()
+}
+
+// RuneCount returns the number of runes of the value, including the line
+// breaks, like counting the runes of [Model.Value] without building it.
+func (m *Model) RuneCount() int {
+	return max(0, m.value.Total(offsetMetric)-1)
+}
+
+// WordCount returns the number of words of the value, separated by white
+// space, like counting the [strings.Fields] of [Model.Value] without building
+// it. The words of each line are counted once and cached, so that only the
+// lines that changed are counted again.
+func (m *Model) WordCount() int {
+	return m.value.Total(wordMetric)
+}
+
+// Snapshot is the value of a textarea at some point, taken by
+// [Model.Snapshot] without copying it.
+type Snapshot struct {
+	value rope.Rope
+}
+
+// Snapshot returns the current value, to tell later whether it changed with
+// [Model.ChangedSince], such as since it was saved.
+func (m Model) Snapshot() Snapshot {
+	return Snapshot{m.value}
+}
+
+// ChangedSince reports whether the value differs from a snapshot. The zero
+// Snapshot is an empty value. The parts of the value that weren't edited
+// since the snapshot are compared in constant time.
+func (m Model) ChangedSince(s Snapshot) bool {
+	if s.value.Len() == 0 {
+		return m.value.Len() > 1 || m.value.Len() == 1 && len(m.value.Line(0)) > 0
+	}
+	return !rope.Equal(m.value, s.value)
 }
 
 // Line returns the 0-indexed row position of the cursor.
@@ -640,13 +969,17 @@ func (m Model) Column() int {
 // ScrollYOffset returns the Y offset (top row) index of the current view, which
 // can be used to calculate the current scroll position.
 func (m Model) ScrollYOffset() int {
-	return m.viewport.YOffset()
+	return m.yOffset
 }
 
 // ScrollPercent returns the amount of the textarea that is currently scrolled
 // through, clamped between 0 and 1.
 func (m Model) ScrollPercent() float64 {
-	return m.viewport.ScrollPercent()
+	maxOffset := m.maxYOffset()
+	if maxOffset == 0 {
+		return 1
+	}
+	return min(float64(m.yOffset)/float64(maxOffset), 1)
 }
 
 // setCursorLineRelative moves the cursor by the given number of lines. Negative
@@ -656,22 +989,21 @@ func (m *Model) setCursorLineRelative(delta int) {
 		return
 	}
 
+	// The offset of the cursor counts the indentation of continuation rows,
+	// so that it stays in the same display column.
 	li := m.LineInfo()
-	charOffset := max(m.lastCharOffset, li.CharOffset)
+	charOffset := max(m.lastCharOffset, li.CharOffset+m.rowIndent(m.value.Line(m.row), li.RowOffset))
 	m.lastCharOffset = charOffset
 
-	// 2 columns to account for the trailing space wrapping.
-	const trailingSpace = 2
-
 	if delta > 0 { //nolint:nestif
 		// Moving down.
 		for range delta {
-			if li.RowOffset+1 >= li.Height && m.row < len(m.value)-1 {
-				m.row++
+			if next := m.nextRow(m.row); li.RowOffset+1 >= li.Height && next < m.value.Len() {
+				m.row = next
 				m.col = 0
 			} else {
 				// Move the cursor to the start of the next virtual line.
-				m.col = min(li.StartColumn+li.Width+trailingSpace, len(m.value[m.row])-1)
+				m.col = min(li.StartColumn+li.Width, len(m.value.Line(m.row)))
 			}
 			li = m.LineInfo()
 		}
@@ -679,11 +1011,11 @@ func (m *Model) setCursorLineRelative(delta int) {
 		// Moving up.
 		for range -delta {
 			if li.RowOffset <= 0 && m.row > 0 {
-				m.row--
-				m.col = len(m.value[m.row])
+				m.row = m.prevRow(m.row)
+				m.col = len(m.value.Line(m.row))
 			} else {
 				// Move the cursor to the end of the previous line.
-				m.col = li.StartColumn - trailingSpace
+				m.col = li.StartColumn - 1
 			}
 			li = m.LineInfo()
 		}
@@ -697,13 +1029,16 @@ func (m *Model) setCursorLineRelative(delta int) {
 		return
 	}
 
+	line := m.value.Line(m.row)
 	offset := 0
+	charOffset -= m.rowIndent(line, nli.RowOffset)
 	for offset < charOffset {
-		if m.row >= len(m.value) || m.col >= len(m.value[m.row]) || offset >= nli.CharWidth-1 {
+		if m.col >= len(line) || offset >= nli.CharWidth-1 {
 			break
 		}
-		offset += rw.RuneWidth(m.value[m.row][m.col])
-		m.col++
+		next, w := nextChar(line, m.col, offset, m.tabStop())
+		offset += w
+		m.col = next
 	}
 	m.repositionView()
 }
@@ -721,12 +1056,70 @@ func (m *Model) CursorUp() {
 // SetCursorColumn moves the cursor to the given position. If the position is
 // out of bounds the cursor will be moved to the start or end accordingly.
 func (m *Model) SetCursorColumn(col int) {
-	m.col = clamp(col, 0, len(m.value[m.row]))
+	m.col = clamp(col, 0, len(m.value.Line(m.row)))
 	// Any time that we move the cursor horizontally we need to reset the last
 	// offset so that the horizontal position when navigating is adjusted.
 	m.lastCharOffset = 0
 }
 
+// SetCursor moves the cursor to the given row and column. Positions out of
+// bounds are clamped to the value.
+func (m *Model) SetCursor(row, col int) {
+	m.row = clamp(row, 0, m.value.Len()-1)
+	m.SetCursorColumn(col)
+	m.revealCursor()
+	m.repositionView()
+}
+
+// LineRunes returns the characters of the given row, or nil if there is no
+// such row. The returned slice must not be modified.
+func (m Model) LineRunes(row int) []rune {
+	if row < 0 || row >= m.value.Len() {
+		return nil
+	}
+	return m.value.Line(row)
+}
+
+// ReplaceRange replaces the text from startRow and startCol up to endRow and
+// endCol, exclusive, with text, whose lines are separated by newlines. Unlike
+// typed or inserted text, the text is inserted as is: it's not sanitized and
+// neither CharLimit nor MaxContentHeight apply. The cursor moves to the end of
+// the inserted text. The change can be undone.
+func (m *Model) ReplaceRange(startRow, startCol, endRow, endCol int, text string) {
+	start := m.clampPos(pos{startRow, startCol})
+	end := m.clampPos(pos{endRow, endCol})
+	if end.before(start) {
+		start, end = end, start
+	}
+
+	var lines [][]rune
+	for l := range strings.SplitSeq(text, "\n") {
+		lines = append(lines, []rune(l))
+	}
+	last := len(lines) - 1
+	col := len(lines[last])
+
+	m.beginEdit(editOther)
+	m.ClearSelection()
+	m.track(func() { m.replace(start, end, lines...) })
+	m.row = start.row + last
+	if last == 0 {
+		col += start.col
+	}
+	m.SetCursorColumn(col)
+	m.endEdit()
+	m.fitLineNumbers()
+	m.recalculateHeight()
+	m.repositionView()
+}
+
+// clampPos returns the position in the value closest to p.
+func (m Model) clampPos(p pos) pos {
+	p.row = clamp(p.row, 0, m.value.Len()-1)
+	p.col = clamp(p.col, 0, len(m.value.Line(p.row)))
+	return p
+}
+
 // CursorStart moves the cursor to the start of the input field.
 func (m *Model) CursorStart() {
 	m.SetCursorColumn(0)
@@ -734,7 +1127,7 @@ func (m *Model) CursorStart() {
 
 // CursorEnd moves the cursor to the end of the input field.
 func (m *Model) CursorEnd() {
-	m.SetCursorColumn(len(m.value[m.row]))
+	m.SetCursorColumn(len(m.value.Line(m.row)))
 }
 
 // Focused returns the focus state on the model.
@@ -767,18 +1160,23 @@ func (m *Model) Blur() {
 
 // Reset sets the input to its default state with no input.
 func (m *Model) Reset() {
-	m.value = make([][]rune, minHeight, maxLines)
+	m.track(func() { m.value = rope.New(make([][]rune, minHeight)...) })
+	m.protected = nil
+	m.folds = nil
 	m.col = 0
 	m.row = 0
-	m.viewport.GotoTop()
+	m.yOffset = 0
 	m.SetCursorColumn(0)
+	m.ClearSelection()
+	m.ClearCursors()
+	m.fitLineNumbers()
 	m.recalculateHeight()
 }
 
 // Word returns the word at the cursor position.
 // A word is delimited by spaces or line-breaks.
 func (m *Model) Word() string {
-	line := m.value[m.row]
+	line := m.value.Line(m.row)
 	col := m.col - 1
 
 	if col < 0 {
@@ -812,10 +1210,15 @@ func (m *Model) Word() string {
 
 // san initializes or retrieves the rune sanitizer.
 func (m *Model) san() runeutil.Sanitizer {
-	if m.rsan == nil {
-		// Textinput has all its input on a single line so collapse
-		// newlines/tabs to single spaces.
-		m.rsan = runeutil.NewSanitizer()
+	// Tabs are kept, or replaced with as many spaces as there are between
+	// tab stops.
+	tabs := "\t"
+	if m.ExpandTabs {
+		tabs = strings.Repeat(" ", m.tabStop())
+	}
+	if m.rsan == nil || m.rsanTabs != tabs {
+		m.rsan = runeutil.NewSanitizer(runeutil.ReplaceTabs(tabs))
+		m.rsanTabs = tabs
 	}
 	return m.rsan
 }
@@ -823,7 +1226,7 @@ func (m *Model) san() runeutil.Sanitizer {
 // deleteBeforeCursor deletes all text before the cursor. Returns whether or
 // not the cursor blink should be reset.
 func (m *Model) deleteBeforeCursor() {
-	m.value[m.row] = m.value[m.row][m.col:]
+	m.replace(pos{m.row, 0}, pos{m.row, m.col})
 	m.SetCursorColumn(0)
 }
 
@@ -831,31 +1234,35 @@ func (m *Model) deleteBeforeCursor() {
 // the cursor blink should be reset. If input is masked delete everything after
 // the cursor so as not to reveal word breaks in the masked input.
 func (m *Model) deleteAfterCursor() {
-	m.value[m.row] = m.value[m.row][:m.col]
-	m.SetCursorColumn(len(m.value[m.row]))
+	m.replace(pos{m.row, m.col}, pos{m.row, len(m.value.Line(m.row))})
+	m.SetCursorColumn(m.col)
 }
 
-// transposeLeft exchanges the runes at the cursor and immediately
+// transposeLeft exchanges the characters at the cursor and immediately
 // before. No-op if the cursor is at the beginning of the line.  If
 // the cursor is not at the end of the line yet, moves the cursor to
 // the right.
 func (m *Model) transposeLeft() {
-	if m.col == 0 || len(m.value[m.row]) < 2 {
+	line := m.value.Line(m.row)
+	if m.col == 0 || len(line) < 2 {
 		return
 	}
-	if m.col >= len(m.value[m.row]) {
-		m.SetCursorColumn(m.col - 1)
-	}
-	m.value[m.row][m.col-1], m.value[m.row][m.col] = m.value[m.row][m.col], m.value[m.row][m.col-1]
-	if m.col < len(m.value[m.row]) {
-		m.SetCursorColumn(m.col + 1)
+	if m.col >= len(line) {
+		m.SetCursorColumn(runeutil.PrevGrapheme(line, m.col))
+		if m.col == 0 {
+			return
+		}
 	}
+	prev, next := runeutil.PrevGrapheme(line, m.col), runeutil.NextGrapheme(line, m.col)
+	m.setLines(m.row, m.row+1, slices.Concat(line[:prev], line[m.col:next], line[prev:m.col], line[next:]))
+	m.SetCursorColumn(next)
 }
 
 // deleteWordLeft deletes the word left to the cursor. Returns whether or not
 // the cursor blink should be reset.
 func (m *Model) deleteWordLeft() {
-	if m.col == 0 || len(m.value[m.row]) == 0 {
+	line := m.value.Line(m.row)
+	if m.col == 0 || len(line) == 0 {
 		return
 	}
 
@@ -865,7 +1272,7 @@ func (m *Model) deleteWordLeft() {
 	oldCol := m.col
 
 	m.SetCursorColumn(m.col - 1)
-	for unicode.IsSpace(m.value[m.row][m.col]) {
+	for unicode.IsSpace(line[m.col]) {
 		if m.col <= 0 {
 			break
 		}
@@ -874,7 +1281,7 @@ func (m *Model) deleteWordLeft() {
 	}
 
 	for m.col > 0 {
-		if !unicode.IsSpace(m.value[m.row][m.col]) {
+		if !unicode.IsSpace(line[m.col]) {
 			m.SetCursorColumn(m.col - 1)
 		} else {
 			if m.col > 0 {
@@ -885,49 +1292,42 @@ func (m *Model) deleteWordLeft() {
 		}
 	}
 
-	if oldCol > len(m.value[m.row]) {
-		m.value[m.row] = m.value[m.row][:m.col]
-	} else {
-		m.value[m.row] = append(m.value[m.row][:m.col], m.value[m.row][oldCol:]...)
-	}
+	m.replace(pos{m.row, m.col}, pos{m.row, min(oldCol, len(line))})
 }
 
 // deleteWordRight deletes the word right to the cursor.
 func (m *Model) deleteWordRight() {
-	if m.col >= len(m.value[m.row]) || len(m.value[m.row]) == 0 {
+	line := m.value.Line(m.row)
+	if m.col >= len(line) || len(line) == 0 {
 		return
 	}
 
 	oldCol := m.col
 
-	for m.col < len(m.value[m.row]) && unicode.IsSpace(m.value[m.row][m.col]) {
+	for m.col < len(line) && unicode.IsSpace(line[m.col]) {
 		// ignore series of whitespace after cursor
 		m.SetCursorColumn(m.col + 1)
 	}
 
-	for m.col < len(m.value[m.row]) {
-		if !unicode.IsSpace(m.value[m.row][m.col]) {
+	for m.col < len(line) {
+		if !unicode.IsSpace(line[m.col]) {
 			m.SetCursorColumn(m.col + 1)
 		} else {
 			break
 		}
 	}
 
-	if m.col > len(m.value[m.row]) {
-		m.value[m.row] = m.value[m.row][:oldCol]
-	} else {
-		m.value[m.row] = append(m.value[m.row][:oldCol], m.value[m.row][m.col:]...)
-	}
+	m.replace(pos{m.row, oldCol}, pos{m.row, min(m.col, len(line))})
 
 	m.SetCursorColumn(oldCol)
 }
 
 // characterRight moves the cursor one character to the right.
 func (m *Model) characterRight() {
-	if m.col < len(m.value[m.row]) {
-		m.SetCursorColumn(m.col + 1)
+	if line := m.value.Line(m.row); m.col < len(line) {
+		m.SetCursorColumn(runeutil.NextGrapheme(line, m.col))
 	} else {
-		if m.row < len(m.value)-1 {
+		if m.row < m.value.Len()-1 {
 			m.row++
 			m.CursorStart()
 		}
@@ -946,7 +1346,7 @@ func (m *Model) characterLeft(insideLine bool) {
 		}
 	}
 	if m.col > 0 {
-		m.SetCursorColumn(m.col - 1)
+		m.SetCursorColumn(runeutil.PrevGrapheme(m.value.Line(m.row), m.col))
 	}
 }
 
@@ -956,13 +1356,14 @@ func (m *Model) characterLeft(insideLine bool) {
 func (m *Model) wordLeft() {
 	for {
 		m.characterLeft(true /* insideLine */)
-		if m.col < len(m.value[m.row]) && !unicode.IsSpace(m.value[m.row][m.col]) {
+		if line := m.value.Line(m.row); m.col < len(line) && !unicode.IsSpace(line[m.col]) {
 			break
 		}
 	}
 
+	line := m.value.Line(m.row)
 	for m.col > 0 {
-		if unicode.IsSpace(m.value[m.row][m.col-1]) {
+		if unicode.IsSpace(line[m.col-1]) {
 			break
 		}
 		m.SetCursorColumn(m.col - 1)
@@ -978,8 +1379,8 @@ func (m *Model) wordRight() {
 
 func (m *Model) doWordRight(fn func(charIdx int, pos int)) {
 	// Skip spaces forward.
-	for m.col >= len(m.value[m.row]) || unicode.IsSpace(m.value[m.row][m.col]) {
-		if m.row == len(m.value)-1 && m.col == len(m.value[m.row]) {
+	for line := m.value.Line(m.row); m.col >= len(line) || unicode.IsSpace(line[m.col]); line = m.value.Line(m.row) {
+		if m.row == m.value.Len()-1 && m.col == len(line) {
 			// End of text.
 			break
 		}
@@ -987,8 +1388,9 @@ func (m *Model) doWordRight(fn func(charIdx int, pos int)) {
 	}
 
 	charIdx := 0
-	for m.col < len(m.value[m.row]) {
-		if unicode.IsSpace(m.value[m.row][m.col]) {
+	line := m.value.Line(m.row)
+	for m.col < len(line) {
+		if unicode.IsSpace(line[m.col]) {
 			break
 		}
 		fn(charIdx, m.col)
@@ -997,37 +1399,54 @@ func (m *Model) doWordRight(fn func(charIdx int, pos int)) {
 	}
 }
 
+// mapWordRight moves the cursor past the word to the right, replacing each of
+// its characters with the result of fn.
+func (m *Model) mapWordRight(fn func(charIdx int, r rune) rune) {
+	var line []rune
+	m.doWordRight(func(charIdx int, i int) {
+		if line == nil {
+			line = slices.Clone(m.value.Line(m.row))
+		}
+		line[i] = fn(charIdx, line[i])
+	})
+	if line != nil {
+		m.setLines(m.row, m.row+1, line)
+	}
+}
+
 // uppercaseRight changes the word to the right to uppercase.
 func (m *Model) uppercaseRight() {
-	m.doWordRight(func(_ int, i int) {
-		m.value[m.row][i] = unicode.ToUpper(m.value[m.row][i])
+	m.mapWordRight(func(_ int, r rune) rune {
+		return unicode.ToUpper(r)
 	})
 }
 
 // lowercaseRight changes the word to the right to lowercase.
 func (m *Model) lowercaseRight() {
-	m.doWordRight(func(_ int, i int) {
-		m.value[m.row][i] = unicode.ToLower(m.value[m.row][i])
+	m.mapWordRight(func(_ int, r rune) rune {
+		return unicode.ToLower(r)
 	})
 }
 
 // capitalizeRight changes the word to the right to title case.
 func (m *Model) capitalizeRight() {
-	m.doWordRight(func(charIdx int, i int) {
+	m.mapWordRight(func(charIdx int, r rune) rune {
 		if charIdx == 0 {
-			m.value[m.row][i] = unicode.ToTitle(m.value[m.row][i])
+			return unicode.ToTitle(r)
 		}
+		return r
 	})
 }
 
 // LineInfo returns the number of characters from the start of the
 // (soft-wrapped) line and the (soft-wrapped) line width.
 func (m Model) LineInfo() LineInfo {
-	grid := m.memoizedWrap(m.value[m.row], m.width)
+	grid := m.wrapLine(m.value.Line(m.row))
 
 	// Find out which line we are currently on. This can be determined by the
 	// m.col and counting the number of runes that we need to skip.
-	var counter int
+	counter := m.scrollOffset()
+	tabWidth := m.tabStop()
 	for i, line := range grid {
 		// We've found the line that we are on
 		if counter+len(line) == m.col && i+1 < len(grid) {
@@ -1040,19 +1459,19 @@ func (m Model) LineInfo() LineInfo {
 				RowOffset:    i + 1,
 				StartColumn:  m.col,
 				Width:        len(grid[i+1]),
-				CharWidth:    uniseg.StringWidth(string(line)),
+				CharWidth:    textWidth(line, tabWidth),
 			}
 		}
 
 		if counter+len(line) >= m.col {
 			return LineInfo{
-				CharOffset:   uniseg.StringWidth(string(line[:max(0, m.col-counter)])),
+				CharOffset:   textWidth(line[:max(0, m.col-counter)], tabWidth),
 				ColumnOffset: m.col - counter,
 				Height:       len(grid),
 				RowOffset:    i,
 				StartColumn:  counter,
 				Width:        len(line),
-				CharWidth:    uniseg.StringWidth(string(line)),
+				CharWidth:    textWidth(line, tabWidth),
 			}
 		}
 
@@ -1064,15 +1483,28 @@ func (m Model) LineInfo() LineInfo {
 // repositionView repositions the view of the viewport based on the defined
 // scrolling behavior.
 func (m *Model) repositionView() {
-	minimum := m.viewport.YOffset()
-	maximum := minimum + m.viewport.Height() - 1
+	m.xOffset = m.scrollOffset()
+	minimum := m.yOffset
+	maximum := minimum + m.height - 1
 	if row := m.cursorLineNumber(); row < minimum {
-		m.viewport.ScrollUp(minimum - row)
+		m.setYOffset(row)
 	} else if row > maximum {
-		m.viewport.ScrollDown(row - maximum)
+		m.setYOffset(row - m.height + 1)
 	}
 }
 
+// setYOffset scrolls the view so that the visual line n is at the top. The
+// view doesn't scroll past the last line.
+func (m *Model) setYOffset(n int) {
+	m.yOffset = clamp(n, 0, m.maxYOffset())
+}
+
+// maxYOffset returns the largest offset the view can be scrolled to, where
+// only the end of the buffer is shown.
+func (m Model) maxYOffset() int {
+	return m.totalVisualLines()
+}
+
 // Width returns the width of the textarea.
 func (m Model) Width() int {
 	return m.width
@@ -1087,8 +1519,8 @@ func (m *Model) MoveToBegin() {
 
 // MoveToEnd moves the cursor to the end of the input.
 func (m *Model) MoveToEnd() {
-	m.row = len(m.value) - 1
-	m.SetCursorColumn(len(m.value[m.row]))
+	m.row = m.value.Len() - 1
+	m.SetCursorColumn(len(m.value.Line(m.row)))
 	m.repositionView()
 }
 
@@ -1096,7 +1528,7 @@ func (m *Model) MoveToEnd() {
 // line, subsequent calls move up by a full page.
 func (m *Model) PageUp() {
 	// If not on the first visible line, snap to it.
-	if offset := m.viewport.YOffset() - m.cursorLineNumber(); offset < 0 {
+	if offset := m.yOffset - m.cursorLineNumber(); offset < 0 {
 		m.setCursorLineRelative(offset)
 		return
 	}
@@ -1109,7 +1541,7 @@ func (m *Model) PageUp() {
 // visible line, subsequent calls move down by a full page.
 func (m *Model) PageDown() {
 	// If not on the last visible line, snap to it.
-	if offset := m.cursorLineNumber() - m.viewport.YOffset(); offset < m.height-1 {
+	if offset := m.cursorLineNumber() - m.yOffset; offset < m.height-1 {
 		m.setCursorLineRelative(m.height - 1 - offset)
 		return
 	}
@@ -1137,8 +1569,8 @@ func (m *Model) SetWidth(w int) {
 	// Add base style borders and padding to reserved outer width.
 	reservedOuter := m.activeStyle().Base.GetHorizontalFrameSize()
 
-	// Add prompt width to reserved inner width.
-	reservedInner := m.promptWidth
+	// Add prompt and gutter width to reserved inner width.
+	reservedInner := m.promptWidth + m.gutterWidth()
 
 	// Add line number width to reserved inner width.
 	if m.ShowLineNumbers {
@@ -1148,7 +1580,8 @@ func (m *Model) SetWidth(w int) {
 		const gap = 2
 
 		// Number of digits plus 1 cell for the margin.
-		reservedInner += numDigits(m.MaxHeight) + gap
+		m.digits = m.lineNumberDigits()
+		reservedInner += m.digits + gap
 	}
 
 	// Input width must be at least one more than the reserved inner and outer
@@ -1211,119 +1644,91 @@ func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
 
 	var cmds []tea.Cmd
 
-	if m.value[m.row] == nil {
-		m.value[m.row] = make([]rune, 0)
-	}
-
 	if m.MaxHeight > 0 && m.MaxHeight != m.cache.Capacity() {
 		m.cache = memoization.NewMemoCache[line, [][]rune](m.MaxHeight)
 	}
 
 	switch msg := msg.(type) {
 	case tea.PasteMsg:
-		m.insertRunesFromUserInput([]rune(msg.Content))
+		m.beginEdit(editOther)
+		m.guard(func() { m.deleteSelection() })
+		m.eachCursor(func() { m.guard(func() { m.insertRunesFromUserInput([]rune(msg.Content)) }) })
+		m.endEdit()
 	case tea.KeyPressMsg:
-		switch {
-		case key.Matches(msg, m.KeyMap.DeleteAfterCursor):
-			m.col = clamp(m.col, 0, len(m.value[m.row]))
-			if m.col >= len(m.value[m.row]) {
-				m.mergeLineBelow(m.row)
-				break
-			}
-			m.deleteAfterCursor()
-		case key.Matches(msg, m.KeyMap.DeleteBeforeCursor):
-			m.col = clamp(m.col, 0, len(m.value[m.row]))
-			if m.col <= 0 {
-				m.mergeLineAbove(m.row)
-				break
-			}
-			m.deleteBeforeCursor()
-		case key.Matches(msg, m.KeyMap.DeleteCharacterBackward):
-			m.col = clamp(m.col, 0, len(m.value[m.row]))
-			if m.col <= 0 {
-				m.mergeLineAbove(m.row)
-				break
-			}
-			if len(m.value[m.row]) > 0 {
-				m.value[m.row] = append(m.value[m.row][:max(0, m.col-1)], m.value[m.row][m.col:]...)
-				if m.col > 0 {
-					m.SetCursorColumn(m.col - 1)
-				}
-			}
-		case key.Matches(msg, m.KeyMap.DeleteCharacterForward):
-			if len(m.value[m.row]) > 0 && m.col < len(m.value[m.row]) {
-				m.value[m.row] = slices.Delete(m.value[m.row], m.col, m.col+1)
-			}
-			if m.col >= len(m.value[m.row]) {
-				m.mergeLineBelow(m.row)
-				break
-			}
-		case key.Matches(msg, m.KeyMap.DeleteWordBackward):
-			if m.col <= 0 {
-				m.mergeLineAbove(m.row)
-				break
-			}
-			m.deleteWordLeft()
-		case key.Matches(msg, m.KeyMap.DeleteWordForward):
-			m.col = clamp(m.col, 0, len(m.value[m.row]))
-			if m.col >= len(m.value[m.row]) {
-				m.mergeLineBelow(m.row)
-				break
-			}
-			m.deleteWordRight()
-		case key.Matches(msg, m.KeyMap.InsertNewline):
-			if m.atContentLimit() {
-				return m, nil
+		var (
+			cmd tea.Cmd
+			ok  bool
+		)
+		if m.guard(func() { cmd, ok = m.completionKey(msg) }); ok {
+			cmds = append(cmds, cmd)
+			break
+		}
+		if m.cursorKey(msg) {
+			break
+		}
+
+		if kind, ok := m.keyEditKind(msg); ok {
+			if m.selection.active {
+				// Replacing the selection starts a new change.
+				m.history.typing = false
 			}
-			m.col = clamp(m.col, 0, len(m.value[m.row]))
-			m.splitLine(m.row, m.col)
-		case key.Matches(msg, m.KeyMap.LineEnd):
-			m.CursorEnd()
-		case key.Matches(msg, m.KeyMap.LineStart):
-			m.CursorStart()
-		case key.Matches(msg, m.KeyMap.CharacterForward):
-			m.characterRight()
-		case key.Matches(msg, m.KeyMap.LineNext):
-			m.CursorDown()
-		case key.Matches(msg, m.KeyMap.WordForward):
-			m.wordRight()
-		case key.Matches(msg, m.KeyMap.Paste):
-			return m, Paste
-		case key.Matches(msg, m.KeyMap.CharacterBackward):
-			m.characterLeft(false /* insideLine */)
-		case key.Matches(msg, m.KeyMap.LinePrevious):
-			m.CursorUp()
-		case key.Matches(msg, m.KeyMap.WordBackward):
-			m.wordLeft()
-		case key.Matches(msg, m.KeyMap.InputBegin):
-			m.MoveToBegin()
-		case key.Matches(msg, m.KeyMap.InputEnd):
-			m.MoveToEnd()
-		case key.Matches(msg, m.KeyMap.PageUp):
-			m.PageUp()
-		case key.Matches(msg, m.KeyMap.PageDown):
-			m.PageDown()
-		case key.Matches(msg, m.KeyMap.LowercaseWordForward):
-			m.lowercaseRight()
-		case key.Matches(msg, m.KeyMap.UppercaseWordForward):
-			m.uppercaseRight()
-		case key.Matches(msg, m.KeyMap.CapitalizeWordForward):
-			m.capitalizeRight()
-		case key.Matches(msg, m.KeyMap.TransposeCharacterBackward):
-			m.transposeLeft()
+			m.beginEdit(kind)
+		}
 
+		if m.guard(func() { cmd, ok = m.selectionKey(msg) }); ok {
+			m.endEdit()
+			cmds = append(cmds, cmd)
+			break
+		}
+
+		switch {
+		case m.multiCursorKey(msg):
+			m.eachCursor(func() { m.guard(func() { m.handleKey(msg) }) })
+		case key.Matches(msg, m.KeyMap.Undo, m.KeyMap.Redo):
+			// Undo and redo go back to values the keys led to, and the
+			// history would be lost if they were undone themselves.
+			if !m.ReadOnly {
+				cmd = m.handleKey(msg)
+			}
 		default:
-			m.insertRunesFromUserInput([]rune(msg.Text))
+			m.guard(func() { cmd = m.handleKey(msg) })
 		}
+		m.endEdit()
+		cmds = append(cmds, cmd, m.updateCompletion(msg))
+
+	case CompletionMsg:
+		m.completionReply(msg)
 
 	case pasteMsg:
-		m.insertRunesFromUserInput([]rune(msg))
+		m.beginEdit(editOther)
+		m.guard(func() { m.deleteSelection() })
+		m.eachCursor(func() { m.guard(func() { m.insertRunesFromUserInput([]rune(msg)) }) })
+		m.endEdit()
 
 	case pasteErrMsg:
 		m.Err = msg
+
+	case copyErrMsg:
+		m.Err = msg
+
+	case tea.MouseClickMsg:
+		m.CloseCompletion()
+		m.ClearCursors()
+		m.mouseDown(msg)
+
+	case tea.MouseMotionMsg:
+		m.mouseDrag(msg)
+
+	case tea.MouseReleaseMsg:
+		m.selection.dragging = false
+
+	case tea.MouseWheelMsg:
+		m.mouseWheel(msg)
 	}
 
+	m.fitLineNumbers()
 	m.recalculateHeight()
+	m.xOffset = m.scrollOffset()
 
 	// Make sure we set the content of the viewport before updating it.
 	view := m.view()
@@ -1345,13 +1750,125 @@ func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
 		cmds = append(cmds, cmd)
 	}
 
+	m.revealCursor()
 	m.repositionView()
 
 	return m, tea.Batch(cmds...)
 }
 
+// handleKey runs the binding of a key press at the cursor, or types its text.
+func (m *Model) handleKey(msg tea.KeyPressMsg) tea.Cmd {
+	switch {
+	case key.Matches(msg, m.KeyMap.Undo):
+		m.Undo()
+	case key.Matches(msg, m.KeyMap.Redo):
+		m.Redo()
+	case key.Matches(msg, m.KeyMap.DeleteAfterCursor):
+		m.col = clamp(m.col, 0, len(m.value.Line(m.row)))
+		if m.col >= len(m.value.Line(m.row)) {
+			m.mergeLineBelow(m.row)
+			break
+		}
+		m.deleteAfterCursor()
+	case key.Matches(msg, m.KeyMap.DeleteBeforeCursor):
+		m.col = clamp(m.col, 0, len(m.value.Line(m.row)))
+		if m.col <= 0 {
+			m.mergeLineAbove(m.row)
+			break
+		}
+		m.deleteBeforeCursor()
+	case key.Matches(msg, m.KeyMap.DeleteCharacterBackward):
+		m.col = clamp(m.col, 0, len(m.value.Line(m.row)))
+		if m.col <= 0 {
+			m.mergeLineAbove(m.row)
+			break
+		}
+		if m.deletePair() {
+			break
+		}
+		if line := m.value.Line(m.row); len(line) > 0 {
+			prev := runeutil.PrevGrapheme(line, m.col)
+			m.replace(pos{m.row, prev}, pos{m.row, m.col})
+			m.SetCursorColumn(prev)
+		}
+	case key.Matches(msg, m.KeyMap.DeleteCharacterForward):
+		if line := m.value.Line(m.row); len(line) > 0 && m.col < len(line) {
+			m.replace(pos{m.row, m.col}, pos{m.row, runeutil.NextGrapheme(line, m.col)})
+		}
+		if m.col >= len(m.value.Line(m.row)) {
+			m.mergeLineBelow(m.row)
+			break
+		}
+	case key.Matches(msg, m.KeyMap.DeleteWordBackward):
+		if m.col <= 0 {
+			m.mergeLineAbove(m.row)
+			break
+		}
+		m.deleteWordLeft()
+	case key.Matches(msg, m.KeyMap.DeleteWordForward):
+		m.col = clamp(m.col, 0, len(m.value.Line(m.row)))
+		if m.col >= len(m.value.Line(m.row)) {
+			m.mergeLineBelow(m.row)
+			break
+		}
+		m.deleteWordRight()
+	case key.Matches(msg, m.KeyMap.InsertNewline):
+		if m.atContentLimit() {
+			break
+		}
+		m.insertNewline()
+	case key.Matches(msg, m.KeyMap.InsertTab):
+		m.insertTab()
+	case key.Matches(msg, m.KeyMap.Outdent):
+		m.outdent()
+	case key.Matches(msg, m.KeyMap.Reflow):
+		m.reflow()
+	case key.Matches(msg, m.KeyMap.LineEnd):
+		m.CursorEnd()
+	case key.Matches(msg, m.KeyMap.LineStart):
+		m.CursorStart()
+	case key.Matches(msg, m.KeyMap.CharacterForward):
+		m.characterRight()
+	case key.Matches(msg, m.KeyMap.LineNext):
+		m.CursorDown()
+	case key.Matches(msg, m.KeyMap.WordForward):
+		m.wordRight()
+	case key.Matches(msg, m.KeyMap.Paste):
+		return Paste
+	case key.Matches(msg, m.KeyMap.CharacterBackward):
+		m.characterLeft(false /* insideLine */)
+	case key.Matches(msg, m.KeyMap.LinePrevious):
+		m.CursorUp()
+	case key.Matches(msg, m.KeyMap.WordBackward):
+		m.wordLeft()
+	case key.Matches(msg, m.KeyMap.InputBegin):
+		m.MoveToBegin()
+	case key.Matches(msg, m.KeyMap.InputEnd):
+		m.MoveToEnd()
+	case key.Matches(msg, m.KeyMap.PageUp):
+		m.PageUp()
+	case key.Matches(msg, m.KeyMap.PageDown):
+		m.PageDown()
+	case key.Matches(msg, m.KeyMap.LowercaseWordForward):
+		m.lowercaseRight()
+	case key.Matches(msg, m.KeyMap.UppercaseWordForward):
+		m.uppercaseRight()
+	case key.Matches(msg, m.KeyMap.CapitalizeWordForward):
+		m.capitalizeRight()
+	case key.Matches(msg, m.KeyMap.TransposeCharacterBackward):
+		m.transposeLeft()
+
+	default:
+		if !m.autoClose(msg.Text) {
+			m.insertRunesFromUserInput([]rune(msg.Text))
+		}
+	}
+	return nil
+}
+
+// view renders the lines in view.
 func (m *Model) view() string {
-	if len(m.Value()) == 0 && m.row == 0 && m.col == 0 && m.Placeholder != "" {
+	if m.value.Len() == 1 && len(m.value.Line(0)) == 0 && m.row == 0 && m.col == 0 && m.Placeholder != "" {
 		return m.placeholderView()
 	}
 	m.virtualCursor.TextStyle = m.activeStyle().computedCursorLine()
@@ -1365,9 +1882,33 @@ func (m *Model) view() string {
 		styles           = m.activeStyle()
 	)
 
-	displayLine := 0
-	for l, line := range m.value {
-		wrappedLines := m.memoizedWrap(line, m.width)
+	// Only the lines in view are wrapped and rendered, starting from the
+	// wrapped line at the top of the view.
+	first, skip := m.findRow(m.yOffset)
+	displayLine := m.yOffset
+
+	// Highlighting a line depends on the lines before it.
+	var state string
+	if m.highlighter != nil {
+		state = m.value.State(m.highlightScanner(), first, "")
+	}
+
+	for l, line := range m.value.Lines(first) {
+		if newLines == m.height {
+			break
+		}
+		wrappedLines := m.wrapLine(line)
+
+		var spans []Span
+		spans, state = m.memoizedHighlight(line, state)
+		if m.hidden(l) {
+			continue
+		}
+		overlay := m.protectedSpans(l, nil)
+		if m.Overlay != nil {
+			overlay = append(overlay, m.Overlay(l, line)...)
+		}
+		overlay = m.cursorSpans(l, overlay)
 
 		if m.row == l {
 			style = styles.computedCursorLine()
@@ -1375,10 +1916,24 @@ func (m *Model) view() string {
 			style = styles.computedText()
 		}
 
+		// col is the column in line of the first character of the wrapped
+		// line, used to render the selection.
+		col := m.scrollOffset()
+		tabWidth := m.tabStop()
 		for wl, wrappedLine := range wrappedLines {
+			startCol := col
+			col += len(wrappedLine)
+			if l == first && wl < skip {
+				continue
+			}
+			if newLines == m.height {
+				break
+			}
+
 			prompt := m.promptView(displayLine)
 			prompt = styles.computedPrompt().Render(prompt)
 			s.WriteString(style.Render(prompt))
+			s.WriteString(m.gutterView(l, wl > 0, style))
 			displayLine++
 
 			var ln string
@@ -1398,31 +1953,61 @@ func (m *Model) view() string {
 				widestLineNumber = lnw
 			}
 
-			strwidth := uniseg.StringWidth(string(wrappedLine))
-			padding := m.width - strwidth
+			// Continuation rows start with the wrap indicator and are
+			// indented, which leaves less room for text.
+			width := m.width - m.rowIndent(line, wl)
+			s.WriteString(m.rowPrefix(line, wl, style))
+
+			strwidth := textWidth(wrappedLine, tabWidth)
 			// If the trailing space causes the line to be wider than the
 			// width, we should not draw it to the screen since it will result
 			// in an extra space at the end of the line which can look off when
 			// the cursor line is showing.
-			if strwidth > m.width {
+			if strwidth > width && len(wrappedLine) > 0 {
 				// The character causing the line to be wider than the width is
-				// guaranteed to be a space since any other character would
-				// have been wrapped.
-				wrappedLine = []rune(strings.TrimSuffix(string(wrappedLine), " "))
-				padding -= m.width - strwidth
+				// guaranteed to be a space or a tab since any other character
+				// would have been wrapped.
+				wrappedLine = wrappedLine[:len(wrappedLine)-1]
+				strwidth = textWidth(wrappedLine, tabWidth)
 			}
+			padding := width - strwidth
 			if m.row == l && lineInfo.RowOffset == wl {
-				s.WriteString(style.Render(string(wrappedLine[:lineInfo.ColumnOffset])))
-				if m.col >= len(line) && lineInfo.CharOffset >= m.width {
+				s.WriteString(m.renderText(l, startCol, 0, wrappedLine[:lineInfo.ColumnOffset], style, spans, overlay))
+				if m.col >= len(line) && lineInfo.CharOffset >= width {
 					m.virtualCursor.SetChar(" ")
 					s.WriteString(m.virtualCursor.View())
 				} else {
-					m.virtualCursor.SetChar(string(wrappedLine[lineInfo.ColumnOffset]))
+					// The cursor covers a whole character. A tab under the
+					// cursor is displayed as the cursor followed by the rest
+					// of the tab's spaces.
+					end, w := nextChar(wrappedLine, lineInfo.ColumnOffset, lineInfo.CharOffset, tabWidth)
+					char := string(wrappedLine[lineInfo.ColumnOffset:end])
+					tab := wrappedLine[lineInfo.ColumnOffset] == '\t'
+					if tab {
+						char = " "
+					}
+					m.virtualCursor.SetChar(char)
 					s.WriteString(style.Render(m.virtualCursor.View()))
-					s.WriteString(style.Render(string(wrappedLine[lineInfo.ColumnOffset+1:])))
+					if tab && w > 1 {
+						// Past the cursor, the tab extends to the same tab
+						// stop.
+						s.WriteString(m.renderText(l, startCol+lineInfo.ColumnOffset, lineInfo.CharOffset+1, []rune{'\t'}, style, spans, overlay))
+					}
+					s.WriteString(m.renderText(l, startCol+end, lineInfo.CharOffset+w, wrappedLine[end:], style, spans, overlay))
 				}
 			} else {
-				s.WriteString(style.Render(string(wrappedLine)))
+				s.WriteString(m.renderText(l, startCol, 0, wrappedLine, style, spans, overlay))
+			}
+			if m.row == l && wl == len(wrappedLines)-1 {
+				// The diagnostic of the cursor line is shown after it.
+				msg := m.diagnosticMessage(padding, style)
+				s.WriteString(msg)
+				padding -= ansi.StringWidth(msg)
+			}
+			if wl == len(wrappedLines)-1 {
+				summary := m.foldSummary(l, padding, style)
+				s.WriteString(summary)
+				padding -= ansi.StringWidth(summary)
 			}
 			s.WriteString(style.Render(strings.Repeat(" ", max(0, padding))))
 			s.WriteRune('\n')
@@ -1430,9 +2015,9 @@ func (m *Model) view() string {
 		}
 	}
 
-	// Always show at least `m.Height` lines at all times.
+	// Always show `m.Height` lines at all times.
 	// To do this we can simply pad out a few extra new lines in the view.
-	for range m.height {
+	for ; newLines < m.height; newLines++ {
 		s.WriteString(m.promptView(displayLine))
 		displayLine++
 
@@ -1454,7 +2039,7 @@ func (m Model) View() string {
 	// we need to render the view again because Update hasn't been called
 	// yet to set the content of the viewport.
 	m.viewport.SetContent(m.view())
-	view := m.viewport.View()
+	view := m.drawCompletion(m.viewport.View())
 	styles := m.activeStyle()
 	return styles.Base.Render(view)
 }
@@ -1504,8 +2089,7 @@ func (m Model) lineNumberView(n int, isCursorLine bool) (str string) {
 	}
 
 	// Format line number dynamically based on the maximum number of lines.
-	digits := len(strconv.Itoa(m.MaxHeight))
-	str = fmt.Sprintf(" %*v ", digits, str)
+	str = fmt.Sprintf(" %*v ", m.lineNumberDigits(), str)
 
 	return textStyle.Render(lineNumberStyle.Render(str))
 }
@@ -1536,6 +2120,7 @@ func (m Model) placeholderView() string {
 		prompt := m.promptView(i)
 		prompt = styles.computedPrompt().Render(prompt)
 		s.WriteString(lineStyle.Render(prompt))
+		s.WriteString(lineStyle.Render(strings.Repeat(" ", m.gutterWidth())))
 
 		// when show line numbers enabled:
 		// - render line number for only the cursor line
@@ -1599,7 +2184,9 @@ func Blink() tea.Msg {
 }
 
 // Cursor returns a [tea.Cursor] for rendering a real cursor in a Bubble Tea
-// program. This requires that [Model.VirtualCursor] is set to false.
+// program. This requires that [Model.VirtualCursor] is set to false. With
+// several cursors, it's the primary one, and the others are drawn in the
+// view.
 //
 // Note that you will almost certainly also need to adjust the offset cursor
 // position per the textarea's per the textarea's position in the terminal.
@@ -1621,14 +2208,16 @@ func (m Model) Cursor() *tea.Cursor {
 	baseStyle := m.activeStyle().Base
 
 	xOffset := lineInfo.CharOffset +
+		m.rowIndent(m.value.Line(m.row), lineInfo.RowOffset) +
 		w(m.promptView(0)) +
+		m.gutterWidth() +
 		w(m.lineNumberView(0, false)) +
 		baseStyle.GetMarginLeft() +
 		baseStyle.GetPaddingLeft() +
 		baseStyle.GetBorderLeftSize()
 
 	yOffset := m.cursorLineNumber() -
-		m.viewport.YOffset() +
+		m.yOffset +
 		baseStyle.GetMarginTop() +
 		baseStyle.GetPaddingTop() +
 		baseStyle.GetBorderTopSize()
@@ -1640,12 +2229,60 @@ func (m Model) Cursor() *tea.Cursor {
 	return c
 }
 
-func (m Model) memoizedWrap(runes []rune, width int) [][]rune {
-	input := line{runes: runes, width: width}
+// wrapLine returns the rows a line is displayed on. Without soft wrapping,
+// that's the part of the line scrolled into view.
+func (m Model) wrapLine(runes []rune) [][]rune {
+	if m.wrapMode() != WrapNone {
+		return m.memoizedWrap(runes)
+	}
+	start := min(m.scrollOffset(), len(runes))
+	end, width := start, 0
+	for end < len(runes) {
+		next, w := nextChar(runes, end, width, m.tabStop())
+		if width+w > m.width {
+			break
+		}
+		width += w
+		end = next
+	}
+	visible := slices.Clone(runes[start:end])
+	if end == len(runes) {
+		// Like wrap, leave room for the cursor at the end of the line.
+		visible = append(visible, ' ')
+	}
+	return [][]rune{visible}
+}
+
+// scrollOffset returns the first column shown when lines aren't soft
+// wrapped, scrolled as little as possible from the current offset to keep
+// the cursor visible.
+func (m Model) scrollOffset() int {
+	if m.wrapMode() != WrapNone {
+		return 0
+	}
+	line := m.value.Line(m.row)
+	col := min(m.col, len(line))
+	offset := min(m.xOffset, col)
+	// The cursor takes up a cell of its own.
+	width := textWidth(line[offset:col], m.tabStop()) + 1
+	for offset < col && width > m.width {
+		// Tabs are taken to be as wide as they can be, which may scroll
+		// a little further than needed.
+		next, w := nextChar(line, offset, 0, m.tabStop())
+		width -= w
+		offset = next
+	}
+	return offset
+}
+
+// memoizedWrap returns the rows a line is soft-wrapped into, which are
+// cached.
+func (m Model) memoizedWrap(runes []rune) [][]rune {
+	input := line{runes: runes, wrapping: m.wrapping()}
 	if v, ok := m.cache.Get(input); ok {
 		return v
 	}
-	v := wrap(runes, width)
+	v := input.wrapping.wrap(runes)
 	m.cache.Set(input, v)
 	return v
 }
@@ -1653,24 +2290,74 @@ func (m Model) memoizedWrap(runes []rune, width int) [][]rune {
 // cursorLineNumber returns the line number that the cursor is on.
 // This accounts for soft wrapped lines.
 func (m Model) cursorLineNumber() int {
-	line := 0
-	for i := range m.row {
-		// Calculate the number of lines that the current line will be split
-		// into.
-		line += len(m.memoizedWrap(m.value[i], m.width))
-	}
-	line += m.LineInfo().RowOffset
-	return line
+	return m.rowsBefore(m.row) + m.LineInfo().RowOffset
 }
 
 // totalVisualLines returns the total number of display lines across all
 // logical lines, accounting for soft wraps.
-func (m *Model) totalVisualLines() int {
-	n := 0
-	for _, line := range m.value {
-		n += len(m.memoizedWrap(line, m.width))
+func (m Model) totalVisualLines() int {
+	return m.value.Total(m.heightMetric()) - m.hiddenHeight(fold.Closed(m.folds))
+}
+
+// heightMetric returns the metric of the number of display lines of a line.
+// The number of display lines of each line is cached in the value, so that
+// only the lines that changed are wrapped again.
+func (m Model) heightMetric() rope.Metric {
+	w := m.wrapping()
+	return rope.Metric{
+		Key:     w,
+		Measure: w.height,
+	}
+}
+
+// lengthKey is the key of lengthMetric.
+type lengthKey struct{}
+
+// lengthMetric is the metric of the number of characters of a line, as
+// counted by [Model.Length].
+var lengthMetric = rope.Metric{
+	Key: lengthKey{},
+	Measure: func(line []rune) int {
+		return uniseg.StringWidth(string(line))
+	},
+}
+
+// wordKey is the key of wordMetric.
+type wordKey struct{}
+
+// wordMetric is the metric of the number of words of a line, as counted by
+// [Model.WordCount].
+var wordMetric = rope.Metric{
+	Key: wordKey{},
+	Measure: func(line []rune) int {
+		n := 0
+		inWord := false
+		for _, r := range line {
+			space := unicode.IsSpace(r)
+			if !space && !inWord {
+				n++
+			}
+			inWord = !space
+		}
+		return n
+	},
+}
+
+// lineNumberDigits returns the number of digits of the line numbers: enough
+// for MaxHeight lines, or for all lines if there are more or no MaxHeight.
+func (m Model) lineNumberDigits() int {
+	return numDigits(max(m.MaxHeight, m.value.Len()))
+}
+
+// fitLineNumbers makes room for the line numbers when the number of lines
+// grows past a power of ten, which can only happen without a MaxHeight.
+func (m *Model) fitLineNumbers() {
+	if !m.ShowLineNumbers || m.digits == 0 {
+		return
 	}
-	return n
+	digits := m.lineNumberDigits()
+	m.width = max(1, m.width+m.digits-digits)
+	m.digits = digits
 }
 
 // recalculateHeight recomputes and applies the textarea height based on
@@ -1685,8 +2372,8 @@ func (m *Model) recalculateHeight() {
 	if m.MaxHeight > 0 {
 		h = min(h, m.MaxHeight)
 	}
-	if maxOffset := total - h; m.viewport.YOffset() > maxOffset {
-		m.viewport.SetYOffset(max(0, maxOffset))
+	if maxOffset := total - h; m.yOffset > maxOffset {
+		m.yOffset = max(0, maxOffset)
 	}
 	m.SetHeight(h)
 }
@@ -1699,7 +2386,7 @@ func (m *Model) atContentLimit() bool {
 	if m.MaxContentHeight > 0 {
 		return m.totalVisualLines() >= m.MaxContentHeight
 	}
-	return m.MaxHeight > 0 && len(m.value) >= m.MaxHeight
+	return m.MaxHeight > 0 && m.value.Len() >= m.MaxHeight
 }
 
 // visualLinesForInsert estimates how many additional visual lines would result
@@ -1711,23 +2398,24 @@ func (m *Model) visualLinesForInsert(lines [][]rune) int {
 	}
 
 	// The current row's visual line count before insertion.
-	currentRowVisual := len(m.memoizedWrap(m.value[m.row], m.width))
+	row := m.value.Line(m.row)
+	currentRowVisual := len(m.memoizedWrap(row))
 
 	// Simulate merging the first paste line into the current row.
 	merged := make([]rune, m.col+len(lines[0]))
-	copy(merged, m.value[m.row][:m.col])
+	copy(merged, row[:m.col])
 	copy(merged[m.col:], lines[0])
 	if len(lines) == 1 {
-		merged = append(merged, m.value[m.row][m.col:]...)
+		merged = append(merged, row[m.col:]...)
 	}
-	delta := len(m.memoizedWrap(merged, m.width)) - currentRowVisual
+	delta := len(m.memoizedWrap(merged)) - currentRowVisual
 
 	// Each additional line is a new logical line.
 	for i, content := range lines {
 		if i == len(lines)-1 {
-			content = append(content, m.value[m.row][m.col:]...)
+			content = append(content, row[m.col:]...)
 		}
-		delta += len(m.memoizedWrap(content, m.width))
+		delta += len(m.memoizedWrap(content))
 	}
 
 	return delta
@@ -1735,22 +2423,12 @@ func (m *Model) visualLinesForInsert(lines [][]rune) int {
 
 // mergeLineBelow merges the current line the cursor is on with the line below.
 func (m *Model) mergeLineBelow(row int) {
-	if row >= len(m.value)-1 {
+	if row >= m.value.Len()-1 {
 		return
 	}
 
-	// To perform a merge, we will need to combine the two lines and then
-	m.value[row] = append(m.value[row], m.value[row+1]...)
-
-	// Shift all lines up by one
-	for i := row + 1; i < len(m.value)-1; i++ {
-		m.value[i] = m.value[i+1]
-	}
-
-	// And, remove the last line
-	if len(m.value) > 0 {
-		m.value = m.value[:len(m.value)-1]
-	}
+	// To perform a merge, we delete the line break between the two lines.
+	m.replace(pos{row, len(m.value.Line(row))}, pos{row + 1, 0})
 }
 
 // mergeLineAbove merges the current line the cursor is on with the line above.
@@ -1759,35 +2437,18 @@ func (m *Model) mergeLineAbove(row int) {
 		return
 	}
 
-	m.col = len(m.value[row-1])
+	m.col = len(m.value.Line(row - 1))
 	m.row = m.row - 1
 
-	// To perform a merge, we will need to combine the two lines and then
-	m.value[row-1] = append(m.value[row-1], m.value[row]...)
-
-	// Shift all lines up by one
-	for i := row; i < len(m.value)-1; i++ {
-		m.value[i] = m.value[i+1]
-	}
-
-	// And, remove the last line
-	if len(m.value) > 0 {
-		m.value = m.value[:len(m.value)-1]
-	}
+	// To perform a merge, we delete the line break between the two lines.
+	m.replace(pos{row - 1, len(m.value.Line(row - 1))}, pos{row, 0})
 }
 
 func (m *Model) splitLine(row, col int) {
-	// To perform a split, take the current line and keep the content before
-	// the cursor, take the content after the cursor and make it the content of
-	// the line underneath, and shift the remaining lines down by one
-	head, tailSrc := m.value[row][:col], m.value[row][col:]
-	tail := make([]rune, len(tailSrc))
-	copy(tail, tailSrc)
-
-	m.value = append(m.value[:row+1], m.value[row:]...)
-
-	m.value[row] = head
-	m.value[row+1] = tail
+	// To perform a split, insert a line break at the cursor, which moves the
+	// content after the cursor to the line underneath, and shifts the
+	// remaining lines down by one.
+	m.replace(pos{row, col}, pos{row, col}, nil, nil)
 
 	m.col = 0
 	m.row++
@@ -1802,71 +2463,6 @@ func Paste() tea.Msg {
 	return pasteMsg(str)
 }
 
-func wrap(runes []rune, width int) [][]rune {
-	var (
-		lines  = [][]rune{{}}
-		word   = []rune{}
-		row    int
-		spaces int
-	)
-
-	// Word wrap the runes
-	for _, r := range runes {
-		if unicode.IsSpace(r) {
-			spaces++
-		} else {
-			word = append(word, r)
-		}
-
-		if spaces > 0 { //nolint:nestif
-			if uniseg.StringWidth(string(lines[row]))+uniseg.StringWidth(string(word))+spaces > width {
-				row++
-				lines = append(lines, []rune{})
-				lines[row] = append(lines[row], word...)
-				lines[row] = append(lines[row], repeatSpaces(spaces)...)
-				spaces = 0
-				word = nil
-			} else {
-				lines[row] = append(lines[row], word...)
-				lines[row] = append(lines[row], repeatSpaces(spaces)...)
-				spaces = 0
-				word = nil
-			}
-		} else {
-			// If the last character is a double-width rune, then we may not be able to add it to this line
-			// as it might cause us to go past the width.
-			lastCharLen := rw.RuneWidth(word[len(word)-1])
-			if uniseg.StringWidth(string(word))+lastCharLen > width {
-				// If the current line has any content, let's move to the next
-				// line because the current word fills up the entire line.
-				if len(lines[row]) > 0 {
-					row++
-					lines = append(lines, []rune{})
-				}
-				lines[row] = append(lines[row], word...)
-				word = nil
-			}
-		}
-	}
-
-	if uniseg.StringWidth(string(lines[row]))+uniseg.StringWidth(string(word))+spaces >= width {
-		lines = append(lines, []rune{})
-		lines[row+1] = append(lines[row+1], word...)
-		// We add an extra space at the end of the line to account for the
-		// trailing space at the end of the previous soft-wrapped lines so that
-		// behaviour when navigating is consistent and so that we don't need to
-		// continually add edges to handle the last line of the wrapped input.
-		spaces++
-		lines[row+1] = append(lines[row+1], repeatSpaces(spaces)...)
-	} else {
-		lines[row] = append(lines[row], word...)
-		spaces++
-		lines[row] = append(lines[row], repeatSpaces(spaces)...)
-	}
-
-	return lines
-}
-
 func repeatSpaces(n int) []rune {
 	return []rune(strings.Repeat(string(' '), n))
 }
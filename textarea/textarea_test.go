@@ -2,6 +2,7 @@ package textarea
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 	"testing"
 	"unicode"
@@ -10,6 +11,7 @@ import (
 	"github.com/haochend413/lipgloss/v2"
 	"github.com/MakeNowJust/heredoc"
 	"github.com/charmbracelet/x/ansi"
+	"github.com/charmbracelet/x/exp/golden"
 )
 
 func TestVerticalScrolling(t *testing.T) {
@@ -44,14 +46,14 @@ func TestVerticalScrolling(t *testing.T) {
 		"should wrap around",
 		"the text area.",
 	}
-	textarea.viewport.GotoTop()
+	textarea.setYOffset(0)
 	for _, line := range lines {
 		view = textarea.View()
 		if !strings.Contains(view, line) {
 			t.Log(view)
 			t.Error("Text area did not render the correct scrolled input")
 		}
-		textarea.viewport.ScrollDown(1)
+		textarea.setYOffset(textarea.ScrollYOffset() + 1)
 	}
 }
 
@@ -1722,11 +1724,10 @@ func TestView(t *testing.T) {
 					lines[i] = fmt.Sprintf("Line %d", i+1)
 				}
 				m.SetValue(strings.Join(lines, "\n"))
-				m.viewport.SetContent(m.view()) // force setting of viewport content.
 
 				m.row = 3
 				m.col = 0
-				m.viewport.SetYOffset(0)
+				m.setYOffset(0)
 				m.PageUp()
 
 				return m
@@ -1753,11 +1754,10 @@ func TestView(t *testing.T) {
 					lines[i] = fmt.Sprintf("Line %d", i+1)
 				}
 				m.SetValue(strings.Join(lines, "\n"))
-				m.viewport.SetContent(m.view()) // force setting of viewport content.
 
 				m.row = 5
 				m.col = 0
-				m.viewport.SetYOffset(3)
+				m.setYOffset(3)
 				m.PageUp()
 
 				return m
@@ -1784,11 +1784,10 @@ func TestView(t *testing.T) {
 					lines[i] = fmt.Sprintf("Line %d", i+1)
 				}
 				m.SetValue(strings.Join(lines, "\n"))
-				m.viewport.SetContent(m.view()) // force setting of viewport content.
 
 				m.row = 5
 				m.col = 0
-				m.viewport.SetYOffset(5)
+				m.setYOffset(5)
 				m.PageUp()
 
 				return m
@@ -1813,11 +1812,10 @@ func TestView(t *testing.T) {
 					lines[i] = fmt.Sprintf("Line %d", i+1)
 				}
 				m.SetValue(strings.Join(lines, "\n"))
-				m.viewport.SetContent(m.view()) // force setting of viewport content.
 
 				m.row = 8
 				m.col = 0
-				m.viewport.SetYOffset(7)
+				m.setYOffset(7)
 				m.PageDown()
 
 				return m
@@ -1842,11 +1840,10 @@ func TestView(t *testing.T) {
 					lines[i] = fmt.Sprintf("Line %d", i+1)
 				}
 				m.SetValue(strings.Join(lines, "\n"))
-				m.viewport.SetContent(m.view()) // force setting of viewport content.
 
 				m.row = 3
 				m.col = 0
-				m.viewport.SetYOffset(3)
+				m.setYOffset(3)
 				m.PageDown()
 
 				return m
@@ -1871,11 +1868,10 @@ func TestView(t *testing.T) {
 					lines[i] = fmt.Sprintf("Line %d", i+1)
 				}
 				m.SetValue(strings.Join(lines, "\n"))
-				m.viewport.SetContent(m.view()) // force setting of viewport content.
 
 				m.row = 4
 				m.col = 0
-				m.viewport.SetYOffset(2)
+				m.setYOffset(2)
 				m.PageDown()
 
 				return m
@@ -1974,6 +1970,996 @@ func TestWord(t *testing.T) {
 	})
 }
 
+func TestUndo(t *testing.T) {
+	var (
+		undo      = tea.KeyPressMsg{Code: 'z', Mod: tea.ModCtrl}
+		redo      = tea.KeyPressMsg{Code: 'y', Mod: tea.ModCtrl}
+		left      = tea.KeyPressMsg{Code: tea.KeyLeft}
+		enter     = tea.KeyPressMsg{Code: tea.KeyEnter}
+		backspace = tea.KeyPressMsg{Code: tea.KeyBackspace}
+		ctrlW     = tea.KeyPressMsg{Code: 'w', Mod: tea.ModCtrl}
+		altU      = tea.KeyPressMsg{Code: 'u', Mod: tea.ModAlt}
+		home      = tea.KeyPressMsg{Code: tea.KeyHome}
+	)
+	typed := func(s string) []tea.Msg {
+		var msgs []tea.Msg
+		for _, r := range s {
+			msgs = append(msgs, keyPress(r))
+		}
+		return msgs
+	}
+	join := func(groups ...[]tea.Msg) []tea.Msg {
+		var msgs []tea.Msg
+		for _, g := range groups {
+			msgs = append(msgs, g...)
+		}
+		return msgs
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		msgs    []tea.Msg
+		want    string
+		wantCol int
+	}{
+		{name: "typing is one change", msgs: join(typed("foo bar"), []tea.Msg{undo}), want: ""},
+		{name: "moving starts a new change", msgs: join(typed("foo"), []tea.Msg{left}, typed("x"), []tea.Msg{undo}), want: "foo", wantCol: 2},
+		{name: "newline is a change", msgs: join(typed("foo"), []tea.Msg{enter}, typed("bar"), []tea.Msg{undo, undo}), want: "foo", wantCol: 3},
+		{name: "backspace", value: "foo", msgs: []tea.Msg{backspace, backspace, undo}, want: "fo", wantCol: 2},
+		{name: "delete word", value: "foo bar", msgs: []tea.Msg{ctrlW, undo}, want: "foo bar", wantCol: 7},
+		{name: "case change", value: "foo bar", msgs: []tea.Msg{home, altU, undo}, want: "foo bar"},
+		{name: "paste", value: "foo", msgs: []tea.Msg{tea.PasteMsg{Content: "bar"}, undo}, want: "foo", wantCol: 3},
+		{name: "set value", value: "foo", msgs: []tea.Msg{undo}, want: ""},
+		{name: "redo", msgs: join(typed("foo"), []tea.Msg{undo, redo}), want: "foo", wantCol: 3},
+		{name: "edit clears redo", msgs: join(typed("foo"), []tea.Msg{undo}, typed("x"), []tea.Msg{redo}), want: "x", wantCol: 1},
+		{name: "no-op edit is not recorded", value: "foo", msgs: []tea.Msg{home, backspace, undo}, want: ""},
+		{name: "nothing to undo", msgs: []tea.Msg{undo, redo}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTextArea()
+			if tt.value != "" {
+				m.SetValue(tt.value)
+			}
+			for _, msg := range tt.msgs {
+				m, _ = m.Update(msg)
+			}
+
+			if got := m.Value(); got != tt.want {
+				t.Errorf("value: want %q, got %q", tt.want, got)
+			}
+			if m.col != tt.wantCol {
+				t.Errorf("column: want %d, got %d", tt.wantCol, m.col)
+			}
+		})
+	}
+}
+
+func TestHistoryLimit(t *testing.T) {
+	m := newTextArea()
+	m.HistoryLimit = 2
+	for _, s := range []string{"a", "b", "c"} {
+		m.InsertString(s)
+	}
+	for m.CanUndo() {
+		m.Undo()
+	}
+	if got := m.Value(); got != "a" {
+		t.Errorf("want %q, got %q", "a", got)
+	}
+	if !m.CanRedo() {
+		t.Error("expected to be able to redo")
+	}
+
+	m.ClearHistory()
+	if m.CanUndo() || m.CanRedo() {
+		t.Error("expected history to be cleared")
+	}
+}
+
+func TestSelection(t *testing.T) {
+	var (
+		shiftLeft      = tea.KeyPressMsg{Code: tea.KeyLeft, Mod: tea.ModShift}
+		shiftRight     = tea.KeyPressMsg{Code: tea.KeyRight, Mod: tea.ModShift}
+		shiftUp        = tea.KeyPressMsg{Code: tea.KeyUp, Mod: tea.ModShift}
+		shiftHome      = tea.KeyPressMsg{Code: tea.KeyHome, Mod: tea.ModShift}
+		altShiftLeft   = tea.KeyPressMsg{Code: tea.KeyLeft, Mod: tea.ModAlt | tea.ModShift}
+		ctrlShiftRight = tea.KeyPressMsg{Code: tea.KeyRight, Mod: tea.ModCtrl | tea.ModShift}
+		selectAll      = tea.KeyPressMsg{Code: 'a', Mod: tea.ModAlt}
+		cut            = tea.KeyPressMsg{Code: 'x', Mod: tea.ModCtrl}
+		left           = tea.KeyPressMsg{Code: tea.KeyLeft}
+		right          = tea.KeyPressMsg{Code: tea.KeyRight}
+		home           = tea.KeyPressMsg{Code: tea.KeyHome}
+		backspace      = tea.KeyPressMsg{Code: tea.KeyBackspace}
+		enter          = tea.KeyPressMsg{Code: tea.KeyEnter}
+		undo           = tea.KeyPressMsg{Code: 'z', Mod: tea.ModCtrl}
+	)
+
+	tests := []struct {
+		name     string
+		value    string
+		msgs     []tea.Msg
+		want     string
+		selected string
+		wantRow  int
+		wantCol  int
+	}{
+		{name: "shift left", value: "foo bar", msgs: []tea.Msg{shiftLeft, shiftLeft}, want: "foo bar", selected: "ar", wantCol: 5},
+		{name: "shift left and back", value: "foo bar", msgs: []tea.Msg{shiftLeft, shiftLeft, shiftRight}, want: "foo bar", selected: "r", wantCol: 6},
+		{name: "back to the anchor", value: "foo bar", msgs: []tea.Msg{shiftLeft, shiftRight}, want: "foo bar", wantCol: 7},
+		{name: "word", value: "foo bar", msgs: []tea.Msg{altShiftLeft}, want: "foo bar", selected: "bar", wantCol: 4},
+		{name: "word forward", value: "foo bar", msgs: []tea.Msg{home, ctrlShiftRight}, want: "foo bar", selected: "foo", wantCol: 3},
+		{name: "line start", value: "foo bar", msgs: []tea.Msg{left, shiftHome}, want: "foo bar", selected: "foo ba", wantCol: 0},
+		{name: "lines", value: "foo\nbar", msgs: []tea.Msg{shiftUp}, want: "foo\nbar", selected: "\nbar", wantCol: 3},
+		{name: "select all", value: "foo\nbar", msgs: []tea.Msg{home, selectAll}, want: "foo\nbar", selected: "foo\nbar", wantRow: 1, wantCol: 3},
+		{name: "left collapses", value: "foo bar", msgs: []tea.Msg{altShiftLeft, left}, want: "foo bar", wantCol: 4},
+		{name: "right collapses", value: "foo bar", msgs: []tea.Msg{altShiftLeft, right}, want: "foo bar", wantCol: 7},
+		{name: "backspace deletes", value: "foo bar", msgs: []tea.Msg{altShiftLeft, backspace}, want: "foo ", wantCol: 4},
+		{name: "typing replaces", value: "foo bar", msgs: []tea.Msg{altShiftLeft, keyPress('x'), keyPress('y')}, want: "foo xy", wantCol: 6},
+		{name: "replace across lines", value: "foo\nbar", msgs: []tea.Msg{shiftLeft, shiftUp, keyPress('x')}, want: "fox", wantCol: 3},
+		{name: "enter replaces", value: "foo bar", msgs: []tea.Msg{altShiftLeft, enter}, want: "foo \n", wantRow: 1},
+		{name: "paste replaces", value: "foo bar", msgs: []tea.Msg{altShiftLeft, tea.PasteMsg{Content: "baz"}}, want: "foo baz", wantCol: 7},
+		{name: "cut", value: "foo bar", msgs: []tea.Msg{altShiftLeft, cut}, want: "foo ", wantCol: 4},
+		{name: "cut without selection", value: "foo bar", msgs: []tea.Msg{cut}, want: "foo bar", wantCol: 7},
+		{name: "undo replace", value: "foo bar", msgs: []tea.Msg{altShiftLeft, keyPress('x'), keyPress('y'), undo}, want: "foo bar", wantCol: 4},
+		{name: "moving clears", value: "foo bar", msgs: []tea.Msg{altShiftLeft, home}, want: "foo bar"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTextArea()
+			m.SetValue(tt.value)
+			for _, msg := range tt.msgs {
+				m, _ = m.Update(msg)
+			}
+
+			if got := m.Value(); got != tt.want {
+				t.Errorf("value: want %q, got %q", tt.want, got)
+			}
+			if got := m.SelectedText(); got != tt.selected {
+				t.Errorf("selection: want %q, got %q", tt.selected, got)
+			}
+			if m.row != tt.wantRow || m.col != tt.wantCol {
+				t.Errorf("cursor: want %d:%d, got %d:%d", tt.wantRow, tt.wantCol, m.row, m.col)
+			}
+		})
+	}
+}
+
+func TestCopySelection(t *testing.T) {
+	m := newTextArea()
+	m.SetValue("foo bar")
+
+	copyKey := tea.KeyPressMsg{Code: 'c', Mod: tea.ModCtrl | tea.ModShift}
+	if _, cmd := m.Update(copyKey); cmd != nil {
+		t.Error("expected no command without a selection")
+	}
+
+	m.SelectAll()
+	m, cmd := m.Update(copyKey)
+	if cmd == nil {
+		t.Error("expected a command copying the selection")
+	}
+	if got, want := m.SelectedText(), "foo bar"; got != want {
+		t.Errorf("copying should keep the selection: want %q, got %q", want, got)
+	}
+}
+
+func TestMouseSelection(t *testing.T) {
+	m := newTextArea()
+	m.SetValue("foo bar\nbaz")
+
+	// The text starts after the prompt and the line numbers.
+	const x = 6
+
+	m, _ = m.Update(tea.MouseClickMsg{X: x + 1, Y: 0, Button: tea.MouseLeft})
+	if m.row != 0 || m.col != 1 {
+		t.Fatalf("click: want cursor at 0:1, got %d:%d", m.row, m.col)
+	}
+	if got := m.SelectedText(); got != "" {
+		t.Errorf("click: want no selection, got %q", got)
+	}
+
+	m, _ = m.Update(tea.MouseMotionMsg{X: x + 5, Y: 0, Button: tea.MouseLeft})
+	if got, want := m.SelectedText(), "oo b"; got != want {
+		t.Errorf("drag: want %q, got %q", want, got)
+	}
+
+	m, _ = m.Update(tea.MouseMotionMsg{X: x + 20, Y: 1, Button: tea.MouseLeft})
+	if got, want := m.SelectedText(), "oo bar\nbaz"; got != want {
+		t.Errorf("drag past end: want %q, got %q", want, got)
+	}
+
+	m, _ = m.Update(tea.MouseReleaseMsg{X: x + 20, Y: 1, Button: tea.MouseLeft})
+	m, _ = m.Update(tea.MouseMotionMsg{X: x, Y: 0})
+	if got, want := m.SelectedText(), "oo bar\nbaz"; got != want {
+		t.Errorf("after release: want %q, got %q", want, got)
+	}
+
+	// Shift-clicking moves the end of the selection that isn't anchored.
+	m, _ = m.Update(tea.MouseClickMsg{X: x, Y: 0, Button: tea.MouseLeft, Mod: tea.ModShift})
+	if got, want := m.SelectedText(), "f"; got != want {
+		t.Errorf("shift click: want %q, got %q", want, got)
+	}
+
+	view := m.View()
+	if !strings.Contains(ansi.Strip(view), "foo bar") {
+		t.Errorf("expected the selected text in the view, got %q", view)
+	}
+}
+
+func TestMouseClick(t *testing.T) {
+	// The text starts after the prompt and the line numbers.
+	const x = 6
+
+	tests := []struct {
+		name    string
+		value   string
+		x, y    int
+		wantRow int
+		wantCol int
+	}{
+		{name: "first line", value: "foo\nbar", x: x + 1, y: 0, wantCol: 1},
+		{name: "second line", value: "foo\nbar", x: x + 2, y: 1, wantRow: 1, wantCol: 2},
+		{name: "past the end of the line", value: "foo\nbar", x: x + 20, y: 0, wantCol: 3},
+		{name: "below the last line", value: "foo\nbar", x: x + 1, y: 4, wantRow: 1, wantCol: 3},
+		{name: "on the prompt", value: "foo", x: 0, y: 0},
+		{name: "soft wrapped", value: "hello world foo", x: x + 2, y: 1, wantCol: 8},
+		{name: "past the end of a soft wrapped line", value: "hello world foo", x: x + 9, y: 0, wantCol: 5},
+		{name: "wide characters", value: "日本語", x: x + 3, y: 0, wantCol: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTextArea()
+			m.SetWidth(16)
+			m.SetValue(tt.value)
+			m, _ = m.Update(tea.MouseClickMsg{X: tt.x, Y: tt.y, Button: tea.MouseLeft})
+			if m.row != tt.wantRow || m.col != tt.wantCol {
+				t.Errorf("cursor: want %d:%d, got %d:%d", tt.wantRow, tt.wantCol, m.row, m.col)
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		m := newTextArea()
+		m.MouseClickEnabled = false
+		m.SetValue("foo")
+		m, _ = m.Update(tea.MouseClickMsg{X: x, Y: 0, Button: tea.MouseLeft})
+		if m.col != 3 {
+			t.Errorf("cursor: want 0:3, got %d:%d", m.row, m.col)
+		}
+	})
+}
+
+func TestDoubleClick(t *testing.T) {
+	const x = 6
+
+	m := newTextArea()
+	m.SetValue("foo bar  baz")
+	click := tea.MouseClickMsg{X: x + 5, Y: 0, Button: tea.MouseLeft}
+	m, _ = m.Update(click)
+	m, _ = m.Update(click)
+	if got, want := m.SelectedText(), "bar"; got != want {
+		t.Errorf("double click: want %q, got %q", want, got)
+	}
+
+	m, _ = m.Update(tea.MouseClickMsg{X: x + 8, Y: 0, Button: tea.MouseLeft})
+	m, _ = m.Update(tea.MouseClickMsg{X: x + 8, Y: 0, Button: tea.MouseLeft})
+	if got, want := m.SelectedText(), "  "; got != want {
+		t.Errorf("double click on blanks: want %q, got %q", want, got)
+	}
+
+	m.DoubleClickInterval = 0
+	m, _ = m.Update(click)
+	m, _ = m.Update(click)
+	if got := m.SelectedText(); got != "" {
+		t.Errorf("double click disabled: want no selection, got %q", got)
+	}
+}
+
+func TestMouseWheel(t *testing.T) {
+	m := newTextArea()
+	m.SetHeight(2)
+	m.SetValue(strings.Repeat("line\n", 9) + "line")
+	m, _ = m.Update(nil)
+	if m.ScrollYOffset() != 8 {
+		t.Fatalf("want the view scrolled to the cursor, got offset %d", m.ScrollYOffset())
+	}
+
+	m, _ = m.Update(tea.MouseWheelMsg{Button: tea.MouseWheelUp})
+	if m.ScrollYOffset() != 5 {
+		t.Errorf("offset: want 5, got %d", m.ScrollYOffset())
+	}
+	if m.row != 6 {
+		t.Errorf("the cursor should stay in view: want row 6, got %d", m.row)
+	}
+
+	m, _ = m.Update(tea.MouseWheelMsg{Button: tea.MouseWheelDown})
+	if m.ScrollYOffset() != 8 || m.row != 8 {
+		t.Errorf("want offset 8 and row 8, got offset %d and row %d", m.ScrollYOffset(), m.row)
+	}
+
+	m.MouseWheelEnabled = false
+	m, _ = m.Update(tea.MouseWheelMsg{Button: tea.MouseWheelUp})
+	if m.ScrollYOffset() != 8 {
+		t.Errorf("disabled: want offset 8, got %d", m.ScrollYOffset())
+	}
+}
+
+func TestHighlighter(t *testing.T) {
+	keyword := lipgloss.NewStyle().Bold(true)
+	comment := lipgloss.NewStyle().Italic(true)
+
+	// The highlighter styles the word "select" and comments between /* and
+	// */, which may span several lines.
+	calls := 0
+	h := HighlighterFunc(func(line []rune, state string) ([]Span, string) {
+		calls++
+		var spans []Span
+		s := string(line)
+		if state == "comment" {
+			end := strings.Index(s, "*/")
+			if end < 0 {
+				return []Span{{Start: 0, End: len(line), Style: comment}}, "comment"
+			}
+			spans = append(spans, Span{Start: 0, End: end + 2, Style: comment})
+			state = ""
+		}
+		if i := strings.Index(s, "select"); i >= 0 {
+			spans = append(spans, Span{Start: i, End: i + 6, Style: keyword})
+		}
+		if i := strings.Index(s, "/*"); i >= 0 && !strings.Contains(s[i:], "*/") {
+			spans = append(spans, Span{Start: i, End: len(line), Style: comment})
+			state = "comment"
+		}
+		return spans, state
+	})
+
+	m := newTextArea()
+	m.SetHighlighter(h)
+	m.SetValue("select 1 /* a\nb\nc */ select\n")
+
+	view := m.View()
+	for _, want := range []string{
+		keyword.Render("select"),
+		comment.Render("/* a"),
+		comment.Render("b"),
+		comment.Render("c */"),
+	} {
+		if !strings.Contains(view, want) {
+			t.Errorf("expected %q in the view, got %q", want, view)
+		}
+	}
+	if got := ansi.Strip(view); !strings.Contains(got, "select 1 /* a") {
+		t.Errorf("highlighting should not change the text, got %q", got)
+	}
+
+	calls = 0
+	m.View()
+	if calls != 0 {
+		t.Errorf("expected the highlighted lines to be cached, got %d calls", calls)
+	}
+
+	// The lines above the view are highlighted again when they change, but
+	// only those.
+	m.MaxHeight = 0
+	m.SetValue(strings.Repeat("a\n", 1000) + "select")
+	m.MoveToEnd()
+	m.View()
+	m.SetCursor(0, 0)
+	m.InsertString("b ")
+	m.MoveToEnd()
+	calls = 0
+	m.View()
+	if calls > 100 {
+		t.Errorf("expected only the changed lines to be highlighted again, got %d calls", calls)
+	}
+	m.SetCursor(0, 0)
+	m.InsertString("/* ")
+	m.MoveToEnd()
+	if view := m.View(); !strings.Contains(view, comment.Render("a")) {
+		t.Errorf("expected the last lines to be in a comment, got %q", view)
+	}
+
+	m.SetHighlighter(nil)
+	if view := m.View(); strings.Contains(view, keyword.Render("select")) {
+		t.Errorf("expected no highlighting, got %q", view)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	var (
+		complete = tea.KeyPressMsg{Code: ' ', Mod: tea.ModCtrl}
+		down     = tea.KeyPressMsg{Code: tea.KeyDown}
+		tab      = tea.KeyPressMsg{Code: tea.KeyTab}
+		esc      = tea.KeyPressMsg{Code: tea.KeyEscape}
+	)
+	names := []string{"users", "user_id", "orders"}
+	provider := CompletionProviderFunc(func(req CompletionRequest) ([]Completion, tea.Cmd) {
+		var items []Completion
+		for _, n := range names {
+			if strings.HasPrefix(n, req.Word) {
+				items = append(items, Completion{Text: n, Detail: "table"})
+			}
+		}
+		return items, nil
+	})
+
+	m := newTextArea()
+	m.CompletionProvider = provider
+	m = sendString(m, "select * from us")
+	m, _ = m.Update(complete)
+	if !m.Completing() {
+		t.Fatal("want the popup open")
+	}
+	view := ansi.Strip(m.View())
+	lines := strings.Split(view, "\n")
+	if !strings.Contains(lines[1], " users   table ") || !strings.Contains(lines[2], " user_id table ") {
+		t.Errorf("want the completions under the cursor, got:\n%s", view)
+	}
+
+	m, _ = m.Update(down)
+	m, _ = m.Update(tab)
+	if got, want := m.Value(), "select * from user_id"; got != want || m.Completing() {
+		t.Errorf("want %q with the popup closed, got %q", want, got)
+	}
+
+	// Typing refreshes the completions, and leaving the word closes them.
+	m.AutoComplete = true
+	m = sendString(m, " o")
+	if !m.Completing() || m.completion.items[0].Text != "orders" {
+		t.Errorf("want orders completed, got %v", m.completion.items)
+	}
+	m = sendString(m, "x")
+	if m.Completing() {
+		t.Error("want the popup closed without completions")
+	}
+	m = sendString(m, " us")
+	m, _ = m.Update(esc)
+	if m.Completing() || m.Value() != "select * from user_id ox us" {
+		t.Errorf("want the popup closed by esc, got %q", m.Value())
+	}
+
+	// Asynchronous completions are shown when they arrive, unless they're
+	// outdated.
+	var requests []CompletionRequest
+	m.CompletionProvider = CompletionProviderFunc(func(req CompletionRequest) ([]Completion, tea.Cmd) {
+		requests = append(requests, req)
+		return nil, func() tea.Msg { return nil }
+	})
+	m.AutoComplete = false
+	m.SetValue("us")
+	m, cmd := m.Update(complete)
+	if cmd == nil || len(requests) != 1 || requests[0].Word != "us" {
+		t.Fatalf("want an asynchronous request for us, got %v", requests)
+	}
+	if got := string(requests[0].Buffer.LineRunes(0)); got != "us" {
+		t.Errorf("want the buffer in the request, got %q", got)
+	}
+	m, _ = m.Update(complete)
+	m, _ = m.Update(requests[0].Reply([]Completion{{Text: "stale"}}))
+	if m.Completing() {
+		t.Error("want the outdated reply ignored")
+	}
+	m, _ = m.Update(requests[1].Reply([]Completion{{Text: "users"}}))
+	m, _ = m.Update(tab)
+	if got := m.Value(); got != "users" {
+		t.Errorf("want the asynchronous completion accepted, got %q", got)
+	}
+}
+
+func TestLargeValue(t *testing.T) {
+	const n = 20000
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d", i+1)
+	}
+
+	m := newTextArea()
+	m.MaxHeight = 0
+	m.ShowLineNumbers = false
+	m.SetHeight(3)
+	m.SetValue(strings.Join(lines, "\n"))
+	if got := m.LineCount(); got != n {
+		t.Fatalf("want %d lines, got %d", n, got)
+	}
+
+	// Typing in the middle of the value scrolls to the cursor.
+	m.MoveToBegin()
+	for range n / 2 {
+		m.CursorDown()
+	}
+	m.CursorEnd()
+	m = sendString(m, "!")
+	if want := "line 10001!"; !strings.Contains(m.View(), want) {
+		t.Errorf("want the view to show %q, got:\n%s", want, stripString(m.View()))
+	}
+	if got := m.ScrollYOffset(); got != n/2-2 {
+		t.Errorf("offset: want %d, got %d", n/2-2, got)
+	}
+
+	lines[n/2] += "!"
+	if m.Value() != strings.Join(lines, "\n") {
+		t.Error("unexpected value after typing")
+	}
+
+	m.Undo()
+	lines[n/2] = strings.TrimSuffix(lines[n/2], "!")
+	if m.Value() != strings.Join(lines, "\n") {
+		t.Error("unexpected value after undoing")
+	}
+}
+
+func TestLineHeight(t *testing.T) {
+	lines := []string{
+		"",
+		"short",
+		"exactly twenty chars",
+		"a line that is long enough to wrap",
+		"averyveryverylongwordthatcannotwrapatall",
+		"中文字符中文字符中文字符",
+		"emoji 😀😀😀😀 and more emoji 😀😀",
+		"trailing spaces      ",
+		"tab\tand ideographic\u3000space",
+		"combining e\u0301 and a \u0301 lone mark",
+	}
+	for _, width := range []int{5, 10, 20, 40} {
+		for _, l := range lines {
+			if got, want := lineHeight([]rune(l), width), len(wrap([]rune(l), width)); got != want {
+				t.Errorf("%q at width %d: want %d, got %d", l, width, want, got)
+			}
+		}
+	}
+}
+
+func TestReplaceRange(t *testing.T) {
+	m := newTextArea()
+	m.SetValue("foo bar\nbaz")
+	m.ClearHistory()
+
+	m.BeginChange()
+	m.ReplaceRange(0, 4, 1, 1, "qux\nq")
+	m.ReplaceRange(0, 0, 0, 0, "> ")
+	m.EndChange()
+	if got, want := m.Value(), "> foo qux\nqaz"; got != want {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+	if got := m.LineRunes(1); string(got) != "qaz" {
+		t.Errorf("want line %q, got %q", "qaz", string(got))
+	}
+
+	m.Undo()
+	if got, want := m.Value(), "foo bar\nbaz"; got != want {
+		t.Errorf("undo: want %q, got %q", want, got)
+	}
+
+	m.SetCursor(5, 10)
+	if m.Line() != 1 || m.Column() != 3 {
+		t.Errorf("want the cursor clamped to 1:3, got %d:%d", m.Line(), m.Column())
+	}
+}
+
+func TestOverlay(t *testing.T) {
+	style := lipgloss.NewStyle().Underline(true)
+	m := newTextArea()
+	m.SetValue("foo bar")
+	m.Overlay = func(row int, line []rune) []Span {
+		return []Span{{Start: 4, End: 7, Style: style}}
+	}
+	view := m.View()
+	if !strings.Contains(view, "\x1b[4;") {
+		t.Errorf("expected the overlay in the view, got %q", view)
+	}
+	if got := stripString(view); !strings.HasPrefix(got, ">   1 foo bar") {
+		t.Errorf("the overlay should not change the text, got %q", got)
+	}
+}
+
+func TestNoSoftWrap(t *testing.T) {
+	m := newTextArea()
+	m.ShowLineNumbers = false
+	m.Prompt = ""
+	m.SoftWrap = false
+	m.SetWidth(10)
+	m.SetHeight(2)
+	m.SetValue("a line that is too long\nshort")
+
+	m.SetCursor(0, 0)
+	if got := stripString(m.View()); got != "a line tha\nshort" {
+		t.Errorf("want the line cut off, got %q", got)
+	}
+
+	m.CursorEnd()
+	m, _ = m.Update(nil)
+	if got := stripString(m.View()); !strings.HasPrefix(got, " too long") {
+		t.Errorf("want the view scrolled to the cursor, got %q", got)
+	}
+}
+
+func TestLineNumberDigits(t *testing.T) {
+	m := newTextArea()
+	m.MaxHeight = 0
+	m.SetWidth(20)
+	m.SetValue(strings.Repeat("x\n", 8) + "x")
+	if got := stripString(m.View()); !strings.HasPrefix(got, ">  1 x") {
+		t.Errorf("want one digit for 9 lines, got %q", got)
+	}
+
+	m.SetValue(strings.Repeat("x\n", 99) + "x")
+	if got := stripString(m.View()); !strings.HasPrefix(got, ">    1 x") {
+		t.Errorf("want three digits for 100 lines, got %q", got)
+	}
+}
+
+func TestAutoIndent(t *testing.T) {
+	enter := tea.KeyPressMsg{Code: tea.KeyEnter}
+	m := newTextArea()
+	m.AutoIndent = true
+	m.AutoClosePairs = DefaultAutoClosePairs
+	m = sendString(m, "  if x {")
+	m, _ = m.Update(enter)
+	m = sendString(m, "y")
+	if got, want := m.Value(), "  if x {\n      y\n  }"; got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	m.CursorEnd()
+	m, _ = m.Update(enter)
+	m = sendString(m, "z")
+	if got, want := m.Value(), "  if x {\n      y\n      z\n  }"; got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	m.AutoIndent = false
+	m, _ = m.Update(enter)
+	if m.Column() != 0 {
+		t.Errorf("want no indentation without AutoIndent, got column %d", m.Column())
+	}
+}
+
+func TestAutoClose(t *testing.T) {
+	backspace := tea.KeyPressMsg{Code: tea.KeyBackspace}
+	m := newTextArea()
+	m.AutoClosePairs = DefaultAutoClosePairs
+	m = sendString(m, "f(a[1]")
+	if got, want := m.Value(), "f(a[1])"; got != want || m.Column() != 6 {
+		t.Errorf("want %q with the cursor before the ), got %q at %d", want, got, m.Column())
+	}
+	m = sendString(m, ")")
+	if got, want := m.Value(), "f(a[1])"; got != want || m.Column() != 7 {
+		t.Errorf("want the ) typed over, got %q at %d", got, m.Column())
+	}
+
+	// Quotes aren't closed after words, nor brackets before them.
+	m.SetValue("")
+	m = sendString(m, "don't \"")
+	if got, want := m.Value(), "don't \"\""; got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	m.SetValue("x")
+	m.CursorStart()
+	m = sendString(m, "(")
+	if got, want := m.Value(), "(x"; got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	// Deleting the opening character of an empty pair deletes both.
+	m.SetValue("")
+	m = sendString(m, "{")
+	m, _ = m.Update(backspace)
+	if got := m.Value(); got != "" {
+		t.Errorf("want the pair deleted, got %q", got)
+	}
+
+	m.AutoClosePairs = ""
+	m = sendString(m, "(")
+	if got := m.Value(); got != "(" {
+		t.Errorf("want nothing closed without pairs, got %q", got)
+	}
+}
+
+func TestIndent(t *testing.T) {
+	var (
+		tab      = tea.KeyPressMsg{Code: tea.KeyTab}
+		shiftTab = tea.KeyPressMsg{Code: tea.KeyTab, Mod: tea.ModShift}
+		down     = tea.KeyPressMsg{Code: tea.KeyDown, Mod: tea.ModShift}
+	)
+	m := newTextArea()
+	m.SetValue("a\nb\nc")
+	m.SetCursor(0, 0)
+	m, _ = m.Update(down)
+	m, _ = m.Update(down)
+	m, _ = m.Update(tab)
+	if got, want := m.Value(), "    a\n    b\nc"; got != want {
+		t.Errorf("want the selected lines indented, got %q", got)
+	}
+	if got := m.SelectedText(); got != "    a\n    b\n" {
+		t.Errorf("want the lines still selected, got %q", got)
+	}
+	m, _ = m.Update(shiftTab)
+	m, _ = m.Update(shiftTab)
+	if got, want := m.Value(), "a\nb\nc"; got != want {
+		t.Errorf("want the selected lines outdented, got %q", got)
+	}
+	m.Undo()
+	if got, want := m.Value(), "    a\n    b\nc"; got != want {
+		t.Errorf("want the outdent undone, got %q", got)
+	}
+
+	// Without a selection, tab inserts spaces up to the next tab stop, or a
+	// tab.
+	m.SetValue("ab")
+	m, _ = m.Update(tab)
+	if got := m.Value(); got != "ab  " {
+		t.Errorf("want spaces to the tab stop, got %q", got)
+	}
+	m.ExpandTabs = false
+	m.SetValue("ab")
+	m, _ = m.Update(tab)
+	m.InsertString("\tc")
+	if got := m.Value(); got != "ab\t\tc" {
+		t.Errorf("want tabs kept, got %q", got)
+	}
+}
+
+func TestTabs(t *testing.T) {
+	m := newTextArea()
+	m.ShowLineNumbers = false
+	m.Prompt = ""
+	m.ExpandTabs = false
+	m.TabWidth = 4
+	m.SetWidth(12)
+	m.SetValue("a\tb\tc\n\tdef")
+	m.SetCursor(0, 2)
+
+	if got, want := stripString(m.View()), "a   b   c\n    def"; got != want {
+		t.Errorf("want tabs extended to the tab stops, got %q", got)
+	}
+	if li := m.LineInfo(); li.CharOffset != 4 || li.CharWidth != 10 {
+		t.Errorf("want the cursor at offset 4 of 10, got %+v", li)
+	}
+
+	// The cursor on a tab covers its first cell.
+	m.SetCursor(0, 1)
+	if got, want := stripString(m.View()), "a   b   c\n    def"; got != want {
+		t.Errorf("want the tab under the cursor extended, got %q", got)
+	}
+	m.SetCursor(0, 2)
+
+	// Moving down keeps the display column, across tabs.
+	m.CursorDown()
+	if m.Column() != 1 {
+		t.Errorf("want column 1 below, got %d", m.Column())
+	}
+
+	// Tabs wrap like spaces.
+	m.SetValue("aaaaaa\tbbbb")
+	if got, want := stripString(m.View()), "aaaaaa\nbbbb"; got != want {
+		t.Errorf("want the line wrapped at the tab, got %q", got)
+	}
+
+	m.TabWidth = 2
+	m.SetValue("a\tb")
+	if got, want := stripString(m.View()), "a b"; got != want {
+		t.Errorf("want a tab width of 2, got %q", got)
+	}
+}
+
+func TestMultipleCursors(t *testing.T) {
+	var (
+		below     = tea.KeyPressMsg{Code: tea.KeyDown, Mod: tea.ModCtrl | tea.ModAlt}
+		next      = tea.KeyPressMsg{Code: 'n', Mod: tea.ModAlt}
+		left      = tea.KeyPressMsg{Code: tea.KeyLeft}
+		backspace = tea.KeyPressMsg{Code: tea.KeyBackspace}
+		esc       = tea.KeyPressMsg{Code: tea.KeyEscape}
+	)
+	m := newTextArea()
+	m.SetValue("foo\nfoo\nbar")
+	m.SetCursor(0, 3)
+	m, _ = m.Update(below)
+	m, _ = m.Update(below)
+	if m.CursorCount() != 3 {
+		t.Fatalf("want 3 cursors, got %d", m.CursorCount())
+	}
+	m = sendString(m, "!")
+	if got, want := m.Value(), "foo!\nfoo!\nbar!"; got != want {
+		t.Errorf("want typing at every cursor, got %q", got)
+	}
+	m, _ = m.Update(backspace)
+	m, _ = m.Update(left)
+	m = sendString(m, "x")
+	if got, want := m.Value(), "foxo\nfoxo\nbaxr"; got != want {
+		t.Errorf("want deleting and moving at every cursor, got %q", got)
+	}
+	if m.Line() != 0 || m.Column() != 3 {
+		t.Errorf("want the primary cursor at 0:3, got %d:%d", m.Line(), m.Column())
+	}
+	if view := m.View(); !strings.Contains(view, "\x1b[7m") {
+		t.Errorf("want the extra cursors drawn, got %q", view)
+	}
+
+	m.Undo()
+	if got, want := m.Value(), "foo\nfoo\nbar"; got != want || m.CursorCount() != 1 {
+		t.Errorf("want the change undone in one step and one cursor left, got %q with %d", got, m.CursorCount())
+	}
+
+	// Occurrences of the word are whole words, found after the last cursor
+	// added and wrapping around.
+	m.SetValue("foo bar foo foobar\nfoo")
+	m.SetCursor(0, 1)
+	for range 3 {
+		m, _ = m.Update(next)
+	}
+	if m.CursorCount() != 3 {
+		t.Errorf("want 3 cursors, got %d", m.CursorCount())
+	}
+	m = sendString(m, "_")
+	if got, want := m.Value(), "f_oo bar f_oo foobar\nf_oo"; got != want {
+		t.Errorf("want typing at every occurrence, got %q", got)
+	}
+
+	// Cursors ending up in the same place are merged.
+	m.SetValue("ab\ncd")
+	m.SetCursor(0, 0)
+	m.AddCursor(0, 1)
+	m, _ = m.Update(left)
+	if m.CursorCount() != 1 {
+		t.Errorf("want merged cursors, got %d", m.CursorCount())
+	}
+
+	m.AddCursor(1, 0)
+	m, _ = m.Update(esc)
+	if m.CursorCount() != 1 {
+		t.Errorf("want the extra cursors removed, got %d", m.CursorCount())
+	}
+
+	// Replacing the selection moves the cursors after it along with the
+	// text, and merges those inside it.
+	selectWord := tea.KeyPressMsg{Code: tea.KeyRight, Mod: tea.ModCtrl | tea.ModShift}
+	m.SetValue("foo bar")
+	m.SetCursor(0, 0)
+	m.AddCursor(0, 7)
+	m, _ = m.Update(selectWord)
+	m = sendString(m, "a")
+	if got, want := m.Value(), "a bara"; got != want {
+		t.Errorf("want typing over the selection and at the extra cursor, got %q", got)
+	}
+	m.SetValue("foo bar")
+	m.SetCursor(0, 0)
+	m.AddCursor(0, 2)
+	m.AddCursor(0, 7)
+	m, _ = m.Update(selectWord)
+	m, _ = m.Update(pasteMsg("xy"))
+	if got, want := m.Value(), "xy barxy"; got != want || m.CursorCount() != 2 {
+		t.Errorf("want pasting over the selection and at the extra cursor, got %q with %d cursors", got, m.CursorCount())
+	}
+}
+
+// largeLog returns a 200,000 line log.
+func largeLog() string {
+	var b strings.Builder
+	for i := range 200_000 {
+		fmt.Fprintf(&b, "2024-01-01T00:00:00Z INFO request %d served in %dms\n", i, i%100)
+		if i%10 == 0 {
+			b.WriteString(strings.Repeat("a long line that wraps ", 10) + "\n")
+		}
+	}
+	return b.String()
+}
+
+// largeTextArea returns a text area holding a 200,000 line log.
+func largeTextArea() Model {
+	m := newTextArea()
+	m.MaxHeight = 0
+	m.SetHeight(40)
+	m.SetWidth(120)
+	m.SetValue(largeLog())
+	m.MoveToEnd()
+	return m
+}
+
+func BenchmarkSetValue(b *testing.B) {
+	s := largeLog()
+	m := newTextArea()
+	m.MaxHeight = 0
+	m.SetHeight(40)
+	m.SetWidth(120)
+	b.ResetTimer()
+	for range b.N {
+		m.SetValue(s)
+		m.View()
+	}
+}
+
+func BenchmarkTyping(b *testing.B) {
+	m := largeTextArea()
+	m.row = 100_000
+	m.View()
+	b.ResetTimer()
+	for i := range b.N {
+		// Type lines of 40 characters.
+		msg := keyPress('x')
+		if i%40 == 39 {
+			msg = tea.KeyPressMsg{Code: tea.KeyEnter}
+		}
+		m, _ = m.Update(msg)
+		m.View()
+	}
+}
+
+func BenchmarkTypingHighlighted(b *testing.B) {
+	number := lipgloss.NewStyle().Bold(true)
+	m := largeTextArea()
+	m.SetHighlighter(HighlighterFunc(func(line []rune, state string) ([]Span, string) {
+		var spans []Span
+		for i := 0; i < len(line); i++ {
+			if unicode.IsDigit(line[i]) {
+				start := i
+				for i < len(line) && unicode.IsDigit(line[i]) {
+					i++
+				}
+				spans = append(spans, Span{Start: start, End: i, Style: number})
+			}
+		}
+		return spans, state
+	}))
+	m.row = 100_000
+	m.View()
+	b.ResetTimer()
+	for i := range b.N {
+		msg := keyPress('x')
+		if i%40 == 39 {
+			msg = tea.KeyPressMsg{Code: tea.KeyEnter}
+		}
+		m, _ = m.Update(msg)
+		m.View()
+	}
+}
+
+func BenchmarkTypingOnChange(b *testing.B) {
+	m := largeTextArea()
+	changes := 0
+	m.OnChange = func(Change) { changes++ }
+	m.row = 100_000
+	m.View()
+	b.ResetTimer()
+	for i := range b.N {
+		msg := keyPress('x')
+		if i%40 == 39 {
+			msg = tea.KeyPressMsg{Code: tea.KeyEnter}
+		}
+		m, _ = m.Update(msg)
+		m.View()
+	}
+	if changes != b.N {
+		b.Fatalf("want %d changes, got %d", b.N, changes)
+	}
+}
+
+func BenchmarkNewline(b *testing.B) {
+	m := largeTextArea()
+	m.row = 100_000
+	m.View()
+	b.ResetTimer()
+	for range b.N {
+		m, _ = m.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+		m.View()
+	}
+}
+
+func BenchmarkPageDown(b *testing.B) {
+	m := largeTextArea()
+	m.MoveToBegin()
+	m.View()
+	b.ResetTimer()
+	for range b.N {
+		m, _ = m.Update(tea.KeyPressMsg{Code: tea.KeyPgDown})
+		m.View()
+	}
+}
+
 func newTextArea() Model {
 	textarea := New()
 
@@ -2013,3 +2999,554 @@ func stripString(str string) string {
 
 	return strings.Join(lines, "\n")
 }
+
+func TestGraphemes(t *testing.T) {
+	corpus := []struct {
+		name  string
+		value string
+	}{
+		{"cjk", "日本語のテキスト"},
+		{"emoji", "a👍🏽b👨\u200d👩\u200d👧c🇯🇵d"},
+		{"rtl", "a\u200fשלום\u200f b"},
+		{"combining", "cafe\u0301 n\u0303o\u0308 x"},
+		{"mixed", "漢a👍🏽e\u0301\u200fz 字"},
+	}
+	keys := []struct {
+		name string
+		msg  tea.Msg
+	}{
+		{"right", tea.KeyPressMsg{Code: tea.KeyRight}},
+		{"right", tea.KeyPressMsg{Code: tea.KeyRight}},
+		{"right", tea.KeyPressMsg{Code: tea.KeyRight}},
+		{"right", tea.KeyPressMsg{Code: tea.KeyRight}},
+		{"backspace", tea.KeyPressMsg{Code: tea.KeyBackspace}},
+		{"left", tea.KeyPressMsg{Code: tea.KeyLeft}},
+		{"delete", tea.KeyPressMsg{Code: tea.KeyDelete}},
+	}
+
+	for _, tc := range corpus {
+		t.Run(tc.name, func(t *testing.T) {
+			m := newTextArea()
+			m.Prompt = ""
+			m.ShowLineNumbers = false
+			m.SetVirtualCursor(false)
+			m.SetWidth(6)
+			m.SetHeight(4)
+			m.SetValue(tc.value)
+			m.MoveToBegin()
+
+			var b strings.Builder
+			record := func(step string) {
+				c := m.Cursor()
+				fmt.Fprintf(&b, "%s: %q col=%d cursor=%d,%d\n%s\n\n",
+					step, m.Value(), m.Column(), c.X, c.Y, stripString(m.View()))
+			}
+			record("start")
+			for _, k := range keys {
+				m, _ = m.Update(k.msg)
+				record(k.name)
+			}
+			golden.RequireEqual(t, b.String())
+		})
+	}
+}
+
+func TestWrapModes(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(m *Model)
+		value string
+		want  string
+	}{
+		{
+			name:  "word",
+			value: "one two three four",
+			want:  "one two\nthree\nfour",
+		},
+		{
+			name:  "char",
+			setup: func(m *Model) { m.WrapMode = WrapChar },
+			value: "one two three four",
+			want:  "one two th\nree four",
+		},
+		{
+			name:  "none",
+			setup: func(m *Model) { m.WrapMode = WrapNone },
+			value: "one two three four",
+			want:  "one two th",
+		},
+		{
+			name:  "indicator",
+			setup: func(m *Model) { m.WrapIndicator = "↪ " },
+			value: "one two three four five",
+			want:  "one two\n↪ three\n↪ four\n↪ five",
+		},
+		{
+			name:  "break indent",
+			setup: func(m *Model) { m.BreakIndent = true },
+			value: "  one two three",
+			want:  "  one two\n  three",
+		},
+		{
+			name: "hanging indent",
+			setup: func(m *Model) {
+				m.WrapMode = WrapChar
+				m.HangingIndent = 2
+			},
+			value: "abcdefghijklmnop",
+			want:  "abcdefghij\n  klmnop",
+		},
+		{
+			name:  "indent capped",
+			setup: func(m *Model) { m.HangingIndent = 20 },
+			value: "aaaaaaaaaaaaaaa",
+			want:  "aaaaaaaaaa\n     aaaaa",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTextArea()
+			m.ShowLineNumbers = false
+			m.Prompt = ""
+			m.SetWidth(10)
+			if tt.setup != nil {
+				tt.setup(&m)
+			}
+			m.SetValue(tt.value)
+			m.SetCursor(0, 0)
+			if got := stripString(m.View()); got != tt.want {
+				t.Errorf("want:\n%s\ngot:\n%s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestWrapIndicator(t *testing.T) {
+	m := newTextArea()
+	m.ShowLineNumbers = false
+	m.Prompt = ""
+	m.SetWidth(10)
+	m.SetVirtualCursor(false)
+	m.WrapIndicator = "> "
+	m.BreakIndent = true
+	m.SetValue("  one two three four")
+	m.SetCursor(0, 4)
+
+	// The cursor keeps its display column on continuation rows, which start
+	// past the indicator and the indentation.
+	m.CursorDown()
+	if m.Column() != 10 {
+		t.Errorf("want the cursor at the start of the second row, got column %d", m.Column())
+	}
+	if c := m.Cursor(); c.X != 4 || c.Y != 1 {
+		t.Errorf("want the cursor at 4,1, got %d,%d", c.X, c.Y)
+	}
+	m.CursorUp()
+	if m.Column() != 4 {
+		t.Errorf("want the cursor back at column 4, got %d", m.Column())
+	}
+
+	// Clicking continuation rows accounts for their indentation.
+	m, _ = m.Update(tea.MouseClickMsg{X: 5, Y: 1, Button: tea.MouseLeft})
+	if m.Column() != 11 {
+		t.Errorf("want a click after the indentation at column 11, got %d", m.Column())
+	}
+	m, _ = m.Update(tea.MouseClickMsg{X: 1, Y: 1, Button: tea.MouseLeft})
+	if m.Column() != 10 {
+		t.Errorf("want a click on the indicator at column 10, got %d", m.Column())
+	}
+}
+
+func TestReflow(t *testing.T) {
+	reflow := tea.KeyPressMsg{Code: 'q', Mod: tea.ModAlt}
+
+	m := newTextArea()
+	m.ReflowWidth = 10
+	m.SetValue("one two\nthree four five\n\nsix seven")
+	m.SetCursor(1, 6)
+	m, _ = m.Update(reflow)
+	if got, want := m.Value(), "one two\nthree four\nfive\n\nsix seven"; got != want {
+		t.Errorf("want the paragraph reflowed, got %q", got)
+	}
+	if m.Line() != 1 || m.Column() != 6 {
+		t.Errorf("want the cursor kept on the same character, got %d,%d", m.Line(), m.Column())
+	}
+
+	// Reflowing can be undone in a single step.
+	m, _ = m.Update(tea.KeyPressMsg{Code: 'z', Mod: tea.ModCtrl})
+	if got, want := m.Value(), "one two\nthree four five\n\nsix seven"; got != want {
+		t.Errorf("want reflowing undone, got %q", got)
+	}
+
+	// With a selection, the paragraphs of the selected lines are reflowed.
+	m.ReflowWidth = 20
+	m.SelectAll()
+	m, _ = m.Update(reflow)
+	if got, want := m.Value(), "one two three four\nfive\n\nsix seven"; got != want {
+		t.Errorf("want the selected paragraphs reflowed, got %q", got)
+	}
+
+	// Between paragraphs, nothing happens.
+	m.SetCursor(2, 0)
+	m, _ = m.Update(reflow)
+	if got, want := m.Value(), "one two three four\nfive\n\nsix seven"; got != want {
+		t.Errorf("want nothing reflowed, got %q", got)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	m := newTextArea()
+	m.SetValue("foo bar")
+	m.ReadOnly = true
+
+	m.SetCursor(0, 3)
+	m = sendString(m, "xyz")
+	m, _ = m.Update(tea.KeyPressMsg{Code: tea.KeyBackspace})
+	m, _ = m.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	m, _ = m.Update(tea.PasteMsg{Content: "baz"})
+	m, _ = m.Update(tea.KeyPressMsg{Code: 'z', Mod: tea.ModCtrl})
+	if got := m.Value(); got != "foo bar" {
+		t.Errorf("want the value unchanged, got %q", got)
+	}
+	if m.Line() != 0 || m.Column() != 3 {
+		t.Errorf("want the cursor unmoved, got %d,%d", m.Line(), m.Column())
+	}
+
+	// The cursor moves, and text can be selected and copied, but not cut.
+	m, _ = m.Update(tea.KeyPressMsg{Code: tea.KeyRight})
+	if m.Column() != 4 {
+		t.Errorf("want the cursor moved, got column %d", m.Column())
+	}
+	m, _ = m.Update(tea.KeyPressMsg{Code: tea.KeyRight, Mod: tea.ModShift})
+	if got := m.SelectedText(); got != "b" {
+		t.Errorf("want %q selected, got %q", "b", got)
+	}
+	var cmd tea.Cmd
+	m, cmd = m.Update(tea.KeyPressMsg{Code: 'x', Mod: tea.ModCtrl})
+	if cmd == nil {
+		t.Error("want the selection copied")
+	}
+	if got := m.Value(); got != "foo bar" {
+		t.Errorf("want the value unchanged by cutting, got %q", got)
+	}
+
+	// The methods still edit the value.
+	m.InsertString("!")
+	if got := m.Value(); got != "foo b!ar" {
+		t.Errorf("want the string inserted, got %q", got)
+	}
+}
+
+func TestProtectedRanges(t *testing.T) {
+	backspace := tea.KeyPressMsg{Code: tea.KeyBackspace}
+
+	m := newTextArea()
+	m.SetValue("name: Ada\nage: 36")
+	m.Protect(Range{Start: 10, End: 15})
+	m.Protect(Range{Start: 0, End: 6})
+	protected := func() []string {
+		value := []rune(m.Value())
+		var texts []string
+		for _, r := range m.ProtectedRanges() {
+			texts = append(texts, string(value[r.Start:r.End]))
+		}
+		return texts
+	}
+	check := func(value string, texts ...string) {
+		t.Helper()
+		if got := m.Value(); got != value {
+			t.Errorf("want value %q, got %q", value, got)
+		}
+		if got := protected(); !slices.Equal(got, texts) {
+			t.Errorf("want %q protected, got %q", texts, got)
+		}
+	}
+	check("name: Ada\nage: 36", "name: ", "age: ")
+
+	// Text can't be typed or pasted inside protected text.
+	m.SetCursor(0, 2)
+	m = sendString(m, "x")
+	m, _ = m.Update(tea.PasteMsg{Content: "y"})
+	check("name: Ada\nage: 36", "name: ", "age: ")
+
+	// Text typed at the edges isn't protected, and moves what follows.
+	m.SetCursor(0, 6)
+	m = sendString(m, "x")
+	m.SetCursor(1, 0)
+	m = sendString(m, "#")
+	check("name: xAda\n#age: 36", "name: ", "age: ")
+
+	// Deleting stops at protected text.
+	m.SetCursor(0, 7)
+	m, _ = m.Update(backspace)
+	m, _ = m.Update(backspace)
+	check("name: Ada\n#age: 36", "name: ", "age: ")
+	m.SetCursor(0, 0)
+	m, _ = m.Update(tea.KeyPressMsg{Code: tea.KeyDelete})
+	check("name: Ada\n#age: 36", "name: ", "age: ")
+
+	// Deleting a selection across protected text only deletes the text
+	// next to the cursor.
+	m.SelectAll()
+	m, _ = m.Update(backspace)
+	check("name: Ada\n#age: ", "name: ", "age: ")
+
+	if m.CanReplace(0, 0, 0, 4) || !m.CanReplace(0, 6, 1, 1) {
+		t.Error("want only unprotected text replaceable")
+	}
+
+	// The methods edit protected text, shrinking the ranges.
+	m.ReplaceRange(0, 2, 0, 9, "")
+	check("na\n#age: ", "na", "age: ")
+
+	// Protected text is styled.
+	styles := m.Styles()
+	styles.Focused.Protected = lipgloss.NewStyle().Underline(true)
+	m.SetStyles(styles)
+	if view := m.View(); !strings.Contains(view, "\x1b[4") {
+		t.Errorf("want protected text styled, got %q", view)
+	}
+
+	// Setting the value clears the ranges.
+	m.SetValue("foo")
+	check("foo")
+
+	// Undo and redo leave protected text alone, but not the text around it.
+	m.SetValue("header\n")
+	m.Protect(Range{Start: 0, End: 6})
+	m.SetCursor(1, 0)
+	m = sendString(m, "body")
+	m.Undo()
+	check("header\n", "header")
+	m.Undo()
+	check("header\n", "header")
+	m.Redo()
+	check("header\nbody", "header")
+
+	// Edits next to protected text are checked where they're made, even
+	// where the text around them would fit inside the range.
+	m.SetValue("xaby")
+	m.Protect(Range{Start: 1, End: 3})
+	m.SetCursor(0, 1)
+	m = sendString(m, "a")
+	check("xaaby", "ab")
+	m.Undo()
+	check("xaby", "ab")
+	m.SetValue("aab")
+	m.Protect(Range{Start: 1, End: 3})
+	m.SetCursor(0, 1)
+	m, _ = m.Update(backspace)
+	check("ab", "ab")
+	m.Undo()
+	check("aab", "ab")
+}
+
+func TestChanges(t *testing.T) {
+	var changes []Change
+	m := newTextArea()
+	m.OnChange = func(c Change) { changes = append(changes, c) }
+
+	m.SetValue("foo\nbar")
+	m.SetCursor(0, 3)
+	m = sendString(m, "d")
+	m, _ = m.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	m, _ = m.Update(tea.KeyPressMsg{Code: tea.KeyBackspace})
+	m.ReplaceRange(0, 1, 1, 2, "x\ny")
+	m.AddCursor(1, 0)
+	m.SetCursor(0, 0)
+	m = sendString(m, "-")
+	m.ClearCursors()
+	m, _ = m.Update(tea.KeyPressMsg{Code: 'z', Mod: tea.ModCtrl})
+	m.Reset()
+
+	want := []Change{
+		{Kind: ChangeInsert, EndRow: 0, NewEndRow: 1, NewEndCol: 3, NewText: "foo\nbar"},
+		{Kind: ChangeInsert, StartCol: 3, EndCol: 3, NewEndCol: 4, NewText: "d"},
+		{Kind: ChangeInsert, StartCol: 4, EndCol: 4, NewEndRow: 1, NewText: "\n"},
+		{Kind: ChangeDelete, StartCol: 4, EndRow: 1, NewEndCol: 4, OldText: "\n"},
+		{Kind: ChangeReplace, StartCol: 1, EndRow: 1, EndCol: 2, NewEndRow: 1, NewEndCol: 1, OldText: "ood\nba", NewText: "x\ny"},
+		{Kind: ChangeInsert, StartRow: 1, EndRow: 1, NewEndRow: 1, NewEndCol: 1, NewText: "-"},
+		{Kind: ChangeInsert, NewEndCol: 1, NewText: "-"},
+		{Kind: ChangeDelete, EndCol: 1, OldText: "-"},
+		{Kind: ChangeDelete, StartRow: 1, EndRow: 1, EndCol: 1, NewEndRow: 1, OldText: "-"},
+		{Kind: ChangeDelete, EndRow: 1, EndCol: 2, OldText: "fx\nyr"},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("want %d changes, got %d: %+v", len(want), len(changes), changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("change %d: want %+v, got %+v", i, want[i], changes[i])
+		}
+	}
+
+	// Changes are reported where they were made, even where the text around
+	// them would fit elsewhere, and redone one by one.
+	m.SetValue("abc\nabc")
+	m.AddCursor(1, 0)
+	m.SetCursor(0, 0)
+	changes = nil
+	m = sendString(m, "a")
+	m.ClearCursors()
+	m.Undo()
+	m.Redo()
+	want = []Change{
+		{Kind: ChangeInsert, StartRow: 1, EndRow: 1, NewEndRow: 1, NewEndCol: 1, NewText: "a"},
+		{Kind: ChangeInsert, NewEndCol: 1, NewText: "a"},
+		{Kind: ChangeDelete, EndCol: 1, OldText: "a"},
+		{Kind: ChangeDelete, StartRow: 1, EndRow: 1, EndCol: 1, NewEndRow: 1, OldText: "a"},
+		{Kind: ChangeInsert, StartRow: 1, EndRow: 1, NewEndRow: 1, NewEndCol: 1, NewText: "a"},
+		{Kind: ChangeInsert, NewEndCol: 1, NewText: "a"},
+	}
+	if !slices.Equal(changes, want) {
+		t.Errorf("want %+v, got %+v", want, changes)
+	}
+	if got := m.Value(); got != "aabc\naabc" {
+		t.Errorf("want the value redone, got %q", got)
+	}
+}
+
+func TestGutter(t *testing.T) {
+	m := newTextArea()
+	m.ShowLineNumbers = false
+	m.Prompt = ""
+	m.SetWidth(24)
+	m.SetHeight(6)
+	m.SetVirtualCursor(false)
+	m.SetGutter(DiagnosticColumn, ChangeColumn, FoldColumn, GutterColumn{
+		Width: 3,
+		Func: func(info GutterContext) string {
+			if info.Soft {
+				return "  |"
+			}
+			return fmt.Sprintf("%2d|", info.Index+1)
+		},
+	})
+	if m.Width() != 16 {
+		t.Errorf("want the text 16 cells wide, got %d", m.Width())
+	}
+	m.SetValue("func main() {\n\tfmt.Println(x)\n}\nlonger than twelve")
+	m.SetDiagnostics([]Diagnostic{
+		{Row: 1, Severity: SeverityWarning, Message: "unused"},
+		{Row: 1, Severity: SeverityError, Message: "undefined: x"},
+	})
+	m.SetLineChanges(map[int]LineChange{1: LineChanged, 3: LineAdded})
+	m.SetFoldIndicators(map[int]FoldState{0: FoldOpen})
+	m.SetCursor(1, 0)
+
+	want := []string{
+		"   ▾  1|func main() {",
+		"E ┃   2|",
+		"  ┃    |fmt.Println(x)",
+		"      3|}",
+		"  ┃   4|longer than",
+		"  ┃    |twelve",
+	}
+	got := strings.Split(stripString(m.View()), "\n")
+	for i := range want {
+		if strings.TrimRight(got[i], " ") != want[i] {
+			t.Errorf("row %d: want %q, got %q", i, want[i], got[i])
+		}
+	}
+
+	// The cursor is past the gutter.
+	if c := m.Cursor(); c.X != 8 || c.Y != 1 {
+		t.Errorf("want the cursor at 8,1, got %d,%d", c.X, c.Y)
+	}
+	m, _ = m.Update(tea.MouseClickMsg{X: 9, Y: 0, Button: tea.MouseLeft})
+	if m.Line() != 0 || m.Column() != 1 {
+		t.Errorf("want a click at 0,1, got %d,%d", m.Line(), m.Column())
+	}
+
+	// The message of the most severe diagnostic of the cursor line is shown
+	// after it.
+	if ds := m.LineDiagnostics(1); len(ds) != 2 || ds[0].Message != "undefined: x" {
+		t.Errorf("want the most severe diagnostic first, got %+v", ds)
+	}
+	m.SetValue("x")
+	m.SetFoldIndicators(nil)
+	m.SetDiagnostics([]Diagnostic{{Row: 0, Severity: SeverityError, Message: "undefined: x"}})
+	if got := strings.TrimRight(strings.Split(stripString(m.View()), "\n")[0], " "); got != "E     1|x  undefined: x" {
+		t.Errorf("want the diagnostic message shown, got %q", got)
+	}
+	m.ShowDiagnosticMessages = false
+	if got := strings.TrimRight(strings.Split(stripString(m.View()), "\n")[0], " "); got != "E     1|x" {
+		t.Errorf("want no diagnostic message shown, got %q", got)
+	}
+
+	// Unknown severities are shown as hints.
+	m.SetDiagnostics([]Diagnostic{{Row: 0, Severity: Severity(7)}})
+	if got := strings.TrimRight(strings.Split(stripString(m.View()), "\n")[0], " "); got != "H     1|x" {
+		t.Errorf("want an unknown severity shown as a hint, got %q", got)
+	}
+}
+
+func TestFolds(t *testing.T) {
+	m := newTextArea()
+	m.ShowLineNumbers = false
+	m.Prompt = ""
+	m.SetWidth(20)
+	m.SetHeight(4)
+	m.SetGutter(FoldColumn)
+	m.SetValue("a:\n  b: 1\n  c:\n    d: 2\ne: 3")
+	view := func() string {
+		t.Helper()
+		var rows []string
+		for _, row := range strings.Split(stripString(m.View()), "\n") {
+			if row = strings.TrimRight(row, " "); row != "" {
+				rows = append(rows, row)
+			}
+		}
+		return strings.Join(rows, "\n")
+	}
+
+	m.FoldByIndent()
+	if got, want := m.Folds(), []Fold{{Start: 0, End: 3}, {Start: 2, End: 3}}; !slices.Equal(got, want) {
+		t.Fatalf("want folds %v, got %v", want, got)
+	}
+
+	// Closing folds moves the cursor out of them.
+	m.SetCursor(3, 2)
+	m.CloseAllFolds()
+	if m.Line() != 0 {
+		t.Errorf("want the cursor on the first line of the fold, got row %d", m.Line())
+	}
+	if got, want := view(), "▸ a: ⋯ 3 lines\n  e: 3"; got != want {
+		t.Errorf("want the fold collapsed\n%s\ngot\n%s", want, got)
+	}
+
+	// The cursor moves over closed folds.
+	m.CursorDown()
+	if m.Line() != 4 {
+		t.Errorf("want the cursor moved over the fold, got row %d", m.Line())
+	}
+	m.CursorUp()
+	if m.Line() != 0 {
+		t.Errorf("want the cursor moved back over the fold, got row %d", m.Line())
+	}
+
+	// Toggling opens the outer fold, leaving the inner one closed.
+	m.ToggleFold(0)
+	if got, want := view(), "▾ a:\n    b: 1\n▸   c: ⋯ 1 line\n  e: 3"; got != want {
+		t.Errorf("want the outer fold open\n%s\ngot\n%s", want, got)
+	}
+
+	// Folds move along with edits, and moving the cursor into a closed fold
+	// opens it.
+	m.SetCursor(0, 0)
+	m.InsertString("x\n")
+	if got, want := m.Folds(), []Fold{{Start: 1, End: 4}, {Start: 3, End: 4, Closed: true}}; !slices.Equal(got, want) {
+		t.Errorf("want folds %v, got %v", want, got)
+	}
+	m.SetCursor(4, 0)
+	if _, ok := m.ClosedFold(4); ok {
+		t.Error("want the fold of the cursor opened")
+	}
+
+	m.SetValue("x {{{\ny {{{\nz\n}}}\n}}}")
+	m.FoldByMarker("{{{", "}}}")
+	if got, want := m.Folds(), []Fold{{Start: 0, End: 4}, {Start: 1, End: 3}}; !slices.Equal(got, want) {
+		t.Errorf("want folds %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,336 @@
+package textarea
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/charmbracelet/x/ansi"
+	"github.com/haochend413/bubbles/v2/internal/runeutil"
+	"github.com/haochend413/lipgloss/v2"
+	"github.com/rivo/uniseg"
+)
+
+// WrapMode is how lines wider than the textarea are soft-wrapped.
+type WrapMode int
+
+const (
+	// WrapWord wraps lines between words. Only words wider than the
+	// textarea are split.
+	WrapWord WrapMode = iota
+
+	// WrapChar wraps lines between any two characters, filling every row.
+	WrapChar
+
+	// WrapNone doesn't wrap lines. They're cut off instead, and the view
+	// scrolls horizontally to keep the cursor visible.
+	WrapNone
+)
+
+// wrapMode returns how lines are wrapped, taking SoftWrap into account.
+func (m Model) wrapMode() WrapMode {
+	if !m.SoftWrap {
+		return WrapNone
+	}
+	return m.WrapMode
+}
+
+// wrapping holds what soft-wrapping a line depends on.
+type wrapping struct {
+	width    int
+	tabWidth int
+	mode     WrapMode
+
+	// hang is the width that the rows a line continues on start with: that
+	// of the WrapIndicator and of the HangingIndent.
+	hang int
+
+	// breakIndent adds the indentation of a line to that of its continuation
+	// rows.
+	breakIndent bool
+}
+
+// wrapping returns what soft-wrapping lines depends on.
+func (m Model) wrapping() wrapping {
+	w := wrapping{width: m.width, tabWidth: m.tabStop(), mode: m.wrapMode()}
+	if w.mode == WrapNone {
+		// Lines aren't wrapped, so they're not wrapped differently.
+		return wrapping{mode: WrapNone}
+	}
+	w.hang = uniseg.StringWidth(m.WrapIndicator) + max(0, m.HangingIndent)
+	w.breakIndent = m.BreakIndent
+	return w
+}
+
+// indent returns the width that the rows a line continues on are indented
+// by. It's at most half the width, so that there's room left for text.
+func (w wrapping) indent(line []rune) int {
+	n := w.hang
+	if w.breakIndent {
+		n += textWidth(indentation(line), w.tabWidth)
+	}
+	return min(n, w.width/2)
+}
+
+// wrap soft-wraps a line into the rows it's displayed on. Its continuation
+// rows are narrower by their indentation. Other whitespace than tabs is
+// displayed as spaces. Like the rows past the end of the value, the last row
+// ends with a space, which the cursor is on at the end of the line.
+func (w wrapping) wrap(runes []rune) [][]rune {
+	switch w.mode {
+	case WrapNone:
+		return [][]rune{append(slices.Clone(runes), ' ')}
+	case WrapChar:
+		return wrapChars(runes, w.width, w.width-w.indent(runes), w.tabWidth)
+	}
+	return wrapWords(runes, w.width, w.width-w.indent(runes), w.tabWidth)
+}
+
+// height returns the number of rows a line is displayed on, like
+// len(w.wrap(line)) does.
+func (w wrapping) height(line []rune) int {
+	if w.mode == WrapNone {
+		return 1
+	}
+	// Lines that fit are common enough to be worth not wrapping, and lines of
+	// printable ASCII characters are even quicker to measure.
+	ascii := true
+	for _, r := range line {
+		if r != ' ' && unicode.IsSpace(r) {
+			return len(w.wrap(line))
+		}
+		ascii = ascii && r >= ' ' && r <= '~'
+	}
+	if ascii && len(line) < w.width || uniseg.StringWidth(string(line)) < w.width {
+		return 1
+	}
+	return len(w.wrap(line))
+}
+
+// wrap word-wraps runes to width, with tab stops every defaultTabWidth
+// columns.
+func wrap(runes []rune, width int) [][]rune {
+	return wrapping{width: width, tabWidth: defaultTabWidth}.wrap(runes)
+}
+
+// lineHeight returns the number of display lines of a line soft-wrapped to
+// width, like len(wrap(line, width)) does.
+func lineHeight(line []rune, width int) int {
+	return wrapping{width: width, tabWidth: defaultTabWidth}.height(line)
+}
+
+// displayedSpace returns a whitespace character as it's displayed: tabs as
+// they are, and other whitespace as a space.
+func displayedSpace(char []rune) []rune {
+	gap := slices.Clone(char)
+	if gap[0] != '\t' {
+		gap[0] = ' '
+	}
+	return gap
+}
+
+// wrapWords wraps runes between words, to first columns on the first row and
+// to rest on the others. Tabs extend to the next multiple of tabWidth from
+// the start of their row.
+func wrapWords(runes []rune, first, rest, tabWidth int) [][]rune {
+	var (
+		lines = [][]rune{{}}
+		word  = []rune{}
+		row   int
+		width = first
+	)
+	newRow := func() {
+		row++
+		lines = append(lines, []rune{})
+		width = rest
+	}
+
+	// Word wrap the runes, keeping the runes of each character together.
+	for i := 0; i < len(runes); {
+		next := runeutil.NextGrapheme(runes, i)
+		char := runes[i:next]
+		i = next
+		if !unicode.IsSpace(char[0]) {
+			word = append(word, char...)
+			// If the last character is a double-width one, then we may not be able to add it to this line
+			// as it might cause us to go past the width.
+			lastCharLen := uniseg.StringWidth(string(char))
+			if uniseg.StringWidth(string(word))+lastCharLen > width {
+				// If the current line has any content, let's move to the next
+				// line because the current word fills up the entire line.
+				if len(lines[row]) > 0 {
+					newRow()
+				}
+				lines[row] = append(lines[row], word...)
+				word = nil
+			}
+			continue
+		}
+
+		gap := displayedSpace(char)
+		x := textWidth(lines[row], tabWidth) + uniseg.StringWidth(string(word))
+		gapWidth := uniseg.StringWidth(string(gap))
+		if gap[0] == '\t' {
+			gapWidth = tabWidthAt(x, tabWidth)
+		}
+		if x+gapWidth > width {
+			newRow()
+		}
+		lines[row] = append(lines[row], word...)
+		lines[row] = append(lines[row], gap...)
+		word = nil
+	}
+
+	if textWidth(lines[row], tabWidth)+uniseg.StringWidth(string(word)) >= width {
+		newRow()
+	}
+	lines[row] = append(lines[row], word...)
+	// We add an extra space at the end of the line to account for the
+	// trailing space at the end of the previous soft-wrapped lines so that
+	// behaviour when navigating is consistent and so that we don't need to
+	// continually add edges to handle the last line of the wrapped input.
+	lines[row] = append(lines[row], ' ')
+
+	return lines
+}
+
+// wrapChars wraps runes between characters, to first columns on the first
+// row and to rest on the others. Tabs extend to the next multiple of
+// tabWidth from the start of their row.
+func wrapChars(runes []rune, first, rest, tabWidth int) [][]rune {
+	lines := [][]rune{{}}
+	row, x, width := 0, 0, first
+	for i := 0; i < len(runes); {
+		next, w := nextChar(runes, i, x, tabWidth)
+		if x+w > width && len(lines[row]) > 0 {
+			row++
+			lines = append(lines, []rune{})
+			x, width = 0, rest
+			next, w = nextChar(runes, i, x, tabWidth)
+		}
+		char := runes[i:next]
+		if unicode.IsSpace(char[0]) {
+			char = displayedSpace(char)
+		}
+		lines[row] = append(lines[row], char...)
+		x += w
+		i = next
+	}
+	// Like wrapWords, the last row ends with a space for the cursor, on a row
+	// of its own if the last one is full.
+	if x >= width {
+		lines = append(lines, []rune{})
+		row++
+	}
+	lines[row] = append(lines[row], ' ')
+	return lines
+}
+
+// rowIndent returns the width that a row of a line is indented by: 0 for
+// the first row, and the indentation of the continuation rows for the
+// others.
+func (m Model) rowIndent(line []rune, row int) int {
+	if row == 0 || m.wrapMode() == WrapNone {
+		return 0
+	}
+	return m.wrapping().indent(line)
+}
+
+// rowPrefix returns what a row of a line starts with: the WrapIndicator,
+// followed by spaces up to the indentation of the row, rendered with style.
+func (m Model) rowPrefix(line []rune, row int, style lipgloss.Style) string {
+	indent := m.rowIndent(line, row)
+	if indent == 0 {
+		return ""
+	}
+	indicator := ansi.Truncate(m.WrapIndicator, indent, "")
+	spaces := strings.Repeat(" ", indent-uniseg.StringWidth(indicator))
+	return m.activeStyle().WrapIndicator.Inherit(style).Render(indicator) + style.Render(spaces)
+}
+
+// Reflow hard-wraps the paragraph the cursor is in, or the paragraphs of
+// the selected lines, at the ReflowWidth. Paragraphs are separated by blank
+// lines. The cursor stays on the same character, and the change can be
+// undone. Like the keys, it doesn't edit protected text or a ReadOnly
+// textarea.
+func (m *Model) Reflow() {
+	m.beginEdit(editOther)
+	m.guard(m.reflow)
+	m.endEdit()
+	m.recalculateHeight()
+}
+
+// reflow hard-wraps the paragraph the cursor is in, or the selected lines.
+func (m *Model) reflow() {
+	first, last := m.indentedRows()
+	if !m.selection.active {
+		if isBlankLine(m.value.Line(m.row)) {
+			// The cursor is between paragraphs.
+			return
+		}
+		for first > 0 && !isBlankLine(m.value.Line(first-1)) {
+			first--
+		}
+		for last < m.value.Len()-1 && !isBlankLine(m.value.Line(last+1)) {
+			last++
+		}
+	}
+	m.ClearSelection()
+
+	// The cursor is kept after the same number of non-space characters.
+	lines := make([][]rune, 0, last-first+1)
+	chars := 0
+	for row, line := range m.value.Lines(first) {
+		if row > last {
+			break
+		}
+		lines = append(lines, line)
+		switch {
+		case row < m.row:
+			chars += nonSpaceCount(line)
+		case row == m.row:
+			chars += nonSpaceCount(line[:min(m.col, len(line))])
+		}
+	}
+
+	width := m.ReflowWidth
+	if width <= 0 {
+		width = m.width
+	}
+	lines = runeutil.Reflow(lines, width, m.tabStop())
+	m.setLines(first, last+1, lines...)
+
+	m.row, m.col = first, 0
+	for i, line := range lines {
+		m.row = first + i
+		n := nonSpaceCount(line)
+		if chars < n || i == len(lines)-1 {
+			col := 0
+			for ; col < len(line) && (chars > 0 || unicode.IsSpace(line[col])); col++ {
+				if !unicode.IsSpace(line[col]) {
+					chars--
+				}
+			}
+			m.SetCursorColumn(col)
+			break
+		}
+		chars -= n
+	}
+}
+
+// isBlankLine reports whether a line is made of whitespace only.
+func isBlankLine(line []rune) bool {
+	return !slices.ContainsFunc(line, func(r rune) bool { return !unicode.IsSpace(r) })
+}
+
+// nonSpaceCount returns the number of runes of a line that aren't
+// whitespace.
+func nonSpaceCount(line []rune) int {
+	n := 0
+	for _, r := range line {
+		if !unicode.IsSpace(r) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,695 @@
+package textarea_vim
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	tea "charm.land/bubbletea/v2"
+	"github.com/haochend413/bubbles/v2/textarea"
+	"github.com/haochend413/bubbles/v2/textinput"
+)
+
+// WriteMsg is sent by the :write command. What writing means is up to the
+// application.
+type WriteMsg struct {
+	// Path is the file name given to the command, if any.
+	Path string
+
+	// Force is set if the command was run as :write!.
+	Force bool
+}
+
+// QuitMsg is sent by the :quit command. What quitting means is up to the
+// application.
+type QuitMsg struct {
+	// Force is set if the command was run as :quit!.
+	Force bool
+}
+
+// ExArgs holds what an ex command was given on the command line.
+type ExArgs struct {
+	// Start and End are the first and last rows of the range the command
+	// applies to, counting from 0. Without a range, both are the cursor row.
+	Start, End int
+
+	// HasRange is set if a range was given.
+	HasRange bool
+
+	// Bang is set if the command name was followed by "!".
+	Bang bool
+
+	// Arg is the rest of the command line after the name, with leading
+	// blanks removed.
+	Arg string
+}
+
+// ExCommand is a command that can be run from the ":" command line.
+type ExCommand struct {
+	// Name is the full name of the command. Like in Vim, a command can also
+	// be run by any unambiguous prefix of its name.
+	Name string
+
+	// Aliases are other names the command can be run by, such as "w" for
+	// "write".
+	Aliases []string
+
+	// Run runs the command. The returned error is shown in place of the
+	// statusbar.
+	Run func(m *Model, args ExArgs) (tea.Cmd, error)
+
+	// Complete, if set, returns the completions of the argument typed so
+	// far. Each completion replaces the whole argument.
+	Complete func(m Model, arg string) []string
+}
+
+// builtinExCommands are the ex commands every textarea has.
+var builtinExCommands = []ExCommand{
+	{Name: "write", Aliases: []string{"w"}, Run: exWrite},
+	{Name: "quit", Aliases: []string{"q"}, Run: exQuit},
+	{Name: "wq", Aliases: []string{"x", "xit"}, Run: exWriteQuit},
+	{Name: "substitute", Aliases: []string{"s"}, Run: exSubstitute},
+	{Name: "set", Aliases: []string{"se"}, Run: exSet, Complete: completeSet},
+	{Name: "nohlsearch", Aliases: []string{"noh"}, Run: exNohlsearch},
+}
+
+// RegisterExCommand adds a command to the ":" command line. It replaces any
+// command with the same name, including a built-in one.
+func (m *Model) RegisterExCommand(cmd ExCommand) {
+	m.exCommands = slices.DeleteFunc(slices.Clone(m.exCommands), func(c ExCommand) bool {
+		return c.Name == cmd.Name
+	})
+	m.exCommands = append(m.exCommands, cmd)
+}
+
+// ExecuteCommand runs an ex command line, as if it had been typed after ":".
+// An error is shown in place of the statusbar. Changes made by the command
+// are undone in a single step.
+func (m *Model) ExecuteCommand(line string) tea.Cmd {
+	m.EndChange()
+	m.BeginChange()
+	cmd, err := m.runEx(line)
+	m.EndChange()
+	if err != nil {
+		m.vim.SetMessage(err.Error())
+	}
+	m.syncOptions()
+	m.vim.Sync(m.editor())
+	m.updateStatusbar()
+	return cmd
+}
+
+// exCommandList returns the commands available on the command line.
+func (m Model) exCommandList() []ExCommand {
+	cmds := slices.Clone(m.exCommands)
+	for _, b := range builtinExCommands {
+		if !slices.ContainsFunc(m.exCommands, func(c ExCommand) bool { return c.Name == b.Name }) {
+			cmds = append(cmds, b)
+		}
+	}
+	return cmds
+}
+
+// lookupExCommand finds the command run by name.
+func (m Model) lookupExCommand(name string) (ExCommand, bool) {
+	cmds := m.exCommandList()
+	for _, c := range cmds {
+		if c.Name == name || slices.Contains(c.Aliases, name) {
+			return c, true
+		}
+	}
+	var found []ExCommand
+	for _, c := range cmds {
+		if strings.HasPrefix(c.Name, name) {
+			found = append(found, c)
+		}
+	}
+	if len(found) == 1 {
+		return found[0], true
+	}
+	return ExCommand{}, false
+}
+
+// runEx parses and runs an ex command line.
+func (m *Model) runEx(line string) (tea.Cmd, error) {
+	line = strings.TrimLeft(line, " \t:")
+	if line == "" {
+		return nil, nil
+	}
+
+	args, rest, err := m.parseRange(line)
+	if err != nil {
+		return nil, err
+	}
+	end := strings.IndexFunc(rest, func(r rune) bool { return !unicode.IsLetter(r) })
+	if end < 0 {
+		end = len(rest)
+	}
+	name, rest := rest[:end], rest[end:]
+
+	// A range on its own jumps to its last line.
+	if name == "" {
+		if strings.TrimSpace(rest) != "" || !args.HasRange {
+			return nil, fmt.Errorf("E492: Not an editor command: %s", line)
+		}
+		row := min(args.End, m.LineCount()-1)
+		m.SetCursor(row, firstNonBlank(m.LineRunes(row)))
+		return nil, nil
+	}
+
+	cmd, ok := m.lookupExCommand(name)
+	if !ok {
+		return nil, fmt.Errorf("E492: Not an editor command: %s", line)
+	}
+	if args.Start < 0 || args.End >= m.LineCount() {
+		return nil, errors.New("E16: Invalid range")
+	}
+	if strings.HasPrefix(rest, "!") {
+		args.Bang = true
+		rest = rest[1:]
+	}
+	args.Arg = strings.TrimLeft(rest, " \t")
+	return cmd.Run(m, args)
+}
+
+// parseRange parses the range at the start of an ex command line, returning
+// the rest of the line.
+func (m *Model) parseRange(line string) (ExArgs, string, error) {
+	args := ExArgs{Start: m.Line(), End: m.Line()}
+	if rest, ok := strings.CutPrefix(line, "%"); ok {
+		return ExArgs{Start: 0, End: m.LineCount() - 1, HasRange: true}, rest, nil
+	}
+
+	start, rest, ok, err := m.parseAddress(line)
+	if err != nil || !ok {
+		return args, line, err
+	}
+	args.Start, args.End, args.HasRange = start, start, true
+
+	if len(rest) > 0 && (rest[0] == ',' || rest[0] == ';') {
+		var end int
+		end, rest, ok, err = m.parseAddress(rest[1:])
+		if err != nil {
+			return args, rest, err
+		}
+		if !ok {
+			end = m.Line()
+		}
+		args.End = end
+	}
+	if args.Start > args.End {
+		args.Start, args.End = args.End, args.Start
+	}
+	return args, rest, nil
+}
+
+// parseAddress parses a line address such as "12", ".", "$", "'<" or ".+3",
+// returning the row it refers to. ok is false if s doesn't start with an
+// address.
+func (m *Model) parseAddress(s string) (row int, rest string, ok bool, err error) {
+	switch {
+	case strings.HasPrefix(s, "."):
+		row, s, ok = m.Line(), s[1:], true
+	case strings.HasPrefix(s, "$"):
+		row, s, ok = m.LineCount()-1, s[1:], true
+	case strings.HasPrefix(s, "'<"):
+		row, s, ok = m.vim.LastSelection().Start.Row, s[2:], true
+	case strings.HasPrefix(s, "'>"):
+		row, s, ok = m.vim.LastSelection().End.Row, s[2:], true
+	case strings.HasPrefix(s, "'"):
+		return 0, s, false, errors.New("E20: Mark not set")
+	case len(s) > 0 && s[0] >= '0' && s[0] <= '9':
+		n, digits := leadingNumber(s)
+		// Line 0 is taken to be the first line.
+		row, s, ok = max(n-1, 0), s[digits:], true
+	}
+
+	// Offsets such as "+3" or "-" apply to the cursor row if there is no
+	// address before them.
+	for len(s) > 0 && (s[0] == '+' || s[0] == '-') {
+		if !ok {
+			row, ok = m.Line(), true
+		}
+		sign := 1
+		if s[0] == '-' {
+			sign = -1
+		}
+		n, digits := leadingNumber(s[1:])
+		if digits == 0 {
+			n = 1
+		}
+		row += sign * n
+		s = s[1+digits:]
+	}
+	return row, s, ok, nil
+}
+
+// leadingNumber parses the decimal number at the start of s, returning it
+// along with the number of digits it has.
+func leadingNumber(s string) (int, int) {
+	digits := 0
+	for digits < len(s) && s[digits] >= '0' && s[digits] <= '9' {
+		digits++
+	}
+	n, _ := strconv.Atoi(s[:digits])
+	return n, digits
+}
+
+// updateCompletions offers the completions of the command line typed so far
+// as suggestions of the prompt.
+func (m *Model) updateCompletions() {
+	m.cmdline.SetSuggestions(m.exCompletions(m.cmdline.Value()))
+}
+
+// exCompletions returns the possible completions of a command line: command
+// names while the name is being typed, and then the completions of the
+// command's argument.
+func (m Model) exCompletions(line string) []string {
+	i := strings.IndexFunc(line, unicode.IsLetter)
+	if i < 0 {
+		return nil
+	}
+	head, rest := line[:i], line[i:]
+
+	j := strings.IndexFunc(rest, func(r rune) bool { return !unicode.IsLetter(r) })
+	if j < 0 {
+		var completions []string
+		for _, c := range m.exCommandList() {
+			if strings.HasPrefix(c.Name, rest) {
+				completions = append(completions, head+c.Name)
+			}
+		}
+		return completions
+	}
+
+	name, arg := rest[:j], rest[j:]
+	cmd, ok := m.lookupExCommand(name)
+	if !ok || cmd.Complete == nil {
+		return nil
+	}
+	arg = strings.TrimPrefix(arg, "!")
+	if !strings.HasPrefix(arg, " ") {
+		return nil
+	}
+	arg = strings.TrimLeft(arg, " ")
+	head = line[:len(line)-len(arg)]
+
+	var completions []string
+	for _, c := range cmd.Complete(m, arg) {
+		completions = append(completions, head+c)
+	}
+	return completions
+}
+
+// exWrite runs :write.
+func exWrite(_ *Model, args ExArgs) (tea.Cmd, error) {
+	return func() tea.Msg {
+		return WriteMsg{Path: args.Arg, Force: args.Bang}
+	}, nil
+}
+
+// exQuit runs :quit.
+func exQuit(_ *Model, args ExArgs) (tea.Cmd, error) {
+	return func() tea.Msg {
+		return QuitMsg{Force: args.Bang}
+	}, nil
+}
+
+// exWriteQuit runs :wq, which writes and then quits.
+func exWriteQuit(m *Model, args ExArgs) (tea.Cmd, error) {
+	write, _ := exWrite(m, args)
+	quit, _ := exQuit(m, args)
+	return tea.Sequence(write, quit), nil
+}
+
+// exSubstitute runs :s/pattern/replacement/flags. The pattern is a Go
+// regular expression matched against each line of the range. In the
+// replacement, "&" stands for the match, "\1" to "\9" for its groups and
+// "\r" for a line break. The "g" flag replaces all matches in a line instead
+// of the first one, and the "i" and "I" flags ignore case or don't, whatever
+// the ignorecase option. An empty pattern is the last search pattern. Lines
+// whose matches are in protected text are left as they are.
+func exSubstitute(m *Model, args ExArgs) (tea.Cmd, error) {
+	if m.ReadOnly {
+		return nil, errors.New("E21: Cannot make changes, 'modifiable' is off")
+	}
+	if args.Arg == "" {
+		return nil, errors.New("E35: No previous regular expression")
+	}
+	delim, size := utf8.DecodeRuneInString(args.Arg)
+	if unicode.IsLetter(delim) || unicode.IsDigit(delim) || delim == '\\' || delim == '"' || delim == '|' {
+		return nil, errors.New("E146: Regular expressions can't be delimited by letters")
+	}
+	parts := splitDelimited(args.Arg[size:], delim)
+	pattern := parts[0]
+	if pattern == "" {
+		// Like in Vim, an empty pattern is the last search pattern.
+		if m.vim.SearchPattern() == "" {
+			return nil, errors.New("E35: No previous regular expression")
+		}
+		pattern = m.vim.SearchPattern()
+	}
+	var replacement, flags string
+	if len(parts) > 1 {
+		replacement = parts[1]
+	}
+	if len(parts) > 2 {
+		flags = strings.TrimSpace(parts[2])
+	}
+
+	global, ignoreCase := false, m.IgnoreCase
+	for _, f := range flags {
+		switch f {
+		case 'g':
+			global = true
+		case 'i':
+			ignoreCase = true
+		case 'I':
+			ignoreCase = false
+		default:
+			return nil, fmt.Errorf("E488: Trailing characters: %s", flags)
+		}
+	}
+	expr := pattern
+	if ignoreCase {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("E383: Invalid search string: %s", pattern)
+	}
+	// The pattern becomes the last search pattern, as in Vim.
+	if err := m.vim.SetSearchPattern(pattern); err != nil {
+		return nil, err
+	}
+	template := vimReplacement(replacement)
+
+	found, replaced := false, false
+	last := args.Start
+	for row := args.Start; row <= args.End; row++ {
+		line := string(m.LineRunes(row))
+		matches := re.FindAllStringSubmatchIndex(line, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		if !global {
+			matches = matches[:1]
+		}
+		found = true
+
+		// Only the text from the first match to the end of the last one is
+		// replaced, so that protected text around it is left alone.
+		from, to := matches[0][0], matches[len(matches)-1][1]
+		startCol := utf8.RuneCountInString(line[:from])
+		endCol := startCol + utf8.RuneCountInString(line[from:to])
+		if !m.CanReplace(row, startCol, row, endCol) {
+			continue
+		}
+		var b []byte
+		prev := from
+		for _, match := range matches {
+			b = append(b, line[prev:match[0]]...)
+			b = re.ExpandString(b, template, line, match)
+			prev = match[1]
+		}
+
+		// Line breaks in the replacement split the line.
+		m.ReplaceRange(row, startCol, row, endCol, string(b))
+		replaced = true
+		breaks := strings.Count(string(b), "\n")
+		row += breaks
+		args.End += breaks
+		last = row
+	}
+	switch {
+	case !found:
+		return nil, fmt.Errorf("E486: Pattern not found: %s", pattern)
+	case !replaced:
+		return nil, errors.New("E21: Cannot make changes, the text is protected")
+	}
+
+	m.SetCursor(last, firstNonBlank(m.LineRunes(last)))
+	return nil, nil
+}
+
+// exNohlsearch runs :nohlsearch.
+func exNohlsearch(m *Model, _ ExArgs) (tea.Cmd, error) {
+	m.ClearSearchHighlight()
+	return nil, nil
+}
+
+// splitDelimited splits s at unescaped occurrences of delim, into at most
+// three parts. Escaped delimiters are unescaped.
+func splitDelimited(s string, delim rune) []string {
+	var (
+		parts []string
+		b     strings.Builder
+	)
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\' && i+1 < len(runes) && runes[i+1] == delim:
+			b.WriteRune(delim)
+			i++
+		case r == '\\' && i+1 < len(runes):
+			b.WriteRune(r)
+			b.WriteRune(runes[i+1])
+			i++
+		case r == delim && len(parts) < 2:
+			parts = append(parts, b.String())
+			b.Reset()
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return append(parts, b.String())
+}
+
+// vimReplacement turns the replacement of a :s command into a template for
+// [regexp.Regexp.Expand].
+func vimReplacement(s string) string {
+	var b strings.Builder
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; {
+		case r == '$':
+			b.WriteString("$$")
+		case r == '&':
+			b.WriteString("${0}")
+		case r == '\\' && i+1 < len(runes):
+			i++
+			switch next := runes[i]; {
+			case next >= '0' && next <= '9':
+				fmt.Fprintf(&b, "${%c}", next)
+			case next == 'r' || next == 'n':
+				b.WriteByte('\n')
+			case next == 't':
+				b.WriteByte('\t')
+			case next == '$':
+				b.WriteString("$$")
+			default:
+				b.WriteRune(next)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// boolOptions are the options that are switched on and off with :set.
+var boolOptions = []struct {
+	name, short string
+	get         func(m *Model) bool
+	set         func(m *Model, v bool)
+}{
+	{"number", "nu", func(m *Model) bool { return m.ShowLineNumbers }, func(m *Model, v bool) {
+		m.ShowLineNumbers = v
+		m.SetWidth(m.width)
+	}},
+	{"wrap", "", func(m *Model) bool { return m.SoftWrap }, func(m *Model, v bool) {
+		m.SoftWrap = v
+	}},
+	{"linebreak", "lbr", func(m *Model) bool { return m.WrapMode == textarea.WrapWord }, func(m *Model, v bool) {
+		m.WrapMode = textarea.WrapChar
+		if v {
+			m.WrapMode = textarea.WrapWord
+		}
+	}},
+	{"breakindent", "bri", func(m *Model) bool { return m.BreakIndent }, func(m *Model, v bool) {
+		m.BreakIndent = v
+	}},
+	{"hlsearch", "hls", func(m *Model) bool { return m.HighlightSearch }, func(m *Model, v bool) {
+		m.HighlightSearch = v
+		// Switching the option on highlights the last search again.
+		if pattern := m.vim.SearchPattern(); v && pattern != "" {
+			_ = m.vim.SetSearchPattern(pattern)
+		}
+	}},
+	{"ignorecase", "ic", func(m *Model) bool { return m.IgnoreCase }, func(m *Model, v bool) {
+		m.IgnoreCase = v
+	}},
+	{"wrapscan", "ws", func(m *Model) bool { return m.WrapScan }, func(m *Model, v bool) {
+		m.WrapScan = v
+	}},
+}
+
+// numberOptions are the options that are given a number with :set.
+var numberOptions = []struct {
+	name, short string
+	get         func(m *Model) int
+	set         func(m *Model, v int)
+}{
+	{"shiftwidth", "sw", func(m *Model) int { return m.ShiftWidth }, func(m *Model, v int) {
+		m.ShiftWidth = v
+	}},
+	{"textwidth", "tw", func(m *Model) int { return m.ReflowWidth }, func(m *Model, v int) {
+		m.ReflowWidth = v
+	}},
+}
+
+// exSet runs :set. Like in Vim, "name" switches an option on, "noname" off
+// and "invname" or "name!" toggles it. "name=value" sets a number option and
+// "name?" shows the value of an option.
+func exSet(m *Model, args ExArgs) (tea.Cmd, error) {
+	fields := strings.Fields(args.Arg)
+	if len(fields) == 0 {
+		fields = []string{"all"}
+	}
+	var shown []string
+	for _, f := range fields {
+		s, err := m.setOption(f)
+		if err != nil {
+			return nil, err
+		}
+		if s != "" {
+			shown = append(shown, s)
+		}
+	}
+	m.vim.SetMessage(strings.Join(shown, " "))
+	return nil, nil
+}
+
+// setOption handles a single argument of :set, returning the value of the
+// option if it should be shown.
+func (m *Model) setOption(arg string) (string, error) {
+	if arg == "all" {
+		var all []string
+		for _, o := range boolOptions {
+			s, _ := m.setOption(o.name + "?")
+			all = append(all, s)
+		}
+		for _, o := range numberOptions {
+			s, _ := m.setOption(o.name + "?")
+			all = append(all, s)
+		}
+		return strings.Join(all, " "), nil
+	}
+
+	name, value, hasValue := strings.Cut(arg, "=")
+	name, query := strings.CutSuffix(name, "?")
+	name, toggle := strings.CutSuffix(name, "!")
+
+	for _, o := range numberOptions {
+		if name != o.name && name != o.short {
+			continue
+		}
+		if !hasValue {
+			return fmt.Sprintf("%s=%d", o.name, o.get(m)), nil
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return "", fmt.Errorf("E521: Number required after =: %s", arg)
+		}
+		o.set(m, n)
+		return "", nil
+	}
+
+	on := true
+	if rest, ok := strings.CutPrefix(name, "inv"); ok {
+		name, toggle = rest, true
+	} else if rest, ok := strings.CutPrefix(name, "no"); ok && !isOption(name) {
+		name, on = rest, false
+	}
+	for _, o := range boolOptions {
+		if name != o.name && name != o.short {
+			continue
+		}
+		switch {
+		case hasValue:
+			return "", fmt.Errorf("E474: Invalid argument: %s", arg)
+		case query:
+			if o.get(m) {
+				return o.name, nil
+			}
+			return "no" + o.name, nil
+		case toggle:
+			o.set(m, !o.get(m))
+		default:
+			o.set(m, on)
+		}
+		return "", nil
+	}
+	return "", fmt.Errorf("E518: Unknown option: %s", arg)
+}
+
+// isOption reports whether name is the name of an option.
+func isOption(name string) bool {
+	for _, o := range boolOptions {
+		if name == o.name || name == o.short {
+			return true
+		}
+	}
+	for _, o := range numberOptions {
+		if name == o.name || name == o.short {
+			return true
+		}
+	}
+	return false
+}
+
+// completeSet completes the option names of :set.
+func completeSet(_ Model, arg string) []string {
+	head := arg[:strings.LastIndex(arg, " ")+1]
+	word := arg[len(head):]
+
+	var names []string
+	for _, o := range boolOptions {
+		names = append(names, o.name, "no"+o.name)
+	}
+	for _, o := range numberOptions {
+		names = append(names, o.name+"=")
+	}
+
+	var completions []string
+	for _, n := range names {
+		if strings.HasPrefix(n, word) {
+			completions = append(completions, head+n)
+		}
+	}
+	return completions
+}
+
+// newCommandLine returns the prompt of the ":" command line.
+func newCommandLine() textinput.Model {
+	ti := textinput.New()
+	ti.Prompt = ":"
+	ti.ShowSuggestions = true
+	return ti
+}
+
+// firstNonBlank returns the index of the first non-blank rune of a line.
+func firstNonBlank(line []rune) int {
+	for i, r := range line {
+		if !unicode.IsSpace(r) {
+			return i
+		}
+	}
+	return max(0, len(line)-1)
+}
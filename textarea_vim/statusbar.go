@@ -0,0 +1,253 @@
+package textarea_vim
+
+import (
+	"fmt"
+
+	"github.com/haochend413/bubbles/v2/statusbar"
+)
+
+// Segment is an item of the statusbar below the textarea, such as the mode or
+// the cursor position. Segments are kept up to date as the textarea changes.
+type Segment struct {
+	// Name identifies the segment. It's the tag of its element in the
+	// Statusbar.
+	Name string
+
+	// Width is the width of the segment, in which its content is centered.
+	// If 0, the segment is as wide as its content.
+	Width int
+
+	// Right places the segment in the right part of the statusbar instead of
+	// the left one.
+	Right bool
+
+	// Hidden hides the segment.
+	Hidden bool
+
+	// Foreground and Background are the colors of the segment, such as "252"
+	// or "#ffffff". Empty colors are the terminal's.
+	Foreground, Background string
+
+	// Content returns the text of the segment.
+	Content func(m Model) string
+
+	// Colors, if set, returns the colors of the segment in place of
+	// Foreground and Background, such as the color of the current mode.
+	Colors func(m Model) (fg, bg string)
+}
+
+// ModeSegment shows the editing mode, in the color of the mode.
+func ModeSegment() Segment {
+	return Segment{
+		Name:  "mode",
+		Width: 8,
+		Content: func(m Model) string {
+			return m.Mode().String()
+		},
+		Colors: func(m Model) (string, string) {
+			return "0", modeColor(m.Mode())
+		},
+	}
+}
+
+// CountSegment shows the number of characters and words of the value. The
+// counts of each line are cached, so that typing in a large value only counts
+// the lines that changed.
+func CountSegment() Segment {
+	return Segment{
+		Name:       "count",
+		Width:      25,
+		Foreground: "252",
+		Background: "236",
+		Content: func(m Model) string {
+			return fmt.Sprintf("%d chars | %d words", m.RuneCount(), m.WordCount())
+		},
+	}
+}
+
+// PositionSegment shows the line and column of the cursor, counting from 1,
+// as in "12:5".
+func PositionSegment() Segment {
+	return Segment{
+		Name:       "position",
+		Width:      9,
+		Foreground: "252",
+		Background: "236",
+		Content: func(m Model) string {
+			return fmt.Sprintf("%d:%d", m.Line()+1, m.Column()+1)
+		},
+	}
+}
+
+// PercentSegment shows how far through the value the cursor line is, as a
+// percentage.
+func PercentSegment() Segment {
+	return Segment{
+		Name:       "percent",
+		Width:      6,
+		Foreground: "252",
+		Background: "236",
+		Content: func(m Model) string {
+			return fmt.Sprintf("%d%%", (m.Line()+1)*100/m.LineCount())
+		},
+	}
+}
+
+// PendingSegment shows the command being typed, such as the operator and
+// count of `2d` while a motion is awaited. It's empty otherwise.
+func PendingSegment() Segment {
+	return Segment{
+		Name:       "pending",
+		Width:      10,
+		Foreground: "252",
+		Background: "236",
+		Content: func(m Model) string {
+			return m.vim.Pending()
+		},
+	}
+}
+
+// ModifiedSegment shows "[+]" when the value differs from the one saved with
+// [Model.MarkSaved].
+func ModifiedSegment() Segment {
+	return Segment{
+		Name:       "modified",
+		Width:      5,
+		Foreground: "214",
+		Background: "236",
+		Content: func(m Model) string {
+			if m.Modified() {
+				return "[+]"
+			}
+			return ""
+		},
+	}
+}
+
+// FileNameSegment shows the FileName of the textarea.
+func FileNameSegment() Segment {
+	return Segment{
+		Name:       "filename",
+		Foreground: "252",
+		Background: "236",
+		Content: func(m Model) string {
+			if m.FileName == "" {
+				return ""
+			}
+			return " " + m.FileName + " "
+		},
+	}
+}
+
+// DefaultSegments returns the segments of the statusbar of a new textarea:
+// the mode and the character and word count.
+func DefaultSegments() []Segment {
+	return []Segment{ModeSegment(), CountSegment()}
+}
+
+// Option is a configuration option that works in conjunction with [New].
+type Option func(*Model)
+
+// WithSegments sets the segments of the statusbar, in place of
+// [DefaultSegments]. For example:
+//
+//	ta := New(WithSegments(ModeSegment(), FileNameSegment(), ModifiedSegment(),
+//		Right(PendingSegment()), Right(PositionSegment()), Right(PercentSegment())))
+func WithSegments(segments ...Segment) Option {
+	return func(m *Model) {
+		m.Segments = segments
+	}
+}
+
+// WithFileName sets the file name shown by [FileNameSegment].
+func WithFileName(name string) Option {
+	return func(m *Model) {
+		m.FileName = name
+	}
+}
+
+// Right places a segment in the right part of the statusbar.
+func Right(s Segment) Segment {
+	s.Right = true
+	return s
+}
+
+// Segment returns the segment with the given name so that it can be hidden
+// or restyled, or nil if there's none.
+func (m Model) Segment(name string) *Segment {
+	for i := range m.Segments {
+		if m.Segments[i].Name == name {
+			return &m.Segments[i]
+		}
+	}
+	return nil
+}
+
+// MarkSaved records the current value as saved, such as after writing it to
+// a file. [Model.Modified] reports changes from it.
+func (m *Model) MarkSaved() {
+	m.saved = m.Snapshot()
+}
+
+// Modified reports whether the value differs from the one recorded by
+// [Model.MarkSaved], or from an empty value if it was never called.
+func (m Model) Modified() bool {
+	return m.ChangedSince(m.saved)
+}
+
+// UpdateStatusbar updates the segments of the statusbar. The statusbar is
+// updated whenever the textarea is updated or rendered, so it's only needed
+// to render the Statusbar elsewhere after changing the textarea.
+func (m Model) UpdateStatusbar() {
+	m.updateStatusbar()
+}
+
+// UpdateWordCount updates the segments of the statusbar.
+//
+// Deprecated: use [Model.UpdateStatusbar].
+func (m Model) UpdateWordCount() {
+	m.updateStatusbar()
+}
+
+// updateStatusbar refills the statusbar with the visible segments.
+func (m Model) updateStatusbar() {
+	sb := m.Statusbar
+	if sb == nil {
+		return
+	}
+	sb.LeftElems = sb.LeftElems[:0]
+	sb.RightElems = sb.RightElems[:0]
+	clear(sb.ElemsMap)
+	if sb.ElemsMap == nil {
+		sb.ElemsMap = make(map[string]*statusbar.Elem)
+	}
+
+	for _, s := range m.Segments {
+		if s.Hidden {
+			continue
+		}
+		var content string
+		if s.Content != nil {
+			content = s.Content(m)
+		}
+		add := sb.AddLeft
+		if s.Right {
+			add = sb.AddRight
+		}
+		elem := add(s.Width, content)
+		fg, bg := s.Foreground, s.Background
+		if s.Colors != nil {
+			fg, bg = s.Colors(m)
+		}
+		elem.SetColors(optionalColor(fg), optionalColor(bg))
+		sb.SetTag(elem, s.Name)
+	}
+}
+
+// optionalColor returns a statusbar color, which is nil if c is empty.
+func optionalColor(c string) *string {
+	if c == "" {
+		return nil
+	}
+	return &c
+}
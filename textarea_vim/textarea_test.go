@@ -2,6 +2,7 @@ package textarea_vim
 
 import (
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 	"unicode"
@@ -9,6 +10,8 @@ import (
 	tea "charm.land/bubbletea/v2"
 	"github.com/MakeNowJust/heredoc"
 	"github.com/charmbracelet/x/ansi"
+	"github.com/charmbracelet/x/exp/golden"
+	"github.com/haochend413/bubbles/v2/textarea"
 	"github.com/haochend413/lipgloss/v2"
 )
 
@@ -44,14 +47,17 @@ func TestVerticalScrolling(t *testing.T) {
 		"should wrap around",
 		"the text area.",
 	}
-	textarea.viewport.GotoTop()
+	textarea.MouseWheelDelta = 1
+	for range lines {
+		textarea, _ = textarea.Update(tea.MouseWheelMsg{Button: tea.MouseWheelUp})
+	}
 	for _, line := range lines {
-		view = textarea.View()
+		view = ansi.Strip(textarea.View())
 		if !strings.Contains(view, line) {
 			t.Log(view)
 			t.Error("Text area did not render the correct scrolled input")
 		}
-		textarea.viewport.ScrollDown(1)
+		textarea, _ = textarea.Update(tea.MouseWheelMsg{Button: tea.MouseWheelDown})
 	}
 }
 
@@ -79,8 +85,7 @@ func TestWordWrapOverflowing(t *testing.T) {
 
 	// We have essentially filled the text area with input.
 	// Let's see if we can cause wrapping to overflow the last line.
-	textarea.row = 0
-	textarea.col = 0
+	textarea.SetCursor(0, 0)
 
 	input = "Testing"
 
@@ -124,8 +129,8 @@ func TestSetValue(t *testing.T) {
 	textarea := newTextArea()
 	textarea.SetValue(strings.Join([]string{"Foo", "Bar", "Baz"}, "\n"))
 
-	if textarea.row != 2 && textarea.col != 3 {
-		t.Log(textarea.row, textarea.col)
+	if textarea.Line() != 2 && textarea.Column() != 3 {
+		t.Log(textarea.Line(), textarea.Column())
 		t.Fatal("Cursor Should be on row 2 column 3 after inserting 2 new lines")
 	}
 
@@ -154,7 +159,7 @@ func TestInsertString(t *testing.T) {
 	}
 
 	// Put cursor in the middle of the text
-	textarea.col = 4
+	textarea.SetCursorColumn(4)
 
 	textarea.InsertString("bar ")
 
@@ -189,8 +194,8 @@ func TestCanHandleEmoji(t *testing.T) {
 		t.Fatal("Expected emoji to be inserted")
 	}
 
-	if textarea.col != 3 {
-		t.Log(textarea.col)
+	if textarea.Column() != 3 {
+		t.Log(textarea.Column())
 		t.Fatal("Expected cursor to be on the third character")
 	}
 
@@ -206,8 +211,7 @@ func TestVerticalNavigationKeepsCursorHorizontalPosition(t *testing.T) {
 
 	textarea.SetValue(strings.Join([]string{"你好你好", "Hello"}, "\n"))
 
-	textarea.row = 0
-	textarea.col = 2
+	textarea.SetCursor(0, 2)
 
 	// 你好|你好
 	// Hell|o
@@ -270,8 +274,8 @@ func TestVerticalNavigationShouldRememberPositionWhileTraversing(t *testing.T) {
 	textarea.SetValue(strings.Join([]string{"Hello", "World", "This is a long line."}, "\n"))
 
 	// We are at the end of the last line.
-	if textarea.col != 20 || textarea.row != 2 {
-		t.Log(textarea.col)
+	if textarea.Column() != 20 || textarea.Line() != 2 {
+		t.Log(textarea.Column())
 		t.Fatal("Expected cursor to be on the 20th character of the last line")
 	}
 
@@ -280,8 +284,8 @@ func TestVerticalNavigationShouldRememberPositionWhileTraversing(t *testing.T) {
 	textarea, _ = textarea.Update(upMsg)
 
 	// We should be at the end of the second line.
-	if textarea.col != 5 || textarea.row != 1 {
-		t.Log(textarea.col)
+	if textarea.Column() != 5 || textarea.Line() != 1 {
+		t.Log(textarea.Column())
 		t.Fatal("Expected cursor to be on the 5th character of the second line")
 	}
 
@@ -289,8 +293,8 @@ func TestVerticalNavigationShouldRememberPositionWhileTraversing(t *testing.T) {
 	textarea, _ = textarea.Update(upMsg)
 
 	// We should be at the end of the first line.
-	if textarea.col != 5 || textarea.row != 0 {
-		t.Log(textarea.col)
+	if textarea.Column() != 5 || textarea.Line() != 0 {
+		t.Log(textarea.Column())
 		t.Fatal("Expected cursor to be on the 5th character of the first line")
 	}
 
@@ -300,8 +304,8 @@ func TestVerticalNavigationShouldRememberPositionWhileTraversing(t *testing.T) {
 	textarea, _ = textarea.Update(downMsg)
 
 	// We should be at the end of the last line.
-	if textarea.col != 20 || textarea.row != 2 {
-		t.Log(textarea.col)
+	if textarea.Column() != 20 || textarea.Line() != 2 {
+		t.Log(textarea.Column())
 		t.Fatal("Expected cursor to be on the 20th character of the last line")
 	}
 
@@ -314,16 +318,16 @@ func TestVerticalNavigationShouldRememberPositionWhileTraversing(t *testing.T) {
 	leftMsg := tea.KeyPressMsg{Code: tea.KeyLeft}
 	textarea, _ = textarea.Update(leftMsg)
 
-	if textarea.col != 4 || textarea.row != 1 {
-		t.Log(textarea.col)
+	if textarea.Column() != 4 || textarea.Line() != 1 {
+		t.Log(textarea.Column())
 		t.Fatal("Expected cursor to be on the 5th character of the second line")
 	}
 
 	// Going down now should keep us at the 4th column since we moved left and
 	// reset the horizontal position saved state.
 	textarea, _ = textarea.Update(downMsg)
-	if textarea.col != 4 || textarea.row != 2 {
-		t.Log(textarea.col)
+	if textarea.Column() != 4 || textarea.Line() != 2 {
+		t.Log(textarea.Column())
 		t.Fatal("Expected cursor to be on the 4th character of the last line")
 	}
 }
@@ -1722,11 +1726,8 @@ func TestView(t *testing.T) {
 					lines[i] = fmt.Sprintf("Line %d", i+1)
 				}
 				m.SetValue(strings.Join(lines, "\n"))
-				m.viewport.SetContent(m.view()) // force setting of viewport content.
 
-				m.row = 3
-				m.col = 0
-				m.viewport.SetYOffset(0)
+				m = scrollTo(m, 0, 3)
 				m.PageUp()
 
 				return m
@@ -1753,11 +1754,8 @@ func TestView(t *testing.T) {
 					lines[i] = fmt.Sprintf("Line %d", i+1)
 				}
 				m.SetValue(strings.Join(lines, "\n"))
-				m.viewport.SetContent(m.view()) // force setting of viewport content.
 
-				m.row = 5
-				m.col = 0
-				m.viewport.SetYOffset(3)
+				m = scrollTo(m, 3, 5)
 				m.PageUp()
 
 				return m
@@ -1784,11 +1782,8 @@ func TestView(t *testing.T) {
 					lines[i] = fmt.Sprintf("Line %d", i+1)
 				}
 				m.SetValue(strings.Join(lines, "\n"))
-				m.viewport.SetContent(m.view()) // force setting of viewport content.
 
-				m.row = 5
-				m.col = 0
-				m.viewport.SetYOffset(5)
+				m = scrollTo(m, 5, 5)
 				m.PageUp()
 
 				return m
@@ -1813,11 +1808,8 @@ func TestView(t *testing.T) {
 					lines[i] = fmt.Sprintf("Line %d", i+1)
 				}
 				m.SetValue(strings.Join(lines, "\n"))
-				m.viewport.SetContent(m.view()) // force setting of viewport content.
 
-				m.row = 8
-				m.col = 0
-				m.viewport.SetYOffset(7)
+				m = scrollTo(m, 7, 8)
 				m.PageDown()
 
 				return m
@@ -1842,11 +1834,8 @@ func TestView(t *testing.T) {
 					lines[i] = fmt.Sprintf("Line %d", i+1)
 				}
 				m.SetValue(strings.Join(lines, "\n"))
-				m.viewport.SetContent(m.view()) // force setting of viewport content.
 
-				m.row = 3
-				m.col = 0
-				m.viewport.SetYOffset(3)
+				m = scrollTo(m, 3, 3)
 				m.PageDown()
 
 				return m
@@ -1871,11 +1860,8 @@ func TestView(t *testing.T) {
 					lines[i] = fmt.Sprintf("Line %d", i+1)
 				}
 				m.SetValue(strings.Join(lines, "\n"))
-				m.viewport.SetContent(m.view()) // force setting of viewport content.
 
-				m.row = 4
-				m.col = 0
-				m.viewport.SetYOffset(2)
+				m = scrollTo(m, 2, 4)
 				m.PageDown()
 
 				return m
@@ -1908,7 +1894,7 @@ func TestView(t *testing.T) {
 				t.Fatalf("Want:\n%v\nGot:\n%v\n", wantView, view)
 			}
 
-			cursorRow := textarea.cursorLineNumber()
+			cursorRow := cursorLineNumber(textarea)
 			cursorCol := textarea.LineInfo().ColumnOffset
 			if tt.want.cursorRow != cursorRow || tt.want.cursorCol != cursorCol {
 				format := "Want cursor at row: %v, col: %v Got: row: %v col: %v\n"
@@ -2013,3 +1999,876 @@ func stripString(str string) string {
 
 	return strings.Join(lines, "\n")
 }
+
+func TestNormalMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		row     int
+		col     int
+		keys    string
+		want    string
+		wantRow int
+		wantCol int
+		mode    Mode
+	}{
+		{name: "dw", value: "foo bar baz", keys: "dw", want: "bar baz"},
+		{name: "count before operator", value: "one two three four", keys: "3dw", want: "four"},
+		{name: "count after operator", value: "one two three four", keys: "d2w", want: "three four"},
+		{name: "dw at end of line", value: "foo bar\nbaz", col: 4, keys: "dw", want: "foo \nbaz", wantCol: 3},
+		{name: "de", value: "foo bar", keys: "de", want: " bar"},
+		{name: "db", value: "foo bar", col: 4, keys: "db", want: "bar"},
+		{name: "punctuation is a word", value: "foo.bar", keys: "dw", want: ".bar"},
+		{name: "dW", value: "foo.bar baz", keys: "dW", want: "baz"},
+		{name: "d$", value: "foo bar", col: 3, keys: "d$", want: "foo", wantCol: 2},
+		{name: "d0", value: "foo bar", col: 4, keys: "d0", want: "bar"},
+		{name: "dd", value: "one\ntwo\nthree", row: 1, keys: "dd", want: "one\nthree", wantRow: 1},
+		{name: "count dd", value: "one\ntwo\nthree", keys: "2dd", want: "three"},
+		{name: "dj", value: "one\ntwo\nthree", keys: "dj", want: "three"},
+		{name: "dG", value: "one\ntwo\nthree", row: 1, keys: "dG", want: "one"},
+		{name: "dgg", value: "one\ntwo\nthree", row: 1, keys: "dgg", want: "three"},
+		{name: "df", value: "foo(bar)", keys: "df(", want: "bar)"},
+		{name: "dt", value: "foo(bar)", keys: "dt)", want: ")"},
+		{name: "dF", value: "foo(bar)", col: 7, keys: "dF(", want: "foo)", wantCol: 3},
+		{name: "x", value: "abc", keys: "x", want: "bc"},
+		{name: "count x", value: "abcdef", col: 1, keys: "3x", want: "aef", wantCol: 1},
+		{name: "x at end of line", value: "abc", col: 2, keys: "x", want: "ab", wantCol: 1},
+		{name: "D", value: "foo bar", col: 3, keys: "D", want: "foo", wantCol: 2},
+		{name: "cw", value: "foo bar", keys: "cwbaz\x1b", want: "baz bar", wantCol: 2},
+		{name: "cc", value: "one\ntwo", keys: "ccnew\x1b", want: "new\ntwo", wantCol: 2},
+		{name: "c$", value: "foo bar", col: 4, keys: "c$baz\x1b", want: "foo baz", wantCol: 6},
+		{name: "cw stays in insert mode", value: "foo", keys: "cw", want: "", mode: ModeInsert},
+		{name: "ciw", value: "one two", col: 1, keys: "ciwX\x1b", want: "X two"},
+		{name: "diw", value: "one two three", col: 5, keys: "diw", want: "one  three", wantCol: 4},
+		{name: "diw on blanks", value: "one   two", col: 4, keys: "diw", want: "onetwo", wantCol: 3},
+		{name: "d3iw", value: "one two three", keys: "d3iw", want: " three"},
+		{name: "daw", value: "one two three", col: 5, keys: "daw", want: "one three", wantCol: 4},
+		{name: "daw at end of line", value: "one two", col: 5, keys: "daw", want: "one", wantCol: 2},
+		{name: "daw on blanks", value: "one two three", col: 3, keys: "daw", want: "one three", wantCol: 3},
+		{name: "d2aw", value: "one two three", keys: "d2aw", want: "three"},
+		{name: "diW", value: "foo.bar baz", col: 2, keys: "diW", want: " baz"},
+		{name: "repeat ciw", value: "one two", keys: "ciwX\x1bw.", want: "X X", wantCol: 2},
+		{name: "indent", value: "foo\nbar", keys: ">j", want: "    foo\n    bar", wantCol: 4},
+		{name: "outdent", value: "    foo", keys: "<<", want: "foo"},
+		{name: "o", value: "one\ntwo", keys: "onew\x1b", want: "one\nnew\ntwo", wantRow: 1, wantCol: 2},
+		{name: "O", value: "one\ntwo", keys: "Onew\x1b", want: "new\none\ntwo", wantCol: 2},
+		{name: "A", value: "foo", keys: "Abar\x1b", want: "foobar", wantCol: 5},
+		{name: "I", value: "  foo", col: 4, keys: "Ibar\x1b", want: "  barfoo", wantCol: 4},
+		{name: "repeat", value: "one two three four", keys: "dw..", want: "four"},
+		{name: "repeat with count", value: "a b c d e f", keys: "dw3.", want: "e f"},
+		{name: "repeat insert", value: "foo\nbar", keys: "A!\x1bj.", want: "foo!\nbar!", wantRow: 1, wantCol: 3},
+		{name: "motions", value: "one two\nthree four", keys: "wjb", wantRow: 1, want: "one two\nthree four"},
+		{name: "G and gg", value: "one\ntwo\nthree", keys: "G", want: "one\ntwo\nthree", wantRow: 2},
+		{name: "count G", value: "one\ntwo\nthree", keys: "2G", want: "one\ntwo\nthree", wantRow: 1},
+		{name: "$ and 0", value: "foo bar", keys: "$", want: "foo bar", wantCol: 6},
+		{name: "f and ;", value: "a-b-c-d", keys: "f-;", want: "a-b-c-d", wantCol: 3},
+		{name: "t and ;", value: "a-b-c-d", keys: "t-;", want: "a-b-c-d", wantCol: 2},
+		{name: "esc cancels operator", value: "foo bar", keys: "d\x1bw", want: "foo bar", wantCol: 4},
+		{name: "~", value: "abc", keys: "~~", want: "ABc", wantCol: 2},
+		{name: "g~w", value: "foo Bar", keys: "g~w", want: "FOO Bar"},
+		{name: "guu", value: "FOO Bar", keys: "guu", want: "foo bar"},
+		{name: "gUe", value: "foo bar", keys: "gUe", want: "FOO bar"},
+		{name: "gUiw", value: "foo bar", col: 5, keys: "gUiw", want: "foo BAR", wantCol: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTextArea()
+			m.SetValue(tt.value)
+			m.SetCursor(tt.row, tt.col)
+			m.SetNormalMode()
+
+			m = sendKeys(m, tt.keys)
+
+			if got := m.Value(); got != tt.want {
+				t.Errorf("value: want %q, got %q", tt.want, got)
+			}
+			if m.Line() != tt.wantRow || m.Column() != tt.wantCol {
+				t.Errorf("cursor: want %d:%d, got %d:%d", tt.wantRow, tt.wantCol, m.Line(), m.Column())
+			}
+			if m.Mode() != tt.mode {
+				t.Errorf("mode: want %s, got %s", tt.mode, m.Mode())
+			}
+		})
+	}
+}
+
+func TestGraphemes(t *testing.T) {
+	corpus := []struct {
+		name  string
+		value string
+	}{
+		{"cjk", "日本語のテキスト"},
+		{"emoji", "a👍🏽b👨\u200d👩\u200d👧c🇯🇵d"},
+		{"rtl", "a\u200fשלום\u200f b"},
+		{"combining", "cafe\u0301 n\u0303o\u0308 x"},
+		{"mixed", "漢a👍🏽e\u0301\u200fz 字"},
+	}
+	keys := []string{"l", "l", "l", "x", "X", "h", "a!\x1b", "$", "x", "~", "0de"}
+
+	for _, tc := range corpus {
+		t.Run(tc.name, func(t *testing.T) {
+			m := newTextArea()
+			m.SetValue(tc.value)
+			m.SetCursor(0, 0)
+			m.SetNormalMode()
+
+			var b strings.Builder
+			record := func(step string) {
+				fmt.Fprintf(&b, "%s: %q col=%d\n", step, m.Value(), m.Column())
+			}
+			record("start")
+			for _, k := range keys {
+				m = sendKeys(m, k)
+				record(k)
+			}
+			golden.RequireEqual(t, b.String())
+		})
+	}
+}
+
+func TestVisualMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		row     int
+		col     int
+		keys    string
+		want    string
+		wantRow int
+		wantCol int
+		mode    Mode
+	}{
+		{name: "v", value: "foo", keys: "v", want: "foo", mode: ModeVisual},
+		{name: "v twice", value: "foo", keys: "vv", want: "foo"},
+		{name: "esc", value: "foo", keys: "vl\x1b", want: "foo", wantCol: 1},
+		{name: "switch modes", value: "foo", keys: "vV", want: "foo", mode: ModeVisualLine},
+		{name: "vd", value: "foo bar", keys: "vlld", want: " bar"},
+		{name: "vd backwards", value: "foo bar", col: 2, keys: "vhd", want: "f bar", wantCol: 1},
+		{name: "vjd", value: "foo\nbar\nbaz", col: 1, keys: "vjd", want: "fr\nbaz", wantCol: 1},
+		{name: "ve", value: "foo bar", keys: "ved", want: " bar"},
+		{name: "vx", value: "foo", keys: "vx", want: "oo"},
+		{name: "vc", value: "foo bar", keys: "vecbaz\x1b", want: "baz bar", wantCol: 2},
+		{name: "vy", value: "foo bar", col: 4, keys: "vey", want: "foo bar", wantCol: 4},
+		{name: "v~", value: "foo bar", keys: "ve~", want: "FOO bar"},
+		{name: "vU", value: "foo bar", keys: "v$U", want: "FOO BAR"},
+		{name: "vu", value: "FOO BAR", keys: "veu", want: "foo BAR"},
+		{name: "o", value: "foo bar", col: 2, keys: "vlohd", want: "fbar", wantCol: 1},
+		{name: "Vd", value: "one\ntwo\nthree", row: 1, keys: "Vd", want: "one\nthree", wantRow: 1},
+		{name: "Vjd", value: "one\ntwo\nthree", keys: "Vjd", want: "three"},
+		{name: "V>", value: "foo\nbar", keys: "Vj>", want: "    foo\n    bar", wantCol: 4},
+		{name: "V count >", value: "foo", keys: "V2>", want: "        foo", wantCol: 8},
+		{name: "Vc", value: "one\ntwo", keys: "Vcnew\x1b", want: "new\ntwo", wantCol: 2},
+		{name: "block d", value: "abcd\nefgh\nijkl", col: 1, keys: "\x16jld", want: "ad\neh\nijkl", wantCol: 1},
+		{name: "block short line", value: "abcd\ne\nijkl", col: 1, keys: "\x16jjld", want: "ad\ne\nil", wantCol: 1},
+		{name: "block c", value: "abcd\nefgh", col: 1, keys: "\x16jlcXY\x1b", want: "aXYd\neXYh", wantCol: 2},
+		{name: "block U", value: "abcd\nefgh", col: 1, keys: "\x16jlU", want: "aBCd\neFGh", wantCol: 1},
+		{name: "block >", value: "abcd\nefgh", col: 1, keys: "\x16j>", want: "a    bcd\ne    fgh", wantCol: 1},
+		{name: "repeat", value: "foo bar baz", keys: "vld.", want: "bar baz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTextArea()
+			m.SetValue(tt.value)
+			m.SetCursor(tt.row, tt.col)
+			m.SetNormalMode()
+
+			m = sendKeys(m, tt.keys)
+
+			if got := m.Value(); got != tt.want {
+				t.Errorf("value: want %q, got %q", tt.want, got)
+			}
+			if m.Line() != tt.wantRow || m.Column() != tt.wantCol {
+				t.Errorf("cursor: want %d:%d, got %d:%d", tt.wantRow, tt.wantCol, m.Line(), m.Column())
+			}
+			if m.Mode() != tt.mode {
+				t.Errorf("mode: want %s, got %s", tt.mode, m.Mode())
+			}
+		})
+	}
+}
+
+func TestSelection(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		keys  string
+		want  string
+	}{
+		{name: "normal mode", value: "foo", keys: "l", want: ""},
+		{name: "characterwise", value: "foo bar", keys: "ve", want: "foo"},
+		{name: "across lines", value: "foo\nbar", keys: "llvjh", want: "o\nba"},
+		{name: "past end of line", value: "foo\nbar", keys: "v$", want: "foo"},
+		{name: "linewise", value: "foo\nbar\nbaz", keys: "Vj", want: "foo\nbar"},
+		{name: "block", value: "abcd\nefgh", keys: "l\x16jl", want: "bc\nfg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTextArea()
+			m.SetValue(tt.value)
+			m.SetCursor(0, 0)
+			m.SetNormalMode()
+
+			m = sendKeys(m, tt.keys)
+
+			if got := m.Selection(); got != tt.want {
+				t.Errorf("want %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestUndo(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		keys    string
+		want    string
+		wantRow int
+		wantCol int
+	}{
+		{name: "undo command", value: "foo bar", keys: "dwu", want: "foo bar"},
+		{name: "undo count", value: "a b c", keys: "dwdwdw2u", want: "b c"},
+		{name: "insert is one change", value: "foo", keys: "Abar baz\x1bu", want: "foo"},
+		{name: "change and insert are one change", value: "foo bar", keys: "cwbaz\x1bu", want: "foo bar"},
+		{name: "o", value: "one\ntwo", keys: "onew\x1bu", want: "one\ntwo"},
+		{name: "visual", value: "one\ntwo", keys: "Vjdu", want: "one\ntwo"},
+		{name: "case change", value: "foo", keys: "g~wu", want: "foo"},
+		{name: "repeat is one change", value: "a b c d", keys: "dw2.u", want: "b c d"},
+		{name: "motion is not a change", value: "foo bar", keys: "dwwu", want: "foo bar"},
+		{name: "redo", value: "foo bar", keys: "dwu\x12", want: "bar"},
+		{name: "change clears redo", value: "foo bar", keys: "dwuxx\x12", want: "o bar"},
+		{name: "set value", value: "foo", keys: "u", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTextArea()
+			m.SetValue(tt.value)
+			m.SetCursor(0, 0)
+			m.SetNormalMode()
+
+			m = sendKeys(m, tt.keys)
+
+			if got := m.Value(); got != tt.want {
+				t.Errorf("value: want %q, got %q", tt.want, got)
+			}
+			if m.Line() != tt.wantRow || m.Column() != tt.wantCol {
+				t.Errorf("cursor: want %d:%d, got %d:%d", tt.wantRow, tt.wantCol, m.Line(), m.Column())
+			}
+		})
+	}
+}
+
+func TestUndoInsertMode(t *testing.T) {
+	m := newTextArea()
+	m = sendKeys(m, "foo\x1b")
+	if !m.CanUndo() {
+		t.Fatal("expected to be able to undo")
+	}
+	m = sendKeys(m, "u")
+	if got := m.Value(); got != "" {
+		t.Errorf("want empty value, got %q", got)
+	}
+	if !m.CanRedo() {
+		t.Error("expected to be able to redo")
+	}
+
+	m.ClearHistory()
+	if m.CanUndo() || m.CanRedo() {
+		t.Error("expected history to be cleared")
+	}
+}
+
+func TestPut(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		row     int
+		col     int
+		keys    string
+		want    string
+		wantRow int
+		wantCol int
+	}{
+		{name: "yw p", value: "foo bar", keys: "ywP", want: "foo foo bar", wantCol: 3},
+		{name: "x p", value: "abc", keys: "xp", want: "bac", wantCol: 1},
+		{name: "count p", value: "ab", keys: "ylp2p", want: "aaaab", wantCol: 3},
+		{name: "yy p", value: "one\ntwo", keys: "yyp", want: "one\none\ntwo", wantRow: 1},
+		{name: "yy P", value: "one\ntwo", row: 1, keys: "yyP", want: "one\ntwo\ntwo", wantRow: 1},
+		{name: "dd p", value: "one\ntwo\nthree", keys: "ddp", want: "two\none\nthree", wantRow: 1},
+		{name: "p on empty line", value: "foo\n", keys: "yejp", want: "foo\nfoo", wantRow: 1, wantCol: 2},
+		{name: "multi-line charwise", value: "ab\ncd", col: 1, keys: "vjyP", want: "ab\ncdb\ncd", wantCol: 1},
+		{name: "named register", value: "foo bar", keys: "\"ayewx\"aP", want: "foo fooar", wantCol: 6},
+		{name: "append to register", value: "foo bar", keys: "\"ayew\"Ayeo\x1b\"ap", want: "foo bar\nfoobar", wantRow: 1, wantCol: 5},
+		{name: "yank register", value: "foo bar", keys: "yewx\"0P", want: "foo fooar", wantCol: 6},
+		{name: "black hole", value: "foo bar", keys: "yew\"_xP", want: "foo fooar", wantCol: 6},
+		{name: "visual p", value: "foo bar", col: 4, keys: "ye0vep", want: "bar bar", wantCol: 2},
+		{name: "visual p at end of line", value: "foo bar", keys: "yewvep", want: "foo foo", wantCol: 6},
+		{name: "visual line p", value: "one\ntwo", keys: "yyjVp", want: "one\none", wantRow: 1},
+		{name: "block put", value: "ab\ncd", keys: "\x16jyP", want: "aab\nccd"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTextArea()
+			m.SetValue(tt.value)
+			m.SetCursor(tt.row, tt.col)
+			m.SetNormalMode()
+
+			m = sendKeys(m, tt.keys)
+
+			if got := m.Value(); got != tt.want {
+				t.Errorf("value: want %q, got %q", tt.want, got)
+			}
+			if m.Line() != tt.wantRow || m.Column() != tt.wantCol {
+				t.Errorf("cursor: want %d:%d, got %d:%d", tt.wantRow, tt.wantCol, m.Line(), m.Column())
+			}
+		})
+	}
+}
+
+func TestRegisters(t *testing.T) {
+	m := newTextArea()
+	m.SetValue("one\ntwo\nthree four")
+	m.SetCursor(0, 0)
+	m.SetNormalMode()
+
+	m = sendKeys(m, "dddd")
+	if got, want := m.Register('1'), (Register{Text: "two", Linewise: true}); got != want {
+		t.Errorf("register 1: want %+v, got %+v", want, got)
+	}
+	if got, want := m.Register('2'), (Register{Text: "one", Linewise: true}); got != want {
+		t.Errorf("register 2: want %+v, got %+v", want, got)
+	}
+
+	m = sendKeys(m, "dw")
+	if got, want := m.Register(SmallDeleteRegister), (Register{Text: "three "}); got != want {
+		t.Errorf("small delete register: want %+v, got %+v", want, got)
+	}
+	if got, want := m.Register(UnnamedRegister), (Register{Text: "three "}); got != want {
+		t.Errorf("unnamed register: want %+v, got %+v", want, got)
+	}
+
+	m.SetRegister('q', Register{Text: "seeded"})
+	m = sendKeys(m, "\"qP")
+	if got, want := m.Value(), "seededfour"; got != want {
+		t.Errorf("value: want %q, got %q", want, got)
+	}
+	if got := m.Registers(); len(got) != 5 {
+		t.Errorf("want 5 registers, got %v", got)
+	}
+}
+
+func TestClipboardRegister(t *testing.T) {
+	clip := &fakeClipboard{}
+	m := newTextArea()
+	m.vim.Clipboard = clip
+	m.SetValue("foo\nbar")
+	m.SetCursor(0, 0)
+	m.SetNormalMode()
+
+	m = sendKeys(m, "\"+yy")
+	if want := "foo\n"; clip.text != want {
+		t.Errorf("clipboard: want %q, got %q", want, clip.text)
+	}
+
+	clip.text = "baz"
+	m = sendKeys(m, "j\"+p")
+	if got, want := m.Value(), "foo\nbbazar"; got != want {
+		t.Errorf("value: want %q, got %q", want, got)
+	}
+}
+
+func TestExCommands(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		row     int
+		keys    string
+		want    string
+		wantRow int
+		message string
+	}{
+		{name: "jump", value: "one\ntwo\nthree", keys: ":3\r", want: "one\ntwo\nthree", wantRow: 2},
+		{name: "jump past end", value: "one\ntwo", keys: ":9\r", want: "one\ntwo", wantRow: 1},
+		{name: "jump relative", value: "one\ntwo\nthree", keys: ":+2\r", want: "one\ntwo\nthree", wantRow: 2},
+		{name: "substitute", value: "foo foo\nfoo", keys: ":s/o/0/\r", want: "f0o foo\nfoo"},
+		{name: "substitute all", value: "foo foo\nfoo", keys: ":%s/o/0/g\r", want: "f00 f00\nf00", wantRow: 1},
+		{name: "substitute range", value: "a\na\na\na", keys: ":2,3s/a/b/\r", want: "a\nb\nb\na", wantRow: 2},
+		{name: "substitute groups", value: "foo bar", keys: ":s/\\(\\w+\\) \\(\\w+\\)/\\2 \\1/\r", want: "foo bar", message: "E486: Pattern not found: \\(\\w+\\) \\(\\w+\\)"},
+		{name: "substitute go groups", value: "foo bar", keys: ":s/(\\w+) (\\w+)/\\2 & \\1/\r", want: "bar foo bar foo"},
+		{name: "substitute line break", value: "a,b", keys: ":s/,/\\r/\r", want: "a\nb", wantRow: 1},
+		{name: "substitute ignore case", value: "Foo", keys: ":s/foo/bar/i\r", want: "bar"},
+		{name: "substitute other delimiter", value: "a/b", keys: ":s#/#-#\r", want: "a-b"},
+		{name: "pattern not found", value: "foo", keys: ":s/x/y/\r", want: "foo", message: "E486: Pattern not found: x"},
+		{name: "visual range", value: "a\nb\nc", row: 1, keys: "Vj:s/^/# /\r", want: "a\n# b\n# c", wantRow: 2},
+		{name: "count range", value: "a\nb\nc", keys: "2:s/$/;/\r", want: "a;\nb;\nc", wantRow: 1},
+		{name: "unknown command", value: "foo", keys: ":frobnicate\r", want: "foo", message: "E492: Not an editor command: frobnicate"},
+		{name: "invalid range", value: "foo", keys: ":1,5s/o/0/\r", want: "foo", message: "E16: Invalid range"},
+		{name: "escape", value: "foo", keys: ":s/o/0/\x1b", want: "foo"},
+		{name: "undo", value: "foo\nfoo", keys: ":%s/o/0/g\ru", want: "foo\nfoo"},
+		{name: "abbreviation", value: "foo", keys: ":subst/o/0/\r", want: "f0o"},
+		{name: "set query", value: "foo", keys: ":set nu? sw?\r", want: "foo", message: "number shiftwidth=4"},
+		{name: "unknown option", value: "foo", keys: ":set foo\r", want: "foo", message: "E518: Unknown option: foo"},
+		{name: "textwidth", value: "one two three", keys: ":set tw=8\rgqq", want: "one two\nthree", wantRow: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTextArea()
+			m.SetValue(tt.value)
+			m.SetCursor(tt.row, 0)
+			m.SetNormalMode()
+
+			m = sendKeys(m, tt.keys)
+
+			if got := m.Value(); got != tt.want {
+				t.Errorf("value: want %q, got %q", tt.want, got)
+			}
+			if m.Line() != tt.wantRow {
+				t.Errorf("row: want %d, got %d", tt.wantRow, m.Line())
+			}
+			if got := m.Message(); got != tt.message {
+				t.Errorf("message: want %q, got %q", tt.message, got)
+			}
+			if m.Mode() != ModeNormal {
+				t.Errorf("mode: want %s, got %s", ModeNormal, m.Mode())
+			}
+		})
+	}
+}
+
+func TestExSet(t *testing.T) {
+	m := newTextArea()
+	m.SetNormalMode()
+
+	m = sendKeys(m, ":set nonumber nowrap sw=2\r")
+	if m.ShowLineNumbers || m.SoftWrap || m.ShiftWidth != 2 {
+		t.Errorf("want options off, got number=%v wrap=%v shiftwidth=%d", m.ShowLineNumbers, m.SoftWrap, m.ShiftWidth)
+	}
+	m = sendKeys(m, ":set number wrap!\r")
+	if !m.ShowLineNumbers || !m.SoftWrap {
+		t.Errorf("want options on, got number=%v wrap=%v", m.ShowLineNumbers, m.SoftWrap)
+	}
+	m = sendKeys(m, ":set nolbr bri\r")
+	if m.WrapMode != textarea.WrapChar || !m.BreakIndent {
+		t.Errorf("want character wrapping with break indent, got %v %v", m.WrapMode, m.BreakIndent)
+	}
+}
+
+func TestExMessages(t *testing.T) {
+	tests := []struct {
+		line string
+		want []tea.Msg
+	}{
+		{line: "w", want: []tea.Msg{WriteMsg{}}},
+		{line: "write! out.txt", want: []tea.Msg{WriteMsg{Path: "out.txt", Force: true}}},
+		{line: "q!", want: []tea.Msg{QuitMsg{Force: true}}},
+		{line: "wq", want: []tea.Msg{WriteMsg{}, QuitMsg{}}},
+		{line: "x", want: []tea.Msg{WriteMsg{}, QuitMsg{}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			m := newTextArea()
+			cmd := m.ExecuteCommand(tt.line)
+			if cmd == nil {
+				t.Fatal("expected a command")
+			}
+			var got []tea.Msg
+			msg := cmd()
+			// tea.Sequence returns an unexported slice of commands.
+			if v := reflect.ValueOf(msg); v.Kind() == reflect.Slice {
+				for i := range v.Len() {
+					got = append(got, v.Index(i).Interface().(tea.Cmd)())
+				}
+			} else {
+				got = append(got, msg)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("want %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRegisterExCommand(t *testing.T) {
+	m := newTextArea()
+	m.SetNormalMode()
+	m.RegisterExCommand(ExCommand{
+		Name: "greet",
+		Run: func(m *Model, args ExArgs) (tea.Cmd, error) {
+			m.InsertString("hello " + args.Arg)
+			return nil, nil
+		},
+		Complete: func(_ Model, arg string) []string {
+			return []string{"world", "there"}
+		},
+	})
+
+	m = sendKeys(m, ":gr\t t\t\r")
+	if got, want := m.Value(), "hello there"; got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestNoWrapView(t *testing.T) {
+	m := newTextArea()
+	m.Prompt = ""
+	m.ShowLineNumbers = false
+	m.Statusbar = nil
+	m.SoftWrap = false
+	m.SetWidth(12)
+	m.SetHeight(2)
+	m.SetValue("0123456789abcdef\nshort")
+	m.SetCursor(0, 0)
+	m.SetNormalMode()
+
+	m = sendKeys(m, "$")
+	got := ansi.Strip(m.View())
+	want := "456789abcdef\nt           "
+	if got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestStatusbarSegments(t *testing.T) {
+	m := New(
+		WithSegments(ModeSegment(), FileNameSegment(), ModifiedSegment(),
+			Right(PendingSegment()), Right(PositionSegment()), Right(PercentSegment())),
+		WithFileName("notes.txt"),
+	)
+	m.Focus()
+	m.SetWidth(60)
+	m.SetValue("one\ntwo\nthree\nfour")
+	m.MarkSaved()
+	m.SetCursor(1, 2)
+	m.SetNormalMode()
+
+	status := func() string {
+		view := ansi.Strip(m.View())
+		return view[strings.LastIndex(view, "\n")+1:]
+	}
+	for _, want := range []string{"NORMAL", "notes.txt", "2:3", "50%"} {
+		if got := status(); !strings.Contains(got, want) {
+			t.Errorf("want %q in the statusbar, got %q", want, got)
+		}
+	}
+	if got := status(); strings.Contains(got, "[+]") {
+		t.Errorf("want the value unmodified, got %q", got)
+	}
+
+	m = sendKeys(m, "2d")
+	if got := status(); !strings.Contains(got, "2d") {
+		t.Errorf("want the pending operator in the statusbar, got %q", got)
+	}
+	m = sendKeys(m, "d")
+	if got := status(); !strings.Contains(got, "[+]") || !strings.Contains(got, "2:1") {
+		t.Errorf("want the value modified and the cursor on 2:1, got %q", got)
+	}
+
+	m = sendKeys(m, "u")
+	if got := status(); strings.Contains(got, "[+]") {
+		t.Errorf("want the value unmodified once undone, got %q", got)
+	}
+	m = sendKeys(m, "x")
+	m.MarkSaved()
+	if got := status(); strings.Contains(got, "[+]") {
+		t.Errorf("want the value unmodified once saved, got %q", got)
+	}
+
+	m.Segment("filename").Hidden = true
+	m.Segment("mode").Colors = nil
+	if got := status(); strings.Contains(got, "notes.txt") {
+		t.Errorf("want the file name hidden, got %q", got)
+	}
+	if elem := m.Statusbar.GetTag("mode"); elem == nil || elem.BgColor != nil {
+		t.Error("want the mode segment restyled without a background")
+	}
+	if m.Segment("missing") != nil {
+		t.Error("want no segment for an unknown name")
+	}
+}
+
+func TestSearch(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		col     int
+		keys    string
+		want    string
+		wantRow int
+		wantCol int
+		message string
+	}{
+		{name: "forward", value: "foo bar\nbar", keys: "/bar\r", wantCol: 4},
+		{name: "next", value: "foo bar\nbar", keys: "/bar\rn", wantRow: 1},
+		{name: "wrap around", value: "foo bar\nbar", keys: "/bar\rnn", wantCol: 4, message: "search hit BOTTOM, continuing at TOP"},
+		{name: "backward", value: "foo bar\nbar", keys: "?bar\r", wantRow: 1, message: "search hit TOP, continuing at BOTTOM"},
+		{name: "previous", value: "foo bar\nbar baz bar", keys: "/bar\rnN", wantCol: 4},
+		{name: "count", value: "foo bar\nbar", keys: "2/bar\r", wantRow: 1},
+		{name: "regexp", value: "foo bar\nbaz", keys: "/ba[z]\r", wantRow: 1},
+		{name: "not found", value: "foo", keys: "/x\r", message: "E486: Pattern not found: x"},
+		{name: "invalid pattern", value: "foo", keys: "/(\r", message: "E383: Invalid search string: ("},
+		{name: "no previous pattern", value: "foo", keys: "n", message: "E35: No previous regular expression"},
+		{name: "empty pattern repeats", value: "a a a", keys: "/a\r/\r", wantCol: 4},
+		{name: "escape", value: "foo bar", keys: "/bar\x1b"},
+		{name: "star", value: "foo bar foo", keys: "*", wantCol: 8},
+		{name: "star whole word", value: "foo food foo", keys: "*", wantCol: 9},
+		{name: "star after cursor", value: "  foo foo", keys: "*", wantCol: 6},
+		{name: "hash", value: "foo bar foo", col: 1, keys: "#", wantCol: 8, message: "search hit TOP, continuing at BOTTOM"},
+		{name: "star n", value: "foo foo foo", keys: "*n", wantCol: 8},
+		{name: "no string under cursor", value: "foo  ", col: 3, keys: "*", wantCol: 3, message: "E348: No string under cursor"},
+		{name: "delete", value: "foo bar", keys: "d/bar\r", want: "bar"},
+		{name: "delete repeat", value: "a bar b bar c", keys: "d/bar\r.", want: "bar c"},
+		{name: "visual", value: "foo bar baz", keys: "v/bar\rd", want: "ar baz"},
+		{name: "substitute last pattern", value: "foo bar", keys: "/bar\r:s//baz/\r", want: "foo baz"},
+		{name: "ignorecase", value: "foo FOO", keys: ":set ic\r/foo\r", wantCol: 4},
+		{name: "nowrapscan", value: "foo bar", col: 4, keys: ":set nows\r/foo\r", wantCol: 4, message: "E385: Search hit BOTTOM without match for: foo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTextArea()
+			m.SetValue(tt.value)
+			m.SetCursor(0, tt.col)
+			m.SetNormalMode()
+
+			m = sendKeys(m, tt.keys)
+
+			want := tt.want
+			if want == "" {
+				want = tt.value
+			}
+			if got := m.Value(); got != want {
+				t.Errorf("value: want %q, got %q", want, got)
+			}
+			if m.Line() != tt.wantRow || m.Column() != tt.wantCol {
+				t.Errorf("cursor: want %d:%d, got %d:%d", tt.wantRow, tt.wantCol, m.Line(), m.Column())
+			}
+			if got := m.Message(); got != tt.message {
+				t.Errorf("message: want %q, got %q", tt.message, got)
+			}
+		})
+	}
+}
+
+func TestSearchHighlight(t *testing.T) {
+	m := newTextArea()
+	m.SetValue("foo bar\nbar baz")
+	m.SetCursor(0, 0)
+	m.SetNormalMode()
+
+	// Matches are highlighted and the cursor moves to the first one while
+	// the pattern is typed.
+	m = sendKeys(m, "/ba")
+	if got, want := m.searchMatches(1), [][2]int{{0, 2}, {4, 6}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("incremental matches: want %v, got %v", want, got)
+	}
+	if m.Line() != 0 || m.Column() != 4 {
+		t.Errorf("incremental cursor: want 0:4, got %d:%d", m.Line(), m.Column())
+	}
+
+	m = sendKeys(m, "r\r")
+	if got, want := m.searchMatches(1), [][2]int{{0, 3}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("matches: want %v, got %v", want, got)
+	}
+	if got, want := m.SearchPattern(), "bar"; got != want {
+		t.Errorf("pattern: want %q, got %q", want, got)
+	}
+
+	m = sendKeys(m, ":noh\r")
+	if got := m.searchMatches(1); got != nil {
+		t.Errorf("matches after :nohlsearch: want none, got %v", got)
+	}
+	m = sendKeys(m, "n")
+	if got := m.searchMatches(1); len(got) != 1 {
+		t.Errorf("matches after n: want 1, got %v", got)
+	}
+
+	if err := m.Search("nope", false); err == nil || err.Error() != "E486: Pattern not found: nope" {
+		t.Errorf("want pattern not found error, got %v", err)
+	}
+}
+
+// sendKeys sends each rune of keys as a key press, with \x1b sent as the
+// escape key, \r as enter, \t as tab, \x12 as ctrl+r and \x16 as ctrl+v.
+func sendKeys(m Model, keys string) Model {
+	for _, k := range keys {
+		var msg tea.KeyPressMsg
+		switch k {
+		case '\x1b':
+			msg = tea.KeyPressMsg{Code: tea.KeyEscape}
+		case '\r':
+			msg = tea.KeyPressMsg{Code: tea.KeyEnter}
+		case '\t':
+			msg = tea.KeyPressMsg{Code: tea.KeyTab}
+		case '\x12':
+			msg = tea.KeyPressMsg{Code: 'r', Mod: tea.ModCtrl}
+		case '\x16':
+			msg = tea.KeyPressMsg{Code: 'v', Mod: tea.ModCtrl}
+		default:
+			msg = tea.KeyPressMsg{Code: k, Text: string(k)}
+		}
+		m, _ = m.Update(msg)
+	}
+	return m
+}
+
+type fakeClipboard struct {
+	text string
+}
+
+func (c *fakeClipboard) ReadAll() (string, error)   { return c.text, nil }
+func (c *fakeClipboard) WriteAll(text string) error { c.text = text; return nil }
+
+// searchMatches returns the columns of the search matches in a row.
+func (m Model) searchMatches(row int) [][2]int {
+	return m.vim.SearchMatches(m.LineRunes(row))
+}
+
+// scrollTo scrolls the view so that it starts at row top, and moves the
+// cursor to row.
+func scrollTo(m Model, top, row int) Model {
+	m.SetCursor(m.LineCount()-1, 0)
+	m.SetCursor(top, 0)
+	m.SetCursor(row, 0)
+	return m
+}
+
+// cursorLineNumber returns the display line of the cursor, counting from the
+// first line of the value.
+func cursorLineNumber(m Model) int {
+	n := m.LineInfo().RowOffset
+	for row := range m.Line() {
+		c := m
+		c.SetCursor(row, 0)
+		n += c.LineInfo().Height
+	}
+	return n
+}
+
+func TestReadOnlyAndProtected(t *testing.T) {
+	m := newTextArea()
+	m.SetValue("foo bar")
+	m.SetCursor(0, 0)
+	m.SetNormalMode()
+	m.ReadOnly = true
+	m = sendKeys(m, "dwxifoo\x1b")
+	if got := m.Value(); got != "foo bar" {
+		t.Errorf("want a read-only value unchanged, got %q", got)
+	}
+
+	m = sendKeys(m, ":s/foo/baz/\r")
+	if got, want := m.Message(), "E21: Cannot make changes, 'modifiable' is off"; got != want || m.Value() != "foo bar" {
+		t.Errorf("want :s refused in a read-only value, got %q with message %q", m.Value(), got)
+	}
+
+	m.ReadOnly = false
+	m.Protect(textarea.Range{Start: 0, End: 4})
+	m.SetCursor(0, 0)
+	m = sendKeys(m, "dwwx")
+	if got := m.Value(); got != "foo ar" {
+		t.Errorf("want only unprotected text changed, got %q", got)
+	}
+
+	m.SetValue("foo foo\nfoo")
+	m.Protect(textarea.Range{Start: 0, End: 3})
+	m = sendKeys(m, ":%s/foo/x/\r")
+	if got, want := m.Value(), "foo foo\nx"; got != want {
+		t.Errorf("want :s to skip protected text, got %q", got)
+	}
+	m = sendKeys(m, ":1s/o/0/g\r")
+	if got, want := m.Message(), "E21: Cannot make changes, the text is protected"; got != want || m.Value() != "foo foo\nx" {
+		t.Errorf("want :s refused on protected text, got %q with message %q", m.Value(), got)
+	}
+}
+
+func TestFolds(t *testing.T) {
+	m := newTextArea()
+	m.SetValue("a:\n  b\n  c\nd:\n  e\nf")
+	m.FoldByIndent()
+	m.SetCursor(0, 0)
+	m.SetNormalMode()
+
+	m = sendKeys(m, "zM")
+	if got := m.Folds(); !got[0].Closed || !got[1].Closed {
+		t.Fatalf("want all folds closed, got %v", got)
+	}
+	m = sendKeys(m, "j")
+	if got := m.Line(); got != 3 {
+		t.Errorf("want j to move over the fold, got row %d", got)
+	}
+	m = sendKeys(m, "k")
+	if got := m.Line(); got != 0 {
+		t.Errorf("want k to move over the fold, got row %d", got)
+	}
+
+	m = sendKeys(m, "za")
+	if _, ok := m.ClosedFold(1); ok {
+		t.Error("want za to open the fold")
+	}
+	m = sendKeys(m, "jzc")
+	if got := m.Line(); got != 0 {
+		t.Errorf("want zc to move the cursor out of the fold, got row %d", got)
+	}
+	m = sendKeys(m, "zR")
+	for _, f := range m.Folds() {
+		if f.Closed {
+			t.Errorf("want zR to open all folds, got %v", m.Folds())
+		}
+	}
+
+	// Deleting a line with a closed fold deletes all of its lines.
+	m = sendKeys(m, "zMddj")
+	if got, want := m.Value(), "d:\n  e\nf"; got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	if got := m.Line(); got != 2 {
+		t.Errorf("want the cursor moved over the fold, got row %d", got)
+	}
+}
+
+func TestCountSegment(t *testing.T) {
+	m := newTextArea()
+	for _, value := range []string{"", "one", "  one  two\n\nthree\tfour ", "é 👍🏽\n\n"} {
+		m.SetValue(value)
+		content := CountSegment().Content(m)
+		text := m.Value()
+		want := fmt.Sprintf("%d chars | %d words", len([]rune(text)), len(strings.Fields(text)))
+		if content != want {
+			t.Errorf("%q: want %q, got %q", value, want, content)
+		}
+	}
+}
+
+func BenchmarkTyping(b *testing.B) {
+	var v strings.Builder
+	for i := range 200_000 {
+		fmt.Fprintf(&v, "2024-01-01T00:00:00Z INFO request %d served in %dms\n", i, i%100)
+	}
+	m := New(WithSegments(ModeSegment(), CountSegment(), ModifiedSegment(),
+		Right(PositionSegment()), Right(PercentSegment())))
+	m.Focus()
+	m.MaxHeight = 0
+	m.SetHeight(40)
+	m.SetWidth(120)
+	m.SetValue(v.String())
+	m.MarkSaved()
+	m.MoveToEnd()
+	m = sendKeys(m, "i")
+	m.View()
+	b.ResetTimer()
+	for i := range b.N {
+		// Type lines of 40 characters.
+		msg := keyPress('x')
+		if i%40 == 39 {
+			msg = tea.KeyPressMsg{Code: tea.KeyEnter}
+		}
+		m, _ = m.Update(msg)
+		m.View()
+	}
+}
@@ -0,0 +1,144 @@
+package textarea_vim
+
+import (
+	tea "charm.land/bubbletea/v2"
+	"github.com/haochend413/bubbles/v2/key"
+	"github.com/haochend413/bubbles/v2/textinput"
+	"github.com/haochend413/bubbles/v2/vim"
+)
+
+// editor drives the textarea from the Vim engine. It implements
+// [vim.Editor], [vim.History], [vim.Pager], [vim.CommandLine] and
+// [vim.ReadOnlyEditor].
+type editor struct {
+	m *Model
+}
+
+// editor returns the textarea as seen by the Vim engine.
+func (m *Model) editor() editor {
+	return editor{m}
+}
+
+func (e editor) LineCount() int {
+	return e.m.LineCount()
+}
+
+func (e editor) Line(row int) []rune {
+	return e.m.LineRunes(row)
+}
+
+func (e editor) Cursor() vim.Pos {
+	return vim.Pos{Row: e.m.Line(), Col: e.m.Column()}
+}
+
+func (e editor) SetCursor(p vim.Pos) {
+	e.m.SetCursor(p.Row, p.Col)
+}
+
+// Replace replaces text unless it's protected, like the keys of the
+// textarea would.
+func (e editor) Replace(start, end vim.Pos, text string) {
+	if !e.m.CanReplace(start.Row, start.Col, end.Row, end.Col) {
+		return
+	}
+	e.m.ReplaceRange(start.Row, start.Col, end.Row, end.Col, text)
+}
+
+func (e editor) ReadOnly() bool {
+	return e.m.ReadOnly
+}
+
+// Key passes keys typed in insert mode on to the textarea. In the other
+// modes, only keys that move the cursor without being Vim motions are.
+func (e editor) Key(msg tea.KeyPressMsg) tea.Cmd {
+	if e.m.vim.Mode() != ModeInsert && !e.m.navigationKey(msg) {
+		return nil
+	}
+	var cmd tea.Cmd
+	e.m.Model, cmd = e.m.Model.Update(msg)
+	return cmd
+}
+
+func (e editor) BeginChange() { e.m.BeginChange() }
+func (e editor) EndChange()   { e.m.EndChange() }
+func (e editor) Undo()        { e.m.Undo() }
+func (e editor) Redo()        { e.m.Redo() }
+
+func (e editor) PageHeight() int {
+	return e.m.Height()
+}
+
+func (e editor) ToggleFold(row int) { e.m.ToggleFold(row) }
+func (e editor) OpenFold(row int)   { e.m.OpenFold(row) }
+func (e editor) CloseFold(row int)  { e.m.CloseFold(row) }
+func (e editor) OpenAllFolds()      { e.m.OpenAllFolds() }
+func (e editor) CloseAllFolds()     { e.m.CloseAllFolds() }
+
+func (e editor) ClosedFold(row int) (start, end int, ok bool) {
+	f, ok := e.m.ClosedFold(row)
+	return f.Start, f.End, ok
+}
+
+func (e editor) OpenCommandLine(prompt, text string) tea.Cmd {
+	m := e.m
+	m.cmdline.Prompt = prompt
+	m.cmdline.SetValue(text)
+	m.cmdline.Focus()
+	if prompt == ":" {
+		m.updateCompletions()
+	} else {
+		m.cmdline.SetSuggestions(nil)
+	}
+	// Start the cursor of the command line blinking.
+	return textinput.Blink
+}
+
+// navigationKey reports whether a key moves the cursor in the textarea
+// without being handled by the Vim engine, such as home or end.
+func (m Model) navigationKey(msg tea.KeyPressMsg) bool {
+	km := m.KeyMap
+	return key.Matches(msg, km.LineStart, km.LineEnd, km.WordForward, km.WordBackward,
+		km.InputBegin, km.InputEnd, km.PageUp, km.PageDown)
+}
+
+// commandLineKey handles a key press on the command line.
+func (m *Model) commandLineKey(msg tea.KeyPressMsg) tea.Cmd {
+	ed := m.editor()
+	switch {
+	case key.Matches(msg, m.KeyMap.EnterNormalMode),
+		key.Matches(msg, m.KeyMap.DeleteCharacterBackward) && m.cmdline.Value() == "":
+		// Like in Vim, deleting past the start of the command line closes
+		// it.
+		m.closeCommandLine()
+		m.vim.CloseCommandLine(ed)
+		return nil
+	case key.Matches(msg, m.KeyMap.InsertNewline):
+		line := m.cmdline.Value()
+		searching := m.vim.Searching()
+		m.closeCommandLine()
+		if searching {
+			return m.vim.ExecuteSearch(ed, line)
+		}
+		m.vim.CloseCommandLine(ed)
+		return m.ExecuteCommand(line)
+	}
+	return m.updateCommandLine(msg)
+}
+
+// closeCommandLine clears and blurs the command line prompt.
+func (m *Model) closeCommandLine() {
+	m.cmdline.Blur()
+	m.cmdline.Reset()
+}
+
+// updateCommandLine passes a message on to the command line prompt.
+func (m *Model) updateCommandLine(msg tea.Msg) tea.Cmd {
+	var cmd tea.Cmd
+	m.cmdline, cmd = m.cmdline.Update(msg)
+	if m.vim.Searching() {
+		m.vim.PreviewSearch(m.editor(), m.cmdline.Value())
+	} else {
+		m.updateCompletions()
+	}
+	return cmd
+}
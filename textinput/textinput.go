@@ -11,10 +11,10 @@ import (
 	"github.com/haochend413/bubbles/v2/cursor"
 	"github.com/haochend413/bubbles/v2/internal/runeutil"
 	"github.com/haochend413/bubbles/v2/key"
+	"github.com/haochend413/bubbles/v2/vim"
 	tea "charm.land/bubbletea/v2"
 	"github.com/haochend413/lipgloss/v2"
 	"github.com/atotto/clipboard"
-	rw "github.com/mattn/go-runewidth"
 	"github.com/rivo/uniseg"
 )
 
@@ -146,6 +146,11 @@ type Model struct {
 	// Should the input suggest to complete
 	ShowSuggestions bool
 
+	// Vim enables vi-style line editing when set, such as to [vim.New]().
+	// Keys are then Vim commands, and text is typed in insert mode. A new
+	// engine starts in normal mode. Set it to nil to disable it.
+	Vim *vim.Engine
+
 	// suggestions is a list of suggestions that may be used to complete the
 	// input.
 	suggestions            [][]rune
@@ -362,36 +367,38 @@ func (m *Model) handleOverflow() {
 	// Correct right offset if we've deleted characters
 	m.offsetRight = min(m.offsetRight, len(m.value))
 
+	// The visible text starts and ends with whole characters.
 	if m.pos < m.offset {
 		m.offset = m.pos
 
 		w := 0
-		i := 0
-		runes := m.value[m.offset:]
+		i := m.offset
 
-		for i < len(runes) && w <= m.Width() {
-			w += rw.RuneWidth(runes[i])
+		for i < len(m.value) && w <= m.Width() {
+			next := runeutil.NextGrapheme(m.value, i)
+			w += uniseg.StringWidth(string(m.value[i:next]))
 			if w <= m.Width()+1 {
-				i++
+				i = next
 			}
 		}
 
-		m.offsetRight = m.offset + i
+		m.offsetRight = i
 	} else if m.pos >= m.offsetRight {
 		m.offsetRight = m.pos
 
 		w := 0
-		runes := m.value[:m.offsetRight]
-		i := len(runes) - 1
+		i := m.offsetRight
 
 		for i > 0 && w < m.Width() {
-			w += rw.RuneWidth(runes[i])
-			if w <= m.Width() {
-				i--
+			prev := runeutil.PrevGrapheme(m.value, i)
+			w += uniseg.StringWidth(string(m.value[prev:i]))
+			if w > m.Width() {
+				break
 			}
+			i = prev
 		}
 
-		m.offset = m.offsetRight - (len(runes) - 1 - i)
+		m.offset = i
 	}
 }
 
@@ -584,7 +591,7 @@ func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
 
 	// Need to check for completion before, because key is configurable and might be double assigned
 	keyMsg, ok := msg.(tea.KeyPressMsg)
-	if ok && key.Matches(keyMsg, m.KeyMap.AcceptSuggestion) {
+	if ok && m.insertMode() && key.Matches(keyMsg, m.KeyMap.AcceptSuggestion) {
 		if m.canAcceptSuggestion() {
 			m.value = append(m.value, m.matchedSuggestions[m.currentSuggestionIndex][len(m.value):]...)
 			m.CursorEnd()
@@ -595,75 +602,28 @@ func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
 	// the cursor position changes, we can reset the blink.
 	oldPos := m.pos
 
+	var cmds []tea.Cmd
+	var cmd tea.Cmd
+
 	switch msg := msg.(type) {
 	case tea.KeyPressMsg:
-		switch {
-		case key.Matches(msg, m.KeyMap.DeleteWordBackward):
-			m.deleteWordBackward()
-		case key.Matches(msg, m.KeyMap.DeleteCharacterBackward):
-			m.Err = nil
-			if len(m.value) > 0 {
-				m.value = append(m.value[:max(0, m.pos-1)], m.value[m.pos:]...)
-				m.Err = m.validate(m.value)
-				if m.pos > 0 {
-					m.SetCursor(m.pos - 1)
-				}
-			}
-		case key.Matches(msg, m.KeyMap.WordBackward):
-			m.wordBackward()
-		case key.Matches(msg, m.KeyMap.CharacterBackward):
-			if m.pos > 0 {
-				m.SetCursor(m.pos - 1)
-			}
-		case key.Matches(msg, m.KeyMap.WordForward):
-			m.wordForward()
-		case key.Matches(msg, m.KeyMap.CharacterForward):
-			if m.pos < len(m.value) {
-				m.SetCursor(m.pos + 1)
-			}
-		case key.Matches(msg, m.KeyMap.LineStart):
-			m.CursorStart()
-		case key.Matches(msg, m.KeyMap.DeleteCharacterForward):
-			if len(m.value) > 0 && m.pos < len(m.value) {
-				m.value = slices.Delete(m.value, m.pos, m.pos+1)
-				m.Err = m.validate(m.value)
-			}
-		case key.Matches(msg, m.KeyMap.LineEnd):
-			m.CursorEnd()
-		case key.Matches(msg, m.KeyMap.DeleteAfterCursor):
-			m.deleteAfterCursor()
-		case key.Matches(msg, m.KeyMap.DeleteBeforeCursor):
-			m.deleteBeforeCursor()
-		case key.Matches(msg, m.KeyMap.Paste):
-			return m, Paste
-		case key.Matches(msg, m.KeyMap.DeleteWordForward):
-			m.deleteWordForward()
-		case key.Matches(msg, m.KeyMap.NextSuggestion):
-			m.nextSuggestion()
-		case key.Matches(msg, m.KeyMap.PrevSuggestion):
-			m.previousSuggestion()
-		default:
-			// Input one or more regular characters.
-			m.insertRunesFromUserInput([]rune(msg.Text))
+		if m.Vim != nil {
+			cmd = m.Vim.HandleKey(lineEditor{&m}, msg)
+		} else {
+			cmd = m.handleKey(msg)
 		}
-
-		// Check again if can be completed
-		// because value might be something that does not match the completion prefix
-		m.updateSuggestions()
+		cmds = append(cmds, cmd)
 
 	case tea.PasteMsg:
-		m.insertRunesFromUserInput([]rune(msg.Content))
+		m.paste(msg.Content)
 
 	case pasteMsg:
-		m.insertRunesFromUserInput([]rune(msg))
+		m.paste(string(msg))
 
 	case pasteErrMsg:
 		m.Err = msg
 	}
 
-	var cmds []tea.Cmd
-	var cmd tea.Cmd
-
 	if m.useVirtualCursor {
 		m.virtualCursor, cmd = m.virtualCursor.Update(msg)
 		cmds = append(cmds, cmd)
@@ -680,6 +640,63 @@ func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
 	return m, tea.Batch(cmds...)
 }
 
+// handleKey handles a key press.
+func (m *Model) handleKey(msg tea.KeyPressMsg) tea.Cmd {
+	switch {
+	case key.Matches(msg, m.KeyMap.DeleteWordBackward):
+		m.deleteWordBackward()
+	case key.Matches(msg, m.KeyMap.DeleteCharacterBackward):
+		m.Err = nil
+		if len(m.value) > 0 {
+			prev := runeutil.PrevGrapheme(m.value, m.pos)
+			m.value = append(m.value[:prev], m.value[m.pos:]...)
+			m.Err = m.validate(m.value)
+			m.SetCursor(prev)
+		}
+	case key.Matches(msg, m.KeyMap.WordBackward):
+		m.wordBackward()
+	case key.Matches(msg, m.KeyMap.CharacterBackward):
+		if m.pos > 0 {
+			m.SetCursor(runeutil.PrevGrapheme(m.value, m.pos))
+		}
+	case key.Matches(msg, m.KeyMap.WordForward):
+		m.wordForward()
+	case key.Matches(msg, m.KeyMap.CharacterForward):
+		if m.pos < len(m.value) {
+			m.SetCursor(runeutil.NextGrapheme(m.value, m.pos))
+		}
+	case key.Matches(msg, m.KeyMap.LineStart):
+		m.CursorStart()
+	case key.Matches(msg, m.KeyMap.DeleteCharacterForward):
+		if len(m.value) > 0 && m.pos < len(m.value) {
+			m.value = slices.Delete(m.value, m.pos, runeutil.NextGrapheme(m.value, m.pos))
+			m.Err = m.validate(m.value)
+		}
+	case key.Matches(msg, m.KeyMap.LineEnd):
+		m.CursorEnd()
+	case key.Matches(msg, m.KeyMap.DeleteAfterCursor):
+		m.deleteAfterCursor()
+	case key.Matches(msg, m.KeyMap.DeleteBeforeCursor):
+		m.deleteBeforeCursor()
+	case key.Matches(msg, m.KeyMap.Paste):
+		return Paste
+	case key.Matches(msg, m.KeyMap.DeleteWordForward):
+		m.deleteWordForward()
+	case key.Matches(msg, m.KeyMap.NextSuggestion):
+		m.nextSuggestion()
+	case key.Matches(msg, m.KeyMap.PrevSuggestion):
+		m.previousSuggestion()
+	default:
+		// Input one or more regular characters.
+		m.insertRunesFromUserInput([]rune(msg.Text))
+	}
+
+	// Check again if can be completed
+	// because value might be something that does not match the completion prefix
+	m.updateSuggestions()
+	return nil
+}
+
 // View renders the textinput in its current state.
 func (m Model) View() string {
 	// Placeholder text
@@ -696,11 +713,13 @@ func (m Model) View() string {
 	v := styleText(m.echoTransform(string(value[:pos])))
 
 	if pos < len(value) { //nolint:nestif
-		char := m.echoTransform(string(value[pos]))
+		// The cursor covers a whole character.
+		end := runeutil.NextGrapheme(value, pos)
+		char := m.echoTransform(string(value[pos:end]))
 		m.virtualCursor.SetChar(char)
-		v += m.virtualCursor.View()                            // cursor and text under it
-		v += styleText(m.echoTransform(string(value[pos+1:]))) // text after cursor
-		v += m.completionView(0)                               // suggested completion
+		v += m.virtualCursor.View()                          // cursor and text under it
+		v += styleText(m.echoTransform(string(value[end:]))) // text after cursor
+		v += m.completionView(0)                             // suggested completion
 	} else {
 		if m.focus && m.canAcceptSuggestion() {
 			suggestion := m.matchedSuggestions[m.currentSuggestionIndex]
@@ -920,8 +939,10 @@ func (m Model) Cursor() *tea.Cursor {
 
 	w := lipgloss.Width
 
+	// The cursor is past the width of the visible text before it.
 	promptWidth := w(m.promptView())
-	xOffset := m.Position() +
+	start := min(m.offset, m.pos)
+	xOffset := uniseg.StringWidth(m.echoTransform(string(m.value[start:m.pos]))) +
 		promptWidth
 	if m.width > 0 {
 		xOffset = min(xOffset, m.width+promptWidth)
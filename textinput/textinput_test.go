@@ -7,6 +7,9 @@ import (
 	"testing"
 
 	tea "charm.land/bubbletea/v2"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/charmbracelet/x/exp/golden"
+	"github.com/haochend413/bubbles/v2/vim"
 )
 
 func Test_CurrentSuggestion(t *testing.T) {
@@ -118,3 +121,74 @@ func sendString(m Model, str string) Model {
 
 	return m
 }
+
+func TestVim(t *testing.T) {
+	m := New()
+	m.Vim = vim.New()
+	m.Focus()
+
+	for _, k := range "ifoo bar baz" {
+		m, _ = m.Update(tea.KeyPressMsg{Code: k, Text: string(k)})
+	}
+	m, _ = m.Update(tea.KeyPressMsg{Code: tea.KeyEscape})
+	if m.Vim.Mode() != vim.ModeNormal || m.Position() != 10 {
+		t.Fatalf("want normal mode at 10, got %s at %d", m.Vim.Mode(), m.Position())
+	}
+
+	for _, k := range "0wdwyyP" {
+		m, _ = m.Update(tea.KeyPressMsg{Code: k, Text: string(k)})
+	}
+	if got, want := m.Value(), "foo baz foo baz"; got != want {
+		t.Errorf("value: want %q, got %q", want, got)
+	}
+}
+
+func TestGraphemes(t *testing.T) {
+	corpus := []struct {
+		name  string
+		value string
+	}{
+		{"cjk", "日本語のテキスト"},
+		{"emoji", "a👍🏽b👨\u200d👩\u200d👧c🇯🇵d"},
+		{"rtl", "a\u200fשלום\u200f b"},
+		{"combining", "cafe\u0301 n\u0303o\u0308 x"},
+		{"mixed", "漢a👍🏽e\u0301\u200fz 字"},
+	}
+	keys := []struct {
+		name string
+		msg  tea.Msg
+	}{
+		{"right", tea.KeyPressMsg{Code: tea.KeyRight}},
+		{"right", tea.KeyPressMsg{Code: tea.KeyRight}},
+		{"right", tea.KeyPressMsg{Code: tea.KeyRight}},
+		{"right", tea.KeyPressMsg{Code: tea.KeyRight}},
+		{"backspace", tea.KeyPressMsg{Code: tea.KeyBackspace}},
+		{"left", tea.KeyPressMsg{Code: tea.KeyLeft}},
+		{"delete", tea.KeyPressMsg{Code: tea.KeyDelete}},
+		{"end", tea.KeyPressMsg{Code: tea.KeyEnd}},
+	}
+
+	for _, tc := range corpus {
+		t.Run(tc.name, func(t *testing.T) {
+			m := New()
+			m.Prompt = ""
+			m.SetVirtualCursor(false)
+			m.SetWidth(6)
+			m.Focus()
+			m.SetValue(tc.value)
+			m.CursorStart()
+
+			var b strings.Builder
+			record := func(step string) {
+				fmt.Fprintf(&b, "%s: %q pos=%d cursor=%d\n%s\n\n",
+					step, m.Value(), m.Position(), m.Cursor().X, ansi.Strip(m.View()))
+			}
+			record("start")
+			for _, k := range keys {
+				m, _ = m.Update(k.msg)
+				record(k.name)
+			}
+			golden.RequireEqual(t, b.String())
+		})
+	}
+}
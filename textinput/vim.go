@@ -0,0 +1,68 @@
+package textinput
+
+import (
+	"slices"
+
+	tea "charm.land/bubbletea/v2"
+	"github.com/haochend413/bubbles/v2/key"
+	"github.com/haochend413/bubbles/v2/vim"
+)
+
+// lineEditor drives the text input from its [vim.Engine]. The input is a
+// buffer of a single line.
+type lineEditor struct {
+	m *Model
+}
+
+func (e lineEditor) LineCount() int {
+	return 1
+}
+
+func (e lineEditor) Line(int) []rune {
+	return e.m.value
+}
+
+func (e lineEditor) Cursor() vim.Pos {
+	return vim.Pos{Col: e.m.pos}
+}
+
+func (e lineEditor) SetCursor(p vim.Pos) {
+	e.m.SetCursor(p.Col)
+}
+
+// Replace replaces text in the input. As the input has a single line, line
+// breaks in text are replaced by spaces, and so are those joining the lines
+// of a linewise put.
+func (e lineEditor) Replace(start, end vim.Pos, text string) {
+	m := e.m
+	s := clamp(start.Col, 0, len(m.value))
+	t := clamp(end.Col, s, len(m.value))
+	value := slices.Concat(m.value[:s], m.san().Sanitize([]rune(text)), m.value[t:])
+	m.setValueInternal(value, m.validate(value))
+}
+
+// Key passes keys typed in insert mode on to the text input. In the other
+// modes, only keys that move the cursor without being Vim motions are.
+func (e lineEditor) Key(msg tea.KeyPressMsg) tea.Cmd {
+	m := e.m
+	if m.Vim.Mode() != vim.ModeInsert && !key.Matches(msg, m.KeyMap.LineStart,
+		m.KeyMap.LineEnd, m.KeyMap.WordForward, m.KeyMap.WordBackward) {
+		return nil
+	}
+	return m.handleKey(msg)
+}
+
+// insertMode reports whether typed text is inserted, which is always the case
+// unless Vim is enabled.
+func (m Model) insertMode() bool {
+	return m.Vim == nil || m.Vim.Mode() == vim.ModeInsert
+}
+
+// paste inserts pasted text at the cursor.
+func (m *Model) paste(text string) {
+	if m.Vim != nil {
+		m.Vim.Paste(lineEditor{m}, text)
+		return
+	}
+	m.insertRunesFromUserInput([]rune(text))
+}
@@ -0,0 +1,162 @@
+package viewport
+
+import (
+	"iter"
+	"slices"
+
+	"github.com/charmbracelet/x/ansi"
+	"github.com/haochend413/bubbles/v2/internal/fold"
+)
+
+// tabWidth is the width of the tabs indenting lines when folding by
+// indentation.
+const tabWidth = 8
+
+// Fold is a range of lines that can be collapsed to its first one, from line
+// Start up to line End, inclusive. When Closed, the lines after the first one
+// are hidden, and the first one is followed by the number of lines hidden,
+// in the FoldSummaryStyle.
+type Fold struct {
+	Start, End int
+	Closed     bool
+}
+
+// SetFolds sets the folds, replacing those set before. Folds can be nested,
+// but they must not otherwise overlap. They're cleared when the content is
+// set.
+func (m *Model) SetFolds(folds []Fold) {
+	m.keepTop(func() {
+		m.folds = m.folds[:0]
+		for _, f := range folds {
+			if f.End < len(m.lines) {
+				m.folds = append(m.folds, fold.Fold(f))
+			}
+		}
+		m.folds = fold.Sort(m.folds)
+	})
+}
+
+// Folds returns the folds, in order of their first line.
+func (m Model) Folds() []Fold {
+	folds := make([]Fold, len(m.folds))
+	for i, f := range m.folds {
+		folds[i] = Fold(f)
+	}
+	return folds
+}
+
+// FoldByIndent sets the folds to those of the lines followed by lines
+// indented more than them, all open. ANSI escape sequences are ignored.
+func (m *Model) FoldByIndent() {
+	m.folds = fold.ByIndent(len(m.lines), m.plainLine, tabWidth)
+}
+
+// FoldByMarker sets the folds to those from the lines containing the open
+// marker to the lines containing the matching close marker, such as "{{{"
+// and "}}}", all open. ANSI escape sequences are ignored.
+func (m *Model) FoldByMarker(open, close string) {
+	m.folds = fold.ByMarker(len(m.lines), m.plainLine, open, close)
+}
+
+// plainLine returns a line without ANSI escape sequences.
+func (m Model) plainLine(i int) string {
+	return ansi.Strip(m.lines[i])
+}
+
+// ToggleFold opens the closed fold a line is in, or if there's none, closes
+// the innermost fold it's in.
+func (m *Model) ToggleFold(line int) {
+	m.keepTop(func() { fold.Toggle(m.folds, line) })
+}
+
+// OpenFold opens the outermost closed fold a line is in.
+func (m *Model) OpenFold(line int) {
+	m.keepTop(func() { fold.Open(m.folds, line) })
+}
+
+// CloseFold closes the innermost open fold a line is in.
+func (m *Model) CloseFold(line int) {
+	m.keepTop(func() { fold.Close(m.folds, line) })
+}
+
+// OpenAllFolds opens all folds.
+func (m *Model) OpenAllFolds() {
+	m.keepTop(func() { fold.SetAll(m.folds, false) })
+}
+
+// CloseAllFolds closes all folds.
+func (m *Model) CloseAllFolds() {
+	m.keepTop(func() { fold.SetAll(m.folds, true) })
+}
+
+// ClosedFold returns the closed fold hiding the lines after a line, if the
+// line is inside one. Closed folds inside it aren't.
+func (m Model) ClosedFold(line int) (Fold, bool) {
+	for _, f := range fold.Closed(m.folds) {
+		if f.Start <= line && line <= f.End {
+			return Fold(f), true
+		}
+	}
+	return Fold{}, false
+}
+
+// keepTop runs f, which opens or closes folds, keeping the line at the top
+// of the view there, or the fold it's closed in.
+func (m *Model) keepTop(f func()) {
+	_, top, _ := m.calculateLine(m.yOffset)
+	f()
+	m.SetYOffset(m.lineOffset(top))
+}
+
+// revealLine opens the folds that hide a line.
+func (m *Model) revealLine(line int) {
+	for fold.Hiding(m.folds, line) >= 0 {
+		fold.Open(m.folds, line)
+	}
+}
+
+// shownLines yields the indices of the lines from line start on that aren't
+// hidden by closed folds, with the number of lines hidden after each.
+func (m Model) shownLines(start int) iter.Seq2[int, int] {
+	return func(yield func(int, int) bool) {
+		closed := fold.Closed(m.folds)
+		for i := start; i < len(m.lines); i++ {
+			for len(closed) > 0 && closed[0].End < i {
+				closed = closed[1:]
+			}
+			hidden := 0
+			if len(closed) > 0 && closed[0].Start <= i {
+				if closed[0].Start < i {
+					// The line is inside the fold; move on past its end.
+					i = closed[0].End
+					continue
+				}
+				hidden = closed[0].End - i
+			}
+			if !yield(i, hidden) {
+				return
+			}
+			i += hidden
+		}
+	}
+}
+
+// lineWidth returns the width of a line as shown, followed by the summary of
+// the closed fold hiding the lines after it, if any.
+func (m Model) lineWidth(i, hidden int) int {
+	return ansi.StringWidth(m.lines[i]) + ansi.StringWidth(m.foldSummary(i, hidden))
+}
+
+// foldSummary renders the summary shown after the first line of a closed
+// fold hiding the lines after it, or returns "" if there's none.
+func (m Model) foldSummary(i, hidden int) string {
+	if hidden == 0 {
+		return ""
+	}
+	return " " + m.FoldSummaryStyle.Render(fold.Summary(fold.Fold{Start: i, End: i + hidden}))
+}
+
+// hasClosedFolds reports whether any line is hidden by a closed fold.
+func (m Model) hasClosedFolds() bool {
+	return slices.ContainsFunc(m.folds, func(f fold.Fold) bool { return f.Closed })
+}
@@ -0,0 +1,130 @@
+package viewport
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/x/ansi"
+	"github.com/haochend413/lipgloss/v2"
+)
+
+// LineNumbers returns a [GutterFunc] showing the number of each line, counting
+// from 1, right-aligned and followed by a space. The rows that soft-wrapped
+// lines continue on, and those past the end of the content, are left blank.
+func LineNumbers(style lipgloss.Style) GutterFunc {
+	return func(info GutterContext) string {
+		w := numberWidth(info.TotalLines)
+		if info.Soft || info.Index >= info.TotalLines {
+			return strings.Repeat(" ", w+1)
+		}
+		return style.Render(padLeft(strconv.Itoa(info.Index+1), w)) + " "
+	}
+}
+
+// RelativeLineNumbers returns a [GutterFunc] showing the distance of each line
+// from the current line, right-aligned and followed by a space. The current
+// line shows its own number instead, left-aligned, like Vim does with both
+// the number and relativenumber options set. Its number is rendered with
+// currentStyle, and the others with style. Like with [LineNumbers], the rows
+// that soft-wrapped lines continue on are left blank.
+func RelativeLineNumbers(style, currentStyle lipgloss.Style) GutterFunc {
+	return func(info GutterContext) string {
+		w := numberWidth(info.TotalLines)
+		switch {
+		case info.Soft || info.Index >= info.TotalLines:
+			return strings.Repeat(" ", w+1)
+		case info.Index == info.Current:
+			n := strconv.Itoa(info.Index + 1)
+			return currentStyle.Render(n+strings.Repeat(" ", w-len(n))) + " "
+		}
+		d := info.Index - info.Current
+		if d < 0 {
+			d = -d
+		}
+		return style.Render(padLeft(strconv.Itoa(d), w)) + " "
+	}
+}
+
+// Markers returns a [GutterFunc] showing the marker of each line in markers,
+// by line index, in a column width cells wide, such as signs for errors and
+// warnings. Markers are truncated to the width, and the lines without one
+// are left blank, as are the rows that soft-wrapped lines continue on. The
+// map is read as the gutter is rendered, so changes to it show up on the next
+// render.
+func Markers(markers map[int]string, width int, style lipgloss.Style) GutterFunc {
+	return func(info GutterContext) string {
+		var marker string
+		if !info.Soft {
+			marker = ansi.Truncate(markers[info.Index], width, "")
+		}
+		pad := strings.Repeat(" ", max(0, width-ansi.StringWidth(marker)))
+		if marker == "" {
+			return pad
+		}
+		return style.Render(marker) + pad
+	}
+}
+
+// Bookmarks returns a [GutterFunc] showing mark on the lines set in
+// bookmarks, by line index, and blanks as wide as it on the others. Like with
+// [Markers], the map is read as the gutter is rendered.
+func Bookmarks(bookmarks map[int]bool, mark string, style lipgloss.Style) GutterFunc {
+	width := ansi.StringWidth(mark)
+	return func(info GutterContext) string {
+		if info.Soft || !bookmarks[info.Index] {
+			return strings.Repeat(" ", width)
+		}
+		return style.Render(mark)
+	}
+}
+
+// Gutters returns a [GutterFunc] showing gutters side by side, from left to
+// right, such as bookmarks followed by line numbers.
+func Gutters(gutters ...GutterFunc) GutterFunc {
+	return func(info GutterContext) string {
+		var b strings.Builder
+		for _, g := range gutters {
+			if g != nil {
+				b.WriteString(g(info))
+			}
+		}
+		return b.String()
+	}
+}
+
+// numberWidth returns the width of the numbers of lines.
+func numberWidth(lines int) int {
+	return len(strconv.Itoa(max(1, lines)))
+}
+
+// padLeft pads s with spaces on the left to width w.
+func padLeft(s string, w int) string {
+	return strings.Repeat(" ", max(0, w-len(s))) + s
+}
+
+// gutterWidth returns the width of the gutter.
+func (m Model) gutterWidth() int {
+	if m.LeftGutterFunc == nil {
+		return 0
+	}
+	return ansi.StringWidth(m.LeftGutterFunc(GutterContext{TotalLines: len(m.lines)}))
+}
+
+// gutterContext returns the context of the gutter of a row of line i.
+func (m Model) gutterContext(i int, soft bool, current int) GutterContext {
+	return GutterContext{
+		Index:      i,
+		TotalLines: len(m.lines),
+		Soft:       soft,
+		Current:    current,
+	}
+}
+
+// currentLine returns the index of the current line, given the index of the
+// line at the top of the view.
+func (m Model) currentLine(top int) int {
+	if m.sel.keyboard {
+		return m.sel.cursor.line
+	}
+	return top
+}
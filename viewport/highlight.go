@@ -10,7 +10,7 @@ import (
 //
 // Assumptions:
 // - matches are measured in bytes, e.g. what [regex.FindAllStringIndex] would return
-// - matches were made against the given content
+// - matches were made against the given content, without ANSI escape sequences
 // - matches are in order
 // - matches do not overlap
 // - content is line terminated with \n only
@@ -30,8 +30,9 @@ func parseMatches(
 	previousLinesOffset := 0
 	bytePos := 0
 
+	content = ansi.Strip(content)
 	highlights := make([]highlightInfo, 0, len(matches))
-	gr := uniseg.NewGraphemes(ansi.Strip(content))
+	gr := uniseg.NewGraphemes(content)
 
 	for _, match := range matches {
 		byteStart, byteEnd := match[0], match[1]
@@ -121,6 +122,35 @@ func (hi highlightInfo) coords() (int, int, int) {
 	return hi.lineStart, 0, 0
 }
 
+// shiftHighlights moves the highlights up by n lines, as the first n lines
+// were dropped, removing those that were on them. It returns the highlights
+// and the new index of the one at index idx, or -1 if it was removed.
+func shiftHighlights(highlights []highlightInfo, idx, n int) ([]highlightInfo, int) {
+	shifted := highlights[:0]
+	newIdx := -1
+	for i, hi := range highlights {
+		if hi.lineEnd < n {
+			continue
+		}
+		lines := make(map[int][2]int, len(hi.lines))
+		for line, r := range hi.lines {
+			if line >= n {
+				lines[line-n] = r
+			}
+		}
+		hi.lines = lines
+		hi.lineStart, hi.lineEnd = max(0, hi.lineStart-n), hi.lineEnd-n
+		if i == idx {
+			newIdx = len(shifted)
+		}
+		shifted = append(shifted, hi)
+	}
+	if len(shifted) == 0 {
+		return nil, -1
+	}
+	return shifted, newIdx
+}
+
 func makeHighlightRanges(
 	highlights []highlightInfo,
 	line int,
@@ -17,6 +17,26 @@ type KeyMap struct {
 	Up           key.Binding
 	Left         key.Binding
 	Right        key.Binding
+
+	// Search opens the search prompt, and NextMatch and PrevMatch move to
+	// the next and previous matches. See [Model.StartSearch]. They're
+	// unset by default; see [KeyMap.WithSearchKeys].
+	Search    key.Binding
+	NextMatch key.Binding
+	PrevMatch key.Binding
+
+	// AcceptSearch and CancelSearch close the search prompt, keeping the
+	// matches or clearing them.
+	AcceptSearch key.Binding
+	CancelSearch key.Binding
+
+	// Select starts or stops selecting text with the keyboard, Copy copies
+	// the selected text and ClearSelection deselects it. See
+	// [Model.StartSelection]. They're unset by default; see
+	// [KeyMap.WithSelectionKeys].
+	Select         key.Binding
+	Copy           key.Binding
+	ClearSelection key.Binding
 }
 
 // DefaultKeyMap returns a set of pager-like default keybindings.
@@ -56,3 +76,54 @@ func DefaultKeyMap() KeyMap {
 		),
 	}
 }
+
+// WithSearchKeys returns the key map with the bindings of the search mode
+// set: "/" opens the search prompt, "enter" and "esc" close it, keeping the
+// matches or not, and "n" and "N" move to the next and previous matches.
+// They're left unset by [DefaultKeyMap], so that they don't take over keys
+// apps use themselves:
+//
+//	vp.KeyMap = viewport.DefaultKeyMap().WithSearchKeys()
+func (k KeyMap) WithSearchKeys() KeyMap {
+	k.Search = key.NewBinding(
+		key.WithKeys("/"),
+		key.WithHelp("/", "search"),
+	)
+	k.NextMatch = key.NewBinding(
+		key.WithKeys("n"),
+		key.WithHelp("n", "next match"),
+	)
+	k.PrevMatch = key.NewBinding(
+		key.WithKeys("N"),
+		key.WithHelp("N", "previous match"),
+	)
+	k.AcceptSearch = key.NewBinding(
+		key.WithKeys("enter"),
+		key.WithHelp("enter", "accept search"),
+	)
+	k.CancelSearch = key.NewBinding(
+		key.WithKeys("esc"),
+		key.WithHelp("esc", "cancel search"),
+	)
+	return k
+}
+
+// WithSelectionKeys returns the key map with the bindings selecting text set:
+// "v" starts or stops selecting text, "y" copies the selected text and "esc"
+// deselects it. Like the search keys, they're left unset by [DefaultKeyMap].
+// See also [Model.MouseSelectEnabled].
+func (k KeyMap) WithSelectionKeys() KeyMap {
+	k.Select = key.NewBinding(
+		key.WithKeys("v"),
+		key.WithHelp("v", "select"),
+	)
+	k.Copy = key.NewBinding(
+		key.WithKeys("y"),
+		key.WithHelp("y", "copy"),
+	)
+	k.ClearSelection = key.NewBinding(
+		key.WithKeys("esc"),
+		key.WithHelp("esc", "clear selection"),
+	)
+	return k
+}
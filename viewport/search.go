@@ -0,0 +1,231 @@
+package viewport
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	tea "charm.land/bubbletea/v2"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/haochend413/bubbles/v2/key"
+	"github.com/haochend413/bubbles/v2/textinput"
+)
+
+// searchState is the state of the search mode.
+type searchState struct {
+	// active is set while a pattern is typed in the search prompt.
+	active bool
+
+	// pattern is the pattern searched for, as typed so far while active.
+	pattern string
+
+	// err is the error of compiling the pattern, if it's an invalid regular
+	// expression.
+	err error
+
+	// yOffset and xOffset are the scroll position when the search was
+	// started, restored when it's cancelled, and searched from while typing.
+	yOffset, xOffset int
+}
+
+// SearchInput returns the prompt that search patterns are typed in, such as
+// to set its prompt, "/" by default, or its styles.
+func (m *Model) SearchInput() *textinput.Model {
+	if !m.searchInputReady {
+		m.searchInput = textinput.New()
+		m.searchInput.Prompt = "/"
+		m.searchInputReady = true
+	}
+	return &m.searchInput
+}
+
+// StartSearch opens the search prompt to type a search pattern. The
+// matches are highlighted as the pattern is typed, scrolling to the first one
+// from the top of the view. The key bindings AcceptSearch and CancelSearch
+// close the prompt, keeping the matches or going back to where the search
+// started. It returns the command focusing the prompt.
+func (m *Model) StartSearch() tea.Cmd {
+	if !m.initialized {
+		m.setInitialValues()
+	}
+	m.search = searchState{active: true, yOffset: m.yOffset, xOffset: m.xOffset}
+	m.ClearHighlights()
+	input := m.SearchInput()
+	input.SetValue("")
+	return input.Focus()
+}
+
+// Searching reports whether the search prompt is open.
+func (m Model) Searching() bool {
+	return m.search.active
+}
+
+// Search highlights the matches of a pattern, as if it were typed in the
+// search prompt and accepted, and scrolls to the first one from the top
+// of the view. The pattern is a regular expression if SearchRegexp is set,
+// and matches the text without ANSI escape sequences. An empty pattern
+// clears the search.
+func (m *Model) Search(pattern string) error {
+	m.search = searchState{pattern: pattern}
+	m.ClearHighlights()
+	m.search.err = m.searchFor(pattern)
+	return m.search.err
+}
+
+// ClearSearch clears the pattern searched for and its highlights, and closes
+// the search prompt.
+func (m *Model) ClearSearch() {
+	m.search = searchState{}
+	m.searchInput.Blur()
+	m.ClearHighlights()
+}
+
+// SearchPattern returns the pattern searched for, or being typed.
+func (m Model) SearchPattern() string {
+	return m.search.pattern
+}
+
+// Matches returns the number of the current match, counting from 1, or 0 if
+// there's none, and the number of matches of the search.
+func (m Model) Matches() (current, total int) {
+	return m.hiIdx + 1, len(m.highlights)
+}
+
+// SearchView renders the search prompt followed by the status of the
+// search while the prompt is open, or only the status when a pattern was
+// searched for, such as to show in a status bar. It returns "" otherwise.
+func (m Model) SearchView() string {
+	var status string
+	if m.search.pattern != "" {
+		statusFunc := m.SearchStatusFunc
+		if statusFunc == nil {
+			statusFunc = defaultSearchStatus
+		}
+		status = statusFunc(m.Matches())
+		if m.search.err != nil {
+			status = "invalid pattern"
+		}
+	}
+	if !m.search.active {
+		return status
+	}
+	if status == "" {
+		return m.searchInput.View()
+	}
+	return m.searchInput.View() + " " + status
+}
+
+// defaultSearchStatus is the status of the search, such as "match 3/17",
+// when SearchStatusFunc isn't set.
+func defaultSearchStatus(current, total int) string {
+	if total == 0 {
+		return "no matches"
+	}
+	return fmt.Sprintf("match %d/%d", current, total)
+}
+
+// searchKey handles a key press while the search prompt is open.
+func (m Model) searchKey(msg tea.KeyPressMsg) (Model, tea.Cmd) {
+	switch {
+	case key.Matches(msg, m.KeyMap.AcceptSearch):
+		m.search.active = false
+		m.searchInput.Blur()
+		if m.search.pattern == "" {
+			m.ClearSearch()
+		} else if m.Vim != nil && m.search.err == nil {
+			// Let the Vim engine's n and N move to the matches.
+			_ = m.Vim.SetSearchPattern(m.searchExpr(m.search.pattern))
+		}
+		return m, nil
+	case key.Matches(msg, m.KeyMap.CancelSearch):
+		m.yOffset, m.xOffset = m.search.yOffset, m.search.xOffset
+		m.ClearSearch()
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.searchInput, cmd = m.searchInput.Update(msg)
+	if pattern := m.searchInput.Value(); pattern != m.search.pattern {
+		// Search again from where the search started.
+		m.yOffset, m.xOffset = m.search.yOffset, m.search.xOffset
+		m.search.pattern = pattern
+		m.ClearHighlights()
+		m.search.err = m.searchFor(pattern)
+	}
+	return m, cmd
+}
+
+// searchFor highlights the matches of a pattern and scrolls to the first one
+// from the top of the view, or else to the first one.
+func (m *Model) searchFor(pattern string) error {
+	if pattern == "" {
+		return nil
+	}
+	highlights, err := m.searchLines(pattern, 0)
+	if err != nil {
+		return err
+	}
+	m.highlights = highlights
+	m.hiIdx = m.findNearestMatch()
+	if m.hiIdx < 0 && len(m.highlights) > 0 {
+		m.hiIdx = 0
+	}
+	m.showHighlight()
+	return nil
+}
+
+// searchLines returns the highlights of the matches of a pattern in the
+// lines from line start on.
+func (m Model) searchLines(pattern string, start int) ([]highlightInfo, error) {
+	re, err := regexp.Compile(m.searchExpr(pattern))
+	if err != nil {
+		return nil, fmt.Errorf("invalid search pattern: %w", err)
+	}
+	content := ansi.Strip(strings.Join(m.lines[start:], "\n"))
+	var matches [][]int
+	for _, match := range re.FindAllStringIndex(content, -1) {
+		if match[1] > match[0] {
+			matches = append(matches, match)
+		}
+	}
+	highlights := parseMatches(content, matches)
+	if start == 0 {
+		return highlights, nil
+	}
+	for i, hi := range highlights {
+		lines := make(map[int][2]int, len(hi.lines))
+		for line, r := range hi.lines {
+			lines[line+start] = r
+		}
+		highlights[i] = highlightInfo{lineStart: hi.lineStart + start, lineEnd: hi.lineEnd + start, lines: lines}
+	}
+	return highlights, nil
+}
+
+// searchNewLines highlights the matches of the pattern searched for in the
+// lines from line start on, which were just set or appended.
+func (m *Model) searchNewLines(start int) {
+	if m.search.pattern == "" || m.search.err != nil {
+		return
+	}
+	highlights, _ := m.searchLines(m.search.pattern, start)
+	m.highlights = append(m.highlights, highlights...)
+	if m.hiIdx < 0 {
+		m.hiIdx = m.findNearestMatch()
+	}
+}
+
+// searchExpr returns the regular expression searching for a pattern: the
+// pattern itself if SearchRegexp is set, or else one matching it literally,
+// ignoring case if SmartCase is set and the pattern is all lower case.
+func (m Model) searchExpr(pattern string) string {
+	expr := pattern
+	if !m.SearchRegexp {
+		expr = regexp.QuoteMeta(pattern)
+	}
+	if m.SmartCase && !strings.ContainsFunc(pattern, unicode.IsUpper) {
+		expr = "(?i)" + expr
+	}
+	return expr
+}
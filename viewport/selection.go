@@ -0,0 +1,279 @@
+package viewport
+
+import (
+	"strings"
+
+	tea "charm.land/bubbletea/v2"
+	"github.com/atotto/clipboard"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/haochend413/bubbles/v2/key"
+	"github.com/haochend413/lipgloss/v2"
+	"github.com/rivo/uniseg"
+)
+
+// copyErrMsg reports a failure to write the clipboard.
+type copyErrMsg struct{ error }
+
+// position is a position in the content: a line and a cell of the line
+// without ANSI escape sequences.
+type position struct {
+	line, col int
+}
+
+// before reports whether p comes before q in the content.
+func (p position) before(q position) bool {
+	return p.line < q.line || (p.line == q.line && p.col < q.col)
+}
+
+// selection is the state of the text selected with the keyboard or the
+// mouse. The selected text spans from the anchor to the cursor.
+type selection struct {
+	// active is set while text is selected.
+	active bool
+
+	// keyboard is set in the selection mode started with the Select key,
+	// in which the movement keys move the cursor rather than scroll. The
+	// cell under the cursor is selected too, as in Vim's visual mode.
+	keyboard bool
+
+	// dragging is set while the mouse button that started a selection is
+	// held down.
+	dragging bool
+
+	anchor, cursor position
+}
+
+// StartSelection starts selecting text with the keyboard, from the top left
+// of the view: the movement keys of the KeyMap move the end of the selection
+// rather than scroll, the Copy key copies the selected text and the
+// ClearSelection key stops selecting.
+func (m *Model) StartSelection() {
+	if len(m.lines) == 0 {
+		return
+	}
+	_, top, _ := m.calculateLine(m.yOffset)
+	p := m.clampPosition(position{top, m.xOffset})
+	m.sel = selection{active: true, keyboard: true, anchor: p, cursor: p}
+}
+
+// Selecting reports whether text is being selected with the keyboard.
+func (m Model) Selecting() bool {
+	return m.sel.keyboard
+}
+
+// ClearSelection deselects the selected text, if any, and stops selecting.
+func (m *Model) ClearSelection() {
+	m.sel = selection{}
+}
+
+// SelectedText returns the selected text without ANSI escape sequences, or
+// an empty string if there is no selection.
+func (m Model) SelectedText() string {
+	start, end, ok := m.selectionRange()
+	if !ok {
+		return ""
+	}
+	var b strings.Builder
+	for i := start.line; i <= end.line; i++ {
+		line := ansi.Strip(m.lines[i])
+		from, to := 0, ansi.StringWidth(line)
+		if i == start.line {
+			from = start.col
+		}
+		if i == end.line {
+			to = end.col
+		}
+		b.WriteString(ansi.Cut(line, from, to))
+		if i < end.line {
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// Copy returns a command writing the selected text to the system clipboard,
+// or nil if there is no selection.
+func (m Model) Copy() tea.Cmd {
+	text := m.SelectedText()
+	if text == "" {
+		return nil
+	}
+	return func() tea.Msg {
+		if err := clipboard.WriteAll(text); err != nil {
+			return copyErrMsg{err}
+		}
+		return nil
+	}
+}
+
+// CopyOSC52 returns a command setting the clipboard of the terminal to the
+// selected text with an OSC 52 escape sequence, which works over SSH, or nil
+// if there is no selection. Not all terminals support it.
+func (m Model) CopyOSC52() tea.Cmd {
+	text := m.SelectedText()
+	if text == "" {
+		return nil
+	}
+	return tea.SetClipboard(text)
+}
+
+// selectionRange returns the start and end of the selected text, in order.
+// The end is exclusive.
+func (m Model) selectionRange() (position, position, bool) {
+	if !m.sel.active || len(m.lines) == 0 {
+		return position{}, position{}, false
+	}
+	start, end := m.clampPosition(m.sel.anchor), m.clampPosition(m.sel.cursor)
+	if end.before(start) {
+		start, end = end, start
+	}
+	if m.sel.keyboard {
+		end.col = m.nextCell(end)
+	}
+	return start, end, start != end
+}
+
+// clampPosition clamps a position to the content.
+func (m Model) clampPosition(p position) position {
+	p.line = clamp(p.line, 0, len(m.lines)-1)
+	p.col = clamp(p.col, 0, ansi.StringWidth(m.lines[p.line]))
+	return p
+}
+
+// nextCell returns the column after the grapheme at a position, or the
+// column itself at the end of the line.
+func (m Model) nextCell(p position) int {
+	col := 0
+	gr := uniseg.NewGraphemes(ansi.Strip(m.lines[p.line]))
+	for col <= p.col && gr.Next() {
+		col += gr.Width()
+	}
+	return max(col, p.col)
+}
+
+// prevCell returns the column of the grapheme before a position.
+func (m Model) prevCell(p position) int {
+	col, prev := 0, 0
+	gr := uniseg.NewGraphemes(ansi.Strip(m.lines[p.line]))
+	for col < p.col && gr.Next() {
+		prev = col
+		col += gr.Width()
+	}
+	return prev
+}
+
+// selectionKey handles the keys that select text and the keys that act on the
+// selection. It reports whether the key was handled.
+func (m *Model) selectionKey(msg tea.KeyPressMsg) (tea.Cmd, bool) {
+	k := m.KeyMap
+	switch {
+	case key.Matches(msg, k.Select):
+		if m.sel.keyboard {
+			m.ClearSelection()
+		} else if m.sel.active {
+			m.sel.keyboard = true
+		} else {
+			m.StartSelection()
+		}
+	case !m.sel.active:
+		return nil, false
+	case key.Matches(msg, k.Copy):
+		cmd := m.Copy()
+		if m.CopyWithOSC52 {
+			cmd = tea.Batch(cmd, m.CopyOSC52())
+		}
+		m.ClearSelection()
+		return cmd, true
+	case key.Matches(msg, k.ClearSelection):
+		m.ClearSelection()
+	case !m.sel.keyboard:
+		return nil, false
+	case key.Matches(msg, k.Up, k.Down, k.Left, k.Right):
+		p := m.clampPosition(m.sel.cursor)
+		switch {
+		case key.Matches(msg, k.Up):
+			p.line--
+		case key.Matches(msg, k.Down):
+			p.line++
+		case key.Matches(msg, k.Left):
+			p.col = m.prevCell(p)
+		case key.Matches(msg, k.Right):
+			if next := m.nextCell(p); next < ansi.StringWidth(m.lines[p.line]) {
+				p.col = next
+			}
+		}
+		p = m.clampPosition(p)
+		m.revealLine(p.line)
+		m.sel.cursor = p
+		m.EnsureVisible(p.line, p.col, m.nextCell(p))
+	default:
+		return nil, false
+	}
+	return nil, true
+}
+
+// mouseDown handles a press of the left mouse button, which starts selecting
+// text from the clicked position.
+func (m *Model) mouseDown(msg tea.MouseClickMsg) {
+	if !m.MouseSelectEnabled || msg.Button != tea.MouseLeft || len(m.lines) == 0 {
+		return
+	}
+	p := m.positionAt(msg.X, msg.Y)
+	m.sel = selection{anchor: p, cursor: p, dragging: true}
+}
+
+// mouseDrag handles the motion of the mouse, which selects text while the
+// button is held down.
+func (m *Model) mouseDrag(msg tea.MouseMotionMsg) {
+	if !m.sel.dragging || msg.Button != tea.MouseLeft {
+		return
+	}
+	m.sel.cursor = m.positionAt(msg.X, msg.Y)
+	m.sel.active = m.sel.cursor != m.sel.anchor
+}
+
+// positionAt returns the position in the content shown at the given cell of
+// the view, taking soft wrapping into account. x and y are relative to the
+// top left corner of the viewport.
+func (m Model) positionAt(x, y int) position {
+	x -= m.Style.GetMarginLeft() + m.Style.GetPaddingLeft() + m.Style.GetBorderLeftSize()
+	x -= m.gutterWidth()
+	y -= m.Style.GetMarginTop() + m.Style.GetPaddingTop() + m.Style.GetBorderTopSize()
+	x, y = max(0, x), max(0, y)
+
+	_, line, voffset := m.calculateLine(m.yOffset + y)
+	if line >= len(m.lines) {
+		line = len(m.lines) - 1
+		return m.clampPosition(position{line, ansi.StringWidth(m.lines[line])})
+	}
+	col := x + m.xOffset
+	if m.SoftWrap {
+		col = voffset*m.maxWidth() + x
+	}
+	return m.clampPosition(position{line, col})
+}
+
+// selectLines styles the selected text of the lines with
+// [Model.SelectionStyle]. rows are their indices.
+func (m Model) selectLines(lines []string, rows []int) []string {
+	start, end, ok := m.selectionRange()
+	if !ok {
+		return lines
+	}
+	for i, row := range rows {
+		if row < start.line || row > end.line || i >= len(lines) {
+			continue
+		}
+		from, to := 0, ansi.StringWidth(lines[i])
+		if row == start.line {
+			from = start.col
+		}
+		if row == end.line {
+			to = end.col
+		}
+		if to > from {
+			lines[i] = lipgloss.StyleRanges(lines[i], lipgloss.NewRange(from, to, m.SelectionStyle))
+		}
+	}
+	return lines
+}
@@ -8,7 +8,10 @@ import (
 
 	tea "charm.land/bubbletea/v2"
 	"github.com/charmbracelet/x/ansi"
+	"github.com/haochend413/bubbles/v2/internal/fold"
 	"github.com/haochend413/bubbles/v2/key"
+	"github.com/haochend413/bubbles/v2/textinput"
+	"github.com/haochend413/bubbles/v2/vim"
 	"github.com/haochend413/lipgloss/v2"
 )
 
@@ -68,6 +71,19 @@ type Model struct {
 	// The number of lines the mouse wheel will scroll. By default, this is 3.
 	MouseWheelDelta int
 
+	// Whether or not to select text by dragging the mouse with the left
+	// button held down. The mouse must be enabled in Bubble Tea, with
+	// motion events, for this to work. It's off by default. See
+	// [Model.StartSelection] to select text with the keyboard.
+	MouseSelectEnabled bool
+
+	// SelectionStyle styles the selected text.
+	SelectionStyle lipgloss.Style
+
+	// CopyWithOSC52 makes the Copy key also set the clipboard of the
+	// terminal, as [Model.CopyOSC52] does.
+	CopyWithOSC52 bool
+
 	// yOffset is the vertical scroll position.
 	yOffset int
 
@@ -91,7 +107,9 @@ type Model struct {
 	// This can be used for things like line numbers, selection indicators,
 	// show statuses, etc. It is expected that the real-width (as measured by
 	// [lipgloss.Width]) of the returned value is always consistent, regardless
-	// of index, soft wrapping, etc.
+	// of index, soft wrapping, etc. See [LineNumbers], [RelativeLineNumbers],
+	// [Markers] and [Bookmarks] for ready-made gutters, and [Gutters] to
+	// show several of them.
 	LeftGutterFunc GutterFunc
 
 	initialized      bool
@@ -111,8 +129,47 @@ type Model struct {
 	// The argument is the line index.
 	StyleLineFunc func(int) lipgloss.Style
 
+	// Vim enables Vim-style navigation when set, such as to [vim.New]():
+	// j and k scroll by lines, ctrl+f and ctrl+b by pages, gg and G to the
+	// top and bottom, and counts apply. Keys that aren't Vim commands are handled by the
+	// KeyMap. Set it to nil to disable it.
+	Vim *vim.Engine
+
+	// Follow keeps the view at the bottom as content is set or appended,
+	// such as to tail logs. Following pauses when the view is scrolled up,
+	// and resumes when it's scrolled back to the bottom.
+	Follow bool
+
+	// MaxLines is the number of lines the viewport keeps. When the content
+	// has more, the oldest lines are dropped. If 0, all lines are kept.
+	MaxLines int
+
+	// SearchRegexp makes search patterns regular expressions. Otherwise they
+	// match literally.
+	SearchRegexp bool
+
+	// SmartCase makes searches ignore case, unless the pattern has an upper
+	// case letter.
+	SmartCase bool
+
+	// SearchStatusFunc renders the status of the search shown by
+	// [Model.SearchView], from the number of the current match, counting
+	// from 1, and the number of matches. If nil, it's "match 3/17".
+	SearchStatusFunc func(current, total int) string
+
+	// FoldSummaryStyle styles the number of lines hidden by a closed fold,
+	// shown after its first line. See [Model.SetFolds].
+	FoldSummaryStyle lipgloss.Style
+
 	highlights []highlightInfo
 	hiIdx      int
+	folds      []fold.Fold
+	search     searchState
+	sel        selection
+
+	// searchInput is the search prompt, set up by SearchInput.
+	searchInput      textinput.Model
+	searchInputReady bool
 }
 
 // GutterFunc can be implemented and set into [Model.LeftGutterFunc].
@@ -141,6 +198,11 @@ type GutterContext struct {
 	// TotalLines is the total number of lines in the viewport.
 	TotalLines int
 
+	// Current is the index of the current line, which relative line
+	// numbers count from: the end of the selection being made with the
+	// keyboard, or else the line at the top of the view.
+	Current int
+
 	// Soft is whether or not the line is soft wrapped.
 	Soft bool
 }
@@ -149,6 +211,7 @@ func (m *Model) setInitialValues() {
 	m.KeyMap = DefaultKeyMap()
 	m.MouseWheelEnabled = true
 	m.MouseWheelDelta = 3
+	m.SelectionStyle = lipgloss.NewStyle().Reverse(true)
 	m.horizontalStep = defaultHorizontalStep
 	m.LeftGutterFunc = NoGutter
 	m.initialized = true
@@ -230,58 +293,131 @@ func (m *Model) SetContent(s string) {
 // SetContentLines allows to set the lines to be shown instead of the content.
 // If a given line has a \n in it, it will still be split into multiple lines
 // similar to that of [Model.SetContent]. See also [Model.SetContent].
+// Highlights and folds are cleared, but the pattern searched for, if any, is
+// highlighted again.
 func (m *Model) SetContentLines(lines []string) {
 	// if there's no content, set content to actual nil instead of one empty
 	// line.
-	m.lines = lines
+	following := m.Follow && m.AtBottom()
+	// The lines are split and dropped in place, so they're copied to leave
+	// the caller's alone.
+	m.lines = slices.Clone(lines)
 	if len(m.lines) == 1 && ansi.StringWidth(m.lines[0]) == 0 {
 		m.lines = nil
 	} else {
-		// iterate in reverse, so we can safely modify the slice.
-		var subLines []string
-		for i := len(m.lines) - 1; i >= 0; i-- {
-			if !strings.ContainsAny(m.lines[i], "\r\n") {
-				continue
-			}
-
-			m.lines[i] = strings.ReplaceAll(m.lines[i], "\r\n", "\n") // normalize line endings
-			subLines = strings.Split(m.lines[i], "\n")
-			if len(subLines) > 1 {
-				m.lines = slices.Insert(m.lines, i+1, subLines[1:]...)
-				m.lines[i] = subLines[0]
-			}
-		}
+		m.lines = splitLines(m.lines)
 	}
 
 	m.longestLineWidth = maxLineWidth(m.lines)
 	m.ClearHighlights()
+	m.ClearSelection()
+	m.folds = nil
+	m.limitLines()
+	m.searchNewLines(0)
 
-	if m.YOffset() > m.maxYOffset() {
+	if following || m.YOffset() > m.maxYOffset() {
 		m.GotoBottom()
 	}
 }
 
+// AppendLines adds lines to the end of the content. Like with
+// [Model.SetContentLines], lines with a \n in them are split, and the pattern
+// searched for is highlighted in them. Unlike it, the highlights and folds
+// are kept, and the cost doesn't grow with the length of the content, so it's
+// suited to streaming output such as logs. See also [Model.Follow] and
+// [Model.MaxLines].
+func (m *Model) AppendLines(lines ...string) {
+	following := m.Follow && m.AtBottom()
+	start := len(m.lines)
+	m.lines = append(m.lines, lines...)
+	m.lines = append(m.lines[:start], splitLines(m.lines[start:])...)
+	m.longestLineWidth = max(m.longestLineWidth, maxLineWidth(m.lines[start:]))
+	m.searchNewLines(start)
+	m.limitLines()
+
+	if following {
+		m.SetYOffset(m.maxYOffset())
+		m.hiIdx = m.findNearestMatch()
+	}
+}
+
+// Following reports whether the view follows the content as it's appended:
+// Follow is set, and the view is at the bottom.
+func (m Model) Following() bool {
+	return m.Follow && m.AtBottom()
+}
+
+// limitLines drops the oldest lines past MaxLines, keeping the view on the
+// same lines.
+func (m *Model) limitLines() {
+	n := len(m.lines) - m.MaxLines
+	if m.MaxLines <= 0 || n <= 0 {
+		return
+	}
+	y := m.lineOffset(n)
+	// The dropped lines are released when the backing array is reallocated
+	// as lines are appended, so it doesn't grow past twice MaxLines. They
+	// aren't cleared, as copies of the model may still show them.
+	m.lines = m.lines[n:]
+	// The longest line may have been dropped, but finding the new one would
+	// take going over all lines; it's only used to limit scrolling right.
+	m.highlights, m.hiIdx = shiftHighlights(m.highlights, m.hiIdx, n)
+	for i := range m.folds {
+		m.folds[i].Start -= n
+		m.folds[i].End -= n
+	}
+	m.folds = fold.Sort(m.folds)
+	m.sel.anchor.line -= n
+	m.sel.cursor.line -= n
+	if m.sel.anchor.line < 0 || m.sel.cursor.line < 0 {
+		m.ClearSelection()
+	}
+	m.yOffset = max(0, m.yOffset-y)
+}
+
+// splitLines splits the lines that have a \n in them in place, normalizing
+// line endings.
+func splitLines(lines []string) []string {
+	// iterate in reverse, so we can safely modify the slice.
+	var subLines []string
+	for i := len(lines) - 1; i >= 0; i-- {
+		if !strings.ContainsAny(lines[i], "\r\n") {
+			continue
+		}
+
+		lines[i] = strings.ReplaceAll(lines[i], "\r\n", "\n") // normalize line endings
+		subLines = strings.Split(lines[i], "\n")
+		if len(subLines) > 1 {
+			lines = slices.Insert(lines, i+1, subLines[1:]...)
+			lines[i] = subLines[0]
+		}
+	}
+	return lines
+}
+
 // GetContent returns the entire content as a single string.
 // Line endings are normalized to '\n'.
 func (m Model) GetContent() string {
 	return strings.Join(m.lines, "\n")
 }
 
-// calculateLine taking soft wrapping into account, returns the total viewable
-// lines and the real-line index for the given yoffset, as well as the virtual
-// line offset.
+// calculateLine taking soft wrapping and closed folds into account, returns
+// the total viewable lines and the real-line index for the given yoffset, as
+// well as the virtual line offset.
 func (m Model) calculateLine(yoffset int) (total, ridx, voffset int) {
-	if !m.SoftWrap {
+	if !m.SoftWrap && len(m.folds) == 0 {
 		total = len(m.lines)
 		ridx = min(yoffset, len(m.lines))
 		return total, ridx, 0
 	}
 
 	maxWidth := float64(m.maxWidth())
-	var lineHeight int
+	lineHeight := 1
 
-	for i, line := range m.lines {
-		lineHeight = max(1, int(math.Ceil(float64(ansi.StringWidth(line))/maxWidth)))
+	for i, hidden := range m.shownLines(0) {
+		if m.SoftWrap {
+			lineHeight = max(1, int(math.Ceil(float64(m.lineWidth(i, hidden))/maxWidth)))
+		}
 
 		if yoffset >= total && yoffset < total+lineHeight {
 			ridx = i
@@ -314,11 +450,7 @@ func (m Model) maxXOffset() int {
 // maxWidth returns the maximum width of the viewport. It accounts for the frame
 // size, in addition to the gutter size.
 func (m Model) maxWidth() int {
-	var gutterSize int
-	if m.LeftGutterFunc != nil {
-		gutterSize = ansi.StringWidth(m.LeftGutterFunc(GutterContext{}))
-	}
-	return max(0, m.Width()-m.Style.GetHorizontalFrameSize()-gutterSize)
+	return max(0, m.Width()-m.Style.GetHorizontalFrameSize()-m.gutterWidth())
 }
 
 // maxHeight returns the maximum height of the viewport. It accounts for the frame
@@ -337,54 +469,71 @@ func (m Model) visibleLines() (lines []string) {
 		return nil
 	}
 
+	// rows are the indices of the lines shown.
 	total, ridx, voffset := m.calculateLine(m.YOffset())
+	current := m.currentLine(ridx)
+	var rows []int
 	if total > 0 {
-		bottom := clamp(ridx+maxHeight, ridx, len(m.lines))
-		lines = m.styleLines(slices.Clone(m.lines[ridx:bottom]), ridx)
-		lines = m.highlightLines(lines, ridx)
+		var summaries []string
+		for i, hidden := range m.shownLines(ridx) {
+			if len(rows) == maxHeight {
+				break
+			}
+			rows = append(rows, i)
+			lines = append(lines, m.lines[i])
+			summaries = append(summaries, m.foldSummary(i, hidden))
+		}
+		lines = m.styleLines(lines, rows)
+		lines = m.highlightLines(lines, rows)
+		lines = m.selectLines(lines, rows)
+		for i, summary := range summaries {
+			lines[i] += summary
+		}
 	}
 
-	for m.FillHeight && len(lines) < maxHeight {
+	for fill := len(m.lines); m.FillHeight && len(lines) < maxHeight; fill++ {
+		rows = append(rows, fill)
 		lines = append(lines, "")
 	}
 
 	// if longest line fit within width, no need to do anything else.
-	if (m.xOffset == 0 && m.longestLineWidth <= maxWidth) || maxWidth == 0 {
-		return m.setupGutter(lines, total, ridx)
+	if (m.xOffset == 0 && m.longestLineWidth <= maxWidth && !m.hasClosedFolds()) || maxWidth == 0 {
+		return m.setupGutter(lines, rows, current)
 	}
 
 	if m.SoftWrap {
-		return m.softWrap(lines, maxWidth, maxHeight, total, ridx, voffset)
+		return m.softWrap(lines, maxWidth, maxHeight, rows, voffset, current)
 	}
 
 	// Cut the lines to the viewport width.
 	for i := range lines {
 		lines[i] = ansi.Cut(lines[i], m.xOffset, m.xOffset+maxWidth)
 	}
-	return m.setupGutter(lines, total, ridx)
+	return m.setupGutter(lines, rows, current)
 }
 
-// styleLines styles the lines using [Model.StyleLineFunc].
-func (m Model) styleLines(lines []string, offset int) []string {
+// styleLines styles the lines using [Model.StyleLineFunc]. rows are their
+// indices.
+func (m Model) styleLines(lines []string, rows []int) []string {
 	if m.StyleLineFunc == nil {
 		return lines
 	}
 	for i := range lines {
-		lines[i] = m.StyleLineFunc(i + offset).Render(lines[i])
+		lines[i] = m.StyleLineFunc(rows[i]).Render(lines[i])
 	}
 	return lines
 }
 
 // highlightLines highlights the lines with [Model.HighlightStyle] and
-// [Model.SelectedHighlightStyle].
-func (m Model) highlightLines(lines []string, offset int) []string {
+// [Model.SelectedHighlightStyle]. rows are their indices.
+func (m Model) highlightLines(lines []string, rows []int) []string {
 	if len(m.highlights) == 0 {
 		return lines
 	}
 	for i := range lines {
 		ranges := makeHighlightRanges(
 			m.highlights,
-			i+offset,
+			rows[i],
 			m.HighlightStyle,
 		)
 		lines[i] = lipgloss.StyleRanges(lines[i], ranges...)
@@ -392,7 +541,7 @@ func (m Model) highlightLines(lines []string, offset int) []string {
 			continue
 		}
 		sel := m.highlights[m.hiIdx]
-		if hi, ok := sel.lines[i+offset]; ok {
+		if hi, ok := sel.lines[rows[i]]; ok {
 			lines[i] = lipgloss.StyleRanges(lines[i], lipgloss.NewRange(
 				hi[0],
 				hi[1],
@@ -403,7 +552,7 @@ func (m Model) highlightLines(lines []string, offset int) []string {
 	return lines
 }
 
-func (m Model) softWrap(lines []string, maxWidth, maxHeight, total, ridx, voffset int) []string {
+func (m Model) softWrap(lines []string, maxWidth, maxHeight int, rows []int, voffset, current int) []string {
 	wrappedLines := make([]string, 0, maxHeight)
 
 	var idx, lineWidth int
@@ -416,11 +565,7 @@ func (m Model) softWrap(lines []string, maxWidth, maxHeight, total, ridx, voffse
 
 		if lineWidth <= maxWidth {
 			if m.LeftGutterFunc != nil {
-				line = m.LeftGutterFunc(GutterContext{
-					Index:      i + ridx,
-					TotalLines: total,
-					Soft:       false,
-				}) + line
+				line = m.LeftGutterFunc(m.gutterContext(rows[i], false, current)) + line
 			}
 			wrappedLines = append(wrappedLines, line)
 			continue
@@ -430,11 +575,7 @@ func (m Model) softWrap(lines []string, maxWidth, maxHeight, total, ridx, voffse
 		for lineWidth > idx {
 			truncatedLine = ansi.Cut(line, idx, maxWidth+idx)
 			if m.LeftGutterFunc != nil {
-				truncatedLine = m.LeftGutterFunc(GutterContext{
-					Index:      i + ridx,
-					TotalLines: total,
-					Soft:       idx > 0,
-				}) + truncatedLine
+				truncatedLine = m.LeftGutterFunc(m.gutterContext(rows[i], idx > 0, current)) + truncatedLine
 			}
 			wrappedLines = append(wrappedLines, truncatedLine)
 			idx += maxWidth
@@ -444,18 +585,15 @@ func (m Model) softWrap(lines []string, maxWidth, maxHeight, total, ridx, voffse
 	return wrappedLines[voffset:min(voffset+maxHeight, len(wrappedLines))]
 }
 
-// setupGutter sets up the left gutter using [Model.LeftGutterFunc].
-func (m Model) setupGutter(lines []string, total, ridx int) []string {
+// setupGutter sets up the left gutter using [Model.LeftGutterFunc]. rows are
+// the indices of the lines, and current is the index of the current line.
+func (m Model) setupGutter(lines []string, rows []int, current int) []string {
 	if m.LeftGutterFunc == nil {
 		return lines
 	}
 
 	for i := range lines {
-		lines[i] = m.LeftGutterFunc(GutterContext{
-			Index:      i + ridx,
-			TotalLines: total,
-			Soft:       false,
-		}) + lines[i]
+		lines[i] = m.LeftGutterFunc(m.gutterContext(rows[i], false, current)) + lines[i]
 	}
 	return lines
 }
@@ -477,8 +615,13 @@ func (m *Model) EnsureVisible(line, colstart, colend int) {
 		m.SetXOffset(colstart - m.horizontalStep) // put one step to the left, feels more natural
 	}
 
-	if line < m.YOffset() || line >= m.YOffset()+m.maxHeight() {
-		m.SetYOffset(line)
+	y := m.lineOffset(line)
+	if m.SoftWrap && maxWidth > 0 {
+		// Show the row of the wrapped line that the columns start on.
+		y += colstart / maxWidth
+	}
+	if y < m.YOffset() || y >= m.YOffset()+m.maxHeight() {
+		m.SetYOffset(y)
 	}
 }
 
@@ -594,7 +737,8 @@ func (m *Model) GotoBottom() (lines []string) {
 	return m.visibleLines()
 }
 
-// SetHighlights sets ranges of characters to highlight.
+// SetHighlights sets ranges of bytes to highlight, in the content without
+// ANSI escape sequences.
 // For instance, `[]int{[]int{2, 10}, []int{20, 30}}` will highlight characters
 // 2 to 10 and 20 to 30.
 // Note that highlights are not expected to transpose each other, and are also
@@ -622,6 +766,7 @@ func (m *Model) showHighlight() {
 		return
 	}
 	line, colstart, colend := m.highlights[m.hiIdx].coords()
+	m.revealLine(line)
 	m.EnsureVisible(line, colstart, colend)
 }
 
@@ -644,8 +789,9 @@ func (m *Model) HighlightPrevious() {
 }
 
 func (m Model) findNearestMatch() int {
+	_, top, _ := m.calculateLine(m.YOffset())
 	for i, match := range m.highlights {
-		if match.lineStart >= m.YOffset() {
+		if match.lineStart >= top {
 			return i
 		}
 	}
@@ -654,6 +800,30 @@ func (m Model) findNearestMatch() int {
 
 // Update handles standard message-based viewport updates.
 func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
+	if !m.initialized {
+		m.setInitialValues()
+	}
+	if m.search.active {
+		if msg, ok := msg.(tea.KeyPressMsg); ok {
+			return m.searchKey(msg)
+		}
+		var cmd tea.Cmd
+		m.searchInput, cmd = m.searchInput.Update(msg)
+		m = m.updateAsModel(msg)
+		return m, cmd
+	}
+	if msg, ok := msg.(tea.KeyPressMsg); ok {
+		if key.Matches(msg, m.KeyMap.Search) {
+			return m, m.StartSearch()
+		}
+		if cmd, ok := m.selectionKey(msg); ok {
+			return m, cmd
+		}
+		if m.Vim != nil {
+			cmd := m.Vim.HandleKey(pager{&m}, msg)
+			return m, cmd
+		}
+	}
 	m = m.updateAsModel(msg)
 	return m, nil
 }
@@ -691,8 +861,23 @@ func (m Model) updateAsModel(msg tea.Msg) Model {
 
 		case key.Matches(msg, m.KeyMap.Right):
 			m.ScrollRight(m.horizontalStep)
+
+		case key.Matches(msg, m.KeyMap.NextMatch):
+			m.HighlightNext()
+
+		case key.Matches(msg, m.KeyMap.PrevMatch):
+			m.HighlightPrevious()
 		}
 
+	case tea.MouseClickMsg:
+		m.mouseDown(msg)
+
+	case tea.MouseMotionMsg:
+		m.mouseDrag(msg)
+
+	case tea.MouseReleaseMsg:
+		m.sel.dragging = false
+
 	case tea.MouseWheelMsg:
 		if !m.MouseWheelEnabled {
 			break
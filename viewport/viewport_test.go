@@ -4,9 +4,13 @@ import (
 	"fmt"
 	"reflect"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
 
+	tea "charm.land/bubbletea/v2"
+	"github.com/haochend413/bubbles/v2/vim"
 	"github.com/haochend413/lipgloss/v2"
 	"github.com/charmbracelet/x/ansi"
 	"github.com/charmbracelet/x/exp/golden"
@@ -773,3 +777,336 @@ func BenchmarkView(b *testing.B) {
 		}
 	})
 }
+
+func TestVim(t *testing.T) {
+	m := New(WithHeight(3), WithWidth(10))
+	m.SoftWrap = true
+	m.Vim = vim.New()
+	m.SetContent("one\ntwo that wraps\nthree\nfour\nfive\nsix\nseven")
+
+	keys := func(s string) {
+		for _, k := range s {
+			m, _ = m.Update(tea.KeyPressMsg{Code: k, Text: string(k)})
+		}
+	}
+
+	keys("jj")
+	if got, want := m.YOffset(), 3; got != want {
+		t.Errorf("j: want Y offset %d, got %d", want, got)
+	}
+	keys("2k")
+	if got, want := m.YOffset(), 0; got != want {
+		t.Errorf("2k: want Y offset %d, got %d", want, got)
+	}
+	keys("G")
+	if !m.AtBottom() {
+		t.Errorf("G: want bottom, got Y offset %d", m.YOffset())
+	}
+	keys("ddx")
+	if got, want := m.TotalLineCount(), 8; got != want {
+		t.Errorf("dd: want %d lines, got %d", want, got)
+	}
+}
+
+func TestFolds(t *testing.T) {
+	m := New(WithHeight(3), WithWidth(20))
+	m.Vim = vim.New()
+	m.LeftGutterFunc = func(info GutterContext) string {
+		return fmt.Sprintf("%d ", info.Index+1)
+	}
+	m.SetContent("a:\n  b\n  c:\n    d\ne:\n  f\ng\nh")
+	m.FoldByIndent()
+
+	keys := func(s string) {
+		for _, k := range s {
+			m, _ = m.Update(tea.KeyPressMsg{Code: k, Text: string(k)})
+		}
+	}
+	view := func() string {
+		var rows []string
+		for _, row := range strings.Split(ansi.Strip(m.View()), "\n") {
+			rows = append(rows, strings.TrimRight(row, " "))
+		}
+		return strings.Join(rows, "\n")
+	}
+
+	keys("zM")
+	if got, want := view(), "1 a: ⋯ 3 lines\n5 e: ⋯ 1 line\n7 g"; got != want {
+		t.Errorf("zM: want\n%s\ngot\n%s", want, got)
+	}
+	if got, want := m.TotalLineCount(), 4; got != want {
+		t.Errorf("zM: want %d lines, got %d", want, got)
+	}
+	keys("j")
+	if got, want := m.YOffset(), 1; got != want {
+		t.Errorf("j: want Y offset %d, got %d", want, got)
+	}
+	keys("kza")
+	if got, want := view(), "1 a:\n2   b\n3   c: ⋯ 1 line"; got != want {
+		t.Errorf("za: want\n%s\ngot\n%s", want, got)
+	}
+	keys("zR")
+	if got, want := m.TotalLineCount(), 8; got != want {
+		t.Errorf("zR: want %d lines, got %d", want, got)
+	}
+
+	// Highlights open the folds hiding them.
+	m.CloseAllFolds()
+	m.SetHighlights([][]int{{strings.Index(m.GetContent(), "d"), strings.Index(m.GetContent(), "d") + 1}})
+	if _, ok := m.ClosedFold(3); ok {
+		t.Error("want the fold of the highlight opened")
+	}
+}
+
+func TestAppendLines(t *testing.T) {
+	m := New(WithHeight(3), WithWidth(20))
+	m.Follow = true
+	m.SetContent("1\n2")
+	m.AppendLines("3", "4\n5")
+	if got, want := m.GetContent(), "1\n2\n3\n4\n5"; got != want {
+		t.Errorf("want content %q, got %q", want, got)
+	}
+	if got, want := m.YOffset(), 2; got != want || !m.Following() {
+		t.Errorf("want the view following at Y offset %d, got %d", want, got)
+	}
+
+	// Scrolling up pauses following, and scrolling back down resumes it.
+	m.ScrollUp(1)
+	m.AppendLines("a long line that is wider")
+	if got, want := m.YOffset(), 1; got != want || m.Following() {
+		t.Errorf("want the view paused at Y offset %d, got %d", want, got)
+	}
+	if got, want := m.maxXOffset(), 5; got != want {
+		t.Errorf("want max X offset %d, got %d", want, got)
+	}
+	m.GotoBottom()
+	m.AppendLines("7")
+	if got, want := m.YOffset(), 4; got != want {
+		t.Errorf("want the view following at Y offset %d, got %d", want, got)
+	}
+
+	// The oldest lines are dropped past MaxLines, along with their
+	// highlights.
+	m.MaxLines = 5
+	m.SetHighlights([][]int{{0, 1}, {6, 7}})
+	m.ScrollUp(2)
+	m.AppendLines("8")
+	if got, want := m.GetContent(), "4\n5\na long line that is wider\n7\n8"; got != want {
+		t.Errorf("want content %q, got %q", want, got)
+	}
+	if got, want := m.YOffset(), 0; got != want {
+		t.Errorf("want the view kept on the same lines at Y offset %d, got %d", want, got)
+	}
+	if got := len(m.highlights); got != 1 || m.highlights[0].lineStart != 0 {
+		t.Errorf("want the highlight of line 4 moved to line 0, got %+v", m.highlights)
+	}
+
+	// The caller's lines are left alone, including their spare capacity.
+	lines := make([]string, 5, 10)
+	copy(lines, []string{"a", "b", "c", "d", "e"})
+	m.MaxLines = 3
+	m.SetContentLines(lines)
+	m.AppendLines("f\ng")
+	if got, want := lines[:cap(lines)], []string{"a", "b", "c", "d", "e", "", "", "", "", ""}; !slices.Equal(got, want) {
+		t.Errorf("want the caller's lines %q, got %q", want, got)
+	}
+	if got, want := m.GetContent(), "e\nf\ng"; got != want {
+		t.Errorf("want content %q, got %q", want, got)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	m := New(WithHeight(2), WithWidth(10))
+	m, _ = m.Update(tea.KeyPressMsg{Code: '/', Text: "/"})
+	if m.Searching() {
+		t.Fatal("the default key map opened the search prompt")
+	}
+	m.KeyMap = DefaultKeyMap().WithSearchKeys()
+	m.SoftWrap = true
+	m.SmartCase = true
+	m.SelectedHighlightStyle = lipgloss.NewStyle().Reverse(true)
+	m.SetContent("\x1b[31mfoo\x1b[0m bar\nx\ny\nFoo baz\nthe last line: foo\nz\nz")
+
+	keys := func(s string) {
+		for _, k := range s {
+			msg := tea.KeyPressMsg{Code: k, Text: string(k)}
+			switch k {
+			case '\r':
+				msg = tea.KeyPressMsg{Code: tea.KeyEnter}
+			case '\x1b':
+				msg = tea.KeyPressMsg{Code: tea.KeyEscape}
+			}
+			m, _ = m.Update(msg)
+		}
+	}
+
+	keys("/fo")
+	if !m.Searching() {
+		t.Fatal("want the search prompt open")
+	}
+	// The cursor of the prompt is drawn after the pattern.
+	if got, want := ansi.Strip(m.SearchView()), "/fo  match 1/3"; got != want {
+		t.Errorf("want search view %q, got %q", want, got)
+	}
+
+	// Smart case only ignores case in lower case patterns.
+	keys("o\rn")
+	if m.Searching() {
+		t.Error("want the search prompt closed")
+	}
+	if current, total := m.Matches(); current != 2 || total != 3 {
+		t.Errorf("want match 2/3, got %d/%d", current, total)
+	}
+	if got, want := m.YOffset(), 3; got != want {
+		t.Errorf("want Y offset %d, got %d", want, got)
+	}
+
+	// The view scrolls to the row of a soft-wrapped line the match is on.
+	keys("n")
+	if got, want := m.YOffset(), 5; got != want {
+		t.Errorf("want Y offset %d, got %d", want, got)
+	}
+	if got := m.View(); !strings.Contains(got, m.SelectedHighlightStyle.Render("foo")) {
+		t.Errorf("want the match highlighted, got %q", got)
+	}
+
+	if err := m.Search("Foo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, total := m.Matches(); total != 1 {
+		t.Errorf("want 1 match, got %d", total)
+	}
+	m.SearchRegexp = true
+	if err := m.Search("ba[rz]"); err != nil {
+		t.Fatal(err)
+	}
+	if _, total := m.Matches(); total != 2 {
+		t.Errorf("want 2 regexp matches, got %d", total)
+	}
+	if err := m.Search("ba["); err == nil {
+		t.Error("want an error for an invalid pattern")
+	}
+
+	// Cancelling the search goes back to where it started.
+	m.SearchRegexp = false
+	m.GotoTop()
+	keys("/last\x1b")
+	if m.Searching() || m.YOffset() != 0 || len(m.highlights) != 0 {
+		t.Errorf("want the search cancelled, got Y offset %d and %d highlights", m.YOffset(), len(m.highlights))
+	}
+
+	// The pattern is searched for in appended lines.
+	_ = m.Search("foo")
+	m.AppendLines("more foo")
+	if _, total := m.Matches(); total != 4 {
+		t.Errorf("want 4 matches, got %d", total)
+	}
+}
+
+func TestSelection(t *testing.T) {
+	m := New(WithHeight(5), WithWidth(10))
+	m.SoftWrap = true
+	m.SetContent("\x1b[31mhello\x1b[0m world\nsecond line that wraps\nthird")
+
+	// Selecting is off by default.
+	m, _ = m.Update(tea.MouseClickMsg{X: 6, Y: 0, Button: tea.MouseLeft})
+	m, _ = m.Update(tea.MouseReleaseMsg{X: 3, Y: 3, Button: tea.MouseLeft})
+	m, _ = m.Update(tea.KeyPressMsg{Code: 'v', Text: "v"})
+	if got := m.SelectedText(); got != "" {
+		t.Fatalf("the defaults selected %q", got)
+	}
+	m.MouseSelectEnabled = true
+	m.KeyMap = DefaultKeyMap().WithSelectionKeys()
+
+	// The second row of the first line, and the second row of the second one
+	// are soft-wrapped.
+	m, _ = m.Update(tea.MouseClickMsg{X: 6, Y: 0, Button: tea.MouseLeft})
+	m, _ = m.Update(tea.MouseMotionMsg{X: 3, Y: 3, Button: tea.MouseLeft})
+	m, _ = m.Update(tea.MouseReleaseMsg{X: 3, Y: 3, Button: tea.MouseLeft})
+	if got, want := m.SelectedText(), "world\nsecond line t"; got != want {
+		t.Errorf("want selected text %q, got %q", want, got)
+	}
+	if !strings.Contains(m.View(), m.SelectionStyle.Render("second lin")) {
+		t.Errorf("want the selection styled, got %q", m.View())
+	}
+	if m.Copy() == nil || m.CopyOSC52() == nil {
+		t.Error("want commands copying the selection")
+	}
+
+	keys := func(s string) {
+		for _, k := range s {
+			m, _ = m.Update(tea.KeyPressMsg{Code: k, Text: string(k)})
+		}
+	}
+	m.ClearSelection()
+	keys("vll")
+	if !m.Selecting() {
+		t.Fatal("want text selected with the keyboard")
+	}
+	if got, want := m.SelectedText(), "hel"; got != want {
+		t.Errorf("want selected text %q, got %q", want, got)
+	}
+	keys("jj")
+	if got, want := m.SelectedText(), "hello world\nsecond line that wraps\nthi"; got != want {
+		t.Errorf("want selected text %q, got %q", want, got)
+	}
+	if got, want := m.YOffset(), 1; got != want {
+		t.Errorf("want the view scrolled to the selection at Y offset %d, got %d", want, got)
+	}
+	var cmd tea.Cmd
+	m, cmd = m.Update(tea.KeyPressMsg{Code: 'y', Text: "y"})
+	if cmd == nil || m.Selecting() || m.SelectedText() != "" {
+		t.Error("want the selection copied and cleared")
+	}
+}
+
+func TestGutters(t *testing.T) {
+	lines := []string{"one", "two that wraps", "three"}
+	for i := 4; i <= 10; i++ {
+		lines = append(lines, strconv.Itoa(i))
+	}
+	bookmarks := map[int]bool{0: true}
+	markers := map[int]string{1: "E", 2: "long"}
+
+	m := New(WithHeight(5), WithWidth(17))
+	m.SoftWrap = true
+	m.LeftGutterFunc = Gutters(
+		Bookmarks(bookmarks, "*", lipgloss.NewStyle()),
+		Markers(markers, 2, lipgloss.NewStyle()),
+		LineNumbers(lipgloss.NewStyle()),
+	)
+	m.SetContentLines(lines)
+	view := func() string {
+		var rows []string
+		for _, row := range strings.Split(ansi.Strip(m.View()), "\n") {
+			rows = append(rows, strings.TrimRight(row, " "))
+		}
+		return strings.Join(rows, "\n")
+	}
+
+	want := "*   1 one\n" +
+		" E  2 two that wr\n" +
+		"      aps\n" +
+		" lo 3 three\n" +
+		"    4 4"
+	if got := view(); got != want {
+		t.Errorf("want\n%s\ngot\n%s", want, got)
+	}
+
+	// Changes to the maps show on the next render.
+	bookmarks[0] = false
+	markers[2] = "W"
+	m.LeftGutterFunc = Gutters(
+		Markers(markers, 1, lipgloss.NewStyle()),
+		RelativeLineNumbers(lipgloss.NewStyle(), lipgloss.NewStyle()),
+	)
+	m.ScrollDown(1)
+	want = "E2  two that wrap\n" +
+		"    s\n" +
+		"W 1 three\n" +
+		"  2 4\n" +
+		"  3 5"
+	if got := view(); got != want {
+		t.Errorf("want\n%s\ngot\n%s", want, got)
+	}
+}
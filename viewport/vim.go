@@ -0,0 +1,90 @@
+package viewport
+
+import (
+	"math"
+
+	tea "charm.land/bubbletea/v2"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/haochend413/bubbles/v2/vim"
+)
+
+// pager drives the viewport from its [vim.Engine]. The viewport is a
+// read-only buffer whose cursor is its top left corner: moving the cursor
+// scrolls the view.
+type pager struct {
+	m *Model
+}
+
+func (p pager) LineCount() int {
+	return max(1, len(p.m.lines))
+}
+
+// Line returns the text of a line, without ANSI escape sequences.
+func (p pager) Line(row int) []rune {
+	if row >= len(p.m.lines) {
+		return nil
+	}
+	return []rune(ansi.Strip(p.m.lines[row]))
+}
+
+func (p pager) Cursor() vim.Pos {
+	_, row, _ := p.m.calculateLine(p.m.yOffset)
+	return vim.Pos{Row: min(row, p.LineCount()-1), Col: p.m.xOffset}
+}
+
+func (p pager) SetCursor(pos vim.Pos) {
+	p.m.SetYOffset(p.m.lineOffset(pos.Row))
+	p.m.SetXOffset(pos.Col)
+	p.m.hiIdx = p.m.findNearestMatch()
+}
+
+// Replace does nothing, as the viewport is read-only.
+func (p pager) Replace(vim.Pos, vim.Pos, string) {}
+
+// Key handles keys that aren't Vim commands with the viewport's key map, such
+// as page down.
+func (p pager) Key(msg tea.KeyPressMsg) tea.Cmd {
+	*p.m = p.m.updateAsModel(msg)
+	return nil
+}
+
+func (p pager) ReadOnly() bool {
+	return true
+}
+
+func (p pager) PageHeight() int {
+	return p.m.Height()
+}
+
+func (p pager) ToggleFold(row int) { p.m.ToggleFold(row) }
+func (p pager) OpenFold(row int)   { p.m.OpenFold(row) }
+func (p pager) CloseFold(row int)  { p.m.CloseFold(row) }
+func (p pager) OpenAllFolds()      { p.m.OpenAllFolds() }
+func (p pager) CloseAllFolds()     { p.m.CloseAllFolds() }
+
+func (p pager) ClosedFold(row int) (start, end int, ok bool) {
+	f, ok := p.m.ClosedFold(row)
+	return f.Start, f.End, ok
+}
+
+// lineOffset returns the Y offset at which a line starts, taking soft
+// wrapping and closed folds into account. Lines hidden by a closed fold start
+// where its first line does.
+func (m Model) lineOffset(row int) int {
+	if !m.SoftWrap && len(m.folds) == 0 {
+		return row
+	}
+	maxWidth := float64(m.maxWidth())
+	var offset int
+	for i, hidden := range m.shownLines(0) {
+		if i+hidden >= row {
+			break
+		}
+		if !m.SoftWrap {
+			offset++
+			continue
+		}
+		offset += max(1, int(math.Ceil(float64(m.lineWidth(i, hidden))/maxWidth)))
+	}
+	return offset
+}
@@ -0,0 +1,463 @@
+package vim
+
+import (
+	"unicode"
+
+	"github.com/haochend413/bubbles/v2/internal/runeutil"
+)
+
+// motion returns the target of a motion from the cursor position. op is the
+// operator waiting for the motion, if any. With an operator, the target may be
+// one past the end of the line.
+func (e *Engine) motion(k string, char rune, count int, op string) (Pos, motionKind, bool) {
+	n := max(count, 1)
+	p := e.cursor()
+	line := e.line(p.Row)
+	lines := e.lineCount()
+	pending := op != ""
+
+	switch k {
+	case "h", "left", "backspace":
+		if p.Col == 0 {
+			return p, exclusive, false
+		}
+		return Pos{p.Row, prevChars(line, p.Col, n)}, exclusive, true
+	case "l", "right", "space":
+		limit := len(line)
+		if !pending {
+			limit = lastChar(line)
+		}
+		if p.Col >= limit {
+			return p, exclusive, false
+		}
+		return Pos{p.Row, nextChars(line, p.Col, n, limit)}, exclusive, true
+	case "j", "down":
+		// Closed folds count as one line.
+		row := p.Row
+		for i := 0; i < n && row < lines-1; i++ {
+			if _, end, ok := e.closedFold(row); ok {
+				row = end
+			}
+			row = min(lines-1, row+1)
+		}
+		if _, end, ok := e.closedFold(row); ok && pending {
+			row = end
+		}
+		if row == p.Row {
+			return p, linewise, false
+		}
+		return Pos{row, e.wantedCol(row)}, linewise, true
+	case "k", "up":
+		row := p.Row
+		for i := 0; i < n && row > 0; i++ {
+			row--
+			if start, _, ok := e.closedFold(row); ok {
+				row = start
+			}
+		}
+		if row == p.Row {
+			return p, linewise, false
+		}
+		return Pos{row, e.wantedCol(row)}, linewise, true
+	case "ctrl+f", "ctrl+b", "ctrl+d", "ctrl+u":
+		return e.pageMotion(k, n)
+	case "0":
+		return Pos{p.Row, 0}, exclusive, true
+	case "^":
+		return Pos{p.Row, firstNonBlank(line)}, exclusive, true
+	case "$":
+		row := min(lines-1, p.Row+n-1)
+		l := e.line(row)
+		return Pos{row, max(0, len(l)-1)}, inclusive, len(l) > 0 || !pending
+	case "gg", "G":
+		row := 0
+		if k == "G" {
+			row = lines - 1
+		}
+		if count > 0 {
+			row = clamp(count-1, 0, lines-1)
+		}
+		return Pos{row, firstNonBlank(e.line(row))}, linewise, true
+	case "w", "W":
+		big := k == "W"
+		if op == "c" && e.classAt(p, big) != classBlank {
+			// Like Vim, "cw" on a word only changes up to the end of the
+			// word, not the blanks after it.
+			for i := range n {
+				if i > 0 || e.classAt(Pos{p.Row, p.Col + 1}, big) == e.classAt(p, big) {
+					next := e.wordEnd(p, big)
+					if next == p {
+						break
+					}
+					p = next
+				}
+			}
+			return p, inclusive, true
+		}
+		prev := p
+		for range n {
+			next := e.wordForward(p, big)
+			prev, p = p, next
+			if next == prev {
+				break
+			}
+		}
+		if pending && p.Row > prev.Row {
+			// When the last word moved over is at the end of a line, the
+			// end of that word is the end of the operated text, rather
+			// than the start of the next line.
+			p = Pos{prev.Row, len(e.line(prev.Row))}
+		}
+		return p, exclusive, p != e.cursor()
+	case "b", "B":
+		for range n {
+			next := e.wordBackward(p, k == "B")
+			if next == p {
+				break
+			}
+			p = next
+		}
+		return p, exclusive, p != e.cursor()
+	case "e", "E":
+		for range n {
+			next := e.wordEnd(p, k == "E")
+			if next == p {
+				break
+			}
+			p = next
+		}
+		return p, inclusive, p != e.cursor()
+	case "f", "t", "F", "T":
+		return e.findChar(k, char, n, false)
+	case ";", ",":
+		if e.lastFind == "" {
+			return p, exclusive, false
+		}
+		find := e.lastFind
+		if k == "," {
+			find = reverseFind(find)
+		}
+		return e.findChar(find, e.lastFindChar, n, true)
+	case "n", "N":
+		return e.searchMotion(k == "N", n)
+	case "*", "#":
+		return e.wordSearchMotion(k == "#", n)
+	case "}", "{":
+		return e.paragraphMotion(k == "{", n)
+	}
+	return p, exclusive, false
+}
+
+// paragraphMotion moves count paragraphs forward with "}", or backward with
+// "{", to the empty line after or before the paragraph, or else to the end or
+// the start of the buffer.
+func (e *Engine) paragraphMotion(backward bool, count int) (Pos, motionKind, bool) {
+	p := e.cursor()
+	last := e.lineCount() - 1
+	step := 1
+	if backward {
+		step = -1
+	}
+	inside := func(row int) bool { return row >= 0 && row <= last }
+
+	row := p.Row
+	for range count {
+		// The empty lines before the paragraph are skipped, then the
+		// paragraph itself.
+		for inside(row+step) && len(e.line(row+step)) == 0 {
+			row += step
+		}
+		for inside(row+step) && len(e.line(row+step)) > 0 {
+			row += step
+		}
+		row += step
+		if !inside(row) {
+			break
+		}
+	}
+
+	target, kind := Pos{row, 0}, exclusive
+	switch {
+	case row < 0:
+		target = Pos{0, 0}
+	case row > last:
+		target, kind = Pos{last, max(0, len(e.line(last))-1)}, inclusive
+	}
+	return target, kind, target != p
+}
+
+// pageMotion moves count pages down with ctrl+f or up with ctrl+b, or count
+// half pages with ctrl+d and ctrl+u, in editors that are a [Pager].
+func (e *Engine) pageMotion(k string, count int) (Pos, motionKind, bool) {
+	p := e.cursor()
+	pager, ok := e.ed.(Pager)
+	if !ok {
+		return p, linewise, false
+	}
+	lines := max(1, pager.PageHeight())
+	if k == "ctrl+d" || k == "ctrl+u" {
+		lines = max(1, lines/2)
+	}
+	row := p.Row + count*lines
+	if k == "ctrl+b" || k == "ctrl+u" {
+		row = p.Row - count*lines
+	}
+	row = clamp(row, 0, e.lineCount()-1)
+	return Pos{row, e.wantedCol(row)}, linewise, row != p.Row
+}
+
+// wantedCol returns the column the cursor should land on when moving
+// vertically to row.
+func (e *Engine) wantedCol(row int) int {
+	return min(e.wantCol, max(0, len(e.line(row))-1))
+}
+
+// findChar searches the current line for the nth occurrence of char. kind is
+// one of "f", "t", "F" or "T". If repeat is set, "t" and "T" skip a match
+// directly next to the cursor so that ";" moves on to the next one.
+func (e *Engine) findChar(kind string, char rune, n int, repeat bool) (Pos, motionKind, bool) {
+	p := e.cursor()
+	line := e.line(p.Row)
+	col := p.Col
+	forward := kind == "f" || kind == "t"
+	step := 1
+	if !forward {
+		step = -1
+	}
+	if repeat && (kind == "t" || kind == "T") {
+		col += step
+	}
+	for found := 0; found < n; {
+		col += step
+		if col < 0 || col >= len(line) {
+			return p, exclusive, false
+		}
+		if line[col] == char {
+			found++
+		}
+	}
+	switch kind {
+	case "t":
+		col--
+	case "T":
+		col++
+	}
+	if forward {
+		return Pos{p.Row, col}, inclusive, true
+	}
+	return Pos{p.Row, col}, exclusive, true
+}
+
+// reverseFind returns the find command searching in the other direction.
+func reverseFind(kind string) string {
+	switch kind {
+	case "f":
+		return "F"
+	case "F":
+		return "f"
+	case "t":
+		return "T"
+	default:
+		return "t"
+	}
+}
+
+// Character classes for word motions.
+const (
+	classBlank = iota
+	classPunct
+	classWord
+)
+
+// charClass returns the class of a rune for word motions. With bigWord, all
+// non-blank runes are in the same class, as for the W, B and E motions.
+func charClass(r rune, bigWord bool) int {
+	switch {
+	case unicode.IsSpace(r):
+		return classBlank
+	case bigWord, r == '_', unicode.IsLetter(r), unicode.IsDigit(r):
+		return classWord
+	default:
+		return classPunct
+	}
+}
+
+// classAt returns the class of the rune at p. The end of a line is blank.
+func (e *Engine) classAt(p Pos, bigWord bool) int {
+	line := e.line(p.Row)
+	if p.Col >= len(line) {
+		return classBlank
+	}
+	return charClass(line[p.Col], bigWord)
+}
+
+// nextPos returns the position after p. The end of each line is a position
+// of its own.
+func (e *Engine) nextPos(p Pos) (Pos, bool) {
+	if p.Col < len(e.line(p.Row)) {
+		return Pos{p.Row, p.Col + 1}, true
+	}
+	if p.Row < e.lineCount()-1 {
+		return Pos{p.Row + 1, 0}, true
+	}
+	return p, false
+}
+
+// prevPos returns the position before p.
+func (e *Engine) prevPos(p Pos) (Pos, bool) {
+	if p.Col > 0 {
+		return Pos{p.Row, p.Col - 1}, true
+	}
+	if p.Row > 0 {
+		return Pos{p.Row - 1, len(e.line(p.Row - 1))}, true
+	}
+	return p, false
+}
+
+// emptyLine reports whether p is on an empty line.
+func (e *Engine) emptyLine(p Pos) bool {
+	return len(e.line(p.Row)) == 0
+}
+
+// wordForward returns the start of the next word, as the w motion does.
+// Empty lines count as words.
+func (e *Engine) wordForward(p Pos, bigWord bool) Pos {
+	start := p
+	if c := e.classAt(p, bigWord); c != classBlank {
+		for e.classAt(p, bigWord) == c {
+			p, _ = e.nextPos(p)
+		}
+	}
+	for e.classAt(p, bigWord) == classBlank {
+		if p != start && e.emptyLine(p) {
+			break
+		}
+		next, ok := e.nextPos(p)
+		if !ok {
+			break
+		}
+		p = next
+	}
+	return p
+}
+
+// wordBackward returns the start of the previous word, as the b motion does.
+func (e *Engine) wordBackward(p Pos, bigWord bool) Pos {
+	p, ok := e.prevPos(p)
+	if !ok {
+		return p
+	}
+	for e.classAt(p, bigWord) == classBlank {
+		if e.emptyLine(p) {
+			return p
+		}
+		if p, ok = e.prevPos(p); !ok {
+			return p
+		}
+	}
+	c := e.classAt(p, bigWord)
+	for p.Col > 0 && e.classAt(Pos{p.Row, p.Col - 1}, bigWord) == c {
+		p.Col--
+	}
+	return p
+}
+
+// wordEnd returns the end of the word, as the e motion does.
+func (e *Engine) wordEnd(p Pos, bigWord bool) Pos {
+	p, ok := e.nextPos(p)
+	if !ok {
+		return p
+	}
+	for e.classAt(p, bigWord) == classBlank {
+		if p, ok = e.nextPos(p); !ok {
+			return p
+		}
+	}
+	c := e.classAt(p, bigWord)
+	for p.Col+1 < len(e.line(p.Row)) && e.classAt(Pos{p.Row, p.Col + 1}, bigWord) == c {
+		p.Col++
+	}
+	return p
+}
+
+// wordObject returns the start and the exclusive end of the count words the
+// "iw" text object selects from p, within its line. Like in Vim, blanks count
+// as words of their own. With around, as for "aw", each word is followed by
+// the blanks after it, or the blanks before it are included when there are
+// none after the last word; starting on blanks, they are followed by the next
+// word instead.
+func (e *Engine) wordObject(p Pos, bigWord, around bool, count int) (Pos, Pos, bool) {
+	line := e.line(p.Row)
+	if len(line) == 0 {
+		return p, p, false
+	}
+	class := func(col int) int { return charClass(line[col], bigWord) }
+	runEnd := func(col int) int {
+		c := class(col)
+		for col < len(line) && class(col) == c {
+			col++
+		}
+		return col
+	}
+
+	col := min(p.Col, len(line)-1)
+	start, end := col, col
+	for start > 0 && class(start-1) == class(col) {
+		start--
+	}
+	for range max(count, 1) {
+		if end == len(line) {
+			break
+		}
+		blank := class(end) == classBlank
+		end = runEnd(end)
+		if around && end < len(line) && (blank || class(end) == classBlank) {
+			end = runEnd(end)
+		}
+	}
+	if around && class(col) != classBlank && class(end-1) != classBlank {
+		for start > 0 && class(start-1) == classBlank {
+			start--
+		}
+	}
+	return Pos{p.Row, start}, Pos{p.Row, end}, true
+}
+
+// firstNonBlank returns the index of the first non-blank rune of a line.
+func firstNonBlank(line []rune) int {
+	for i, r := range line {
+		if !unicode.IsSpace(r) {
+			return i
+		}
+	}
+	return max(0, len(line)-1)
+}
+
+// nextChars returns the column n characters after col in line, up to limit.
+// Characters are grapheme clusters, so that an emoji made of several runes or
+// a letter followed by combining accents is stepped over as a whole.
+func nextChars(line []rune, col, n, limit int) int {
+	for i := 0; i < n && col < limit; i++ {
+		col = runeutil.NextGrapheme(line, col)
+	}
+	return min(col, limit)
+}
+
+// prevChars returns the column n characters before col in line, counting
+// grapheme clusters like nextChars.
+func prevChars(line []rune, col, n int) int {
+	var starts []int
+	for i := 0; i < min(col, len(line)); i = runeutil.NextGrapheme(line, i) {
+		starts = append(starts, i)
+	}
+	if n >= len(starts) {
+		return 0
+	}
+	return starts[len(starts)-n]
+}
+
+// lastChar returns the column of the last character of line, or 0 if it's
+// empty.
+func lastChar(line []rune) int {
+	return runeutil.PrevGrapheme(line, len(line))
+}
@@ -0,0 +1,263 @@
+package vim
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/haochend413/bubbles/v2/internal/runeutil"
+)
+
+// applyOperator applies op to the text between start and end, which must be
+// in order.
+func (e *Engine) applyOperator(op string, start, end Pos, kind motionKind) {
+	if kind == linewise {
+		e.applyLinewise(op, start.Row, end.Row)
+		return
+	}
+
+	if kind == inclusive {
+		line := e.line(end.Row)
+		end.Col = nextChars(line, end.Col, 1, len(line))
+	}
+
+	switch op {
+	case "d", "c":
+		e.writeRegister(Register{Text: e.textRange(start, end)}, false)
+		e.deleteRange(start, end)
+		if op == "c" {
+			e.setMode(ModeInsert)
+		}
+	case "y":
+		e.writeRegister(Register{Text: e.textRange(start, end)}, true)
+		e.setCursor(start)
+	case ">", "<", "gq":
+		e.applyLinewise(op, start.Row, end.Row)
+	case "g~", "gu", "gU":
+		e.mapRange(start, end, caseFunc(op))
+		e.setCursor(start)
+	}
+}
+
+// applyLinewise applies op to the lines first through last.
+func (e *Engine) applyLinewise(op string, first, last int) {
+	text := e.linesText(first, last)
+	cur := e.cursor()
+
+	switch op {
+	case "d":
+		e.writeRegister(Register{Text: text, Linewise: true}, false)
+		e.deleteLines(first, last)
+		row := min(first, e.lineCount()-1)
+		e.setCursor(Pos{row, firstNonBlank(e.line(row))})
+	case "c":
+		e.writeRegister(Register{Text: text, Linewise: true}, false)
+		e.replace(Pos{first, 0}, Pos{last, len(e.line(last))}, "")
+		e.setCursor(Pos{first, 0})
+		e.setMode(ModeInsert)
+	case "y":
+		e.writeRegister(Register{Text: text, Linewise: true}, true)
+		if first < cur.Row {
+			e.setCursor(Pos{first, min(cur.Col, len(e.line(first)))})
+		}
+	case ">", "<":
+		for row := first; row <= last; row++ {
+			e.setLine(row, shiftLine(e.line(row), e.ShiftWidth, op == ">"))
+		}
+		e.setCursor(Pos{first, firstNonBlank(e.line(first))})
+	case "g~", "gu", "gU":
+		e.mapRange(Pos{first, 0}, Pos{last, len(e.line(last))}, caseFunc(op))
+		e.setCursor(Pos{first, min(cur.Col, len(e.line(first)))})
+	case "gq":
+		lines := make([][]rune, 0, last-first+1)
+		for row := first; row <= last; row++ {
+			lines = append(lines, e.line(row))
+		}
+		formatted := make([]string, 0, len(lines))
+		for _, l := range runeutil.Reflow(lines, e.textWidth(), tabStop) {
+			formatted = append(formatted, string(l))
+		}
+		e.replace(Pos{first, 0}, Pos{last, len(e.line(last))}, strings.Join(formatted, "\n"))
+		// Like in Vim, the cursor ends up on the last formatted line.
+		row := first + len(formatted) - 1
+		e.setCursor(Pos{row, firstNonBlank(e.line(row))})
+	}
+}
+
+// textWidth returns the width that gq formats lines to.
+func (e *Engine) textWidth() int {
+	if e.TextWidth > 0 {
+		return e.TextWidth
+	}
+	return defaultTextWidth
+}
+
+// mapRange replaces each rune between start and end, end exclusive, with
+// the result of fn.
+func (e *Engine) mapRange(start, end Pos, fn func(rune) rune) {
+	for row := start.Row; row <= end.Row; row++ {
+		line := slices.Clone(e.line(row))
+		from, to := 0, len(line)
+		if row == start.Row {
+			from = start.Col
+		}
+		if row == end.Row {
+			to = min(to, end.Col)
+		}
+		for i := from; i < to; i++ {
+			line[i] = fn(line[i])
+		}
+		e.setLine(row, line)
+	}
+}
+
+// caseFunc returns the function changing the case of runes for a case
+// operator.
+func caseFunc(op string) func(rune) rune {
+	switch op {
+	case "gu", "u":
+		return unicode.ToLower
+	case "gU", "U":
+		return unicode.ToUpper
+	default:
+		return toggleCase
+	}
+}
+
+// toggleCase switches the case of a rune.
+func toggleCase(r rune) rune {
+	if unicode.IsUpper(r) {
+		return unicode.ToLower(r)
+	}
+	return unicode.ToUpper(r)
+}
+
+// shiftLine indents or outdents a line by width spaces. Empty lines are
+// never indented.
+func shiftLine(line []rune, width int, indent bool) []rune {
+	if indent {
+		if len(line) == 0 {
+			return line
+		}
+		return slices.Concat([]rune(strings.Repeat(" ", width)), line)
+	}
+	n := 0
+	for n < width && n < len(line) && line[n] == ' ' {
+		n++
+	}
+	return slices.Clone(line[n:])
+}
+
+// textRange returns the text between start and end, end exclusive.
+func (e *Engine) textRange(start, end Pos) string {
+	if start.Row == end.Row {
+		return string(e.line(start.Row)[start.Col:end.Col])
+	}
+	var b strings.Builder
+	b.WriteString(string(e.line(start.Row)[start.Col:]))
+	for row := start.Row + 1; row < end.Row; row++ {
+		b.WriteByte('\n')
+		b.WriteString(string(e.line(row)))
+	}
+	b.WriteByte('\n')
+	b.WriteString(string(e.line(end.Row)[:end.Col]))
+	return b.String()
+}
+
+// linesText returns the lines first through last joined by newlines.
+func (e *Engine) linesText(first, last int) string {
+	return e.textRange(Pos{first, 0}, Pos{last, len(e.line(last))})
+}
+
+// deleteRange deletes the text between start and end, end exclusive, and
+// moves the cursor to start.
+func (e *Engine) deleteRange(start, end Pos) {
+	e.replace(start, end, "")
+	e.setCursor(start)
+}
+
+// deleteLines deletes the lines first through last, always leaving at least
+// one (empty) line behind.
+func (e *Engine) deleteLines(first, last int) {
+	switch {
+	case last < e.lineCount()-1:
+		e.replace(Pos{first, 0}, Pos{last + 1, 0}, "")
+	case first > 0:
+		e.replace(Pos{first - 1, len(e.line(first - 1))}, Pos{last, len(e.line(last))}, "")
+	default:
+		e.replace(Pos{0, 0}, Pos{last, len(e.line(last))}, "")
+	}
+}
+
+// clampNormalCursor keeps the cursor on a character, as normal and visual
+// modes don't allow the cursor past the end of the line.
+func (e *Engine) clampNormalCursor() {
+	if e.mode == ModeInsert || e.ed == nil {
+		return
+	}
+	p := e.cursor()
+	if line := e.line(p.Row); p.Col > lastChar(line) {
+		e.setCursor(Pos{p.Row, lastChar(line)})
+	}
+}
+
+// line returns the characters of a line of the editor.
+func (e *Engine) line(row int) []rune {
+	return e.ed.Line(row)
+}
+
+// lineCount returns the number of lines of the editor.
+func (e *Engine) lineCount() int {
+	return max(1, e.ed.LineCount())
+}
+
+// cursor returns the cursor position of the editor.
+func (e *Engine) cursor() Pos {
+	return e.ed.Cursor()
+}
+
+// setCursor moves the cursor of the editor.
+func (e *Engine) setCursor(p Pos) {
+	p.Row = clamp(p.Row, 0, e.lineCount()-1)
+	p.Col = clamp(p.Col, 0, len(e.line(p.Row)))
+	e.ed.SetCursor(p)
+}
+
+// replace replaces the text between start and end, end exclusive, unless the
+// editor is read-only.
+func (e *Engine) replace(start, end Pos, text string) {
+	if e.readOnly() {
+		return
+	}
+	e.ed.Replace(start, end, text)
+}
+
+// setLine replaces the content of a line, leaving the cursor where it was.
+func (e *Engine) setLine(row int, line []rune) {
+	if slices.Equal(line, e.line(row)) {
+		return
+	}
+	cur := e.cursor()
+	e.replace(Pos{row, 0}, Pos{row, len(e.line(row))}, string(line))
+	e.setCursor(cur)
+}
+
+// insert inserts text at the cursor, moving the cursor to the end of it.
+func (e *Engine) insert(text string) {
+	p := e.cursor()
+	e.replace(p, p, text)
+	lines := strings.Split(text, "\n")
+	last := lines[len(lines)-1]
+	col := len([]rune(last))
+	if len(lines) == 1 {
+		col += p.Col
+	}
+	e.setCursor(Pos{p.Row + len(lines) - 1, col})
+}
+
+func clamp(v, low, high int) int {
+	if high < low {
+		low, high = high, low
+	}
+	return min(high, max(low, v))
+}
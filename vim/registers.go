@@ -0,0 +1,296 @@
+package vim
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/atotto/clipboard"
+)
+
+// Register is the content of a Vim register.
+type Register struct {
+	// Text is the content of the register. The lines of a linewise or
+	// blockwise register are separated by newlines, without a trailing one.
+	Text string
+
+	// Linewise is set if the register holds whole lines, which are put on
+	// lines of their own.
+	Linewise bool
+
+	// Blockwise is set if the register holds a block yanked in visual block
+	// mode, which is put as a block again.
+	Blockwise bool
+}
+
+// Register names with a special meaning.
+const (
+	// UnnamedRegister is used when no register is given. It holds the last
+	// yanked or deleted text.
+	UnnamedRegister = '"'
+
+	// YankRegister holds the last text yanked without naming a register.
+	YankRegister = '0'
+
+	// SmallDeleteRegister holds the last deletion within a line made
+	// without naming a register. Larger deletions go to registers "1 to
+	// "9, shifting older ones up.
+	SmallDeleteRegister = '-'
+
+	// ClipboardRegister reads from and writes to the clipboard. The "*
+	// register is the same as "+.
+	ClipboardRegister = '+'
+
+	// BlackHoleRegister discards whatever is written to it.
+	BlackHoleRegister = '_'
+)
+
+// Clipboard is a clipboard the "+ and "* registers read from and write to.
+type Clipboard interface {
+	ReadAll() (string, error)
+	WriteAll(text string) error
+}
+
+// SystemClipboard is the system clipboard.
+var SystemClipboard Clipboard = systemClipboard{}
+
+type systemClipboard struct{}
+
+func (systemClipboard) ReadAll() (string, error)   { return clipboard.ReadAll() }
+func (systemClipboard) WriteAll(text string) error { return clipboard.WriteAll(text) }
+
+// validRegister reports whether name is the name of a register. Uppercase
+// letters name the same registers as lowercase ones.
+func validRegister(name rune) bool {
+	switch {
+	case name >= 'a' && name <= 'z', name >= 'A' && name <= 'Z',
+		name >= '0' && name <= '9':
+		return true
+	}
+	return strings.ContainsRune(`"-+*_`, name)
+}
+
+// Register returns the content of the named register. Reading the "+ or "*
+// register reads the clipboard, where text ending with a newline is
+// linewise.
+func (e *Engine) Register(name rune) Register {
+	switch name {
+	case ClipboardRegister, '*':
+		if e.Clipboard == nil {
+			return Register{}
+		}
+		text, err := e.Clipboard.ReadAll()
+		if err != nil {
+			return Register{}
+		}
+		if strings.HasSuffix(text, "\n") {
+			return Register{Text: strings.TrimSuffix(text, "\n"), Linewise: true}
+		}
+		return Register{Text: text}
+	}
+	return e.registers[unicode.ToLower(name)]
+}
+
+// SetRegister sets the content of the named register, so that apps can seed
+// registers or restore persisted ones. Setting the "+ or "* register writes
+// the clipboard. Invalid names are ignored.
+func (e *Engine) SetRegister(name rune, r Register) error {
+	if !validRegister(name) {
+		return nil
+	}
+	return e.setRegister(unicode.ToLower(name), r)
+}
+
+// Registers returns the content of all registers that have been set, other
+// than the clipboard, so that apps can persist them.
+func (e *Engine) Registers() map[rune]Register {
+	return maps.Clone(e.registers)
+}
+
+// setRegister sets the content of a register. Only writing the clipboard can
+// fail.
+func (e *Engine) setRegister(name rune, r Register) error {
+	switch name {
+	case BlackHoleRegister:
+		return nil
+	case ClipboardRegister, '*':
+		if e.Clipboard == nil {
+			return nil
+		}
+		text := r.Text
+		if r.Linewise {
+			text += "\n"
+		}
+		return e.Clipboard.WriteAll(text)
+	}
+	if e.registers == nil {
+		e.registers = make(map[rune]Register)
+	}
+	e.registers[name] = r
+	return nil
+}
+
+// writeRegister stores yanked or deleted text in the register named by the
+// command being run, along with the unnamed register. An uppercase name
+// appends to the register. A clipboard error becomes the message.
+func (e *Engine) writeRegister(r Register, yank bool) {
+	name := e.cmd.register
+	var err error
+	switch {
+	case name == BlackHoleRegister:
+		return
+	case name == 0 || name == UnnamedRegister:
+		switch {
+		case yank:
+			err = e.setRegister(YankRegister, r)
+		case r.Linewise || strings.Contains(r.Text, "\n"):
+			for n := '9'; n > '1'; n-- {
+				if prev, ok := e.registers[n-1]; ok {
+					_ = e.setRegister(n, prev)
+				}
+			}
+			err = e.setRegister('1', r)
+		default:
+			err = e.setRegister(SmallDeleteRegister, r)
+		}
+	case unicode.IsUpper(name):
+		name = unicode.ToLower(name)
+		if prev, ok := e.registers[name]; ok {
+			r = appendRegister(prev, r)
+		}
+		err = e.setRegister(name, r)
+	default:
+		err = e.setRegister(name, r)
+	}
+	if err != nil {
+		e.message = err.Error()
+	}
+	_ = e.setRegister(UnnamedRegister, r)
+}
+
+// appendRegister appends r to prev. Appending lines to a register makes it
+// linewise.
+func appendRegister(prev, r Register) Register {
+	if prev.Linewise || r.Linewise {
+		return Register{Text: prev.Text + "\n" + r.Text, Linewise: true}
+	}
+	return Register{Text: prev.Text + r.Text, Blockwise: prev.Blockwise}
+}
+
+// readRegister returns the content of the register named by the command being
+// run, or of the unnamed register.
+func (e *Engine) readRegister() Register {
+	name := e.cmd.register
+	if name == 0 {
+		name = UnnamedRegister
+	}
+	return e.Register(name)
+}
+
+// put puts the content of a register count times after the cursor, or before
+// it if before is set, as "p" and "P" do.
+func (e *Engine) put(r Register, count int, before bool) {
+	if r.Text == "" && !r.Linewise {
+		return
+	}
+	switch {
+	case r.Linewise:
+		e.putLines(r.Text, count, before)
+	case r.Blockwise:
+		e.putBlock(r.Text, count, before)
+	default:
+		p := e.cursor()
+		if !before && len(e.line(p.Row)) > 0 {
+			p.Col++
+			e.setCursor(p)
+		}
+		text := strings.Repeat(r.Text, count)
+		e.insert(text)
+		// The cursor ends on the last character put, or at the start of
+		// text spanning several lines.
+		if strings.Contains(text, "\n") {
+			e.setCursor(p)
+		} else {
+			end := e.cursor()
+			e.setCursor(Pos{end.Row, end.Col - 1})
+		}
+	}
+}
+
+// putLines puts text as whole lines below the cursor line, or above it if
+// before is set.
+func (e *Engine) putLines(text string, count int, before bool) {
+	text = strings.Repeat(text+"\n", count)
+	row := e.cursor().Row
+	if before {
+		e.replace(Pos{row, 0}, Pos{row, 0}, text)
+	} else {
+		end := len(e.line(row))
+		e.replace(Pos{row, end}, Pos{row, end}, "\n"+strings.TrimSuffix(text, "\n"))
+		row++
+	}
+	e.setCursor(Pos{row, firstNonBlank(e.line(row))})
+}
+
+// putBlock puts text as a block after the cursor, or before it if before is
+// set. Lines too short to reach the block are padded with spaces.
+func (e *Engine) putBlock(text string, count int, before bool) {
+	p := e.cursor()
+	col := p.Col
+	if !before && len(e.line(p.Row)) > 0 {
+		col++
+	}
+	for i, l := range strings.Split(text, "\n") {
+		row := p.Row + i
+		if row == e.lineCount() {
+			last := e.lineCount() - 1
+			end := Pos{last, len(e.line(last))}
+			e.replace(end, end, "\n")
+		}
+		line := slices.Clone(e.line(row))
+		if len(line) < col {
+			line = append(line, []rune(strings.Repeat(" ", col-len(line)))...)
+		}
+		e.setLine(row, slices.Insert(line, col, []rune(strings.Repeat(l, count))...))
+	}
+	e.setCursor(Pos{p.Row, col})
+}
+
+// visualPut replaces the visual selection with the content of a register.
+// The replaced text is stored in the registers like a deletion.
+func (e *Engine) visualPut(count int) {
+	r := e.readRegister()
+	sel, _ := e.selection()
+	// The replaced text goes to the unnamed register, not the one read.
+	e.cmd.register = 0
+	e.setMode(ModeNormal)
+
+	switch sel.Mode {
+	case ModeVisualLine:
+		e.applyLinewise("d", sel.Start.Row, sel.End.Row)
+		// Lines replace lines, so charwise text is put on a line of its
+		// own.
+		r.Linewise, r.Blockwise = true, false
+		if sel.Start.Row >= e.lineCount() {
+			e.put(r, count, false)
+		} else {
+			e.setCursor(Pos{sel.Start.Row, 0})
+			e.put(r, count, true)
+		}
+	case ModeVisualBlock:
+		e.applyBlock("d", sel, 1)
+		e.put(r, count, true)
+	default:
+		start, end := e.charwiseRange(sel)
+		e.applyOperator("d", start, end, exclusive)
+		// Text deleted up to the end of the line leaves the cursor before
+		// where it was, so put after it.
+		atEnd := start.Col >= len(e.line(start.Row)) && start.Col > 0
+		if atEnd {
+			e.setCursor(Pos{start.Row, start.Col - 1})
+		}
+		e.put(r, count, !atEnd)
+	}
+	e.finishCommand(0, true)
+}
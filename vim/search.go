@@ -0,0 +1,434 @@
+package vim
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"unicode/utf8"
+
+	tea "charm.land/bubbletea/v2"
+)
+
+// searchState holds the last search pattern and the search being typed on the
+// "/" or "?" command line.
+type searchState struct {
+	// pattern is the last search pattern, repeated by n and N, and re is
+	// its compiled form, compiled with ignoreCase as the IgnoreCase option.
+	// backward is set if it was searched for with "?" or "#".
+	pattern    string
+	re         *regexp.Regexp
+	ignoreCase bool
+	backward   bool
+
+	// highlight is set while the matches of the last pattern are
+	// highlighted. ClearSearchHighlight clears it until the next search.
+	highlight bool
+
+	// typing is set while a pattern is typed on the command line.
+	typing bool
+
+	// origin is the cursor position when the search was started, from is
+	// the mode it was started from and count is the count typed before it.
+	origin Pos
+	from   Mode
+	count  int
+
+	// preview is the pattern being typed, highlighted while typing. It's nil
+	// if the pattern is empty or invalid.
+	preview *regexp.Regexp
+}
+
+// SearchPattern returns the last search pattern.
+func (e *Engine) SearchPattern() string {
+	return e.search.pattern
+}
+
+// SetSearchPattern makes pattern the last search pattern, repeated by n and
+// N, and highlights its matches, without searching for it.
+func (e *Engine) SetSearchPattern(pattern string) error {
+	return e.setSearch(pattern, e.search.backward)
+}
+
+// Search searches for the next match of a regular expression, like "/" does,
+// and moves the cursor to it. If backward is set, it searches backwards like
+// "?" does. The pattern is remembered for n and N.
+func (e *Engine) Search(ed Editor, pattern string, backward bool) error {
+	e.ed = ed
+	if err := e.setSearch(pattern, backward); err != nil {
+		return err
+	}
+	p, err := e.findMatch(e.cursor(), backward, 1)
+	if err != nil {
+		return err
+	}
+	e.setCursor(p)
+	e.clampNormalCursor()
+	e.wantCol = e.cursor().Col
+	return nil
+}
+
+// ClearSearchHighlight stops highlighting the matches of the last search
+// until the next one, like :nohlsearch.
+func (e *Engine) ClearSearchHighlight() {
+	e.search.highlight = false
+}
+
+// SearchMatches returns the start and end columns of the matches to
+// highlight in a line: those of the pattern being typed on the command line,
+// or else of the last search pattern if HighlightSearch is set.
+func (e *Engine) SearchMatches(line []rune) [][2]int {
+	s := &e.search
+	switch {
+	case s.preview != nil:
+		return lineMatches(s.preview, line)
+	case s.re != nil && s.highlight && e.HighlightSearch && !s.typing:
+		return lineMatches(e.lastRegexp(), line)
+	}
+	return nil
+}
+
+// Searching reports whether a search pattern is being typed on the command
+// line, as opposed to an ex command.
+func (e *Engine) Searching() bool {
+	return e.search.typing
+}
+
+// PreviewSearch moves the cursor to the first match of the pattern typed so
+// far on the command line and highlights its matches. The cursor stays where
+// the search started if there is no match.
+func (e *Engine) PreviewSearch(ed Editor, pattern string) {
+	e.ed = ed
+	s := &e.search
+	if !s.typing {
+		return
+	}
+	e.setCursor(s.origin)
+	s.preview = nil
+	if pattern == "" {
+		return
+	}
+	re, err := e.searchRegexp(pattern)
+	if err != nil {
+		return
+	}
+	s.preview = re
+	if p, ok := e.findPattern(re, s.origin, s.backward, max(s.count, 1)); ok {
+		e.setCursor(p)
+	}
+}
+
+// ExecuteSearch searches for the pattern typed on the command line and
+// closes it. The search is the motion of the command it was typed in, such
+// as "d/foo".
+func (e *Engine) ExecuteSearch(ed Editor, pattern string) tea.Cmd {
+	e.ed = ed
+	backward := e.search.backward
+	e.leaveSearch()
+	if err := e.setSearch(pattern, backward); err != nil {
+		e.message = err.Error()
+		e.cmd = command{}
+		return nil
+	}
+	// It's recorded as "n" so that "." repeats it without the command line.
+	if n := len(e.keys); n > 0 && !e.replaying {
+		e.keys[n-1] = tea.KeyPressMsg{Code: 'n', Text: "n"}
+	}
+	return e.runMotion(tea.KeyPressMsg{}, "n", 0, e.search.count)
+}
+
+// CloseCommandLine tells the engine that the command line was closed without
+// running what was typed, or after running an ex command. A search that was
+// being typed is cancelled: the cursor goes back to where it was and the mode
+// the search was started from is restored. Otherwise, the engine returns to
+// normal mode.
+func (e *Engine) CloseCommandLine(ed Editor) {
+	e.ed = ed
+	if !e.search.typing {
+		e.SetNormalMode(ed)
+		return
+	}
+	e.leaveSearch()
+	e.cmd = command{}
+}
+
+// leaveSearch stops typing a search pattern, moving the cursor back to where
+// the search started and restoring the mode it was started from.
+func (e *Engine) leaveSearch() {
+	s := &e.search
+	s.typing = false
+	s.preview = nil
+	e.setCursor(s.origin)
+	e.setMode(s.from)
+}
+
+// enterCommandLine opens the ":" command line. In visual mode, the command
+// line starts with the range of the selected lines, and with a count, with
+// the range of count lines.
+func (e *Engine) enterCommandLine(count int) tea.Cmd {
+	cl, ok := e.ed.(CommandLine)
+	if !ok {
+		e.cmd = command{}
+		return nil
+	}
+	var text string
+	switch {
+	case e.mode.Visual():
+		text = "'<,'>"
+	case count == 1:
+		text = "."
+	case count > 1:
+		text = fmt.Sprintf(".,.+%d", count-1)
+	}
+	e.cmd = command{}
+	e.setMode(ModeCommand)
+	return cl.OpenCommandLine(":", text)
+}
+
+// enterSearch opens the command line to type a search pattern. The pending
+// operator, count and visual selection are kept until the search is done,
+// as the search is their motion.
+func (e *Engine) enterSearch(backward bool, count int) tea.Cmd {
+	cl, ok := e.ed.(CommandLine)
+	if !ok {
+		e.cmd = command{}
+		return nil
+	}
+	prompt := "/"
+	if backward {
+		prompt = "?"
+	}
+	s := &e.search
+	s.typing = true
+	s.backward = backward
+	s.origin = e.cursor()
+	s.from = e.mode
+	s.count = count
+	s.preview = nil
+	e.setMode(ModeCommand)
+	return cl.OpenCommandLine(prompt, "")
+}
+
+// setSearch makes pattern the last search pattern. An empty pattern repeats
+// the last one.
+func (e *Engine) setSearch(pattern string, backward bool) error {
+	s := &e.search
+	if pattern == "" {
+		if s.re == nil {
+			return errors.New("E35: No previous regular expression")
+		}
+		pattern = s.pattern
+	}
+	re, err := e.searchRegexp(pattern)
+	if err != nil {
+		return err
+	}
+	s.pattern, s.re, s.ignoreCase, s.backward = pattern, re, e.IgnoreCase, backward
+	s.highlight = true
+	return nil
+}
+
+// lastRegexp returns the compiled last search pattern, compiled again if the
+// IgnoreCase option changed since.
+func (e *Engine) lastRegexp() *regexp.Regexp {
+	s := &e.search
+	if s.re != nil && s.ignoreCase != e.IgnoreCase {
+		if re, err := e.searchRegexp(s.pattern); err == nil {
+			s.re, s.ignoreCase = re, e.IgnoreCase
+		}
+	}
+	return s.re
+}
+
+// searchRegexp compiles a search pattern, ignoring case if the IgnoreCase
+// option is set.
+func (e *Engine) searchRegexp(pattern string) (*regexp.Regexp, error) {
+	expr := pattern
+	if e.IgnoreCase {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("E383: Invalid search string: %s", pattern)
+	}
+	return re, nil
+}
+
+// searchMotion returns the position of the count-th match of the last search
+// pattern, as n does. If reverse is set, it searches in the opposite
+// direction, as N does.
+func (e *Engine) searchMotion(reverse bool, count int) (Pos, motionKind, bool) {
+	p := e.cursor()
+	if e.search.re == nil {
+		e.message = "E35: No previous regular expression"
+		return p, exclusive, false
+	}
+	e.search.highlight = true
+	target, err := e.findMatch(p, e.search.backward != reverse, count)
+	if err != nil {
+		e.message = err.Error()
+		return p, exclusive, false
+	}
+	return target, exclusive, true
+}
+
+// wordSearchMotion searches for the keyword under or after the cursor, as *
+// and # do.
+func (e *Engine) wordSearchMotion(backward bool, count int) (Pos, motionKind, bool) {
+	p := e.cursor()
+	line := e.line(p.Row)
+	col := p.Col
+	for col < len(line) && charClass(line[col], false) != classWord {
+		col++
+	}
+	if col == len(line) {
+		e.message = "E348: No string under cursor"
+		return p, exclusive, false
+	}
+	start, end := wordAt(line, col, func(r rune) bool {
+		return charClass(r, false) == classWord
+	})
+	word := string(line[start:end])
+
+	// Only match whole words. \b only knows about ASCII word characters,
+	// so other words may match inside longer ones.
+	pattern := regexp.QuoteMeta(word)
+	if isASCII(word) {
+		pattern = `\b` + pattern + `\b`
+	}
+	if err := e.setSearch(pattern, backward); err != nil {
+		e.message = err.Error()
+		return p, exclusive, false
+	}
+	// Start from the start of the word, so that a backward search doesn't
+	// find the word under the cursor.
+	target, err := e.findMatch(Pos{p.Row, start}, backward, count)
+	if err != nil {
+		e.message = err.Error()
+		return p, exclusive, false
+	}
+	return target, exclusive, true
+}
+
+// findMatch returns the count-th match of the last search pattern after p, or
+// before it if backward is set. If the search wraps around, the message says
+// so.
+func (e *Engine) findMatch(p Pos, backward bool, count int) (Pos, error) {
+	s := &e.search
+	target, wrapped, ok := e.searchFrom(e.lastRegexp(), p, backward, count)
+	switch {
+	case !ok && !e.WrapScan && backward:
+		return p, errors.New("E384: Search hit TOP without match for: " + s.pattern)
+	case !ok && !e.WrapScan:
+		return p, errors.New("E385: Search hit BOTTOM without match for: " + s.pattern)
+	case !ok:
+		return p, errors.New("E486: Pattern not found: " + s.pattern)
+	case wrapped && backward:
+		e.message = "search hit TOP, continuing at BOTTOM"
+	case wrapped:
+		e.message = "search hit BOTTOM, continuing at TOP"
+	}
+	return target, nil
+}
+
+// findPattern is like findMatch for a pattern other than the last one, and
+// doesn't set the message.
+func (e *Engine) findPattern(re *regexp.Regexp, p Pos, backward bool, count int) (Pos, bool) {
+	target, _, ok := e.searchFrom(re, p, backward, count)
+	return target, ok
+}
+
+// searchFrom returns the start of the count-th match of re after p, or before
+// it if backward is set. wrapped tells whether the search went past the end
+// of the buffer and continued from the other end, which it only does if the
+// WrapScan option is set.
+func (e *Engine) searchFrom(re *regexp.Regexp, p Pos, backward bool, count int) (target Pos, wrapped, ok bool) {
+	for range max(count, 1) {
+		next, w, found := e.nextMatch(re, p, backward)
+		if !found {
+			return p, wrapped, false
+		}
+		p, wrapped = next, wrapped || w
+	}
+	return p, wrapped, true
+}
+
+// nextMatch returns the start of the first match of re after p, or the last
+// one before it if backward is set.
+func (e *Engine) nextMatch(re *regexp.Regexp, p Pos, backward bool) (Pos, bool, bool) {
+	n := e.lineCount()
+	// The line of p is searched twice: first the part after p, and last,
+	// after wrapping around, the part before it.
+	for i := 0; i <= n; i++ {
+		row := p.Row + i
+		if backward {
+			row = p.Row - i
+		}
+		wrapped := row < 0 || row >= n
+		if wrapped && !e.WrapScan {
+			break
+		}
+		row = (row + n) % n
+
+		matches := lineMatches(re, e.line(row))
+		if backward {
+			for j := len(matches) - 1; j >= 0; j-- {
+				col := matches[j][0]
+				if (i == 0 && col < p.Col) || (i == n && col >= p.Col) || (i > 0 && i < n) {
+					return Pos{row, col}, wrapped, true
+				}
+			}
+			continue
+		}
+		for _, match := range matches {
+			col := match[0]
+			if (i == 0 && col > p.Col) || (i == n && col <= p.Col) || (i > 0 && i < n) {
+				return Pos{row, col}, wrapped, true
+			}
+		}
+	}
+	return p, false, false
+}
+
+// lineMatches returns the start and end columns of the matches of re in a
+// line.
+func lineMatches(re *regexp.Regexp, line []rune) [][2]int {
+	str := string(line)
+	indexes := re.FindAllStringIndex(str, -1)
+	if len(indexes) == 0 {
+		return nil
+	}
+	matches := make([][2]int, 0, len(indexes))
+	col, prev := 0, 0
+	for _, idx := range indexes {
+		col += utf8.RuneCountInString(str[prev:idx[0]])
+		start := col
+		col += utf8.RuneCountInString(str[idx[0]:idx[1]])
+		prev = idx[1]
+		matches = append(matches, [2]int{start, col})
+	}
+	return matches
+}
+
+// wordAt returns the start and end of the word around col in line, made of
+// the runes for which inWord returns true.
+func wordAt(line []rune, col int, inWord func(rune) bool) (int, int) {
+	start := col
+	for start > 0 && inWord(line[start-1]) {
+		start--
+	}
+	end := col
+	for end < len(line) && inWord(line[end]) {
+		end++
+	}
+	return start, end
+}
+
+// isASCII reports whether s only contains ASCII characters.
+func isASCII(s string) bool {
+	for i := range len(s) {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
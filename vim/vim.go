@@ -0,0 +1,963 @@
+// Package vim provides a Vim-style modal editing engine for Bubble Tea
+// components.
+//
+// An [Engine] holds the editing mode, the command being typed with its count
+// and register, the registers, the last search and what's needed to repeat
+// the last change. It drives any text component that implements [Editor]:
+// keys typed in insert mode are passed on to the component, while keys typed
+// in the other modes are interpreted as Vim commands, operators and motions.
+//
+// Components can implement more interfaces to support more commands: [History]
+// for undo and redo, [Pager] for scrolling by pages, [CommandLine] for the
+// ":", "/" and "?" command lines, [ReadOnlyEditor] to refuse changes and
+// [Folder] for the "z" fold commands.
+package vim
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	tea "charm.land/bubbletea/v2"
+	"github.com/haochend413/bubbles/v2/key"
+)
+
+const defaultShiftWidth = 4
+
+// defaultTextWidth is the width the gq operator formats lines to when
+// TextWidth isn't set, like Vim does.
+const defaultTextWidth = 79
+
+// tabStop is the distance between the tab stops of the indentation of lines
+// formatted by gq, Vim's default.
+const tabStop = 8
+
+// Mode is a Vim editing mode.
+type Mode int
+
+// Available modes.
+const (
+	// ModeNormal is Vim's normal mode. Keys are interpreted as commands,
+	// operators and motions.
+	ModeNormal Mode = iota
+
+	// ModeInsert is the mode in which typed text is inserted into the buffer.
+	ModeInsert
+
+	// ModeVisual selects text characterwise.
+	ModeVisual
+
+	// ModeVisualLine selects whole lines.
+	ModeVisualLine
+
+	// ModeVisualBlock selects a rectangular block of text.
+	ModeVisualBlock
+
+	// ModeCommand is the mode in which an ex command or a search pattern is
+	// typed on the command line.
+	ModeCommand
+)
+
+// String returns the name of the mode as shown in a statusbar.
+func (m Mode) String() string {
+	switch m {
+	case ModeNormal:
+		return "NORMAL"
+	case ModeInsert:
+		return "INSERT"
+	case ModeVisual:
+		return "VISUAL"
+	case ModeVisualLine:
+		return "V-LINE"
+	case ModeVisualBlock:
+		return "V-BLOCK"
+	case ModeCommand:
+		return "COMMAND"
+	default:
+		return ""
+	}
+}
+
+// Visual reports whether m is one of the visual modes.
+func (m Mode) Visual() bool {
+	return m == ModeVisual || m == ModeVisualLine || m == ModeVisualBlock
+}
+
+// Pos is a position in the buffer of an [Editor]. Rows and columns count
+// lines and runes from 0.
+type Pos struct {
+	Row, Col int
+}
+
+// Before reports whether p comes before q in the buffer.
+func (p Pos) Before(q Pos) bool {
+	return p.Row < q.Row || (p.Row == q.Row && p.Col < q.Col)
+}
+
+// Editor is a text component driven by an [Engine].
+type Editor interface {
+	// LineCount returns the number of lines in the buffer, at least 1.
+	LineCount() int
+
+	// Line returns the characters of a line. The engine doesn't modify the
+	// returned slice.
+	Line(row int) []rune
+
+	// Cursor returns the cursor position.
+	Cursor() Pos
+
+	// SetCursor moves the cursor. Positions out of bounds are clamped to
+	// the buffer.
+	SetCursor(p Pos)
+
+	// Replace replaces the text from start up to end, exclusive, with text,
+	// whose lines are separated by newlines. The engine moves the cursor
+	// afterwards.
+	Replace(start, end Pos, text string)
+
+	// Key handles the keys typed in insert mode, and the keys that aren't
+	// Vim commands in the other modes, such as arrow keys or page keys.
+	// Outside of insert mode, it must not change the text.
+	Key(msg tea.KeyPressMsg) tea.Cmd
+}
+
+// History is implemented by editors that can undo and redo changes.
+type History interface {
+	// BeginChange starts a change, made of the edits until EndChange is
+	// called, that is undone in a single step. It does nothing if a change
+	// has already begun.
+	BeginChange()
+
+	// EndChange completes the change started by BeginChange.
+	EndChange()
+
+	// Undo reverts the last change.
+	Undo()
+
+	// Redo reapplies the last undone change.
+	Redo()
+}
+
+// Pager is implemented by editors that scroll by pages with ctrl+f and
+// ctrl+b, and by half pages with ctrl+d and ctrl+u.
+type Pager interface {
+	// PageHeight returns the number of lines in a page.
+	PageHeight() int
+}
+
+// CommandLine is implemented by editors that have a command line to type ex
+// commands after ":", and search patterns after "/" and "?".
+//
+// While the command line is open, the engine is in [ModeCommand] and keys are
+// expected to go to the command line rather than to [Engine.HandleKey]. The
+// editor reports what's typed with [Engine.PreviewSearch],
+// [Engine.ExecuteSearch] and [Engine.CloseCommandLine].
+type CommandLine interface {
+	// OpenCommandLine opens the command line with the given prompt, which
+	// is ":", "/" or "?", and text.
+	OpenCommandLine(prompt, text string) tea.Cmd
+}
+
+// ReadOnlyEditor is implemented by editors whose text may not be changed.
+// Motions, searches, visual mode and yanking still work.
+type ReadOnlyEditor interface {
+	// ReadOnly reports whether the text may not be changed.
+	ReadOnly() bool
+}
+
+// Folder is implemented by editors that fold lines. The engine opens, closes
+// and toggles folds with "zo", "zc" and "za", and all of them with "zR" and
+// "zM", and "j" and "k" move over closed folds.
+type Folder interface {
+	// ToggleFold opens the closed fold a row is in, or if there's none,
+	// closes the innermost fold it's in.
+	ToggleFold(row int)
+
+	// OpenFold opens the outermost closed fold a row is in.
+	OpenFold(row int)
+
+	// CloseFold closes the innermost open fold a row is in.
+	CloseFold(row int)
+
+	// OpenAllFolds opens all folds.
+	OpenAllFolds()
+
+	// CloseAllFolds closes all folds.
+	CloseAllFolds()
+
+	// ClosedFold returns the first and last rows of the closed fold that
+	// hides the rows after its first one, if row is inside one.
+	ClosedFold(row int) (start, end int, ok bool)
+}
+
+// KeyMap is the key bindings that switch modes.
+type KeyMap struct {
+	// EnterInsertMode enters insert mode from normal mode, like "i".
+	EnterInsertMode key.Binding
+
+	// EnterNormalMode leaves insert and visual modes, and cancels the
+	// command being typed.
+	EnterNormalMode key.Binding
+}
+
+// DefaultKeyMap returns the default key bindings.
+func DefaultKeyMap() KeyMap {
+	return KeyMap{
+		EnterInsertMode: key.NewBinding(key.WithKeys("i"), key.WithHelp("i", "insert mode")),
+		EnterNormalMode: key.NewBinding(key.WithKeys("esc"), key.WithHelp("esc", "normal mode")),
+	}
+}
+
+// motionKind describes how the text between the cursor and the target of a
+// motion is selected when the motion is used after an operator.
+type motionKind int
+
+const (
+	// exclusive motions don't include the character at the target.
+	exclusive motionKind = iota
+
+	// inclusive motions include the character at the target.
+	inclusive
+
+	// linewise motions operate on whole lines.
+	linewise
+)
+
+// command is the normal mode command being typed.
+type command struct {
+	// count is the count typed before an operator or command.
+	count int
+
+	// opCount is the count typed between an operator and its motion.
+	opCount int
+
+	// operator is the pending operator, if any.
+	operator string
+
+	// pending is a key waiting for another key to complete it, such as the
+	// "g" of "gg" or the "f" of "fx".
+	pending string
+
+	// register is the register named with '"' for the command, or 0 if none
+	// was.
+	register rune
+}
+
+// Engine is a Vim editing engine. Create one with [New] and pass it the keys
+// typed in an [Editor] with [Engine.HandleKey].
+type Engine struct {
+	// KeyMap holds the keys that switch modes.
+	KeyMap KeyMap
+
+	// ShiftWidth is the number of spaces the > and < operators indent or
+	// outdent lines by.
+	ShiftWidth int
+
+	// TextWidth is the width that the gq operator formats lines to. If 0 or
+	// less, it's 79.
+	TextWidth int
+
+	// IgnoreCase makes searches ignore case.
+	IgnoreCase bool
+
+	// WrapScan makes searches continue from the other end of the buffer when
+	// they reach one end.
+	WrapScan bool
+
+	// HighlightSearch makes [Engine.SearchMatches] return the matches of the
+	// last search, for editors to highlight them.
+	HighlightSearch bool
+
+	// Clipboard is read and written by the "+ and "* registers.
+	Clipboard Clipboard
+
+	// ed is the editor of the call being handled.
+	ed Editor
+
+	// mode is the current editing mode.
+	mode Mode
+
+	// cmd is the normal mode command being typed.
+	cmd command
+
+	// wantCol is the column the cursor tries to keep while moving vertically.
+	wantCol int
+
+	// lastFind and lastFindChar hold the last f, t, F or T search so that it
+	// can be repeated with ";" and ",".
+	lastFind     string
+	lastFindChar rune
+
+	// keys are the keys of the command currently being typed.
+	keys []tea.KeyPressMsg
+
+	// recording is set while the keys typed in insert mode belong to the
+	// change that entered insert mode.
+	recording bool
+
+	// lastChange and lastCount are the keys and count of the last change,
+	// replayed by ".".
+	lastChange []tea.KeyPressMsg
+	lastCount  int
+
+	// replaying is set while "." replays the last change.
+	replaying bool
+
+	// registers holds the content of the registers, other than the
+	// clipboard.
+	registers map[rune]Register
+
+	// anchor is the end of the visual selection opposite to the cursor.
+	anchor Pos
+
+	// blockInsert is the insert started by "c" in visual block mode, which
+	// is copied to the other lines of the block when insert mode is left.
+	blockInsert *blockInsert
+
+	// lastVisual is the last visual selection, marked by '< and '>.
+	lastVisual Selection
+
+	// search holds the last search pattern and the search being typed.
+	search searchState
+
+	// message is a message for the editor to show, such as an error.
+	message string
+}
+
+// New returns an engine in normal mode with the default settings.
+func New() *Engine {
+	return &Engine{
+		KeyMap:          DefaultKeyMap(),
+		ShiftWidth:      defaultShiftWidth,
+		WrapScan:        true,
+		HighlightSearch: true,
+		Clipboard:       SystemClipboard,
+	}
+}
+
+// Mode returns the current editing mode.
+func (e *Engine) Mode() Mode {
+	return e.mode
+}
+
+// SetInsertMode switches to insert mode. It does nothing if the editor is
+// read-only.
+func (e *Engine) SetInsertMode(ed Editor) {
+	e.ed = ed
+	if e.readOnly() {
+		return
+	}
+	e.setMode(ModeInsert)
+}
+
+// SetNormalMode switches to normal mode, discarding the command being typed.
+func (e *Engine) SetNormalMode(ed Editor) {
+	e.ed = ed
+	e.cmd = command{}
+	e.setMode(ModeNormal)
+	e.clampNormalCursor()
+	e.wantCol = e.cursor().Col
+}
+
+// Message returns the message for the editor to show in place of a
+// statusbar, such as an error or the search wrapping around. It's cleared by
+// the next key press.
+func (e *Engine) Message() string {
+	return e.message
+}
+
+// SetMessage sets the message returned by [Engine.Message].
+func (e *Engine) SetMessage(msg string) {
+	e.message = msg
+}
+
+// Pending returns the keys of the command being typed, such as `"a2d` while
+// a motion is awaited, or an empty string if none is.
+func (e *Engine) Pending() string {
+	c := e.cmd
+	var b strings.Builder
+	if c.register != 0 {
+		b.WriteString(`"` + string(c.register))
+	}
+	if c.count > 0 {
+		b.WriteString(strconv.Itoa(c.count))
+	}
+	b.WriteString(c.operator)
+	if c.opCount > 0 {
+		b.WriteString(strconv.Itoa(c.opCount))
+	}
+	b.WriteString(c.pending)
+	return b.String()
+}
+
+// Sync brings the engine up to date with changes made to the editor other
+// than through the engine, such as by an ex command: in normal mode, the
+// cursor is kept on a character, and vertical motions keep its column.
+func (e *Engine) Sync(ed Editor) {
+	e.ed = ed
+	e.clampNormalCursor()
+	e.wantCol = e.cursor().Col
+}
+
+// HandleKey handles a key typed in the editor, in any mode but
+// [ModeCommand], where keys go to the editor's command line.
+func (e *Engine) HandleKey(ed Editor, msg tea.KeyPressMsg) tea.Cmd {
+	e.ed = ed
+	e.message = ""
+	return e.handleKey(msg)
+}
+
+// Paste inserts pasted text at the cursor. Outside of insert mode, the paste
+// is a change of its own.
+func (e *Engine) Paste(ed Editor, text string) {
+	e.ed = ed
+	if e.readOnly() {
+		return
+	}
+	e.recordInsert(tea.KeyPressMsg{Text: text})
+	e.beginChange()
+	e.insert(text)
+	if e.mode != ModeInsert {
+		e.endChange()
+		e.clampNormalCursor()
+		e.wantCol = e.cursor().Col
+	}
+}
+
+// setMode switches modes.
+func (e *Engine) setMode(mode Mode) {
+	// Remember the selection when leaving visual mode, for the '< and '>
+	// marks.
+	if sel, ok := e.selection(); ok && !mode.Visual() {
+		e.lastVisual = sel
+	}
+	e.mode = mode
+}
+
+// handleKey dispatches a key press to the handler of the current mode.
+func (e *Engine) handleKey(msg tea.KeyPressMsg) tea.Cmd {
+	switch e.mode {
+	case ModeInsert:
+		return e.insertKey(msg)
+	case ModeCommand:
+		return nil
+	}
+	return e.normalKey(msg)
+}
+
+// insertKey handles a key press in insert mode.
+func (e *Engine) insertKey(msg tea.KeyPressMsg) tea.Cmd {
+	e.recordInsert(msg)
+	e.beginChange()
+	if key.Matches(msg, e.KeyMap.EnterNormalMode) {
+		e.finishInsert()
+		// Like Vim, leaving insert mode moves the cursor back onto the
+		// last inserted character.
+		p := e.cursor()
+		e.setCursor(Pos{p.Row, prevChars(e.line(p.Row), p.Col, 1)})
+		e.SetNormalMode(e.ed)
+		return nil
+	}
+	return e.ed.Key(msg)
+}
+
+// recordInsert records a key typed in insert mode as part of the change being
+// recorded for ".".
+func (e *Engine) recordInsert(msg tea.KeyPressMsg) {
+	if e.mode == ModeInsert && e.recording && !e.replaying {
+		e.keys = append(e.keys, msg)
+	}
+}
+
+// finishInsert completes the change that entered insert mode, if any.
+func (e *Engine) finishInsert() {
+	if e.recording && !e.replaying {
+		e.lastChange = e.keys
+	}
+	e.recording = false
+	e.finishBlockInsert()
+	if !e.replaying {
+		e.endChange()
+	}
+}
+
+// finishCommand is called once a normal mode command is complete. change
+// tells whether the command modified the buffer and should be repeatable
+// with ".". count is the count typed before the command, which is multiplied
+// by the one typed after its operator, if any.
+func (e *Engine) finishCommand(count int, change bool) {
+	if e.cmd.opCount > 0 {
+		count = multiplyCount(max(count, 1), e.cmd.opCount)
+	}
+	e.cmd = command{}
+	if change && !e.replaying {
+		e.lastCount = count
+		if e.mode == ModeInsert {
+			// Keep recording until insert mode is left.
+			e.recording = true
+		} else {
+			e.lastChange = e.keys
+			e.endChange()
+		}
+	}
+	e.clampNormalCursor()
+	e.wantCol = e.cursor().Col
+}
+
+// maxCount is the largest count, like in Vim: larger counts are cut down to
+// it.
+const maxCount = 999999999
+
+// multiplyCount returns the count of a command typed with counts both before
+// and after its operator, such as "2d3w", up to maxCount.
+func multiplyCount(a, b int) int {
+	if a > maxCount/b {
+		return maxCount
+	}
+	return min(a*b, maxCount)
+}
+
+// idle reports whether no command is being typed.
+func (e *Engine) idle() bool {
+	return e.cmd == command{}
+}
+
+// normalKey handles a key press in normal and visual modes.
+func (e *Engine) normalKey(msg tea.KeyPressMsg) tea.Cmd {
+	c := &e.cmd
+	k := msg.String()
+
+	// A visual mode change is recorded from the key that entered visual
+	// mode, so only start a new recording from normal mode.
+	newCommand := e.idle() && e.mode == ModeNormal
+	if newCommand && !e.replaying {
+		e.endChange()
+		e.beginChange()
+	}
+
+	// Count digits. A "0" that doesn't continue a count is a motion.
+	if d, err := strconv.Atoi(k); err == nil && len(k) == 1 && c.pending == "" && (d > 0 || c.count > 0 || c.opCount > 0) {
+		if newCommand {
+			e.keys = nil
+		}
+		// Counts aren't recorded with the keys of the change: "." replays
+		// them with the count of the whole change, or the one typed before it.
+		if c.operator != "" {
+			c.opCount = min(c.opCount*10+d, maxCount)
+		} else {
+			c.count = min(c.count*10+d, maxCount)
+		}
+		return nil
+	}
+
+	if newCommand {
+		e.keys = nil
+	}
+	if !e.replaying {
+		e.keys = append(e.keys, msg)
+	}
+
+	if key.Matches(msg, e.KeyMap.EnterNormalMode) {
+		e.cmd = command{}
+		if e.mode.Visual() {
+			e.SetNormalMode(e.ed)
+		}
+		return nil
+	}
+
+	count := c.count
+	if c.opCount > 0 {
+		count = multiplyCount(max(count, 1), c.opCount)
+	}
+
+	// Complete commands that were waiting for another key.
+	if c.pending != "" {
+		prefix := c.pending
+		c.pending = ""
+		switch prefix {
+		case "f", "t", "F", "T":
+			r := []rune(msg.Text)
+			if len(r) != 1 {
+				e.cmd = command{}
+				return nil
+			}
+			e.lastFind, e.lastFindChar = prefix, r[0]
+			return e.runMotion(msg, prefix, r[0], count)
+		case `"`:
+			r := []rune(msg.Text)
+			if len(r) != 1 || !validRegister(r[0]) {
+				e.cmd = command{}
+				return nil
+			}
+			c.register = r[0]
+		case "g":
+			switch k {
+			case "g":
+				return e.runMotion(msg, "gg", 0, count)
+			case "~", "u", "U":
+				if c.operator == "" && !e.mode.Visual() && !e.readOnly() {
+					c.operator = "g" + k
+					return nil
+				}
+				e.cmd = command{}
+			case "q":
+				switch {
+				case e.readOnly():
+					e.cmd = command{}
+				case e.mode.Visual():
+					e.visualOperator("gq", count)
+				case c.operator == "":
+					c.operator = "gq"
+				case c.operator == "gq":
+					// "gqgq" formats lines like "gqq".
+					e.linewiseOperator(count)
+				default:
+					e.cmd = command{}
+				}
+			default:
+				e.cmd = command{}
+			}
+		case "z":
+			e.foldCommand(k, count)
+		case "i", "a":
+			e.textObject(prefix == "a", k, count)
+		}
+		return nil
+	}
+
+	switch k {
+	case "f", "t", "F", "T", "g", "z", `"`:
+		c.pending = k
+		return nil
+	case "i", "a":
+		// After an operator, "i" and "a" start a text object, such as the
+		// "iw" of "diw".
+		if c.operator != "" {
+			c.pending = k
+			return nil
+		}
+	}
+
+	if k == ":" && c.operator == "" {
+		return e.enterCommandLine(count)
+	}
+	if k == "/" || k == "?" {
+		return e.enterSearch(k == "?", count)
+	}
+
+	if e.mode.Visual() {
+		if !e.visualCommand(k, count) {
+			return e.runMotion(msg, k, 0, count)
+		}
+		return nil
+	}
+
+	switch k {
+	case "d", "c", "y", ">", "<":
+		if c.operator == "" {
+			if k != "y" && e.readOnly() {
+				e.cmd = command{}
+				return nil
+			}
+			c.operator = k
+			return nil
+		}
+		if c.operator == k {
+			e.linewiseOperator(count)
+			return nil
+		}
+		e.cmd = command{}
+		return nil
+	case "~", "u", "U", "q":
+		if strings.HasPrefix(c.operator, "g") && strings.HasSuffix(c.operator, k) {
+			e.linewiseOperator(count)
+			return nil
+		}
+	case ".":
+		if c.operator == "" {
+			e.repeatLastChange(count)
+			return nil
+		}
+	}
+
+	if c.operator == "" {
+		if key.Matches(msg, e.KeyMap.EnterInsertMode) {
+			k = "i"
+		}
+		if e.simpleCommand(k, count) {
+			return nil
+		}
+	}
+
+	return e.runMotion(msg, k, 0, count)
+}
+
+// foldCommand runs the "z" command completed by k, if the editor folds lines.
+func (e *Engine) foldCommand(k string, count int) {
+	f, ok := e.ed.(Folder)
+	if !ok || e.cmd.operator != "" {
+		e.cmd = command{}
+		return
+	}
+	row := e.cursor().Row
+	switch k {
+	case "a":
+		f.ToggleFold(row)
+	case "o":
+		f.OpenFold(row)
+	case "c":
+		f.CloseFold(row)
+	case "R":
+		f.OpenAllFolds()
+	case "M":
+		f.CloseAllFolds()
+	}
+	e.finishCommand(count, false)
+}
+
+// closedFold returns the first and last rows of the closed fold a row is in,
+// if the editor folds lines.
+func (e *Engine) closedFold(row int) (start, end int, ok bool) {
+	if f, ok := e.ed.(Folder); ok {
+		return f.ClosedFold(row)
+	}
+	return 0, 0, false
+}
+
+// linewiseOperator applies the pending operator to count lines, as a doubled
+// operator such as "dd" does.
+func (e *Engine) linewiseOperator(count int) {
+	op := e.cmd.operator
+	row := e.cursor().Row
+	if start, _, ok := e.closedFold(row); ok {
+		row = start
+	}
+	// Closed folds count as one line.
+	last := row
+	for i := 1; i < count && last < e.lineCount()-1; i++ {
+		if _, end, ok := e.closedFold(last); ok {
+			last = end
+		}
+		last = min(e.lineCount()-1, last+1)
+	}
+	if _, end, ok := e.closedFold(last); ok {
+		last = end
+	}
+	e.applyOperator(op, Pos{row, 0}, Pos{last, 0}, linewise)
+	e.finishCommand(e.cmd.count, op != "y")
+}
+
+// editCommands are the commands of simpleCommand that change the text.
+const editCommands = " x X D C s S u ctrl+r ~ p P i a A I o O "
+
+// simpleCommand runs a command that isn't made of an operator and a motion.
+// It returns false if k is not such a command.
+func (e *Engine) simpleCommand(k string, count int) bool {
+	n := max(count, 1)
+	if e.readOnly() && strings.Contains(editCommands, " "+k+" ") {
+		e.finishCommand(count, false)
+		return true
+	}
+	p := e.cursor()
+
+	switch k {
+	case "x":
+		e.operate("d", "l", n)
+		return true
+	case "X":
+		e.operate("d", "h", n)
+		return true
+	case "D":
+		e.operate("d", "$", n)
+		return true
+	case "C":
+		e.operate("c", "$", n)
+		return true
+	case "s":
+		e.operate("c", "l", n)
+		return true
+	case "S":
+		last := min(p.Row+n-1, e.lineCount()-1)
+		e.applyOperator("c", Pos{p.Row, 0}, Pos{last, 0}, linewise)
+	case "u", "ctrl+r":
+		if h, ok := e.ed.(History); ok {
+			e.endChange()
+			for range n {
+				if k == "u" {
+					h.Undo()
+				} else {
+					h.Redo()
+				}
+			}
+		}
+		e.finishCommand(count, false)
+		return true
+	case "~":
+		line := e.line(p.Row)
+		if len(line) == 0 {
+			e.finishCommand(count, false)
+			return true
+		}
+		end := nextChars(line, p.Col, n, len(line))
+		e.mapRange(p, Pos{p.Row, end}, toggleCase)
+		e.setCursor(Pos{p.Row, end})
+	case "p", "P":
+		e.put(e.readRegister(), n, k == "P")
+	case "Y":
+		last := min(p.Row+n-1, e.lineCount()-1)
+		e.applyOperator("y", Pos{p.Row, 0}, Pos{last, 0}, linewise)
+		e.finishCommand(count, false)
+		return true
+	case "i":
+		e.setMode(ModeInsert)
+	case "a":
+		line := e.line(p.Row)
+		e.setCursor(Pos{p.Row, nextChars(line, p.Col, 1, len(line))})
+		e.setMode(ModeInsert)
+	case "A":
+		e.setCursor(Pos{p.Row, len(e.line(p.Row))})
+		e.setMode(ModeInsert)
+	case "I":
+		e.setCursor(Pos{p.Row, firstNonBlank(e.line(p.Row))})
+		e.setMode(ModeInsert)
+	case "v":
+		e.enterVisual(ModeVisual)
+		return true
+	case "V":
+		e.enterVisual(ModeVisualLine)
+		return true
+	case "ctrl+v":
+		e.enterVisual(ModeVisualBlock)
+		return true
+	case "o":
+		e.replace(Pos{p.Row, len(e.line(p.Row))}, Pos{p.Row, len(e.line(p.Row))}, "\n")
+		e.setCursor(Pos{p.Row + 1, 0})
+		e.setMode(ModeInsert)
+	case "O":
+		e.replace(Pos{p.Row, 0}, Pos{p.Row, 0}, "\n")
+		e.setCursor(Pos{p.Row, 0})
+		e.setMode(ModeInsert)
+	default:
+		return false
+	}
+
+	e.finishCommand(count, true)
+	return true
+}
+
+// operate runs an operator with the given motion, such as "dl" for "x".
+func (e *Engine) operate(op, motion string, count int) {
+	e.cmd.operator = op
+	e.runMotion(tea.KeyPressMsg{}, motion, 0, count)
+}
+
+// runMotion moves the cursor with the given motion, or applies the pending
+// operator to the text it moves over. Keys that aren't motions are passed on
+// to the editor, unless an operator is pending.
+func (e *Engine) runMotion(msg tea.KeyPressMsg, k string, char rune, count int) tea.Cmd {
+	op := e.cmd.operator
+	cur := e.cursor()
+
+	target, kind, ok := e.motion(k, char, count, op)
+	if !ok {
+		e.cmd = command{}
+		if op != "" || msg.String() != k {
+			return nil
+		}
+		cmd := e.ed.Key(msg)
+		e.clampNormalCursor()
+		e.wantCol = e.cursor().Col
+		return cmd
+	}
+
+	if op == "" {
+		e.setCursor(target)
+		switch k {
+		case "j", "k", "down", "up", "ctrl+f", "ctrl+b", "ctrl+d", "ctrl+u":
+		case "$":
+			e.wantCol = math.MaxInt
+		default:
+			e.wantCol = e.cursor().Col
+		}
+		e.cmd = command{}
+		e.clampNormalCursor()
+		return nil
+	}
+
+	start, end := cur, target
+	if end.Before(start) {
+		start, end = end, start
+	}
+	e.applyOperator(op, start, end, kind)
+	e.finishCommand(e.cmd.count, op != "y")
+	return nil
+}
+
+// textObject applies the pending operator to the text object completed by k:
+// count words with "w" or "W", followed by the blanks after them if around is
+// set, as "aw" does, or otherwise by nothing, as "iw" does.
+func (e *Engine) textObject(around bool, k string, count int) {
+	op := e.cmd.operator
+	if k != "w" && k != "W" {
+		e.cmd = command{}
+		return
+	}
+	start, end, ok := e.wordObject(e.cursor(), k == "W", around, count)
+	if !ok {
+		e.cmd = command{}
+		return
+	}
+	e.applyOperator(op, start, end, exclusive)
+	e.finishCommand(e.cmd.count, op != "y")
+}
+
+// repeatLastChange replays the last change. A count replaces the count of
+// the original change.
+func (e *Engine) repeatLastChange(count int) {
+	keys := e.lastChange
+	if count == 0 {
+		count = e.lastCount
+	}
+	e.cmd = command{}
+	if len(keys) == 0 || e.readOnly() {
+		return
+	}
+
+	e.replaying = true
+	if count > 0 {
+		for _, r := range strconv.Itoa(count) {
+			e.handleKey(tea.KeyPressMsg{Code: r, Text: string(r)})
+		}
+	}
+	for _, k := range keys {
+		e.handleKey(k)
+	}
+	if e.mode == ModeInsert {
+		e.SetNormalMode(e.ed)
+	}
+	e.replaying = false
+	e.endChange()
+	e.lastCount = count
+	e.clampNormalCursor()
+	e.wantCol = e.cursor().Col
+}
+
+// beginChange starts a change in the editor's history, if it has one.
+func (e *Engine) beginChange() {
+	if h, ok := e.ed.(History); ok {
+		h.BeginChange()
+	}
+}
+
+// endChange completes the change started by beginChange.
+func (e *Engine) endChange() {
+	if h, ok := e.ed.(History); ok {
+		h.EndChange()
+	}
+}
+
+// readOnly reports whether the editor refuses changes.
+func (e *Engine) readOnly() bool {
+	r, ok := e.ed.(ReadOnlyEditor)
+	return ok && r.ReadOnly()
+}
@@ -0,0 +1,260 @@
+package vim
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	tea "charm.land/bubbletea/v2"
+)
+
+// buffer is a minimal Editor keeping its lines in memory.
+type buffer struct {
+	lines    [][]rune
+	cur      Pos
+	engine   *Engine
+	readOnly bool
+	page     int
+	prompt   string
+}
+
+func newBuffer(e *Engine, value string) *buffer {
+	b := &buffer{engine: e}
+	for _, l := range strings.Split(value, "\n") {
+		b.lines = append(b.lines, []rune(l))
+	}
+	return b
+}
+
+func (b *buffer) String() string {
+	lines := make([]string, len(b.lines))
+	for i, l := range b.lines {
+		lines[i] = string(l)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (b *buffer) LineCount() int      { return len(b.lines) }
+func (b *buffer) Line(row int) []rune { return b.lines[row] }
+func (b *buffer) Cursor() Pos         { return b.cur }
+func (b *buffer) SetCursor(p Pos)     { b.cur = p }
+
+func (b *buffer) Replace(start, end Pos, text string) {
+	head := string(b.lines[start.Row][:start.Col])
+	tail := string(b.lines[end.Row][end.Col:])
+	var lines [][]rune
+	for _, l := range strings.Split(head+text+tail, "\n") {
+		lines = append(lines, []rune(l))
+	}
+	b.lines = slices.Concat(b.lines[:start.Row], lines, b.lines[end.Row+1:])
+}
+
+func (b *buffer) Key(msg tea.KeyPressMsg) tea.Cmd {
+	if b.engine.Mode() != ModeInsert {
+		return nil
+	}
+	switch msg.String() {
+	case "enter":
+		b.insert("\n")
+	case "backspace":
+		if b.cur.Col > 0 {
+			b.Replace(Pos{b.cur.Row, b.cur.Col - 1}, b.cur, "")
+			b.cur.Col--
+		}
+	default:
+		b.insert(msg.Text)
+	}
+	return nil
+}
+
+func (b *buffer) insert(text string) {
+	b.Replace(b.cur, b.cur, text)
+	if text == "\n" {
+		b.cur = Pos{b.cur.Row + 1, 0}
+		return
+	}
+	b.cur.Col += len([]rune(text))
+}
+
+func (b *buffer) ReadOnly() bool  { return b.readOnly }
+func (b *buffer) PageHeight() int { return b.page }
+
+func (b *buffer) OpenCommandLine(prompt, text string) tea.Cmd {
+	b.prompt = prompt + text
+	return nil
+}
+
+func sendKeys(e *Engine, b *buffer, keys string) {
+	for _, k := range keys {
+		var msg tea.KeyPressMsg
+		switch k {
+		case '\x1b':
+			msg = tea.KeyPressMsg{Code: tea.KeyEscape}
+		case '\x04':
+			msg = tea.KeyPressMsg{Code: 'd', Mod: tea.ModCtrl}
+		case '\x06':
+			msg = tea.KeyPressMsg{Code: 'f', Mod: tea.ModCtrl}
+		case '\x16':
+			msg = tea.KeyPressMsg{Code: 'v', Mod: tea.ModCtrl}
+		default:
+			msg = tea.KeyPressMsg{Code: k, Text: string(k)}
+		}
+		e.HandleKey(b, msg)
+	}
+}
+
+func TestEngine(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		cursor    Pos
+		keys      string
+		readOnly  bool
+		textWidth int
+		want      string
+		wantPos   Pos
+		wantMode  Mode
+	}{
+		{name: "dw", value: "foo bar", keys: "dw", want: "bar"},
+		{name: "count", value: "a b c d", keys: "2d2w", want: "", wantPos: Pos{0, 0}},
+		{name: "huge count", value: "foo bar\nbaz", keys: "99999999999999999999dw", want: ""},
+		{name: "huge counts", value: "foo bar\nbaz", keys: "99999999999d99999999999e", want: ""},
+		{name: "huge count motion", value: "foo bar\nbaz", keys: "99999999999b99999999999e", want: "foo bar\nbaz", wantPos: Pos{1, 2}},
+		{name: "change", value: "foo bar", keys: "cwbaz\x1b", want: "baz bar", wantPos: Pos{0, 2}},
+		{name: "dd", value: "one\ntwo\nthree", cursor: Pos{1, 0}, keys: "dd", want: "one\nthree", wantPos: Pos{1, 0}},
+		{name: "repeat", value: "a b c d", keys: "dw..", want: "d"},
+		{name: "repeat with count", value: "a b c d e f g h i j", keys: "d2w3.", want: "f g h i j"},
+		{name: "repeat keeps count", value: "a b c d e f g h i j", keys: "2d2w.", want: "i j"},
+		{name: "repeat dd with count", value: "1\n2\n3\n4\n5\n6", keys: "d2d3.", want: "6"},
+		{name: "repeat insert", value: "a\nb", keys: "A!\x1bj.", want: "a!\nb!", wantPos: Pos{1, 1}},
+		{name: "x joined emoji", value: "a👨\u200d👩\u200d👧b", keys: "0lx", want: "ab", wantPos: Pos{0, 1}},
+		{name: "x combining mark", value: "e\u0301xyz", keys: "0x", want: "xyz"},
+		{name: "X joined emoji", value: "a👨\u200d👩\u200d👧b", keys: "$X", want: "ab", wantPos: Pos{0, 1}},
+		{name: "h over combining mark", value: "ae\u0301b", keys: "$hx", want: "ab", wantPos: Pos{0, 1}},
+		{name: "yank and put", value: "one\ntwo", keys: "yyjp", want: "one\ntwo\none", wantPos: Pos{2, 0}},
+		{name: "visual", value: "foo bar", keys: "vex", want: " bar"},
+		{name: "visual line", value: "one\ntwo\nthree", keys: "Vjd", want: "three"},
+		{name: "visual block", value: "abc\ndef", keys: "l\x16jd", want: "ac\ndf", wantPos: Pos{0, 1}},
+		{name: "visual stays", value: "foo bar", keys: "vw", want: "foo bar", wantPos: Pos{0, 4}, wantMode: ModeVisual},
+		{name: "read-only motion", value: "foo bar", keys: "w", readOnly: true, want: "foo bar", wantPos: Pos{0, 4}},
+		{name: "read-only delete", value: "foo bar", keys: "dwxp", readOnly: true, want: "foo bar", wantPos: Pos{0, 4}},
+		{name: "read-only insert", value: "foo", keys: "ibar", readOnly: true, want: "foo"},
+		{name: "read-only visual", value: "foo bar", keys: "vwd", readOnly: true, want: "foo bar", wantPos: Pos{0, 4}, wantMode: ModeVisual},
+		{name: "page down", value: "1\n2\n3\n4\n5\n6", keys: "\x06", want: "1\n2\n3\n4\n5\n6", wantPos: Pos{2, 0}},
+		{name: "half page down", value: "1\n2\n3\n4\n5\n6", keys: "\x04\x04", want: "1\n2\n3\n4\n5\n6", wantPos: Pos{2, 0}},
+		{name: "search", value: "foo\nbar foo", keys: "*", want: "foo\nbar foo", wantPos: Pos{1, 4}},
+		{name: "search backward", value: "foo bar foo", keys: "#", want: "foo bar foo", wantPos: Pos{0, 8}},
+		{name: "paragraph", value: "a\nb\n\nc\n\nd", keys: "}}", want: "a\nb\n\nc\n\nd", wantPos: Pos{4, 0}},
+		{name: "paragraph backward", value: "a\n\nb\nc", cursor: Pos{3, 0}, keys: "{", want: "a\n\nb\nc", wantPos: Pos{1, 0}},
+		{name: "gqq", value: "one two three", textWidth: 8, keys: "gqq", want: "one two\nthree", wantPos: Pos{1, 0}},
+		{name: "gq paragraph", value: "one\ntwo\n\nthree\nfour", keys: "gq}", want: "one two\n\nthree\nfour", wantPos: Pos{1, 0}},
+		{name: "visual gq", value: "a\nb\nc", keys: "Vjgq", want: "a b\nc"},
+		{name: "read-only gq", value: "a\nb", keys: "gqj", readOnly: true, want: "a\nb", wantPos: Pos{1, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := New()
+			b := newBuffer(e, tt.value)
+			e.TextWidth = tt.textWidth
+			b.readOnly = tt.readOnly
+			b.page = 2
+			b.cur = tt.cursor
+
+			sendKeys(e, b, tt.keys)
+
+			if got := b.String(); got != tt.want {
+				t.Errorf("value: want %q, got %q", tt.want, got)
+			}
+			if b.cur != tt.wantPos {
+				t.Errorf("cursor: want %v, got %v", tt.wantPos, b.cur)
+			}
+			if e.Mode() != tt.wantMode {
+				t.Errorf("mode: want %s, got %s", tt.wantMode, e.Mode())
+			}
+		})
+	}
+}
+
+func TestPending(t *testing.T) {
+	e := New()
+	b := newBuffer(e, "foo bar")
+
+	sendKeys(e, b, `"a2d3`)
+	if got, want := e.Pending(), `"a2d3`; got != want {
+		t.Errorf("want pending %q, got %q", want, got)
+	}
+
+	sendKeys(e, b, "w")
+	if got := e.Pending(); got != "" {
+		t.Errorf("want nothing pending, got %q", got)
+	}
+}
+
+func TestSearchCommandLine(t *testing.T) {
+	e := New()
+	b := newBuffer(e, "foo\nbar\nbaz bar")
+
+	sendKeys(e, b, "/")
+	if e.Mode() != ModeCommand || !e.Searching() || b.prompt != "/" {
+		t.Fatalf("want search command line, got mode %s and prompt %q", e.Mode(), b.prompt)
+	}
+
+	e.PreviewSearch(b, "ba")
+	if want := (Pos{1, 0}); b.cur != want {
+		t.Errorf("preview: want cursor %v, got %v", want, b.cur)
+	}
+	if got := e.SearchMatches([]rune("baz bar")); !slices.Equal(got, [][2]int{{0, 2}, {4, 6}}) {
+		t.Errorf("preview: unexpected matches %v", got)
+	}
+
+	e.ExecuteSearch(b, "baz")
+	if want := (Pos{2, 0}); b.cur != want {
+		t.Errorf("search: want cursor %v, got %v", want, b.cur)
+	}
+	if e.Mode() != ModeNormal || e.SearchPattern() != "baz" {
+		t.Errorf("search: want normal mode and pattern baz, got %s and %q", e.Mode(), e.SearchPattern())
+	}
+
+	sendKeys(e, b, "gg/")
+	e.PreviewSearch(b, "bar")
+	e.CloseCommandLine(b)
+	if want := (Pos{0, 0}); b.cur != want || e.Mode() != ModeNormal {
+		t.Errorf("cancel: want cursor %v in normal mode, got %v in %s", want, b.cur, e.Mode())
+	}
+
+	sendKeys(e, b, "3:")
+	if b.prompt != ":.,.+2" {
+		t.Errorf("want count as range, got %q", b.prompt)
+	}
+}
+
+type fakeClipboard struct {
+	text string
+	err  error
+}
+
+func (c *fakeClipboard) ReadAll() (string, error)   { return c.text, c.err }
+func (c *fakeClipboard) WriteAll(text string) error { c.text = text; return c.err }
+
+func TestRegisters(t *testing.T) {
+	e := New()
+	clip := &fakeClipboard{}
+	e.Clipboard = clip
+	b := newBuffer(e, "foo bar")
+
+	sendKeys(e, b, `"ayw"Ayw"+yy`)
+	if got := e.Register('a').Text; got != "foo foo " {
+		t.Errorf("want appended register, got %q", got)
+	}
+	if clip.text != "foo bar\n" {
+		t.Errorf("want linewise clipboard, got %q", clip.text)
+	}
+
+	clip.err = errors.New("no clipboard")
+	sendKeys(e, b, `"+yw`)
+	if e.Message() != "no clipboard" {
+		t.Errorf("want clipboard error as message, got %q", e.Message())
+	}
+}
@@ -0,0 +1,284 @@
+package vim
+
+import (
+	"slices"
+	"strings"
+)
+
+// blockInsert is an insert started by "c" in visual block mode. When insert
+// mode is left, the text typed on the first line of the block is inserted on
+// the other lines as well.
+type blockInsert struct {
+	row    int
+	col    int
+	bottom int
+}
+
+// Selection is the text selected in one of the visual modes.
+type Selection struct {
+	// Mode is the visual mode the text was selected in.
+	Mode Mode
+
+	// Start and End are the first and last selected positions, inclusive.
+	// In visual block mode, they are the top left and bottom right corners
+	// of the block.
+	Start, End Pos
+}
+
+// Contains reports whether the rune at row and col is selected. Columns past
+// the end of a line select the line break.
+func (s Selection) Contains(row, col int) bool {
+	if row < s.Start.Row || row > s.End.Row {
+		return false
+	}
+	switch s.Mode {
+	case ModeVisualLine:
+		return true
+	case ModeVisualBlock:
+		return col >= s.Start.Col && col <= s.End.Col
+	default:
+		if row == s.Start.Row && col < s.Start.Col {
+			return false
+		}
+		if row == s.End.Row && col > s.End.Col {
+			return false
+		}
+		return true
+	}
+}
+
+// Selection returns the current visual selection, if in one of the visual
+// modes.
+func (e *Engine) Selection(ed Editor) (Selection, bool) {
+	e.ed = ed
+	return e.selection()
+}
+
+// SelectedText returns the selected text in one of the visual modes. In
+// visual block mode, the lines of the block are separated by newlines. It
+// returns an empty string in other modes.
+func (e *Engine) SelectedText(ed Editor) string {
+	e.ed = ed
+	sel, ok := e.selection()
+	if !ok {
+		return ""
+	}
+	switch sel.Mode {
+	case ModeVisualLine:
+		return e.linesText(sel.Start.Row, sel.End.Row)
+	case ModeVisualBlock:
+		return strings.Join(e.blockText(sel), "\n")
+	default:
+		start, end := e.charwiseRange(sel)
+		return e.textRange(start, end)
+	}
+}
+
+// LastSelection returns the last visual selection, whose first and last lines
+// are marked by '< and '>.
+func (e *Engine) LastSelection() Selection {
+	return e.lastVisual
+}
+
+// enterVisual starts the given visual mode with the selection anchored at the
+// cursor.
+func (e *Engine) enterVisual(mode Mode) {
+	e.anchor = e.cursor()
+	e.cmd = command{}
+	e.setMode(mode)
+}
+
+// selection returns the current visual selection, if any.
+func (e *Engine) selection() (Selection, bool) {
+	if !e.mode.Visual() || e.ed == nil {
+		return Selection{}, false
+	}
+	cur := e.cursor()
+	start, end := e.anchor, cur
+	if end.Before(start) {
+		start, end = end, start
+	}
+	if e.mode == ModeVisualBlock {
+		start.Col = min(e.anchor.Col, cur.Col)
+		end.Col = max(e.anchor.Col, cur.Col)
+	}
+	return Selection{Mode: e.mode, Start: start, End: end}, true
+}
+
+// charwiseRange returns the range of a characterwise selection with an
+// exclusive end. A selection that ends past the last character of a line
+// includes the line break.
+func (e *Engine) charwiseRange(sel Selection) (Pos, Pos) {
+	end := sel.End
+	if end.Col < len(e.line(end.Row)) {
+		end.Col++
+	} else if end.Row < e.lineCount()-1 {
+		end = Pos{end.Row + 1, 0}
+	}
+	return sel.Start, end
+}
+
+// blockText returns the selected part of each line of a block selection.
+func (e *Engine) blockText(sel Selection) []string {
+	lines := make([]string, 0, sel.End.Row-sel.Start.Row+1)
+	for row := sel.Start.Row; row <= sel.End.Row; row++ {
+		line := e.line(row)
+		from, to := blockColumns(line, sel)
+		lines = append(lines, string(line[from:to]))
+	}
+	return lines
+}
+
+// blockColumns returns the part of line covered by a block selection.
+func blockColumns(line []rune, sel Selection) (int, int) {
+	from := min(sel.Start.Col, len(line))
+	to := min(sel.End.Col+1, len(line))
+	return from, to
+}
+
+// visualCommand runs a command specific to the visual modes. It returns false
+// if k should be handled as a motion instead.
+func (e *Engine) visualCommand(k string, count int) bool {
+	var mode Mode
+	switch k {
+	case "v":
+		mode = ModeVisual
+	case "V":
+		mode = ModeVisualLine
+	case "ctrl+v":
+		mode = ModeVisualBlock
+	case "o":
+		anchor := e.anchor
+		e.anchor = e.cursor()
+		e.setCursor(anchor)
+		e.cmd = command{}
+		return true
+	case "d", "x", "y", "c", "s", ">", "<", "~", "u", "U":
+		if k != "y" && e.readOnly() {
+			e.cmd = command{}
+			return true
+		}
+		e.visualOperator(k, count)
+		return true
+	case "p", "P":
+		if e.readOnly() {
+			e.cmd = command{}
+			return true
+		}
+		e.visualPut(max(count, 1))
+		return true
+	default:
+		return false
+	}
+
+	// Typing the key of the current visual mode leaves it, while the key of
+	// another visual mode switches to it.
+	e.cmd = command{}
+	if mode == e.mode {
+		e.SetNormalMode(e.ed)
+	} else {
+		e.setMode(mode)
+	}
+	return true
+}
+
+// visualOperator applies an operator to the visual selection and leaves
+// visual mode.
+func (e *Engine) visualOperator(op string, count int) {
+	sel, _ := e.selection()
+	switch op {
+	case "x":
+		op = "d"
+	case "s":
+		op = "c"
+	case "~", "u", "U":
+		op = "g" + op
+	}
+	n := max(count, 1)
+
+	e.setMode(ModeNormal)
+	switch {
+	case op == "gq":
+		// Formatting works on whole lines in every visual mode.
+		e.applyLinewise(op, sel.Start.Row, sel.End.Row)
+	case sel.Mode == ModeVisualBlock:
+		e.applyBlock(op, sel, n)
+	case op == ">" || op == "<":
+		// A count shifts the lines that many times.
+		for range n {
+			e.applyLinewise(op, sel.Start.Row, sel.End.Row)
+		}
+	case sel.Mode == ModeVisualLine:
+		e.applyLinewise(op, sel.Start.Row, sel.End.Row)
+	default:
+		start, end := e.charwiseRange(sel)
+		e.applyOperator(op, start, end, exclusive)
+	}
+	e.finishCommand(0, op != "y")
+}
+
+// applyBlock applies an operator to a visual block.
+func (e *Engine) applyBlock(op string, sel Selection, count int) {
+	top, bottom, left := sel.Start.Row, sel.End.Row, sel.Start.Col
+
+	switch op {
+	case "d", "c":
+		e.writeRegister(Register{Text: strings.Join(e.blockText(sel), "\n"), Blockwise: true}, false)
+		for row := top; row <= bottom; row++ {
+			line := e.line(row)
+			from, to := blockColumns(line, sel)
+			e.setLine(row, slices.Concat(line[:from], line[to:]))
+		}
+		e.setCursor(Pos{top, left})
+		if op == "c" {
+			e.blockInsert = &blockInsert{row: top, col: e.cursor().Col, bottom: bottom}
+			e.setMode(ModeInsert)
+		}
+	case "y":
+		e.writeRegister(Register{Text: strings.Join(e.blockText(sel), "\n"), Blockwise: true}, true)
+		e.setCursor(Pos{top, left})
+	case ">", "<":
+		for row := top; row <= bottom; row++ {
+			line := e.line(row)
+			if len(line) <= left {
+				continue
+			}
+			shifted := line[left:]
+			for range count {
+				shifted = shiftLine(shifted, e.ShiftWidth, op == ">")
+			}
+			e.setLine(row, slices.Concat(line[:left], shifted))
+		}
+		e.setCursor(Pos{top, left})
+	case "g~", "gu", "gU":
+		fn := caseFunc(op)
+		for row := top; row <= bottom; row++ {
+			line := slices.Clone(e.line(row))
+			from, to := blockColumns(line, sel)
+			for i := from; i < to; i++ {
+				line[i] = fn(line[i])
+			}
+			e.setLine(row, line)
+		}
+		e.setCursor(Pos{top, left})
+	}
+}
+
+// finishBlockInsert copies the text typed after "c" in visual block mode to
+// the other lines of the block.
+func (e *Engine) finishBlockInsert() {
+	bi := e.blockInsert
+	e.blockInsert = nil
+	p := e.cursor()
+	if bi == nil || p.Row != bi.row || p.Col <= bi.col {
+		return
+	}
+	text := slices.Clone(e.line(bi.row)[bi.col:p.Col])
+	for row := bi.row + 1; row <= bi.bottom && row < e.lineCount(); row++ {
+		line := e.line(row)
+		if len(line) < bi.col {
+			continue
+		}
+		e.setLine(row, slices.Insert(slices.Clone(line), bi.col, text...))
+	}
+}